@@ -0,0 +1,440 @@
+package json
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// EncodeAppend appends the JSON encoding of value, with the default options,
+// to dst and returns the extended slice. Unlike Encode, it writes directly
+// into dst without building intermediate values, so that reusing dst makes
+// encoding allocate little.
+func EncodeAppend(dst []byte, value lua.LValue) ([]byte, error) {
+	return encodeAppend(dst, value, &EncodeOptions{})
+}
+
+// appendable reports whether values can be encoded with opts by the
+// appending encoder, which does not track paths and leaves out the options
+// that need them.
+func appendable(opts *EncodeOptions) bool {
+	return !opts.WarnUnsafeInts && opts.MaxDepth <= 0 && opts.MaxArrayElems <= 0 &&
+		opts.MaxObjectMembers <= 0 && opts.MemoryBudget <= 0 && len(opts.Enums) == 0 &&
+		len(opts.Overrides) == 0 && opts.TableKeys == TableKeysError && opts.Cycles == CyclesError &&
+		opts.FieldSampler == nil && len(opts.Classes) == 0
+}
+
+// appendEncoder writes the encoding of values into buf.
+type appendEncoder struct {
+	buf  []byte
+	opts *EncodeOptions
+
+	// visited holds the tables already encoded, as in encodeState, and
+	// converting the userdata whose metamethod results are being encoded.
+	visited    map[*lua.LTable]bool
+	converting map[*lua.LUserData]bool
+
+	// keys is the scratch space for the sorted keys of the objects being
+	// encoded, each object using the keys after those of its parent.
+	keys []string
+
+	// w, when non-nil, receives the contents of buf whenever it grows past
+	// flushSize, so that the whole encoding is never held in memory.
+	w io.Writer
+
+	// timer enforces the Timeout option.
+	timer *encodeTimer
+}
+
+// maxPooledSize is the capacity of the largest buffer kept in the pool, so
+// that encoding one large document does not pin its memory.
+const maxPooledSize = 64 << 10
+
+var encoderPool = sync.Pool{
+	New: func() interface{} {
+		return &appendEncoder{visited: make(map[*lua.LTable]bool)}
+	},
+}
+
+// encodeAppend appends the encoding of value to dst. opts must be
+// appendable.
+func encodeAppend(dst []byte, value lua.LValue, opts *EncodeOptions) ([]byte, error) {
+	e := encoderPool.Get().(*appendEncoder)
+	e.buf, e.opts, e.timer = dst, opts, newEncodeTimer(opts)
+	err := e.value(value)
+	data := e.buf
+	e.release()
+	if err != nil {
+		return dst, err
+	}
+	if opts.rewritesEscapes() {
+		data = append(data[:len(dst)], rewriteEscapes(data[len(dst):], opts)...)
+	}
+	if opts.Indent != "" || opts.Prefix != "" {
+		return append(dst, indentJSON(data[len(dst):], opts.Prefix, opts.Indent)...), nil
+	}
+	return data, nil
+}
+
+// encodePooled returns the encoding of value with opts in a pooled buffer,
+// which must be handed back to putBuffer once its contents have been copied.
+func encodePooled(value lua.LValue, opts *EncodeOptions) ([]byte, error) {
+	if !appendable(opts) {
+		return EncodeWithOptions(value, opts)
+	}
+	buf := bufferPool.Get().(*[]byte)
+	data, err := encodeAppend((*buf)[:0], value, opts)
+	if err != nil {
+		putBuffer(data)
+	}
+	return data, err
+}
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 1024)
+		return &b
+	},
+}
+
+func putBuffer(b []byte) {
+	if cap(b) <= maxPooledSize {
+		b = b[:0]
+		bufferPool.Put(&b)
+	}
+}
+
+func (e *appendEncoder) release() {
+	for t := range e.visited {
+		delete(e.visited, t)
+	}
+	e.buf, e.opts, e.converting, e.keys, e.w, e.timer = nil, nil, nil, e.keys[:0], nil, nil
+	encoderPool.Put(e)
+}
+
+func (e *appendEncoder) value(value lua.LValue) error {
+	if err := e.timer.tick(); err != nil {
+		return err
+	}
+	// No offsets into buf are kept across values, so it can be flushed here.
+	if e.w != nil && len(e.buf) >= flushSize {
+		if _, err := e.w.Write(e.buf); err != nil {
+			return err
+		}
+		e.buf = e.buf[:0]
+	}
+	switch v := value.(type) {
+	case lua.LBool:
+		e.buf = strconv.AppendBool(e.buf, bool(v))
+	case lua.LNumber:
+		if data, ok := appendInteger(e.buf, v); ok {
+			e.buf = data
+			return nil
+		}
+		if data, ok := quoteBigInt(v, e.opts.BigInts); ok {
+			e.buf = append(e.buf, data...)
+			return nil
+		}
+		return e.number(float64(v))
+	case *lua.LNilType:
+		e.buf = append(e.buf, "null"...)
+	case lua.LString:
+		return e.string(string(v))
+	case *lua.LTable:
+		return e.table(v)
+	case *lua.LUserData:
+		return e.userData(v)
+	default:
+		return invalidTypeError(value.Type())
+	}
+	return nil
+}
+
+// number appends f as formatNumber formats it, without allocating.
+func (e *appendEncoder) number(f float64) error {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		_, err := json.Marshal(f)
+		return err
+	}
+	if e.opts.FloatFormat != "" {
+		e.buf, _ = appendFloat(e.buf, f, e.opts.FloatFormat)
+		return nil
+	}
+	switch e.opts.FloatCompat {
+	case FloatJS:
+		if f == 0 {
+			f = 0
+		}
+	case FloatPython:
+		e.buf = append(e.buf, formatPython(f)...)
+		return nil
+	}
+	// This is the formatting of encoding/json.
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	e.buf = strconv.AppendFloat(e.buf, f, format, -1, 64)
+	if format == 'e' {
+		// Clean up e-09 to e-9.
+		if n := len(e.buf); n >= 4 && e.buf[n-4] == 'e' && e.buf[n-3] == '-' && e.buf[n-2] == '0' {
+			e.buf[n-2] = e.buf[n-1]
+			e.buf = e.buf[:n-1]
+		}
+	}
+	return nil
+}
+
+// string appends s as marshalString encodes it. Strings that need no
+// escaping are copied without going through encoding/json.
+func (e *appendEncoder) string(s string) error {
+	if len(e.opts.ExtraEscapes) == 0 && !needsEscape(s) {
+		e.buf = append(e.buf, '"')
+		e.buf = append(e.buf, s...)
+		e.buf = append(e.buf, '"')
+		return nil
+	}
+	data, err := marshalString(s, e.opts.ExtraEscapes)
+	e.buf = append(e.buf, data...)
+	return err
+}
+
+// needsEscape reports whether encoding/json escapes any byte of s, which it
+// does for control characters, quotes, backslashes, HTML characters and all
+// non-ASCII runes it checks for validity.
+func needsEscape(s string) bool {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c < 0x20, c >= 0x80, c == '"', c == '\\', c == '<', c == '>', c == '&':
+			return true
+		}
+	}
+	return false
+}
+
+// table appends the encoding of t, with the checks of jsonValue in the same
+// order so that invalid tables fail with the same error.
+func (e *appendEncoder) table(t *lua.LTable) error {
+	if e.visited[t] {
+		return errNested
+	}
+	e.visited[t] = true
+
+	if n, field, ok := explicitLen(t, e.opts.PackedArrays); ok {
+		for key, _ := t.Next(lua.LNil); key != lua.LNil; key, _ = t.Next(key) {
+			if field && key == lua.LString("n") {
+				continue
+			}
+			if k, ok := key.(lua.LNumber); !ok || k < 1 || k > lua.LNumber(n) || k != lua.LNumber(int(k)) {
+				return invalidKey(key)
+			}
+		}
+		e.buf = append(e.buf, '[')
+		for i := 1; i <= n; i++ {
+			if i > 1 {
+				e.buf = append(e.buf, ',')
+			}
+			if err := e.value(t.RawGetInt(i)); err != nil {
+				return err
+			}
+		}
+		e.buf = append(e.buf, ']')
+		return nil
+	}
+
+	first, _ := t.Next(lua.LNil)
+	switch first.Type() {
+	case lua.LTNil:
+		if isEmptyObject(t) {
+			e.buf = append(e.buf, "{}"...)
+		} else {
+			e.buf = append(e.buf, "[]"...)
+		}
+		return nil
+	case lua.LTNumber:
+		expected := lua.LNumber(1)
+		for key := first; key != lua.LNil; key, _ = t.Next(key) {
+			if key.Type() != lua.LTNumber {
+				return invalidKey(key)
+			}
+			if key != expected {
+				if e.opts.SparseArrays != SparseError {
+					return e.sparse(t)
+				}
+				return errSparseArray
+			}
+			expected++
+		}
+		e.buf = append(e.buf, '[')
+		for i := 1; i < int(expected); i++ {
+			if i > 1 {
+				e.buf = append(e.buf, ',')
+			}
+			if err := e.value(t.RawGetInt(i)); err != nil {
+				return err
+			}
+		}
+		e.buf = append(e.buf, ']')
+		return nil
+	case lua.LTString:
+		start := len(e.keys)
+		for key := first; key != lua.LNil; key, _ = t.Next(key) {
+			k, ok := key.(lua.LString)
+			if !ok {
+				e.keys = e.keys[:start]
+				return invalidKey(key)
+			}
+			e.keys = append(e.keys, string(k))
+		}
+		sortMembers(t, e.keys[start:], e.opts.SortKeys)
+		end := len(e.keys)
+		err := e.object(start, end, func(key string) lua.LValue {
+			return t.RawGetString(key)
+		})
+		e.keys = e.keys[:start]
+		return err
+	}
+	return invalidKey(first)
+}
+
+// object appends an object whose sorted keys are e.keys[start:end], getting
+// the values with get.
+func (e *appendEncoder) object(start, end int, get func(string) lua.LValue) error {
+	e.buf = append(e.buf, '{')
+	for i := start; i < end; i++ {
+		if i > start {
+			e.buf = append(e.buf, ',')
+		}
+		// Keys are escaped by encoding/json, without the ExtraEscapes.
+		key := e.keys[i]
+		if needsEscape(key) {
+			data, _ := json.Marshal(key)
+			e.buf = append(e.buf, data...)
+		} else {
+			e.buf = append(e.buf, '"')
+			e.buf = append(e.buf, key...)
+			e.buf = append(e.buf, '"')
+		}
+		e.buf = append(e.buf, ':')
+		if err := e.value(get(key)); err != nil {
+			return err
+		}
+	}
+	e.buf = append(e.buf, '}')
+	return nil
+}
+
+// opaque appends the JSON text data as encoding/json copies the output of
+// Marshalers: compacted, with the HTML characters in strings escaped.
+func (e *appendEncoder) opaque(data []byte) {
+	start := len(e.buf)
+	b := bytes.NewBuffer(e.buf)
+	// data is valid, having been checked by decodeOpaque.
+	json.Compact(b, data)
+	e.buf = b.Bytes()
+	if compacted := e.buf[start:]; bytes.ContainsAny(compacted, "<>&\u2028\u2029") {
+		var escaped bytes.Buffer
+		json.HTMLEscape(&escaped, compacted)
+		e.buf = append(e.buf[:start], escaped.Bytes()...)
+	}
+}
+
+func (e *appendEncoder) userData(ud *lua.LUserData) error {
+	switch v := ud.Value.(type) {
+	case *Object:
+		start := len(e.keys)
+		e.keys = append(e.keys, v.keys...)
+		sort.Strings(e.keys[start:])
+		err := e.object(start, len(e.keys), func(key string) lua.LValue {
+			value, _ := v.Get(key)
+			return value
+		})
+		e.keys = e.keys[:start]
+		return err
+	case *Array:
+		e.buf = append(e.buf, '[')
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				e.buf = append(e.buf, ',')
+			}
+			if err := e.value(v.Get(i)); err != nil {
+				return err
+			}
+		}
+		e.buf = append(e.buf, ']')
+		return nil
+	case *Opaque:
+		if e.opts.SortKeys {
+			data, err := sortKeys(v.data)
+			if err != nil {
+				return err
+			}
+			e.buf = append(e.buf, data...)
+			return nil
+		}
+		e.opaque(v.data)
+		return nil
+	case Int64:
+		if data, ok := quoteBigInt(ud, e.opts.BigInts); ok {
+			e.buf = append(e.buf, data...)
+			return nil
+		}
+		e.buf = strconv.AppendInt(e.buf, int64(v), 10)
+		return nil
+	}
+	if ud == Null {
+		e.buf = append(e.buf, "null"...)
+		return nil
+	}
+	if data, ok, err := encodeRegistered(ud); ok {
+		if err == nil && e.opts.SortKeys {
+			data, err = sortKeys(data)
+		}
+		if err != nil {
+			return err
+		}
+		e.opaque(data)
+		return nil
+	}
+	if L := e.opts.State; L != nil {
+		if value, ok, err := userDataValue(L, ud); ok {
+			if err != nil {
+				return err
+			}
+			if e.converting[ud] {
+				return errNested
+			}
+			if e.converting == nil {
+				e.converting = make(map[*lua.LUserData]bool)
+			}
+			e.converting[ud] = true
+			defer delete(e.converting, ud)
+			return e.value(value)
+		}
+	}
+	if !e.opts.ReflectUserData || ud.Value == nil {
+		return invalidTypeError(lua.LTUserData)
+	}
+	var data []byte
+	var err error
+	if mapper := e.opts.FieldNameMapper; mapper != nil {
+		data, err = json.Marshal(mapFields(reflect.ValueOf(ud.Value), mapper))
+	} else {
+		data, err = json.Marshal(ud.Value)
+	}
+	if err == nil && e.opts.SortKeys {
+		data, err = sortKeys(data)
+	}
+	if err != nil {
+		return unwrapMarshalerError(err)
+	}
+	e.buf = append(e.buf, data...)
+	return nil
+}
@@ -0,0 +1,141 @@
+package json
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestEncodeAppendMatchesMarshal(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	Preload(L)
+	if err := L.DoString(`
+	local json = require("json")
+	local nested = {}
+	nested.self = nested
+	local shared = {1}
+	values = {
+		{1, 2.5, -0.0, 1e21, 1e-7, 123456789012, true, false, "x"},
+		{a = {b = {c = "<&>"}}, ["k\n"] = "é", ["\226\128\168"] = "\255"},
+		{},
+		{n = 3, [2] = "two"},
+		{n = 2},
+		"plain",
+		{[1] = 1, [3] = 3},
+		{1, x = 2},
+		{x = 2, [1] = 1},
+		{f = print},
+		{print, x = 1},
+		nested,
+		{shared, shared},
+		{a = {json.null, json.object()}},
+		0 / 0,
+		{1, 1 / 0},
+	}
+	`); err != nil {
+		t.Fatal(err)
+	}
+	values := L.GetGlobal("values").(*lua.LTable)
+	compats := []FloatCompat{FloatGo, FloatJS, FloatPython}
+	for i := 1; i <= values.Len(); i++ {
+		v := values.RawGetInt(i)
+		for _, opts := range []EncodeOptions{{}, {ExtraEscapes: []rune{'é'}}, {FloatCompat: compats[i%3]}, {Indent: "  "}, {PackedArrays: true}} {
+			want, wantErr := marshalValue(v, &opts)
+			got, gotErr := encodeAppend(nil, v, &opts)
+			if (wantErr == nil) != (gotErr == nil) || (wantErr != nil && wantErr.Error() != gotErr.Error()) {
+				t.Errorf("value %d: expecting error %v, got %v", i, wantErr, gotErr)
+			} else if !bytes.Equal(got, want) {
+				t.Errorf("value %d: expecting %s, got %s", i, want, got)
+			}
+		}
+	}
+}
+
+func TestEncodeAppend(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	tbl := L.NewTable()
+	tbl.RawSetString("a", lua.LNumber(1))
+	dst := []byte("x=")
+	dst, err := EncodeAppend(dst, tbl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(dst) != `x={"a":1}` {
+		t.Fatalf("unexpected result %s", dst)
+	}
+	if _, err := EncodeAppend(dst, lua.LNumber(math.NaN())); err == nil {
+		t.Fatal("expecting an error for NaN")
+	}
+	allocs := testing.AllocsPerRun(10, func() {
+		dst, _ = EncodeAppend(dst[:0], tbl)
+	})
+	if allocs > 1 {
+		t.Errorf("expecting at most 1 allocation, got %v", allocs)
+	}
+}
+
+func TestEncodeToBuffer(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local buf = json.encode_to_buffer({1, 2})
+	assert(buf:tostring() == "[1,2]")
+	assert(json.encode_to_buffer("\n", buf) == buf)
+	assert(buf:tostring() == '[1,2]"\\n"')
+	local _, err = json.encode_to_buffer(print, buf)
+	assert(err == "cannot encode function to JSON", err)
+	assert(#buf == 9)
+	buf:reset()
+	assert(#json.encode_to_buffer({a = {}}, buf, {indent = " "}) == 12)
+	assert(tostring(buf) == '{\n "a": []\n}')
+	buf:reset()
+	json.encode_to_buffer({1, 2, 3}, buf, {max_array_elems = 2, truncate = true})
+	assert(tostring(buf) == '[1,2,{"$truncated":1}]', tostring(buf))
+	assert(not pcall(json.encode_to_buffer, 1, {}))
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
+
+func BenchmarkEncodeAppend(b *testing.B) {
+	L := lua.NewState()
+	defer L.Close()
+
+	value, err := Decode(L, benchmarkDocument)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	var dst []byte
+	for i := 0; i < b.N; i++ {
+		if dst, err = EncodeAppend(dst[:0], value); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncodeMarshal(b *testing.B) {
+	L := lua.NewState()
+	defer L.Close()
+
+	value, err := Decode(L, benchmarkDocument)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := marshalValue(value, &EncodeOptions{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
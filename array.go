@@ -0,0 +1,181 @@
+package json
+
+import (
+	"github.com/yuin/gopher-lua"
+)
+
+const arrayTypeName = "json.chunked_array"
+
+// arrayChunkSize is the number of elements in each chunk of an Array.
+const arrayChunkSize = 4096
+
+// Array is a decoded JSON array held in Go in chunks of a fixed size, as
+// returned to Lua as userdata for the arrays longer than the ArrayThreshold
+// option. Scripts read and write its elements by indexing the userdata, as
+// they would a table, from 1. Unlike a table holding a million values, it is
+// a single object to the Lua garbage collector, and growing it never copies
+// the elements already stored.
+type Array struct {
+	chunks [][]lua.LValue
+	n      int
+
+	// frozen makes scripts fail to set elements, for cached documents.
+	frozen bool
+}
+
+// Len returns the number of elements.
+func (a *Array) Len() int {
+	return a.n
+}
+
+// Get returns the element at index i, counting from 0, or nil when i is out
+// of range.
+func (a *Array) Get(i int) lua.LValue {
+	if i < 0 || i >= a.n {
+		return lua.LNil
+	}
+	return a.chunks[i/arrayChunkSize][i%arrayChunkSize]
+}
+
+// Set replaces the element at index i, counting from 0, or appends value
+// when i is the length of the array. It reports whether i was in range.
+func (a *Array) Set(i int, value lua.LValue) bool {
+	if i < 0 || i > a.n {
+		return false
+	}
+	if i == a.n {
+		a.Append(value)
+	} else {
+		a.chunks[i/arrayChunkSize][i%arrayChunkSize] = value
+	}
+	return true
+}
+
+// Append adds value after the last element.
+func (a *Array) Append(value lua.LValue) {
+	if a.n%arrayChunkSize == 0 {
+		a.chunks = append(a.chunks, make([]lua.LValue, 0, arrayChunkSize))
+	}
+	last := len(a.chunks) - 1
+	a.chunks[last] = append(a.chunks[last], value)
+	a.n++
+}
+
+// pop removes the last element.
+func (a *Array) pop() {
+	last := len(a.chunks) - 1
+	chunk := a.chunks[last]
+	chunk[len(chunk)-1] = nil
+	if a.chunks[last] = chunk[:len(chunk)-1]; len(a.chunks[last]) == 0 {
+		a.chunks = a.chunks[:last]
+	}
+	a.n--
+}
+
+func registerArray(L *lua.LState) *lua.LTable {
+	mt := L.NewTypeMetatable(arrayTypeName)
+	mt.RawSetString("__index", L.NewFunction(arrayElemIndex))
+	mt.RawSetString("__newindex", L.NewFunction(arrayNewIndex))
+	mt.RawSetString("__len", L.NewFunction(arrayLen))
+	return mt
+}
+
+// arrayMetatable returns the metatable of Array userdata, registering it when
+// the module has not been loaded, as when hosts decode directly.
+func arrayMetatable(L *lua.LState) lua.LValue {
+	if mt := L.GetTypeMetatable(arrayTypeName); mt != lua.LNil {
+		return mt
+	}
+	return registerArray(L)
+}
+
+// toArray moves the elements of the table arr, which has outgrown the
+// ArrayThreshold option, to Array userdata.
+func (d *decoder) toArray(arr *lua.LTable) *lua.LUserData {
+	a := &Array{}
+	n := arr.Len()
+	for i := 1; i <= n; i++ {
+		a.Append(arr.RawGetInt(i))
+	}
+	return &lua.LUserData{Value: a, Env: d.L.Env, Metatable: arrayMetatable(d.L)}
+}
+
+func checkArray(L *lua.LState, n int) *Array {
+	ud := L.CheckUserData(n)
+	a, ok := ud.Value.(*Array)
+	if !ok {
+		L.ArgError(n, "json array expected")
+	}
+	return a
+}
+
+var arrayMethods = map[string]lua.LGFunction{
+	"get":     arrayGet,
+	"len":     arrayLen,
+	"ipairs":  arrayIpairs,
+	"totable": arrayToTable,
+}
+
+// arrayElemIndex returns the element at a numeric index or the method with the
+// given name.
+func arrayElemIndex(L *lua.LState) int {
+	a := checkArray(L, 1)
+	switch key := L.Get(2).(type) {
+	case lua.LNumber:
+		L.Push(a.Get(int(key) - 1))
+		return 1
+	case lua.LString:
+		if fn, ok := arrayMethods[string(key)]; ok {
+			L.Push(L.NewFunction(fn))
+			return 1
+		}
+	}
+	L.Push(lua.LNil)
+	return 1
+}
+
+func arrayNewIndex(L *lua.LState) int {
+	a := checkArray(L, 1)
+	if a.frozen {
+		L.RaiseError("cannot modify a cached JSON document")
+	}
+	if !a.Set(L.CheckInt(2)-1, L.Get(3)) {
+		L.ArgError(2, "index out of range")
+	}
+	return 0
+}
+
+func arrayGet(L *lua.LState) int {
+	L.Push(checkArray(L, 1).Get(L.CheckInt(2) - 1))
+	return 1
+}
+
+func arrayLen(L *lua.LState) int {
+	L.Push(lua.LNumber(checkArray(L, 1).Len()))
+	return 1
+}
+
+// arrayIpairs returns an iterator yielding the index and the value of each
+// element, including those that are nil.
+func arrayIpairs(L *lua.LState) int {
+	a := checkArray(L, 1)
+	i := 0
+	L.Push(L.NewFunction(func(L *lua.LState) int {
+		if i >= a.Len() {
+			return 0
+		}
+		i++
+		L.Push(lua.LNumber(i))
+		L.Push(a.Get(i - 1))
+		return 2
+	}))
+	return 1
+}
+
+// arrayToTable converts an array, and all objects and arrays nested in it,
+// to tables.
+func arrayToTable(L *lua.LState) int {
+	checkArray(L, 1)
+	L.Push(materialize(L, L.Get(1), make(map[lua.LValue]lua.LValue)))
+	return 1
+}
@@ -0,0 +1,77 @@
+package json
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestArrayThreshold(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local small = json.decode(doc, {array_threshold = 10000})
+	assert(type(small) == "table" and #small == 10000)
+
+	local arr = json.decode(doc, {array_threshold = 100})
+	assert(type(arr) == "userdata" and #arr == 10000 and arr:len() == 10000)
+	assert(arr[1] == 0 and arr[4097] == 4096 and arr:get(10000) == 9999)
+	assert(arr[0] == nil and arr[10001] == nil)
+
+	local sum = 0
+	for i, v in arr:ipairs() do
+		assert(v == i - 1)
+		sum = sum + v
+	end
+	assert(sum == 49995000)
+
+	arr[1] = "first"
+	arr[#arr + 1] = true
+	assert(arr[1] == "first" and #arr == 10001)
+	assert(not pcall(function() arr[10003] = 1 end))
+
+	local t = arr:totable()
+	assert(type(t) == "table" and #t == 10001 and t[10001] == true)
+	assert(json.encode(arr) == json.encode(t))
+	assert(json.encode(arr, {max_depth = 3}) == json.encode(t))
+
+	local nested = json.decode('{"a":[1,null,{"b":[1,2,3]}]}', {array_threshold = 2, keep_nulls = true})
+	assert(type(nested.a) == "userdata" and nested.a[2] == json.null and nested.a[3].b[3] == 3)
+	assert(json.encode(nested) == '{"a":[1,null,{"b":[1,2,3]}]}')
+	assert(json.hash(nested) == json.hash(json.decode('{"a":[1,null,{"b":[1,2,3]}]}', {keep_nulls = true})))
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	elems := make([]string, 10000)
+	for i := range elems {
+		elems[i] = strconv.Itoa(i)
+	}
+	s.SetGlobal("doc", lua.LString("["+strings.Join(elems, ",")+"]"))
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestArrayThresholdTokens(t *testing.T) {
+	s := lua.NewState()
+	defer s.Close()
+
+	opts := &DecodeOptions{ArrayThreshold: 1, FastPathThreshold: -1}
+	value, err := DecodeWithOptions(s, []byte(`[[1],[2,3]]`), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, ok := value.(*lua.LUserData).Value.(*Array)
+	if !ok || a.Len() != 2 {
+		t.Fatalf("expecting an Array of 2 elements, got %v", value)
+	}
+	if _, ok := a.Get(0).(*lua.LTable); !ok {
+		t.Errorf("expecting arrays within the threshold to be tables, got %v", a.Get(0))
+	}
+	if data, err := Encode(value); err != nil || string(data) != `[[1],[2,3]]` {
+		t.Errorf("got %s, %v", data, err)
+	}
+}
@@ -0,0 +1,206 @@
+// Package bench provides corpora of representative JSON documents and
+// benchmark helpers for the json module, so that changes affecting its
+// performance, and upgrades of gopher-lua, can be evaluated with
+//
+//	go test ./bench -run XXX -bench . -benchmem
+//
+// and compared with benchstat. Hosts can run the same helpers on corpora of
+// their own documents. The tests of the package also check the allocations
+// made for each corpus against a budget, failing on regressions.
+package bench
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+
+	luajson "github.com/dstgo/gopher-json"
+	"github.com/yuin/gopher-lua"
+)
+
+// Corpus is a named set of JSON documents.
+type Corpus struct {
+	Name string
+	// Data holds a single document or, when Lines is set, one document per
+	// line.
+	Data  []byte
+	Lines bool
+}
+
+// Documents returns the documents of c.
+func (c Corpus) Documents() [][]byte {
+	if !c.Lines {
+		return [][]byte{c.Data}
+	}
+	var docs [][]byte
+	s := luajson.SplitDocuments(bytes.NewReader(c.Data))
+	for s.Next() {
+		docs = append(docs, append([]byte(nil), s.Bytes()...))
+	}
+	return docs
+}
+
+// Corpora returns the standard corpora: small API messages, a deeply nested
+// configuration, a wide array of records and a JSON Lines log.
+func Corpora() []Corpus {
+	return []Corpus{
+		{Name: "small", Data: smallMessage(0)},
+		{Name: "deep", Data: deepConfig(24)},
+		{Name: "wide", Data: wideArray(2000)},
+		{Name: "ndjson", Data: logLines(500), Lines: true},
+	}
+}
+
+func smallMessage(i int) []byte {
+	id := strconv.Itoa(10000 + i)
+	return []byte(`{"id":` + id + `,"type":"message","user":{"id":42,"name":"gopher","verified":true},` +
+		`"text":"Hello, \"world\" é\n","tags":["lua","json"],"score":98.6,"reply_to":null}`)
+}
+
+func deepConfig(depth int) []byte {
+	var b strings.Builder
+	for i := 0; i < depth; i++ {
+		n := strconv.Itoa(i)
+		b.WriteString(`{"name":"level` + n + `","enabled":true,"weight":` + n + `.5,"labels":["a","b"],"child":`)
+	}
+	b.WriteString(`{"leaf":true}`)
+	b.WriteString(strings.Repeat("}", depth))
+	return []byte(b.String())
+}
+
+func wideArray(n int) []byte {
+	var b strings.Builder
+	b.WriteByte('[')
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		s := strconv.Itoa(i)
+		b.WriteString(`{"id":` + s + `,"sku":"item-` + s + `","price":` + s + `.99,"stock":` + strconv.Itoa(i%17) + `,"active":` + strconv.FormatBool(i%3 != 0) + `}`)
+	}
+	b.WriteByte(']')
+	return []byte(b.String())
+}
+
+func logLines(n int) []byte {
+	var b bytes.Buffer
+	for i := 0; i < n; i++ {
+		b.WriteString(`{"ts":"2024-01-02T15:04:05.` + strconv.Itoa(100+i%900) + `Z","level":"info","msg":"request done",` +
+			`"status":200,"duration_ms":` + strconv.Itoa(i%250) + `,"path":"/api/v1/items/` + strconv.Itoa(i) + `"}`)
+		b.WriteByte('\n')
+	}
+	return b.Bytes()
+}
+
+// Decode benchmarks decoding the documents of c with opts, which may be nil.
+func Decode(b *testing.B, c Corpus, opts *luajson.DecodeOptions) {
+	if opts == nil {
+		opts = &luajson.DecodeOptions{}
+	}
+	L := lua.NewState()
+	defer L.Close()
+
+	docs := c.Documents()
+	b.ReportAllocs()
+	b.SetBytes(int64(len(c.Data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, doc := range docs {
+			if _, err := luajson.DecodeWithOptions(L, doc, opts); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// Encode benchmarks encoding the decoded documents of c with opts, which may
+// be nil.
+func Encode(b *testing.B, c Corpus, opts *luajson.EncodeOptions) {
+	if opts == nil {
+		opts = &luajson.EncodeOptions{}
+	}
+	L := lua.NewState()
+	defer L.Close()
+
+	values := decodeAll(b, L, c)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(c.Data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, value := range values {
+			if _, err := luajson.EncodeWithOptions(value, opts); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// Script benchmarks running fn, a Lua function taking the json module and
+// the documents of c as a string, or an array of strings when c.Lines is
+// set, in a state where the module was loaded with opts. For instance
+//
+//	function(json, s) json.encode(json.decode(s)) end
+//
+// measures a round trip through the Lua API.
+func Script(b *testing.B, c Corpus, fn string, opts ...luajson.Option) {
+	L := lua.NewState()
+	defer L.Close()
+
+	luajson.Preload(L, opts...)
+	if err := L.DoString(`return require("json"), ` + fn); err != nil {
+		b.Fatal(err)
+	}
+	module, f := L.Get(-2), L.Get(-1)
+	L.Pop(2)
+	var arg lua.LValue = lua.LString(c.Data)
+	if c.Lines {
+		t := L.NewTable()
+		for _, doc := range c.Documents() {
+			t.Append(lua.LString(doc))
+		}
+		arg = t
+	}
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(c.Data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := L.CallByParam(lua.P{Fn: f, Protect: true}, module, arg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Allocs returns the average number of allocations made to decode, then
+// encode, the documents of c with the default options.
+func Allocs(c Corpus) (decode, encode float64) {
+	L := lua.NewState()
+	defer L.Close()
+
+	docs := c.Documents()
+	values := make([]lua.LValue, len(docs))
+	decode = testing.AllocsPerRun(10, func() {
+		for i, doc := range docs {
+			values[i], _ = luajson.Decode(L, doc)
+		}
+	})
+	encode = testing.AllocsPerRun(10, func() {
+		for _, value := range values {
+			luajson.Encode(value)
+		}
+	})
+	return decode, encode
+}
+
+func decodeAll(b *testing.B, L *lua.LState, c Corpus) []lua.LValue {
+	var values []lua.LValue
+	for _, doc := range c.Documents() {
+		value, err := luajson.Decode(L, doc)
+		if err != nil {
+			b.Fatal(err)
+		}
+		values = append(values, value)
+	}
+	return values
+}
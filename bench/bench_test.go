@@ -0,0 +1,85 @@
+package bench
+
+import (
+	"testing"
+
+	luajson "github.com/dstgo/gopher-json"
+)
+
+// allocBudgets holds the number of allocations allowed to decode and encode
+// each corpus, about a quarter above those measured when they were set.
+// Lower them along with changes that reduce allocations.
+var allocBudgets = map[string][2]float64{
+	"small":  {100, 15},
+	"deep":   {1200, 75},
+	"wide":   {96000, 2600},
+	"ndjson": {31000, 3800},
+}
+
+func TestAllocBudgets(t *testing.T) {
+	for _, c := range Corpora() {
+		budget, ok := allocBudgets[c.Name]
+		if !ok {
+			t.Errorf("%s: no allocation budget", c.Name)
+			continue
+		}
+		decode, encode := Allocs(c)
+		if decode > budget[0] {
+			t.Errorf("%s: decoding made %.0f allocations, the budget is %.0f", c.Name, decode, budget[0])
+		}
+		if encode > budget[1] {
+			t.Errorf("%s: encoding made %.0f allocations, the budget is %.0f", c.Name, encode, budget[1])
+		}
+	}
+}
+
+func TestCorpora(t *testing.T) {
+	for _, c := range Corpora() {
+		docs := c.Documents()
+		if len(docs) == 0 || (len(docs) > 1) != c.Lines {
+			t.Errorf("%s: unexpected number of documents %d", c.Name, len(docs))
+		}
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	for _, c := range Corpora() {
+		b.Run(c.Name, func(b *testing.B) {
+			Decode(b, c, nil)
+		})
+	}
+}
+
+func BenchmarkDecodeTokens(b *testing.B) {
+	opts := &luajson.DecodeOptions{FastPathThreshold: -1}
+	for _, c := range Corpora() {
+		b.Run(c.Name, func(b *testing.B) {
+			Decode(b, c, opts)
+		})
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	for _, c := range Corpora() {
+		b.Run(c.Name, func(b *testing.B) {
+			Encode(b, c, nil)
+		})
+	}
+}
+
+func BenchmarkScriptRoundTrip(b *testing.B) {
+	const fn = `function(json, s)
+		if type(s) == "table" then
+			for _, line in ipairs(s) do
+				json.encode(json.decode(line))
+			end
+		else
+			json.encode(json.decode(s))
+		end
+	end`
+	for _, c := range Corpora() {
+		b.Run(c.Name, func(b *testing.B) {
+			Script(b, c, fn)
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package json
+
+import (
+	"github.com/yuin/gopher-lua"
+)
+
+const bufferTypeName = "json.buffer"
+
+// Buffer holds encoded JSON returned to Lua as userdata, which avoids copying
+// large documents into Lua strings. Hosts can retrieve it from the userdata's
+// Value field.
+type Buffer struct {
+	data []byte
+}
+
+// Bytes returns the contents of the buffer.
+func (b *Buffer) Bytes() []byte {
+	return b.data
+}
+
+// Len returns the length of the buffer in bytes.
+func (b *Buffer) Len() int {
+	return len(b.data)
+}
+
+func registerBuffer(L *lua.LState) {
+	mt := L.NewTypeMetatable(bufferTypeName)
+	methods := L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"len":      bufferLen,
+		"reset":    bufferReset,
+		"tostring": bufferString,
+		"write_to": bufferWriteTo,
+	})
+	mt.RawSetString("__index", methods)
+	mt.RawSetString("__len", L.NewFunction(bufferLen))
+	mt.RawSetString("__tostring", L.NewFunction(bufferString))
+}
+
+func newBuffer(L *lua.LState, data []byte) *lua.LUserData {
+	ud := L.NewUserData()
+	ud.Value = &Buffer{data: data}
+	ud.Metatable = L.GetTypeMetatable(bufferTypeName)
+	return ud
+}
+
+func checkBuffer(L *lua.LState, n int) *Buffer {
+	ud := L.CheckUserData(n)
+	b, ok := ud.Value.(*Buffer)
+	if !ok {
+		L.ArgError(n, "json buffer expected")
+	}
+	return b
+}
+
+func bufferLen(L *lua.LState) int {
+	L.Push(lua.LNumber(checkBuffer(L, 1).Len()))
+	return 1
+}
+
+// bufferReset empties the buffer, keeping its memory for the next encodings
+// appended by json.encode_to_buffer.
+func bufferReset(L *lua.LState) int {
+	b := checkBuffer(L, 1)
+	b.data = b.data[:0]
+	L.Push(L.Get(1))
+	return 1
+}
+
+func bufferString(L *lua.LState) int {
+	L.Push(lua.LString(checkBuffer(L, 1).data))
+	return 1
+}
+
+// bufferWriteTo writes the buffer to a userdata wrapping an io.Writer, or to
+// any value with a write method, such as a file opened by the io library.
+func bufferWriteTo(L *lua.LState) int {
+	b := checkBuffer(L, 1)
+	w := checkWriter(L, 2)
+	if _, err := w.Write(b.data); err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	L.Push(lua.LTrue)
+	return 1
+}
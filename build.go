@@ -0,0 +1,208 @@
+package json
+
+import (
+	"github.com/yuin/gopher-lua"
+)
+
+const builderTypeName = "json.builder"
+
+// builder writes a document straight to its buffer from the calls of a
+// script, without building the tables the document would be encoded from.
+type builder struct {
+	buf  []byte
+	opts *EncodeOptions
+
+	// stack holds the containers being built, and complete reports whether
+	// the top-level value has been started.
+	stack    []builderFrame
+	complete bool
+	// closed is set once json.build returns, after which the builder can
+	// no longer be used.
+	closed bool
+}
+
+type builderFrame struct {
+	object bool
+	n      int
+}
+
+func registerBuilder(L *lua.LState) {
+	mt := L.NewTypeMetatable(builderTypeName)
+	methods := L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"obj":   builderObject,
+		"arr":   builderArray,
+		"kv":    builderMember,
+		"value": builderValue,
+	})
+	mt.RawSetString("__index", methods)
+}
+
+func checkBuilder(L *lua.LState, n int) *builder {
+	ud := L.CheckUserData(n)
+	b, ok := ud.Value.(*builder)
+	if !ok {
+		L.ArgError(n, "json builder expected")
+	}
+	if b.closed {
+		L.RaiseError("json builder used after json.build returned")
+	}
+	return b
+}
+
+// begin writes what comes before the next value: the separator from the
+// previous one and, inside objects, the member key.
+func (b *builder) begin(L *lua.LState, key string, hasKey bool) {
+	if len(b.stack) == 0 {
+		switch {
+		case b.complete:
+			L.RaiseError("document already complete")
+		case hasKey:
+			L.RaiseError("unexpected member key outside of an object")
+		}
+		b.complete = true
+		return
+	}
+	f := &b.stack[len(b.stack)-1]
+	switch {
+	case f.object && !hasKey:
+		L.RaiseError("member key expected in object")
+	case !f.object && hasKey:
+		L.RaiseError("unexpected member key in array")
+	}
+	if f.n > 0 {
+		b.buf = append(b.buf, ',')
+	}
+	f.n++
+	if hasKey {
+		data, err := marshalString(key, b.opts.ExtraEscapes)
+		if err != nil {
+			L.RaiseError("%s", err.Error())
+		}
+		b.buf = append(append(b.buf, data...), ':')
+	}
+}
+
+func (b *builder) encode(L *lua.LState, value lua.LValue) {
+	data, err := EncodeWithOptions(value, b.opts)
+	if err != nil {
+		L.RaiseError("%s", err.Error())
+	}
+	b.buf = append(b.buf, data...)
+}
+
+// container writes a container whose contents are written by fn.
+func (b *builder) container(L *lua.LState, object bool, fn *lua.LFunction, self lua.LValue) {
+	open, end := byte('['), byte(']')
+	if object {
+		open, end = '{', '}'
+	}
+	b.buf = append(b.buf, open)
+	b.stack = append(b.stack, builderFrame{object: object})
+	L.Push(fn)
+	L.Push(self)
+	L.Call(1, 0)
+	b.stack = b.stack[:len(b.stack)-1]
+	b.buf = append(b.buf, end)
+}
+
+// checkKey returns the member key passed before the argument at n, if any,
+// and the position of that argument.
+func checkKey(L *lua.LState, n int) (string, bool, int) {
+	if key, ok := L.Get(n).(lua.LString); ok {
+		return string(key), true, n + 1
+	}
+	return "", false, n
+}
+
+// builderObject writes an object, b:obj([key,] fn), whose members are
+// written by fn.
+func builderObject(L *lua.LState) int {
+	b := checkBuilder(L, 1)
+	key, hasKey, n := checkKey(L, 2)
+	fn := L.CheckFunction(n)
+	b.begin(L, key, hasKey)
+	b.container(L, true, fn, L.Get(1))
+	return 0
+}
+
+// builderArray writes an array, b:arr([key,] fn_or_elems), whose elements
+// are written by fn or taken from a table.
+func builderArray(L *lua.LState) int {
+	b := checkBuilder(L, 1)
+	key, hasKey, n := checkKey(L, 2)
+	switch v := L.Get(n).(type) {
+	case *lua.LFunction:
+		b.begin(L, key, hasKey)
+		b.container(L, false, v, L.Get(1))
+	case *lua.LTable:
+		if _, array := isArray(v); !array {
+			L.ArgError(n, "array expected")
+		}
+		b.begin(L, key, hasKey)
+		b.encode(L, v)
+	default:
+		L.TypeError(n, lua.LTFunction)
+	}
+	return 0
+}
+
+func builderMember(L *lua.LState) int {
+	b := checkBuilder(L, 1)
+	key := L.CheckString(2)
+	value := L.CheckAny(3)
+	b.begin(L, key, true)
+	b.encode(L, value)
+	return 0
+}
+
+func builderValue(L *lua.LState) int {
+	b := checkBuilder(L, 1)
+	value := L.CheckAny(2)
+	b.begin(L, "", false)
+	b.encode(L, value)
+	return 0
+}
+
+// apiBuild calls fn with a builder and returns the document it wrote.
+func (m *module) apiBuild(L *lua.LState) int {
+	fn := L.CheckFunction(1)
+	opts, lopts := checkEncodeOptions(L, 2, m.encode)
+
+	// The values written are encoded without indentation, which applies to
+	// the whole document once it is complete.
+	fragment := opts
+	fragment.Indent, fragment.Prefix = "", ""
+	b := &builder{opts: &fragment}
+	ud := L.NewUserData()
+	ud.Value = b
+	ud.Metatable = L.GetTypeMetatable(builderTypeName)
+	L.Push(fn)
+	L.Push(ud)
+	L.Call(1, 0)
+	b.closed = true
+	if !b.complete {
+		L.Push(lua.LNil)
+		L.Push(lua.LString("nothing was built"))
+		return 2
+	}
+	if opts.SortKeys {
+		// Members are written as they come, so the document is sorted
+		// once it is complete.
+		data, err := sortKeys(b.buf)
+		if err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+		b.buf = data
+	}
+	if opts.Indent != "" || opts.Prefix != "" {
+		b.buf = indentJSON(b.buf, opts.Prefix, opts.Indent)
+	}
+	if lopts.bool("buffer", false) {
+		L.Push(newBuffer(L, b.buf))
+	} else {
+		L.Push(lua.LString(string(b.buf)))
+	}
+	return 1 + pushReport(L, opts.Report)
+}
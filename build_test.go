@@ -0,0 +1,57 @@
+package json
+
+import (
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestBuildLua(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local s = json.build(function(b)
+		b:obj(function()
+			b:kv("z", 1)
+			b:arr("xs", {1, 2, 3})
+			b:obj("o", function() end)
+			b:arr("rows", function()
+				for i = 1, 2 do
+					b:obj(function() b:kv("i", i) end)
+				end
+				b:value("end")
+				b:arr({})
+			end)
+			b:kv("a", {k = true})
+		end)
+	end)
+	assert(s == '{"z":1,"xs":[1,2,3],"o":{},"rows":[{"i":1},{"i":2},"end",[]],"a":{"k":true}}', s)
+	assert(json.build(function(b) b:value(json.null) end) == "null")
+	assert(tostring(json.build(function(b) b:arr({"x"}) end, {buffer = true})) == '["x"]')
+
+	local s, err = json.build(function() end)
+	assert(s == nil and err == "nothing was built")
+
+	local saved
+	json.build(function(b) saved = b; b:value(1) end)
+	local ok, err = pcall(saved.value, saved, 2)
+	assert(not ok and string.find(err, "after json.build returned"))
+
+	local function fails(fn, msg)
+		local ok, err = pcall(json.build, fn)
+		assert(not ok and string.find(err, msg, 1, true), err)
+	end
+	fails(function(b) b:value(1); b:value(2) end, "document already complete")
+	fails(function(b) b:kv("a", 1) end, "outside of an object")
+	fails(function(b) b:obj(function() b:value(1) end) end, "member key expected")
+	fails(function(b) b:arr(function() b:kv("a", 1) end) end, "unexpected member key in array")
+	fails(function(b) b:arr({a = 1}) end, "array expected")
+	fails(function(b) b:value(print) end, "cannot encode function")
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,126 @@
+package json
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+
+	"github.com/yuin/gopher-lua"
+)
+
+const frozenTypeName = "json.frozen"
+
+// decodeCache holds the documents most recently decoded by json.decode,
+// keyed by the SHA-256 of their JSON text. It is shared by all the states
+// loading the module from the same loader.
+type decodeCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[[sha256.Size]byte]*list.Element
+	// order lists the entries from the most recently used.
+	order *list.List
+}
+
+type cacheEntry struct {
+	key   [sha256.Size]byte
+	value lua.LValue
+}
+
+func newDecodeCache(size int) *decodeCache {
+	return &decodeCache{
+		size:    size,
+		entries: make(map[[sha256.Size]byte]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// WithDecodeCache makes json.decode cache up to size decoded documents, and
+// return the cached value when it is passed the same string again. Cached
+// tables are shared by every caller, including other states loading the
+// module from the same loader, so they are frozen: adding members to them
+// raises an error, and scripts must not modify them in any other way. Calls
+// with an options table, and modules using a TablePool, bypass the cache.
+func WithDecodeCache(size int) Option {
+	return func(c *config) {
+		if size > 0 {
+			c.decodeCache = newDecodeCache(size)
+		}
+	}
+}
+
+func (c *decodeCache) get(key [sha256.Size]byte) (lua.LValue, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*cacheEntry).value, true
+}
+
+func (c *decodeCache) put(key [sha256.Size]byte, value lua.LValue) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, value: value})
+	if c.order.Len() > c.size {
+		last := c.order.Back()
+		c.order.Remove(last)
+		delete(c.entries, last.Value.(*cacheEntry).key)
+	}
+}
+
+// cacheable reports whether documents decoded with opts can be cached.
+func (c *decodeCache) cacheable(opts *DecodeOptions) bool {
+	return c != nil && opts.TablePool == nil && opts.Report == nil
+}
+
+func registerFrozen(L *lua.LState) {
+	mt := L.NewTypeMetatable(frozenTypeName)
+	mt.RawSetString("__newindex", L.NewFunction(frozenNewIndex))
+	mt.RawSetString("__metatable", lua.LString("frozen"))
+}
+
+func frozenNewIndex(L *lua.LState) int {
+	L.RaiseError("cannot modify a cached JSON document")
+	return 0
+}
+
+// freeze sets the frozen metatable on the tables of value, and marks its
+// objects as frozen.
+func freeze(L *lua.LState, value lua.LValue) {
+	switch v := value.(type) {
+	case *lua.LTable:
+		if memberOrder(v) != nil {
+			// Ordered tables keep their metatable, which records the order.
+			frozen := L.GetTypeMetatable(frozenTypeName).(*lua.LTable)
+			frozen.ForEach(func(key, value lua.LValue) {
+				v.Metatable.(*lua.LTable).RawSet(key, value)
+			})
+		} else {
+			v.Metatable = L.GetTypeMetatable(frozenTypeName)
+		}
+		v.ForEach(func(_, elem lua.LValue) {
+			freeze(L, elem)
+		})
+	case *lua.LUserData:
+		if o, ok := v.Value.(*Object); ok {
+			o.frozen = true
+			for _, elem := range o.values {
+				freeze(L, elem)
+			}
+		}
+		if a, ok := v.Value.(*Array); ok {
+			a.frozen = true
+			for _, chunk := range a.chunks {
+				for _, elem := range chunk {
+					freeze(L, elem)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package json
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestDecodeCacheEviction(t *testing.T) {
+	c := newDecodeCache(2)
+	a, b, d := sha256.Sum256([]byte("a")), sha256.Sum256([]byte("b")), sha256.Sum256([]byte("d"))
+	c.put(a, lua.LString("a"))
+	c.put(b, lua.LString("b"))
+	if _, ok := c.get(a); !ok {
+		t.Fatal("a was not cached")
+	}
+	c.put(d, lua.LString("d"))
+	if _, ok := c.get(b); ok {
+		t.Fatal("b, the least recently used, was not evicted")
+	}
+	if v, ok := c.get(a); !ok || v != lua.LString("a") {
+		t.Fatalf("got %v", v)
+	}
+}
+
+func TestDecodeCacheLua(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local doc = '{"rules":[{"id":1}],"meta":{"v":2}}'
+	local a, b = json.decode(doc), json.decode(doc)
+	assert(rawequal(a, b) and a.rules[1].id == 1)
+	assert(not rawequal(json.decode(doc, {}), a))
+
+	local ok, err = pcall(function() a.extra = true end)
+	assert(not ok and string.find(err, "cannot modify a cached JSON document"))
+	assert(not pcall(function() a.rules[1].name = "x" end))
+	assert(not pcall(setmetatable, a, nil))
+	assert(json.encode(a) == '{"meta":{"v":2},"rules":[{"id":1}]}')
+
+	local obj = json.decode('{"k":1}', {objects = "userdata"})
+	obj.k = 2
+
+	local v, err = json.decode("{")
+	assert(v == nil and err)
+	json.decode("1")
+	json.decode("2")
+	assert(not rawequal(json.decode(doc), a))
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s, WithDecodeCache(2))
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+	s2 := lua.NewState()
+	defer s2.Close()
+
+	// The cache is shared by the states loading the module from one loader.
+	loader := NewLoader(WithDecodeCache(1))
+	s.PreloadModule("cached", loader)
+	s2.PreloadModule("cached", loader)
+	for _, L := range []*lua.LState{s, s2} {
+		if err := L.DoString(`shared = require("cached").decode('{"a":[1]}')`); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.GetGlobal("shared") != s2.GetGlobal("shared") {
+		t.Error("documents are not shared between states")
+	}
+}
+
+func TestDecodeCacheObjects(t *testing.T) {
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s, WithDecodeCache(1), func(c *config) { c.decode.UserDataObjects = true })
+	if err := s.DoString(`
+	local json = require("json")
+	local doc = json.decode('{"a":{"b":1}}')
+	assert(rawequal(doc, json.decode('{"a":{"b":1}}')))
+	assert(not pcall(function() doc.a.b = 2 end))
+	`); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,83 @@
+package json
+
+import (
+	"github.com/yuin/gopher-lua"
+)
+
+// classTag returns the tag of the instance t, whose metatable is in the
+// Classes option.
+func (j jsonValue) classTag(t *lua.LTable) (string, bool) {
+	mt, ok := t.Metatable.(*lua.LTable)
+	if !ok || len(j.state.opts.Classes) == 0 {
+		return "", false
+	}
+	tag, ok := j.state.opts.Classes[mt]
+	return tag, ok
+}
+
+// typeKey returns the member holding the tag of class instances.
+func (o *EncodeOptions) typeKey() string {
+	if o.TypeKey == "" {
+		return defaultTypeKey
+	}
+	return o.TypeKey
+}
+
+// classes returns the classes of the option name, a table mapping
+// metatables to tags, added to those of base.
+func (o luaOptions) classes(name string, base map[*lua.LTable]string) map[*lua.LTable]string {
+	switch v := o.get(name).(type) {
+	case *lua.LNilType:
+		return base
+	case *lua.LTable:
+		merged := make(map[*lua.LTable]string, len(base))
+		for mt, tag := range base {
+			merged[mt] = tag
+		}
+		v.ForEach(func(key, value lua.LValue) {
+			mt, ok := key.(*lua.LTable)
+			tag, isString := value.(lua.LString)
+			if !ok || !isString {
+				o.L.ArgError(o.arg, "option '"+name+"' must map metatables to tags")
+			}
+			merged[mt] = string(tag)
+		})
+		return merged
+	}
+	o.L.ArgError(o.arg, "option '"+name+"' must be a table")
+	return nil
+}
+
+// apiRegisterClass registers the metatable mt under tag, so that its
+// instances encode with their tag and decode back to instances.
+func (m *module) apiRegisterClass(L *lua.LState) int {
+	tag := L.CheckString(1)
+	mt := L.CheckTable(2)
+
+	classes := make(map[*lua.LTable]string, len(m.encode.Classes)+1)
+	for k, v := range m.encode.Classes {
+		classes[k] = v
+	}
+	classes[mt] = tag
+	m.encode.Classes = classes
+
+	constructors := make(map[string]Constructor, len(m.decode.Constructors)+1)
+	for k, v := range m.decode.Constructors {
+		constructors[k] = v
+	}
+	key := m.decode.TypeKey
+	if key == "" {
+		key = defaultTypeKey
+	}
+	constructors[tag] = func(L *lua.LState, obj lua.LValue) (lua.LValue, error) {
+		t, ok := obj.(*lua.LTable)
+		if !ok {
+			return obj, nil
+		}
+		t.RawSetString(key, lua.LNil)
+		t.Metatable = mt
+		return t, nil
+	}
+	m.decode.Constructors = constructors
+	return 0
+}
@@ -0,0 +1,38 @@
+package json
+
+import (
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestClasses(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local Point = {}
+	Point.__index = Point
+	function Point:len2() return self.x * self.x + self.y * self.y end
+	local Empty = {}
+
+	local p = setmetatable({x = 3, y = 4}, Point)
+	assert(json.encode({p}) == '[{"x":3,"y":4}]')
+	assert(json.encode({p}, {classes = {[Point] = "point"}}) == '[{"$type":"point","x":3,"y":4}]')
+	assert(json.encode(p, {classes = {[Point] = "point"}, type_key = "kind"}) == '{"kind":"point","x":3,"y":4}')
+	assert(json.encode(setmetatable({}, Empty), {classes = {[Empty] = "empty"}}) == '{"$type":"empty"}')
+	assert(not pcall(json.encode, p, {classes = {point = Point}}))
+
+	json.register_class("point", Point)
+	local s = json.encode({a = p, b = {1, 2}})
+	assert(s == '{"a":{"$type":"point","x":3,"y":4},"b":[1,2]}', s)
+	local doc = json.decode(s)
+	assert(getmetatable(doc.a) == Point and doc.a:len2() == 25 and doc.a["$type"] == nil)
+	assert(json.encode(doc) == s)
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
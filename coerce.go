@@ -0,0 +1,88 @@
+package json
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// Coercion is a type that string values are converted to when decoding.
+type Coercion string
+
+const (
+	// CoerceNumber converts strings holding a number, such as "8080".
+	CoerceNumber Coercion = "number"
+	// CoerceBoolean converts the strings "true" and "false".
+	CoerceBoolean Coercion = "boolean"
+)
+
+type coercion struct {
+	pattern pathPattern
+	to      Coercion
+}
+
+// compileCoercions parses the path patterns of the Coerce option.
+func compileCoercions(rules map[string]Coercion) ([]coercion, error) {
+	// Apply overlapping patterns in a deterministic order.
+	patterns := make([]string, 0, len(rules))
+	for s := range rules {
+		patterns = append(patterns, s)
+	}
+	sort.Strings(patterns)
+
+	compiled := make([]coercion, 0, len(rules))
+	for _, s := range patterns {
+		to := rules[s]
+		if to != CoerceNumber && to != CoerceBoolean {
+			return nil, fmt.Errorf("unknown coercion %q for %s", string(to), s)
+		}
+		pp, err := parsePathPattern(s)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, coercion{pattern: pp, to: to})
+	}
+	return compiled, nil
+}
+
+// text converts the string value s, found at path p, applying the first
+// coercion whose pattern matches p. A string that cannot be coerced records
+// an error.
+func (d *decoder) text(s string, p path) lua.LValue {
+	for _, c := range d.coerce {
+		if !c.pattern.match(p) {
+			continue
+		}
+		switch c.to {
+		case CoerceNumber:
+			n, err := strconv.ParseFloat(s, 64)
+			if err == nil && !math.IsInf(n, 0) && !math.IsNaN(n) {
+				if d.opts.WarnUnsafeInts {
+					d.opts.Report.checkText(p, s)
+				}
+				return lua.LNumber(n)
+			}
+		case CoerceBoolean:
+			switch s {
+			case "true":
+				return lua.LTrue
+			case "false":
+				return lua.LFalse
+			}
+		}
+		if d.err == nil {
+			d.err = fmt.Errorf("cannot coerce %q at %s to %s", s, p, string(c.to))
+		}
+		return lua.LNil
+	}
+	if d.opts.BigIntStrings && isBigIntString(s) {
+		if n, err := d.number(s, p); err == nil {
+			return n
+		}
+	}
+	d.charge(stringCost+len(s), p)
+	return d.str(s, false)
+}
@@ -0,0 +1,70 @@
+package json
+
+import (
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestCoerce(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	opts := DecodeOptions{Coerce: map[string]Coercion{
+		"$.port":          CoerceNumber,
+		"$.enabled":       CoerceBoolean,
+		"$.servers[*].id": CoerceNumber,
+	}}
+	for _, threshold := range []int{0, -1} {
+		opts.FastPathThreshold = threshold
+		value, err := DecodeWithOptions(L, []byte(`{"port":"8080","enabled":"false","name":"42","servers":[{"id":"1"},{"id":2}]}`), &opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tbl := value.(*lua.LTable)
+		if port := tbl.RawGetString("port"); port != lua.LNumber(8080) {
+			t.Errorf("expecting port 8080, got %v", port)
+		}
+		if enabled := tbl.RawGetString("enabled"); enabled != lua.LFalse {
+			t.Errorf("expecting enabled false, got %v", enabled)
+		}
+		if name := tbl.RawGetString("name"); name != lua.LString("42") {
+			t.Errorf("expecting name to stay a string, got %v", name)
+		}
+		servers := tbl.RawGetString("servers").(*lua.LTable)
+		for i := 1; i <= 2; i++ {
+			if id := L.GetField(servers.RawGetInt(i), "id"); id != lua.LNumber(i) {
+				t.Errorf("expecting id %d, got %v", i, id)
+			}
+		}
+
+		if _, err := DecodeWithOptions(L, []byte(`{"port":"http"}`), &opts); err == nil {
+			t.Error("expecting coercion error")
+		}
+	}
+
+	if _, err := DecodeWithOptions(L, []byte(`{}`), &DecodeOptions{Coerce: map[string]Coercion{"$.a": "date"}}); err == nil {
+		t.Error("expecting unknown coercion error")
+	}
+}
+
+func TestCoerceLua(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local value = json.decode('{"port":"8080","on":"true"}', {coerce = {["$.port"] = "number", ["$.on"] = "boolean"}})
+	assert(value.port == 8080 and value.on == true)
+
+	local value, err = json.decode('{"port":"x"}', {coerce = {["$.port"] = "number"}})
+	assert(value == nil and err:find("port"))
+
+	assert(not pcall(json.decode, '{}', {coerce = {["$.port"] = "date"}}))
+	assert(not pcall(json.decode, '{}', {coerce = {"number"}}))
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,186 @@
+package json
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+
+	"github.com/yuin/gopher-lua"
+)
+
+var (
+	errNotRows        = errors.New("columnar decode expects an array of objects")
+	errInvalidColumns = errors.New("columns must be arrays keyed by member name")
+)
+
+// decodeColumns decodes an array of objects into one array per requested
+// member. Members that are not requested are skipped without being
+// converted. It returns the columns, keyed by member name, and the number of
+// rows.
+func decodeColumns(d *decoder, data []byte, names []string) (*lua.LTable, int, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	columns := make(map[string]*lua.LTable, len(names))
+	result := d.L.CreateTable(0, len(names))
+	for _, name := range names {
+		columns[name] = d.L.NewTable()
+		result.RawSetString(name, columns[name])
+	}
+
+	if tok, err := dec.Token(); err != nil {
+		return nil, 0, err
+	} else if tok != json.Delim('[') {
+		return nil, 0, errNotRows
+	}
+	rows := 0
+	for dec.More() {
+		if tok, err := dec.Token(); err != nil {
+			return nil, 0, err
+		} else if tok != json.Delim('{') {
+			return nil, 0, errNotRows
+		}
+		rows++
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, 0, err
+			}
+			column := columns[tok.(string)]
+			if column == nil {
+				var skipped json.RawMessage
+				if err := dec.Decode(&skipped); err != nil {
+					return nil, 0, err
+				}
+				continue
+			}
+			var value interface{}
+			if err := dec.Decode(&value); err != nil {
+				return nil, 0, err
+			}
+			column.RawSetInt(rows, d.value(value, nil))
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, 0, err
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, 0, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, 0, errTrailingData
+	}
+	if d.err != nil {
+		return nil, 0, d.err
+	}
+	return result, rows, nil
+}
+
+// encodeRows encodes count rows from the parallel arrays in columns as an
+// array of objects. Members whose value is nil are omitted from their row.
+func encodeRows(columns *lua.LTable, count int, opts *EncodeOptions) ([]byte, error) {
+	var names []string
+	var values []*lua.LTable
+	var err error
+	columns.ForEach(func(key, value lua.LValue) {
+		name, ok := key.(lua.LString)
+		column, isTable := value.(*lua.LTable)
+		if !ok || !isTable {
+			err = errInvalidColumns
+			return
+		}
+		names = append(names, string(name))
+		values = append(values, column)
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(columnsByName{names, values})
+
+	keys := make([][]byte, len(names))
+	for i, name := range names {
+		if keys[i], err = marshalString(name, opts.ExtraEscapes); err != nil {
+			return nil, err
+		}
+	}
+
+	// The values are encoded compactly, and the rows indented as a whole.
+	valueOpts := *opts
+	valueOpts.Indent, valueOpts.Prefix = "", ""
+
+	var b bytes.Buffer
+	b.WriteByte('[')
+	for row := 1; row <= count; row++ {
+		if row > 1 {
+			b.WriteByte(',')
+		}
+		b.WriteByte('{')
+		first := true
+		for i, column := range values {
+			value := column.RawGetInt(row)
+			if value == lua.LNil {
+				continue
+			}
+			data, err := EncodeWithOptions(value, &valueOpts)
+			if err != nil {
+				return nil, err
+			}
+			if !first {
+				b.WriteByte(',')
+			}
+			first = false
+			b.Write(keys[i])
+			b.WriteByte(':')
+			b.Write(data)
+		}
+		b.WriteByte('}')
+	}
+	b.WriteByte(']')
+	if opts.Indent != "" || opts.Prefix != "" {
+		return indentJSON(b.Bytes(), opts.Prefix, opts.Indent), nil
+	}
+	return b.Bytes(), nil
+}
+
+type columnsByName struct {
+	names  []string
+	values []*lua.LTable
+}
+
+func (c columnsByName) Len() int           { return len(c.names) }
+func (c columnsByName) Less(i, j int) bool { return c.names[i] < c.names[j] }
+func (c columnsByName) Swap(i, j int) {
+	c.names[i], c.names[j] = c.names[j], c.names[i]
+	c.values[i], c.values[j] = c.values[j], c.values[i]
+}
+
+func (m *module) apiEncodeRows(L *lua.LState) int {
+	columns := L.CheckTable(1)
+	count := L.CheckInt(2)
+
+	opts, _ := checkEncodeOptions(L, 3, m.encode)
+
+	data, err := encodeRows(columns, count, &opts)
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	L.Push(lua.LString(data))
+	return 1 + pushReport(L, opts.Report)
+}
+
+func (m *module) apiDecodeColumns(L *lua.LState) int {
+	str := L.CheckString(1)
+	names := checkStrings(L, 2)
+
+	columns, rows, err := decodeColumns(newDecoder(L, &m.decode), []byte(str), names)
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	L.Push(columns)
+	L.Push(lua.LNumber(rows))
+	return 2
+}
@@ -0,0 +1,59 @@
+package json
+
+import (
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestDecodeColumns(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local cols, n = json.decode_columns('[{"id":1,"name":"a","price":2.5,"extra":{"x":[1]}},{"id":2,"price":3},{"name":"c"}]', {"id", "name", "price"})
+	assert(n == 3)
+	assert(cols.id[1] == 1 and cols.id[2] == 2 and cols.id[3] == nil)
+	assert(cols.name[1] == "a" and cols.name[2] == nil and cols.name[3] == "c")
+	assert(cols.price[1] == 2.5 and cols.price[2] == 3)
+	assert(cols.extra == nil)
+
+	local cols, n = json.decode_columns('[]', {"id"})
+	assert(n == 0 and #cols.id == 0)
+
+	local cols, err = json.decode_columns('[1]', {"id"})
+	assert(cols == nil and string.find(err, "array of objects"))
+
+	local cols, err = json.decode_columns('[{"id":1}', {"id"})
+	assert(cols == nil and err)
+
+	local str = json.encode_rows({id = {1, 2, 3}, name = {"a", nil, "c"}}, 3)
+	assert(str == '[{"id":1,"name":"a"},{"id":2},{"id":3,"name":"c"}]')
+	assert(json.encode_rows({id = {1}}, 0) == "[]")
+
+	local cols, n = json.decode_columns(str, {"id", "name"})
+	assert(n == 3 and cols.name[3] == "c")
+
+	local str, err = json.encode_rows({id = 1}, 1)
+	assert(str == nil and string.find(err, "columns"))
+
+	str = json.encode_rows({at = {stamp}, tags = {{b = 1, a = 2}}}, 1, {sort_keys = true, indent = " "})
+	assert(str == '[\n {\n  "at": {\n   "unix": 1\n  },\n  "tags": {\n   "a": 2,\n   "b": 1\n  }\n }\n]', str)
+	local _, err, report = json.encode_rows({id = {2^60}}, 1, {warn_unsafe_int = true})
+	assert(err == nil and #report.unsafe_ints == 1)
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	stamp := s.NewUserData()
+	stamp.Metatable = s.NewTable()
+	s.SetField(stamp.Metatable, "__tojson", s.NewFunction(func(L *lua.LState) int {
+		t := L.NewTable()
+		t.RawSetString("unix", lua.LNumber(1))
+		L.Push(t)
+		return 1
+	}))
+	s.SetGlobal("stamp", stamp)
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
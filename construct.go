@@ -0,0 +1,103 @@
+package json
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// Constructor builds the value that a tagged object decodes to, such as
+// userdata or a table with a metatable, from the object as decoded.
+type Constructor func(L *lua.LState, obj lua.LValue) (lua.LValue, error)
+
+// defaultTypeKey is the member naming the constructor of an object unless the
+// TypeKey option names another.
+const defaultTypeKey = "$type"
+
+// WithConstructor makes json.decode pass the objects whose type member, "$type"
+// unless scripts pass the type_key option, is name to fn, and decode them to
+// the value it returns. Only the objects with the names of registered
+// constructors are constructed; the others decode as usual.
+func WithConstructor(name string, fn Constructor) Option {
+	return func(c *config) {
+		if c.decode.Constructors == nil {
+			c.decode.Constructors = make(map[string]Constructor)
+		}
+		c.decode.Constructors[name] = fn
+	}
+}
+
+// luaConstructor returns the constructor calling fn, which returns the
+// constructed value, or nil and an error message.
+func luaConstructor(L *lua.LState, fn *lua.LFunction) Constructor {
+	return func(_ *lua.LState, obj lua.LValue) (lua.LValue, error) {
+		if err := L.CallByParam(lua.P{Fn: fn, NRet: 2, Protect: true}, obj); err != nil {
+			return nil, err
+		}
+		value, msg := L.Get(-2), L.Get(-1)
+		L.Pop(2)
+		if value == lua.LNil && msg != lua.LNil {
+			return nil, errors.New(lua.LVAsString(msg))
+		}
+		return value, nil
+	}
+}
+
+// constructors returns the constructors of the option name, a table mapping
+// type names to functions, added to those of base.
+func (o luaOptions) constructors(name string, base map[string]Constructor) map[string]Constructor {
+	switch v := o.get(name).(type) {
+	case *lua.LNilType:
+		return base
+	case *lua.LTable:
+		merged := make(map[string]Constructor, len(base))
+		for name, fn := range base {
+			merged[name] = fn
+		}
+		v.ForEach(func(key, value lua.LValue) {
+			fn, ok := value.(*lua.LFunction)
+			if !ok {
+				o.L.ArgError(o.arg, fmt.Sprintf("constructor %s must be a function", lua.LVAsString(key)))
+			}
+			merged[lua.LVAsString(key)] = luaConstructor(o.L, fn)
+		})
+		return merged
+	}
+	o.L.ArgError(o.arg, "option '"+name+"' must be a table")
+	return nil
+}
+
+// construct returns the value built by the constructor named by the type
+// member of obj, the object found at path p, or obj itself if it has none.
+// Errors are recorded and leave obj unchanged.
+func (d *decoder) construct(obj lua.LValue, p path) lua.LValue {
+	if len(d.opts.Constructors) == 0 || d.err != nil {
+		return obj
+	}
+	key := d.opts.TypeKey
+	if key == "" {
+		key = defaultTypeKey
+	}
+	var tag lua.LValue
+	switch obj := obj.(type) {
+	case *lua.LTable:
+		tag = obj.RawGetString(key)
+	case *lua.LUserData:
+		tag, _ = obj.Value.(*Object).Get(key)
+	}
+	name, ok := tag.(lua.LString)
+	if !ok {
+		return obj
+	}
+	fn, ok := d.opts.Constructors[string(name)]
+	if !ok {
+		return obj
+	}
+	value, err := fn(d.L, obj)
+	if err != nil {
+		d.err = fmt.Errorf("cannot construct %s at %s: %v", name, p, err)
+		return obj
+	}
+	return value
+}
@@ -0,0 +1,83 @@
+package json
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestConstructors(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local Point = {}
+	Point.__index = Point
+	function Point:len2() return self.x * self.x + self.y * self.y end
+	local ctors = {
+		point = function(obj) return setmetatable({x = obj.x, y = obj.y}, Point) end,
+		fail = function() return nil, "bad fail" end,
+	}
+	local doc = json.decode('{"a": {"$type": "point", "x": 3, "y": 4}, "b": [{"$type": "other", "v": 1}]}', {constructors = ctors})
+	assert(getmetatable(doc.a) == Point and doc.a:len2() == 25)
+	assert(doc.b[1]["$type"] == "other" and doc.b[1].v == 1)
+
+	local _, err = json.decode('[{"$type": "fail"}]', {constructors = ctors})
+	assert(err == "cannot construct fail at $[0]: bad fail", err)
+	assert(json.decode('{"kind": "point", "x": 1, "y": 0}', {constructors = ctors, type_key = "kind"}):len2() == 1)
+	assert(json.decode('{"$type": "point", "x": 1, "y": 0}').x == 1)
+	assert(json.decode('{"$type": "go"}') == 42)
+	assert(not pcall(json.decode, "{}", {constructors = {point = 1}}))
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s, WithConstructor("go", func(L *lua.LState, obj lua.LValue) (lua.LValue, error) {
+		return lua.LNumber(42), nil
+	}))
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConstructorsGo(t *testing.T) {
+	s := lua.NewState()
+	defer s.Close()
+
+	opts := &DecodeOptions{Constructors: map[string]Constructor{
+		"id": func(L *lua.LState, obj lua.LValue) (lua.LValue, error) {
+			return L.GetField(obj, "v"), nil
+		},
+		"bad": func(L *lua.LState, obj lua.LValue) (lua.LValue, error) {
+			return nil, errors.New("no")
+		},
+	}}
+	for _, threshold := range []int{0, -1} {
+		opts.FastPathThreshold = threshold
+		value, err := DecodeWithOptions(s, []byte(`[{"$type": "id", "v": 1}, {"$type": "id"}]`), opts)
+		if err != nil || value.(*lua.LTable).Len() != 1 || value.(*lua.LTable).RawGetInt(1) != lua.LNumber(1) {
+			t.Errorf("threshold %d: got %v, %v", threshold, value, err)
+		}
+		_, err = DecodeWithOptions(s, []byte(`{"a": {"$type": "bad"}}`), opts)
+		if err == nil || err.Error() != "cannot construct bad at $.a: no" {
+			t.Errorf("threshold %d: got %v", threshold, err)
+		}
+	}
+
+	var got []lua.LValue
+	p, err := NewPushDecoder(s, opts, func(value lua.LValue) error {
+		got = append(got, value)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Feed([]byte(`{"$type": "id", "v": [1]} [{"$type": "id", "v": 2}]`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].(*lua.LTable).RawGetInt(1) != lua.LNumber(1) || got[1].(*lua.LTable).RawGetInt(1) != lua.LNumber(2) {
+		t.Errorf("unexpected values %v", got)
+	}
+}
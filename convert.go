@@ -0,0 +1,233 @@
+package json
+
+import (
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"strconv"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// ToLValue converts the Go value v to a Lua value directly, giving the same
+// result as encoding it with encoding/json and decoding it with Decode:
+// structs follow their json tags, values implementing json.Marshaler or
+// encoding.TextMarshaler are converted from their encoding, and byte slices
+// become base64 strings. Lua values are returned as they are. Values that
+// encoding/json cannot encode, such as channels and functions, convert to
+// nil.
+func ToLValue(L *lua.LState, v interface{}) lua.LValue {
+	return toLValue(L, mapFields(reflect.ValueOf(v), func(name string) string { return name }))
+}
+
+func toLValue(L *lua.LState, v interface{}) lua.LValue {
+	switch v := v.(type) {
+	case nil:
+		return lua.LNil
+	case lua.LValue:
+		return v
+	case bool:
+		return lua.LBool(v)
+	case string:
+		return lua.LString(v)
+	case float64:
+		return lua.LNumber(v)
+	case int:
+		return lua.LNumber(v)
+	case json.Number:
+		f, _ := v.Float64()
+		return lua.LNumber(f)
+	case orderedFields:
+		t := L.CreateTable(0, len(v))
+		for _, f := range v {
+			t.RawSetString(f.name, toLValue(L, f.value))
+		}
+		return t
+	case []interface{}:
+		t := L.CreateTable(len(v), 0)
+		for _, elem := range v {
+			t.Append(toLValue(L, elem))
+		}
+		return t
+	case map[string]interface{}:
+		t := L.CreateTable(0, len(v))
+		for key, value := range v {
+			t.RawSetString(key, toLValue(L, value))
+		}
+		return t
+	}
+	rv := reflect.ValueOf(v)
+	if t := rv.Type(); t.Implements(marshalerType) || t.Implements(textMarshalerType) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return lua.LNil
+		}
+		value, err := Decode(L, data)
+		if err != nil {
+			return lua.LNil
+		}
+		return value
+	}
+	switch rv.Kind() {
+	case reflect.Bool:
+		return lua.LBool(rv.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return lua.LNumber(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return lua.LNumber(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return lua.LNumber(rv.Float())
+	case reflect.String:
+		return lua.LString(rv.String())
+	case reflect.Slice:
+		// Byte slices and nil slices, left to encoding/json by mapFields.
+		if rv.IsNil() {
+			return lua.LNil
+		}
+		return lua.LString(base64.StdEncoding.EncodeToString(rv.Bytes()))
+	case reflect.Map:
+		t := L.CreateTable(0, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			key, ok := mapKey(iter.Key())
+			if !ok {
+				return lua.LNil
+			}
+			t.RawSetString(key, toLValue(L, iter.Value().Interface()))
+		}
+		return t
+	}
+	return lua.LNil
+}
+
+// mapKey returns the object key of a map key, as encoding/json does.
+func mapKey(k reflect.Value) (string, bool) {
+	if k.Kind() == reflect.String {
+		return k.String(), true
+	}
+	if tm, ok := k.Interface().(encoding.TextMarshaler); ok {
+		text, err := tm.MarshalText()
+		return string(text), err == nil
+	}
+	switch k.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10), true
+	}
+	return "", false
+}
+
+// FromLValue converts the Lua value v to the Go values of encoding/json:
+// map[string]interface{}, []interface{}, float64, string, bool and nil.
+// Tables are converted as Encode would encode them, and it fails on the same
+// values.
+func FromLValue(v lua.LValue) (interface{}, error) {
+	return fromLValue(v, make(map[*lua.LTable]bool))
+}
+
+func fromLValue(v lua.LValue, visited map[*lua.LTable]bool) (interface{}, error) {
+	switch v := v.(type) {
+	case *lua.LNilType:
+		return nil, nil
+	case lua.LBool:
+		return bool(v), nil
+	case lua.LNumber:
+		return float64(v), nil
+	case lua.LString:
+		return string(v), nil
+	case *lua.LUserData:
+		switch value := v.Value.(type) {
+		case nullValue:
+			return nil, nil
+		case *Opaque:
+			return value.Value(), nil
+		case Int64:
+			return int64(value), nil
+		case *Object:
+			obj := make(map[string]interface{}, len(value.keys))
+			for i, key := range value.keys {
+				member, err := fromLValue(value.values[i], visited)
+				if err != nil {
+					return nil, err
+				}
+				obj[key] = member
+			}
+			return obj, nil
+		}
+		return nil, invalidTypeError(lua.LTUserData)
+	case *lua.LTable:
+		if visited[v] {
+			return nil, errNested
+		}
+		visited[v] = true
+		defer delete(visited, v)
+		return fromTable(v, visited)
+	}
+	return nil, invalidTypeError(v.Type())
+}
+
+func fromTable(t *lua.LTable, visited map[*lua.LTable]bool) (interface{}, error) {
+	n, field, explicit := explicitLen(t, false)
+	key, _ := t.Next(lua.LNil)
+	switch {
+	case explicit:
+	case key == lua.LNil:
+		if isEmptyObject(t) {
+			return map[string]interface{}{}, nil
+		}
+		return []interface{}{}, nil
+	case key.Type() == lua.LTNumber:
+		n = t.Len()
+	case key.Type() == lua.LTString:
+		obj := make(map[string]interface{})
+		var err error
+		t.ForEach(func(key, value lua.LValue) {
+			if err != nil {
+				return
+			}
+			k, ok := key.(lua.LString)
+			if !ok {
+				err = errInvalidKeys
+				return
+			}
+			obj[string(k)], err = fromLValue(value, visited)
+		})
+		return obj, err
+	default:
+		return nil, errInvalidKeys
+	}
+
+	// Check the keys as Encode does: explicit lengths allow missing elements.
+	count := 0
+	var keyErr error
+	t.ForEach(func(key, _ lua.LValue) {
+		if field && key == lua.LString("n") {
+			return
+		}
+		k, ok := key.(lua.LNumber)
+		switch {
+		case !ok:
+			keyErr = errInvalidKeys
+		case k < 1 || k != lua.LNumber(int(k)) || (explicit && k > lua.LNumber(n)):
+			keyErr = errInvalidKeys
+		}
+		count++
+	})
+	if keyErr != nil {
+		return nil, keyErr
+	}
+	if !explicit && count != n {
+		return nil, errSparseArray
+	}
+	arr := make([]interface{}, n)
+	for i := range arr {
+		elem, err := fromLValue(t.RawGetInt(i+1), visited)
+		if err != nil {
+			return nil, err
+		}
+		arr[i] = elem
+	}
+	return arr, nil
+}
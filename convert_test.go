@@ -0,0 +1,121 @@
+package json
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/yuin/gopher-lua"
+)
+
+type convertedItem struct {
+	Name    string            `json:"name"`
+	Count   uint8             `json:"count,omitempty"`
+	Labels  map[int]string    `json:"labels"`
+	When    time.Time         `json:"when"`
+	Data    []byte            `json:"data"`
+	Missing []string          `json:"missing"`
+	Nested  *convertedItem    `json:"nested,omitempty"`
+	Attrs   map[string]string `json:"-"`
+	Ratio   float32
+}
+
+func TestToLValue(t *testing.T) {
+	s := lua.NewState()
+	defer s.Close()
+
+	values := []interface{}{
+		nil,
+		true,
+		"s",
+		42,
+		int64(-7),
+		3.5,
+		json.Number("12"),
+		[]int{1, 2},
+		[2]string{"a", "b"},
+		map[string]interface{}{"a": []interface{}{1.0, nil}},
+		&convertedItem{
+			Name:   "x",
+			Labels: map[int]string{1: "one"},
+			When:   time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC),
+			Data:   []byte("hi"),
+			Nested: &convertedItem{Name: "y", Count: 2},
+			Ratio:  0.5,
+		},
+	}
+	for _, v := range values {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := Decode(s, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := ToLValue(s, v); !deepEqual(expected, actual) {
+			encoded, _ := Encode(actual)
+			t.Fatalf("%#v: expecting %s, got %s", v, data, encoded)
+		}
+	}
+	if ToLValue(s, make(chan int)) != lua.LNil {
+		t.Fatal("expecting nil for a channel")
+	}
+	tbl := s.NewTable()
+	if ToLValue(s, tbl) != tbl {
+		t.Fatal("Lua values should be returned as they are")
+	}
+	if v := ToLValue(s, map[string]interface{}{"t": tbl}).(*lua.LTable); v.RawGetString("t") != tbl {
+		t.Fatal("nested Lua values should be returned as they are")
+	}
+}
+
+func TestFromLValue(t *testing.T) {
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(`
+	local json = require("json")
+	doc = {name = "x", list = {1, "two", json.null, {}}, empty = json.object(), n3 = json.array({n = 2, "a"})}
+	sparse = {[1] = 1, [3] = 3}
+	mixed = {1, a = 2}
+	fn = {f = print}
+	cyclic = {}
+	cyclic.self = cyclic
+	`); err != nil {
+		t.Fatal(err)
+	}
+	v, err := FromLValue(s.GetGlobal("doc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"name":  "x",
+		"list":  []interface{}{1.0, "two", nil, []interface{}{}},
+		"empty": map[string]interface{}{},
+		"n3":    []interface{}{"a", nil},
+	}
+	if !reflect.DeepEqual(v, expected) {
+		t.Fatalf("expecting %#v, got %#v", expected, v)
+	}
+	for name, expected := range map[string]error{
+		"sparse": errSparseArray,
+		"mixed":  errInvalidKeys,
+		"fn":     invalidTypeError(lua.LTFunction),
+		"cyclic": errNested,
+	} {
+		if _, err := FromLValue(s.GetGlobal(name)); err != expected {
+			t.Errorf("%s: expecting %v, got %v", name, expected, err)
+		}
+	}
+
+	shared := s.NewTable()
+	twice := s.NewTable()
+	twice.Append(shared)
+	twice.Append(shared)
+	if _, err := FromLValue(twice); err != nil {
+		t.Errorf("shared tables: %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package json
+
+import (
+	"net/url"
+	"strconv"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// Cycles selects how tables that contain themselves are encoded.
+type Cycles int
+
+const (
+	// CyclesError fails the conversion. Tables found more than once, even
+	// outside of a cycle, fail it as well.
+	CyclesError Cycles = iota
+	// CyclesNull encodes null in place of a table found again within itself.
+	// Tables shared outside of a cycle are encoded each time.
+	CyclesNull
+	// CyclesRef encodes a JSON Reference, {"$ref": "#/pointer"}, to where the
+	// table was first found instead.
+	CyclesRef
+)
+
+var cyclesNames = map[string]Cycles{
+	"error": CyclesError,
+	"null":  CyclesNull,
+	"ref":   CyclesRef,
+}
+
+// WithCycles makes json.encode encode cyclic tables with policy, unless
+// scripts pass the cycles option.
+func WithCycles(policy Cycles) Option {
+	return func(c *config) {
+		c.encode.Cycles = policy
+	}
+}
+
+// pointer returns the JSON Pointer to p.
+func (p path) pointer() Pointer {
+	ptr := make(Pointer, len(p))
+	for i, e := range p {
+		if e.isIndex {
+			ptr[i] = strconv.Itoa(e.index)
+		} else {
+			ptr[i] = e.key
+		}
+	}
+	return ptr
+}
+
+// enter records t as being encoded, reporting false when it is already, as
+// one of the tables enclosing j.
+func (j jsonValue) enter(t *lua.LTable) bool {
+	if j.state.visited[t] {
+		return false
+	}
+	j.state.visited[t] = true
+	if j.state.opts.Cycles == CyclesRef {
+		if j.state.ancestors == nil {
+			j.state.ancestors = make(map[*lua.LTable]path)
+		}
+		j.state.ancestors[t] = j.path
+	}
+	return true
+}
+
+// leave forgets that t is being encoded, unless every table may only be
+// found once.
+func (j jsonValue) leave(t *lua.LTable) {
+	if j.state.opts.Cycles != CyclesError {
+		delete(j.state.visited, t)
+		delete(j.state.ancestors, t)
+	}
+}
+
+// marshalCycle encodes the table t, found again within itself, with the
+// Cycles option.
+func (j jsonValue) marshalCycle(t *lua.LTable) ([]byte, error) {
+	switch j.state.opts.Cycles {
+	case CyclesNull:
+		j.state.degrade(j.path, "cyclic table replaced by null")
+		return []byte(`null`), nil
+	case CyclesRef:
+		ref := "#" + (&url.URL{Fragment: j.state.ancestors[t].pointer().String()}).EscapedFragment()
+		data, err := marshalString(ref, nil)
+		return append(append([]byte(`{"$ref":`), data...), '}'), err
+	}
+	return nil, errNested
+}
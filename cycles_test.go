@@ -0,0 +1,63 @@
+package json
+
+import (
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestCycles(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local node = {name = "root", children = {}}
+	node.children[1] = {name = "child", parent = node}
+
+	local _, err = json.encode(node)
+	assert(err == "cannot encode recursively nested tables to JSON", err)
+
+	assert(json.encode(node, {cycles = "null"}) == '{"children":[{"name":"child","parent":null}],"name":"root"}')
+	assert(json.encode(node, {cycles = "ref"}) == '{"children":[{"name":"child","parent":{"$ref":"#"}}],"name":"root"}')
+
+	local loop = {}
+	loop.self = loop
+	assert(json.encode({a = {["b c"] = loop}}, {cycles = "ref"}) == '{"a":{"b c":{"self":{"$ref":"#/a/b%20c"}}}}')
+
+	local shared = {1}
+	_, err = json.encode({shared, shared})
+	assert(err == "cannot encode recursively nested tables to JSON", err)
+	assert(json.encode({shared, shared}, {cycles = "null"}) == "[[1],[1]]")
+	assert(json.encode({shared, shared}, {cycles = "ref"}) == "[[1],[1]]")
+
+	assert(not pcall(json.encode, node, {cycles = "skip"}))
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWithCycles(t *testing.T) {
+	s := lua.NewState()
+	defer s.Close()
+
+	loop := s.NewTable()
+	loop.RawSetString("self", loop)
+	data, err := EncodeWithOptions(loop, &EncodeOptions{Cycles: CyclesNull})
+	if err != nil || string(data) != `{"self":null}` {
+		t.Errorf("got %s, %v", data, err)
+	}
+
+	const str = `
+	local json = require("json")
+	local t = {}
+	t[1] = t
+	assert(json.encode(t) == '[{"$ref":"#"}]')
+	`
+	Preload(s, WithCycles(CyclesRef))
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,61 @@
+package json
+
+import (
+	"fmt"
+	"time"
+)
+
+// deadlineInterval is the number of values encoded between two checks of
+// the Timeout option, so that reading the clock costs little.
+const deadlineInterval = 64
+
+// TimeoutError is returned when an encode runs longer than the Timeout of
+// its options.
+type TimeoutError struct {
+	Timeout time.Duration
+	// Values is the number of values encoded before the encode was aborted.
+	Values int
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("encode exceeded timeout of %v after %d values", e.Timeout, e.Values)
+}
+
+// WithEncodeDeadline aborts the json.encode calls of scripts, and the other
+// functions encoding Lua values, that run longer than d, so that pathological
+// data cannot stall hosts with a time budget, such as game servers running
+// scripts between frames. Scripts may shorten it with the timeout_ms option.
+func WithEncodeDeadline(d time.Duration) Option {
+	return func(c *config) {
+		c.encode.Timeout = d
+	}
+}
+
+// encodeTimer checks the Timeout option of an encode.
+type encodeTimer struct {
+	timeout  time.Duration
+	deadline time.Time
+	values   int
+}
+
+// newEncodeTimer returns the timer of an encode starting now, or nil when
+// opts sets no Timeout.
+func newEncodeTimer(opts *EncodeOptions) *encodeTimer {
+	if opts.Timeout <= 0 {
+		return nil
+	}
+	return &encodeTimer{timeout: opts.Timeout, deadline: time.Now().Add(opts.Timeout)}
+}
+
+// tick counts a value about to be encoded, and fails once the deadline has
+// passed.
+func (t *encodeTimer) tick() error {
+	if t == nil {
+		return nil
+	}
+	t.values++
+	if t.values%deadlineInterval == 0 && time.Now().After(t.deadline) {
+		return &TimeoutError{Timeout: t.timeout, Values: t.values - 1}
+	}
+	return nil
+}
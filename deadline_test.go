@@ -0,0 +1,58 @@
+package json
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestEncodeDeadline(t *testing.T) {
+	s := lua.NewState()
+	defer s.Close()
+
+	arr := s.NewTable()
+	for i := 0; i < 1000; i++ {
+		arr.Append(lua.LNumber(i))
+	}
+	for _, opts := range []*EncodeOptions{
+		{Timeout: time.Nanosecond},
+		{Timeout: time.Nanosecond, WarnUnsafeInts: true, Report: &Report{}},
+	} {
+		_, err := EncodeWithOptions(arr, opts)
+		var te *TimeoutError
+		if !errors.As(err, &te) || te.Values != deadlineInterval-1 {
+			t.Errorf("got %v", err)
+		}
+	}
+	if _, err := EncodeWithOptions(arr, &EncodeOptions{Timeout: time.Minute}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEncodeDeadlineLua(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local big = {}
+	for i = 1, 1000 do big[i] = {i} end
+	local _, err = json.encode(big, {timeout_ms = 60000})
+	assert(err == "encode exceeded timeout of 1ns after 63 values", err)
+	assert(json.encode({1, 2}) == "[1,2]")
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s, WithEncodeDeadline(time.Nanosecond))
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+
+	s2 := lua.NewState()
+	defer s2.Close()
+
+	Preload(s2)
+	if err := s2.DoString(`assert(require("json").encode({1}, {timeout_ms = 1000}) == "[1]")`); err != nil {
+		t.Error(err)
+	}
+}
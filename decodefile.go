@@ -0,0 +1,122 @@
+package json
+
+import (
+	"bufio"
+	"io"
+	"os"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// DecodeFile decodes the JSON document in the file at path with the given
+// options, without first loading the file into a Lua string.
+//
+// Files larger than the fast path threshold are decoded as they are read, so
+// that only the resulting Lua value, and not the document itself, has to fit
+// in memory. The MaxBytes option is checked against the size of the file
+// before any of it is read.
+func DecodeFile(L *lua.LState, path string, opts *DecodeOptions) (lua.LValue, error) {
+	if opts == nil {
+		opts = &DecodeOptions{}
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	if opts.MaxBytes > 0 && size > int64(opts.MaxBytes) {
+		return nil, limitHandler(opts.OnLimit).fail("max_bytes", nil, int(size), opts.MaxBytes)
+	}
+	threshold := opts.FastPathThreshold
+	if threshold == 0 {
+		threshold = defaultFastPathThreshold
+	}
+	if size <= int64(threshold) {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return nil, err
+		}
+		return DecodeWithOptions(L, data, opts)
+	}
+	return DecodeReader(L, f, opts)
+}
+
+// DecodeReader decodes the JSON document read from r with the given options,
+// as it is read, so that only the resulting Lua value, and not the document
+// itself, has to fit in memory. Documents using a Grammar other than the
+// default are read in full before being decoded.
+func DecodeReader(L *lua.LState, r io.Reader, opts *DecodeOptions) (lua.LValue, error) {
+	if opts == nil {
+		opts = &DecodeOptions{}
+	}
+	if opts.MaxBytes > 0 {
+		r = &maxBytesReader{r: r, max: opts.MaxBytes, onLimit: opts.OnLimit}
+	}
+	// Only the fast path implements the grammars other than the default, and
+	// it needs the whole document.
+	if opts.Grammar != GrammarECMA404 {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		return DecodeWithOptions(L, data, opts)
+	}
+	d := newDecoder(L, opts)
+	if err := d.compile(); err != nil {
+		return nil, err
+	}
+	t := newTokenDecoder(d, bufio.NewReaderSize(r, 64<<10))
+	value, err := t.read(nil)
+	if err == nil {
+		err = t.finish()
+	}
+	if err == nil && d.err != nil {
+		err = d.err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// maxBytesReader fails with the max_bytes limit once more than max bytes
+// have been read from r.
+type maxBytesReader struct {
+	r       io.Reader
+	n, max  int
+	onLimit func(*LimitError)
+	err     error
+}
+
+func (m *maxBytesReader) Read(p []byte) (int, error) {
+	if m.err != nil {
+		return 0, m.err
+	}
+	n, err := m.r.Read(p)
+	if m.n += n; m.n > m.max {
+		m.err = limitHandler(m.onLimit).fail("max_bytes", nil, m.n, m.max)
+		return 0, m.err
+	}
+	return n, err
+}
+
+// apiDecodeFile decodes the JSON document read from a file opened by the io
+// library, a userdata wrapping an io.Reader or any value with a read method.
+func (m *module) apiDecodeFile(L *lua.LState) int {
+	if L.Get(1).Type() == lua.LTString {
+		L.ArgError(1, "file expected, got string")
+	}
+	r := checkReader(L, 1)
+	opts, lopts := checkDecodeOptions(L, 2, m.decode)
+	value, err := DecodeReader(L, r, &opts)
+	if err != nil {
+		return pushDecodeError(L, nil, err, lopts.bool("error_object", m.errorObjects))
+	}
+	L.Push(value)
+	return 1 + pushReport(L, opts.Report)
+}
@@ -0,0 +1,121 @@
+package json
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestDecodeFile(t *testing.T) {
+	s := lua.NewState()
+	defer s.Close()
+
+	dir := t.TempDir()
+	name := filepath.Join(dir, "doc.json")
+	doc := `{"items": [` + strings.Repeat(`{"id": 1, "tags": ["a", "b"]},`, 1000) + `{"id": 2}]}`
+	if err := os.WriteFile(name, []byte(doc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, opts := range []*DecodeOptions{nil, {FastPathThreshold: -1}} {
+		value, err := DecodeFile(s, name, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		items := s.GetField(value, "items").(*lua.LTable)
+		if items.Len() != 1001 || s.GetField(items.RawGetInt(1001), "id") != lua.LNumber(2) {
+			t.Errorf("unexpected value %v", value)
+		}
+	}
+
+	var limit *LimitError
+	if _, err := DecodeFile(s, name, &DecodeOptions{MaxBytes: 100}); !errors.As(err, &limit) {
+		t.Errorf("got %v, want a limit error", err)
+	}
+	if err := os.WriteFile(name, []byte(doc+"}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeFile(s, name, nil); err == nil {
+		t.Error("expected an error for trailing data")
+	}
+	if _, err := DecodeFile(s, filepath.Join(dir, "missing.json"), nil); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("got %v, want a missing file error", err)
+	}
+}
+
+func TestDecodeReader(t *testing.T) {
+	s := lua.NewState()
+	defer s.Close()
+
+	doc := `[` + strings.Repeat(`{"a": 1},`, 10000) + `2]`
+	value, err := DecodeReader(s, strings.NewReader(doc), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if arr := value.(*lua.LTable); arr.Len() != 10001 || arr.RawGetInt(10001) != lua.LNumber(2) {
+		t.Errorf("unexpected value of length %d", arr.Len())
+	}
+	value, err = DecodeReader(s, strings.NewReader(`{a: 1,}`), &DecodeOptions{Grammar: GrammarJSON5})
+	if err != nil || s.GetField(value, "a") != lua.LNumber(1) {
+		t.Errorf("got %v, %v", value, err)
+	}
+
+	var limits int
+	opts := &DecodeOptions{MaxBytes: 1000, OnLimit: func(*LimitError) { limits++ }}
+	var limit *LimitError
+	if _, err := DecodeReader(s, strings.NewReader(doc), opts); !errors.As(err, &limit) || limit.Limit != "max_bytes" {
+		t.Errorf("got %v, want a limit error", err)
+	}
+	if limits != 1 {
+		t.Errorf("limit handler called %d times", limits)
+	}
+}
+
+func TestDecodeFileLua(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local f = assert(io.open(path))
+	local doc = assert(json.decode_file(f, {keep_nulls = true}))
+	f:close()
+	assert(#doc.items == 500 and doc.items[500].id == 500 and doc.last == json.null)
+
+	f = assert(io.open(path))
+	local _, err = json.decode_file(f, {max_bytes = 100})
+	f:close()
+	assert(string.find(err, "max_bytes"), err)
+
+	local chunks = {'{"a": ', '[1, 2', ']}'}
+	local reader = {read = function(self, n) return table.remove(chunks, 1) end}
+	assert(json.decode_file(reader).a[2] == 2)
+
+	_, err = json.decode_file({read = function() return "[1," end})
+	assert(err ~= nil)
+	assert(not pcall(json.decode_file, "[1]"))
+	`
+	var b strings.Builder
+	b.WriteString(`{"items": [`)
+	for i := 1; i <= 500; i++ {
+		if i > 1 {
+			b.WriteByte(',')
+		}
+		b.WriteString(`{"id": ` + strconv.Itoa(i) + `}`)
+	}
+	b.WriteString(`], "last": null}`)
+	name := filepath.Join(t.TempDir(), "doc.json")
+	if err := os.WriteFile(name, []byte(b.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := lua.NewState()
+	defer s.Close()
+
+	s.SetGlobal("path", lua.LString(name))
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,129 @@
+package json
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// destructure returns the top-level members of doc with the given keys, or
+// nil for those that are missing.
+func destructure(doc lua.LValue, keys []string) ([]lua.LValue, error) {
+	values := make([]lua.LValue, len(keys))
+	switch doc := doc.(type) {
+	case *lua.LTable:
+		if n, array := isArray(doc); array && n > 0 {
+			return nil, errors.New("expected object, got array")
+		}
+		for i, key := range keys {
+			values[i] = doc.RawGetString(key)
+		}
+	case *lua.LUserData:
+		o, ok := doc.Value.(*Object)
+		if !ok {
+			return nil, errors.New("expected object, got userdata")
+		}
+		for i, key := range keys {
+			values[i], _ = o.Get(key)
+		}
+	default:
+		return nil, fmt.Errorf("expected object, got %s", doc.Type())
+	}
+	return values, nil
+}
+
+// decodeMembers decodes the JSON object str as a projection on the
+// top-level members with the given keys, so that the rest is skipped.
+func (m *module) decodeMembers(L *lua.LState, str lua.LString, keys []string) (lua.LValue, error) {
+	data := []byte(str)
+	if kind := peekKind(data); kind != "object" {
+		return nil, fmt.Errorf("expected object at offset 0, got %s", kind)
+	}
+	patterns := make([]pathPattern, len(keys))
+	for i, key := range keys {
+		patterns[i] = pathPattern{{pathElem: pathElem{key: key}}}
+	}
+	return decodeProjection(newDecoder(L, &m.decode), data, patterns)
+}
+
+func (m *module) apiDestructure(L *lua.LState) int {
+	doc := L.CheckAny(1)
+	keys := make([]string, L.GetTop()-1)
+	for i := range keys {
+		keys[i] = L.CheckString(i + 2)
+	}
+
+	if str, ok := doc.(lua.LString); ok {
+		value, err := m.decodeMembers(L, str, keys)
+		if err != nil {
+			L.RaiseError("%s", err.Error())
+		}
+		doc = value
+	}
+	values, err := destructure(doc, keys)
+	if err != nil {
+		L.ArgError(1, err.Error())
+	}
+	for _, v := range values {
+		L.Push(v)
+	}
+	return len(values)
+}
+
+// pick returns a new table holding the members of doc with the keys of
+// defaults. Missing and null members take a copy of their default, and the
+// others must have the same JSON type. A json.null default accepts any
+// value.
+func pick(L *lua.LState, doc lua.LValue, defaults *lua.LTable) (*lua.LTable, error) {
+	keys := sortedKeys(defaults)
+	values, err := destructure(doc, keys)
+	if err != nil {
+		return nil, err
+	}
+	result := L.CreateTable(0, len(keys))
+	for i, key := range keys {
+		def, v := defaults.RawGetString(key), values[i]
+		switch {
+		case v == lua.LNil || v == Null:
+			v = clone(L, def)
+		case def != Null && !sameJSONType(def, v):
+			return nil, fmt.Errorf("%s: expected %s, got %s", path{}.child(key), jsonType(def), jsonType(v))
+		}
+		result.RawSetString(key, v)
+	}
+	return result, nil
+}
+
+// sameJSONType reports whether x and y have the same JSON type. An empty
+// table is both an array and an object.
+func sameJSONType(x, y lua.LValue) bool {
+	tx, ty := jsonType(x), jsonType(y)
+	if tx == ty {
+		return true
+	}
+	return (isEmptyTable(x) && ty == "object") || (isEmptyTable(y) && tx == "object")
+}
+
+func (m *module) apiPick(L *lua.LState) int {
+	doc := L.CheckAny(1)
+	defaults := L.CheckTable(2)
+
+	if str, ok := doc.(lua.LString); ok {
+		value, err := m.decodeMembers(L, str, sortedKeys(defaults))
+		if err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+		doc = value
+	}
+	result, err := pick(L, doc, defaults)
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	L.Push(result)
+	return 1
+}
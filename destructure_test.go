@@ -0,0 +1,69 @@
+package json
+
+import (
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestDestructureLua(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local id, name, items = json.destructure('{"id":7,"name":"x","items":[1,2],"other":{"deep":true}}', "id", "name", "items")
+	assert(id == 7 and name == "x" and #items == 2)
+
+	local a, missing, b = json.destructure({a = 1, b = 2}, "a", "missing", "b")
+	assert(a == 1 and missing == nil and b == 2)
+	assert(select("#", json.destructure({}, "a", "b")) == 2)
+	assert(select("#", json.destructure('{"a":1}')) == 0)
+
+	local obj = json.decode('{"k":"v"}', {objects = "userdata"})
+	assert(type(obj) == "userdata")
+	assert(json.destructure(obj, "k") == "v")
+
+	local ok, err = pcall(json.destructure, "[1,2]", "a")
+	assert(not ok and string.find(err, "expected object at offset 0, got array"))
+	local ok, err = pcall(json.destructure, '{"a":', "a")
+	assert(not ok)
+	local ok, err = pcall(json.destructure, {1, 2}, "a")
+	assert(not ok and string.find(err, "expected object, got array"))
+	assert(not pcall(json.destructure, 1, "a"))
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPickLua(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local defaults = {id = 0, name = "", tags = {}, meta = json.null}
+	local doc = json.pick('{"id":3,"tags":["a"],"extra":true,"meta":{"x":1}}', defaults)
+	assert(doc.id == 3 and doc.name == "" and doc.tags[1] == "a" and doc.meta.x == 1 and doc.extra == nil)
+
+	local doc = json.pick({name = "n", tags = {k = "v"}}, defaults)
+	assert(doc.id == 0 and doc.name == "n" and doc.tags.k == "v" and doc.meta == json.null)
+	local doc = json.pick({id = json.null}, defaults)
+	assert(doc.id == 0 and doc.tags ~= defaults.tags)
+
+	local doc, err = json.pick({id = "3"}, defaults)
+	assert(doc == nil and err == "$.id: expected number, got string")
+	local doc, err = json.pick('{"tags":"a"}', defaults)
+	assert(doc == nil and err == "$.tags: expected array, got string")
+	local doc, err = json.pick("[]", defaults)
+	assert(doc == nil and string.find(err, "expected object"))
+	local doc, err = json.pick({1}, defaults)
+	assert(doc == nil and err == "expected object, got array")
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,478 @@
+package json
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// differ computes an RFC 6902 patch transforming a Lua document into
+// another.
+type differ struct {
+	L *lua.LState
+	diffOptions
+
+	// sources are the subtrees of the source document that are left in
+	// place, under objects only, so that their pointers remain valid
+	// for the whole patch.
+	sources []diffSource
+
+	ops []patchOp
+}
+
+// diffOptions are the options of patch_diff.
+type diffOptions struct {
+	// moves makes the differ emit move and copy operations for subtrees
+	// found elsewhere in the source document rather than adding them anew.
+	moves bool
+
+	// lcs makes the differ align arrays on their longest common
+	// subsequence, matching elements by deep equality or, when arrayKey is
+	// set, by the value of that member.
+	lcs      bool
+	arrayKey string
+}
+
+type diffSource struct {
+	path  Pointer
+	value *lua.LTable
+}
+
+// diffPatch returns the patch transforming a into b.
+func diffPatch(L *lua.LState, a, b lua.LValue, opts diffOptions) []patchOp {
+	d := &differ{L: L, diffOptions: opts}
+	if !opts.moves {
+		d.diff(Pointer{}, a, b)
+		return d.ops
+	}
+	d.findSources(Pointer{}, a, b)
+	d.diff(Pointer{}, a, b)
+	d.pairMoves()
+	// The patch is checked as a precaution: the plain diff is always
+	// correct.
+	if patched, err := applyPatch(L, a, d.ops); err != nil || !deepEqual(patched, b) {
+		opts.moves = false
+		return diffPatch(L, a, b, opts)
+	}
+	return d.ops
+}
+
+func (p Pointer) child(token string) Pointer {
+	return append(p[:len(p):len(p)], token)
+}
+
+func (p Pointer) elem(i int) Pointer {
+	return p.child(strconv.Itoa(i))
+}
+
+// nonEmpty returns v if it is a table with contents.
+func nonEmpty(v lua.LValue) (*lua.LTable, bool) {
+	t, ok := v.(*lua.LTable)
+	if !ok {
+		return nil, false
+	}
+	key, _ := t.Next(lua.LNil)
+	return t, key != lua.LNil
+}
+
+// isObject reports whether v is a table holding an object.
+func isObject(v lua.LValue) (*lua.LTable, bool) {
+	t, ok := v.(*lua.LTable)
+	if !ok {
+		return nil, false
+	}
+	_, array := isArray(t)
+	return t, !array
+}
+
+func sortedKeys(tables ...*lua.LTable) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, t := range tables {
+		t.ForEach(func(key, _ lua.LValue) {
+			if k := lua.LVAsString(key); !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		})
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (d *differ) findSources(p Pointer, a, b lua.LValue) {
+	ta, ok := isObject(a)
+	if !ok {
+		return
+	}
+	tb, ok := isObject(b)
+	if !ok {
+		return
+	}
+	for _, key := range sortedKeys(ta) {
+		av, bv := ta.RawGetString(key), tb.RawGetString(key)
+		if t, ok := nonEmpty(av); ok && deepEqual(av, bv) {
+			d.sources = append(d.sources, diffSource{path: p.child(key), value: t})
+		} else {
+			d.findSources(p.child(key), av, bv)
+		}
+	}
+}
+
+func (d *differ) diff(p Pointer, a, b lua.LValue) {
+	if deepEqual(a, b) {
+		return
+	}
+	ta, okA := a.(*lua.LTable)
+	tb, okB := b.(*lua.LTable)
+	if okA && okB {
+		na, arrayA := isArray(ta)
+		nb, arrayB := isArray(tb)
+		switch {
+		case arrayA && arrayB:
+			d.diffArrays(p, ta, na, tb, nb)
+			return
+		case !(arrayA && na > 0) && !(arrayB && nb > 0):
+			// An empty table is an empty object as well.
+			d.diffObjects(p, ta, tb)
+			return
+		}
+	}
+	d.ops = append(d.ops, patchOp{op: "replace", path: p, value: clone(d.L, b)})
+}
+
+func (d *differ) diffObjects(p Pointer, a, b *lua.LTable) {
+	for _, key := range sortedKeys(a, b) {
+		av, bv := a.RawGetString(key), b.RawGetString(key)
+		switch {
+		case bv == lua.LNil:
+			d.remove(p.child(key), av)
+		case av == lua.LNil:
+			d.add(p.child(key), bv)
+		default:
+			d.diff(p.child(key), av, bv)
+		}
+	}
+}
+
+func (d *differ) diffArrays(p Pointer, a *lua.LTable, na int, b *lua.LTable, nb int) {
+	switch {
+	case d.lcs:
+		d.diffArrayLCS(p, a, na, b, nb)
+		return
+	case d.moves:
+		d.diffArrayMoves(p, a, na, b, nb)
+		return
+	}
+	for i := 0; i < na && i < nb; i++ {
+		d.diff(p.elem(i), a.RawGetInt(i+1), b.RawGetInt(i+1))
+	}
+	for i := na - 1; i >= nb; i-- {
+		d.remove(p.elem(i), a.RawGetInt(i+1))
+	}
+	for i := na; i < nb; i++ {
+		d.add(p.elem(i), b.RawGetInt(i+1))
+	}
+}
+
+// diffArrayMoves brings the elements of a into the order of b, moving the
+// elements found further in the array rather than changing those in the
+// way.
+func (d *differ) diffArrayMoves(p Pointer, a *lua.LTable, na int, b *lua.LTable, nb int) {
+	cur := make([]lua.LValue, na)
+	for i := range cur {
+		cur[i] = a.RawGetInt(i + 1)
+	}
+	for i := 0; i < nb; i++ {
+		want := b.RawGetInt(i + 1)
+		if i < len(cur) && deepEqual(cur[i], want) {
+			continue
+		}
+		if j := indexOf(cur, want, i+1); j >= 0 {
+			d.ops = append(d.ops, patchOp{op: "move", from: p.elem(j), path: p.elem(i)})
+			v := cur[j]
+			copy(cur[i+1:j+1], cur[i:j])
+			cur[i] = v
+			continue
+		}
+		if i < len(cur) && !containsElem(b, cur[i], i+2, nb) {
+			d.diff(p.elem(i), cur[i], want)
+			cur[i] = want
+			continue
+		}
+		d.add(p.elem(i), want)
+		cur = append(cur, nil)
+		copy(cur[i+1:], cur[i:])
+		cur[i] = want
+	}
+	for i := len(cur) - 1; i >= nb; i-- {
+		d.remove(p.elem(i), cur[i])
+	}
+}
+
+// maxLCSCells bounds the table of the longest common subsequence of two
+// arrays; the elements of larger arrays are compared index by index.
+const maxLCSCells = 1 << 22
+
+// diffArrayLCS keeps the longest common subsequence of a and b in place,
+// removing and adding the other elements around it.
+func (d *differ) diffArrayLCS(p Pointer, a *lua.LTable, na int, b *lua.LTable, nb int) {
+	// The common prefix and suffix are kept without a table.
+	pre := 0
+	for pre < na && pre < nb && d.sameElem(a.RawGetInt(pre+1), b.RawGetInt(pre+1)) {
+		d.diff(p.elem(pre), a.RawGetInt(pre+1), b.RawGetInt(pre+1))
+		pre++
+	}
+	suf := 0
+	for suf < na-pre && suf < nb-pre && d.sameElem(a.RawGetInt(na-suf), b.RawGetInt(nb-suf)) {
+		suf++
+	}
+	if m, n := na-pre-suf, nb-pre-suf; m*n <= maxLCSCells {
+		d.diffLCS(p, a, b, pre, m, n)
+	} else {
+		for i := pre; i < pre+m && i < pre+n; i++ {
+			d.diff(p.elem(i), a.RawGetInt(i+1), b.RawGetInt(i+1))
+		}
+		for i := pre + m - 1; i >= pre+n; i-- {
+			d.remove(p.elem(i), a.RawGetInt(i+1))
+		}
+		for i := pre + m; i < pre+n; i++ {
+			d.add(p.elem(i), b.RawGetInt(i+1))
+		}
+	}
+	for i := 0; i < suf; i++ {
+		d.diff(p.elem(nb-suf+i), a.RawGetInt(na-suf+i+1), b.RawGetInt(nb-suf+i+1))
+	}
+}
+
+// diffLCS aligns the m elements of a and the n elements of b that follow
+// their common prefix of pre elements on their longest common subsequence.
+func (d *differ) diffLCS(p Pointer, a, b *lua.LTable, pre, m, n int) {
+	x := func(i int) lua.LValue { return a.RawGetInt(pre + i + 1) }
+	y := func(j int) lua.LValue { return b.RawGetInt(pre + j + 1) }
+	// lcs[i][j] is the length of the longest common subsequence of the
+	// elements of x from i and those of y from j.
+	lcs := make([][]int, m+1)
+	for i := range lcs {
+		lcs[i] = make([]int, n+1)
+	}
+	for i := m - 1; i >= 0; i-- {
+		for j := n - 1; j >= 0; j-- {
+			switch {
+			case d.sameElem(x(i), y(j)):
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	// k is the index in the array being patched.
+	for i, j, k := 0, 0, pre; i < m || j < n; {
+		switch {
+		case i < m && j < n && d.sameElem(x(i), y(j)):
+			d.diff(p.elem(k), x(i), y(j))
+			i, j, k = i+1, j+1, k+1
+		case i < m && (j == n || lcs[i+1][j] >= lcs[i][j+1]):
+			d.remove(p.elem(k), x(i))
+			i++
+		default:
+			d.add(p.elem(k), y(j))
+			j, k = j+1, k+1
+		}
+	}
+}
+
+// sameElem reports whether x and y are the same array element: equal, or
+// objects with equal values for arrayKey.
+func (d *differ) sameElem(x, y lua.LValue) bool {
+	if d.arrayKey != "" {
+		tx, okX := isObject(x)
+		ty, okY := isObject(y)
+		if okX && okY {
+			kx, ky := tx.RawGetString(d.arrayKey), ty.RawGetString(d.arrayKey)
+			if kx != lua.LNil && ky != lua.LNil {
+				return deepEqual(kx, ky)
+			}
+		}
+	}
+	return deepEqual(x, y)
+}
+
+// indexOf returns the index of the first element of values from start equal
+// to v, or -1.
+func indexOf(values []lua.LValue, v lua.LValue, start int) int {
+	for i := start; i < len(values); i++ {
+		if deepEqual(values[i], v) {
+			return i
+		}
+	}
+	return -1
+}
+
+// containsElem reports whether the element of t at one of the positions
+// from i to n is equal to v.
+func containsElem(t *lua.LTable, v lua.LValue, i, n int) bool {
+	for ; i <= n; i++ {
+		if deepEqual(t.RawGetInt(i), v) {
+			return true
+		}
+	}
+	return false
+}
+
+// remove emits the removal of old, recorded in the operation for
+// pairMoves, at p.
+func (d *differ) remove(p Pointer, old lua.LValue) {
+	d.ops = append(d.ops, patchOp{op: "remove", path: p, value: old})
+}
+
+func (d *differ) add(p Pointer, v lua.LValue) {
+	if t, ok := nonEmpty(v); ok && d.moves {
+		for _, source := range d.sources {
+			if deepEqual(source.value, t) {
+				d.ops = append(d.ops, patchOp{op: "copy", from: source.path, path: p})
+				return
+			}
+		}
+	}
+	d.ops = append(d.ops, patchOp{op: "add", path: p, value: clone(d.L, v)})
+}
+
+// pairMoves replaces the removal of a subtree and its addition elsewhere by
+// a move. Removed subtrees are indexed by their canonical encoding, so that
+// each addition finds its removal with a single lookup; the resulting patch
+// is checked once by diffPatch.
+func (d *differ) pairMoves() {
+	removed := make(map[string][]int)
+	for r, op := range d.ops {
+		if op.op != "remove" {
+			continue
+		}
+		if key, ok := d.subtreeKey(op.value); ok {
+			removed[key] = append(removed[key], r)
+		}
+	}
+	if len(removed) == 0 {
+		return
+	}
+	dropped := make([]bool, len(d.ops))
+	for k, add := range d.ops {
+		if add.op != "add" {
+			continue
+		}
+		key, ok := d.subtreeKey(add.value)
+		if !ok {
+			continue
+		}
+		candidates := removed[key]
+		for i, r := range candidates {
+			at, ok := d.movePosition(r, k, dropped)
+			if !ok {
+				continue
+			}
+			move := patchOp{op: "move", from: d.ops[r].path, path: add.path}
+			d.ops[r], d.ops[k] = move, move
+			dropped[r+k-at] = true
+			removed[key] = append(candidates[:i:i], candidates[i+1:]...)
+			break
+		}
+	}
+	ops := d.ops[:0]
+	for i, op := range d.ops {
+		if !dropped[i] {
+			ops = append(ops, op)
+		}
+	}
+	d.ops = ops
+}
+
+// subtreeKey returns the canonical encoding of v if it is a table with
+// contents, which may be moved rather than removed and added.
+func (d *differ) subtreeKey(v lua.LValue) (string, bool) {
+	if _, ok := nonEmpty(v); !ok {
+		return "", false
+	}
+	data, err := EncodeWithOptions(canonicalize(d.L, v, nil, nil), &EncodeOptions{SortKeys: true})
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+// movePosition returns the position, r or k, at which a move can replace the
+// removal at r and the addition at k: that of the removal if the operations
+// in between leave the destination alone, or else that of the addition if
+// they leave the source alone.
+func (d *differ) movePosition(r, k int, dropped []bool) (int, bool) {
+	lo, hi := r, k
+	if lo > hi {
+		lo, hi = hi, lo
+	}
+	untouched := func(p Pointer) bool {
+		for i := lo + 1; i < hi; i++ {
+			if op := d.ops[i]; !dropped[i] && (interferes(op.path, p) || op.op == "move" && interferes(op.from, p)) {
+				return false
+			}
+		}
+		return true
+	}
+	switch {
+	case untouched(d.ops[k].path):
+		return r, true
+	case untouched(d.ops[r].path):
+		return k, true
+	}
+	return 0, false
+}
+
+// interferes reports whether an operation at q may change the value that p
+// points to, or its location: q is a prefix of p or the reverse, or q shifts
+// the array element that p goes through.
+func interferes(q, p Pointer) bool {
+	for i := 0; i < len(q) && i < len(p); i++ {
+		if q[i] != p[i] {
+			return (i == len(q)-1 || i == len(p)-1) && isIndexToken(q[i]) && isIndexToken(p[i])
+		}
+	}
+	return true
+}
+
+// isIndexToken reports whether token may be the index of an array element.
+func isIndexToken(token string) bool {
+	if token == "-" {
+		return true
+	}
+	for i := 0; i < len(token); i++ {
+		if token[i] < '0' || token[i] > '9' {
+			return false
+		}
+	}
+	return token != ""
+}
+
+func apiPatchDiff(L *lua.LState) int {
+	a := L.CheckAny(1)
+	b := L.CheckAny(2)
+	opts := checkOptions(L, 3)
+
+	do := diffOptions{
+		moves:    opts.bool("detect_moves", false),
+		arrayKey: opts.string("array_key", ""),
+	}
+	def := "index"
+	if do.arrayKey != "" {
+		def = "lcs"
+	}
+	switch arrays := opts.string("arrays", def); arrays {
+	case "index":
+	case "lcs":
+		do.lcs = true
+	default:
+		L.ArgError(3, "option 'arrays' must be \"index\" or \"lcs\"")
+	}
+	L.Push(patchTable(L, diffPatch(L, a, b, do)))
+	return 1
+}
@@ -0,0 +1,190 @@
+package json
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+var diffInputs = []struct {
+	a, b string
+}{
+	{`{"a":1}`, `{"a":1}`},
+	{`{"a":1,"b":2}`, `{"a":3,"c":4}`},
+	{`{"a":{"x":[1,2,3]}}`, `{"a":{"x":[1,4]}}`},
+	{`[1,2]`, `[1,2,3,4]`},
+	{`{"a":[]}`, `{"a":{"b":1}}`},
+	{`{"a":{"b":1}}`, `{"a":{}}`},
+	{`{"a":[1]}`, `{"a":"x"}`},
+	{`[1,2,3]`, `"x"`},
+	{`[{"id":1},{"id":2},{"id":3}]`, `[{"id":3},{"id":1},{"id":2}]`},
+	{`[{"id":1},{"id":2},{"id":3}]`, `[{"id":2},{"id":4},{"id":3},{"id":1}]`},
+	{`{"a":{"deep":{"x":1}},"b":{}}`, `{"a":{},"b":{"deep":{"x":1}}}`},
+	{`{"tmpl":{"x":[1,2]},"list":[]}`, `{"tmpl":{"x":[1,2]},"list":[{"x":[1,2]}]}`},
+	{`[[1,2],[3,4],[5]]`, `[[5],[1,2],[3,4],[1,2]]`},
+	{`{"a/b":{"~":1}}`, `{"a/b":{"~":2}}`},
+}
+
+func TestDiffPatch(t *testing.T) {
+	for _, opts := range []diffOptions{
+		{},
+		{moves: true},
+		{lcs: true},
+		{lcs: true, moves: true},
+		{lcs: true, arrayKey: "id"},
+	} {
+		for _, test := range diffInputs {
+			s := lua.NewState()
+			a, _ := Decode(s, []byte(test.a))
+			b, _ := Decode(s, []byte(test.b))
+			ops := diffPatch(s, a, b, opts)
+			patched, err := applyPatch(s, a, ops)
+			if err != nil {
+				t.Fatalf("%s -> %s: %v", test.a, test.b, err)
+			}
+			if !deepEqual(patched, b) {
+				data, _ := Encode(patched)
+				t.Fatalf("%s -> %s: got %s", test.a, test.b, data)
+			}
+			s.Close()
+		}
+	}
+}
+
+func TestDiffMoves(t *testing.T) {
+	tests := []struct {
+		a, b string
+		ops  []string
+	}{
+		{`[{"id":1},{"id":2},{"id":3}]`, `[{"id":3},{"id":1},{"id":2}]`, []string{"move /2 /0"}},
+		{`{"a":{"deep":{"x":1}},"b":{}}`, `{"a":{},"b":{"deep":{"x":1}}}`, []string{"move /a/deep /b/deep"}},
+		{`{"tmpl":{"x":[1,2]},"list":[]}`, `{"tmpl":{"x":[1,2]},"list":[{"x":[1,2]}]}`, []string{"copy /tmpl /list/0"}},
+		{`{"a":{"x":1},"b":{"y":2}}`, `{"c":{"y":2},"d":{"x":1}}`, []string{"move /a /d", "move /b /c"}},
+	}
+	for _, test := range tests {
+		s := lua.NewState()
+		a, _ := Decode(s, []byte(test.a))
+		b, _ := Decode(s, []byte(test.b))
+		ops := diffPatch(s, a, b, diffOptions{moves: true})
+		if len(ops) != len(test.ops) {
+			t.Fatalf("%s -> %s: expecting %d operations, got %d", test.a, test.b, len(test.ops), len(ops))
+		}
+		for i, op := range ops {
+			if got := op.op + " " + op.from.String() + " " + op.path.String(); got != test.ops[i] {
+				t.Fatalf("%s -> %s: expecting %s, got %s", test.a, test.b, test.ops[i], got)
+			}
+		}
+		s.Close()
+	}
+}
+
+func TestDiffManyMoves(t *testing.T) {
+	s := lua.NewState()
+	defer s.Close()
+
+	const n = 1000
+	a, b := s.NewTable(), s.NewTable()
+	for i := 0; i < n; i++ {
+		v := s.NewTable()
+		v.RawSetString("n", lua.LNumber(i))
+		a.RawSetString(fmt.Sprintf("old%d", i), v)
+		b.RawSetString(fmt.Sprintf("new%d", i), clone(s, v))
+	}
+	ops := diffPatch(s, a, b, diffOptions{moves: true})
+	if len(ops) != n {
+		t.Fatalf("expecting %d operations, got %d", n, len(ops))
+	}
+	for _, op := range ops {
+		if op.op != "move" {
+			t.Fatalf("expecting moves, got %s %s", op.op, op.path)
+		}
+	}
+}
+
+func TestDiffLCS(t *testing.T) {
+	tests := []struct {
+		a, b string
+		key  string
+		ops  []string
+	}{
+		{`[1,2,3,4]`, `[1,3,4,5]`, "", []string{"remove /1", "add /3"}},
+		{`[1,2,3]`, `[0,1,2,3]`, "", []string{"add /0"}},
+		{`["a","b","c"]`, `["c","a","b"]`, "", []string{"add /0", "remove /3"}},
+		{`[{"id":1,"v":1},{"id":2,"v":2}]`, `[{"id":2,"v":3}]`, "id", []string{"remove /0", "replace /0/v"}},
+		{`[{"id":1},{"id":2}]`, `[{"id":0},{"id":1},{"id":2,"x":true}]`, "id", []string{"add /0", "add /2/x"}},
+	}
+	for _, test := range tests {
+		s := lua.NewState()
+		a, _ := Decode(s, []byte(test.a))
+		b, _ := Decode(s, []byte(test.b))
+		ops := diffPatch(s, a, b, diffOptions{lcs: true, arrayKey: test.key})
+		if len(ops) != len(test.ops) {
+			t.Fatalf("%s -> %s: expecting %d operations, got %d", test.a, test.b, len(test.ops), len(ops))
+		}
+		for i, op := range ops {
+			if got := op.op + " " + op.path.String(); got != test.ops[i] {
+				t.Fatalf("%s -> %s: expecting %s, got %s", test.a, test.b, test.ops[i], got)
+			}
+		}
+		s.Close()
+	}
+}
+
+func TestDiffLargeArrays(t *testing.T) {
+	s := lua.NewState()
+	defer s.Close()
+
+	const n = 10000
+	a, b, c := s.CreateTable(n, 0), s.CreateTable(n+1, 0), s.CreateTable(n, 0)
+	for i := 1; i <= n; i++ {
+		a.Append(lua.LNumber(i))
+		b.Append(lua.LNumber(i))
+		if i == n/2 {
+			b.Append(lua.LString("x"))
+		}
+		c.Append(lua.LNumber(-i))
+	}
+	c.RawSetInt(1, lua.LNumber(1))
+	c.RawSetInt(n, lua.LNumber(n))
+	// The common prefix and suffix leave a single insertion to align.
+	if ops := diffPatch(s, a, b, diffOptions{lcs: true}); len(ops) != 1 || ops[0].op != "add" || ops[0].path.String() != "/5000" {
+		t.Fatalf("expecting a single addition, got %d operations", len(ops))
+	}
+	// Arrays too large to align are compared index by index.
+	ops := diffPatch(s, a, c, diffOptions{lcs: true})
+	if len(ops) != n-2 {
+		t.Fatalf("expecting %d operations, got %d", n-2, len(ops))
+	}
+	patched, err := applyPatch(s, a, ops)
+	if err != nil || !deepEqual(patched, c) {
+		t.Fatalf("patch does not transform the array: %v", err)
+	}
+}
+
+func TestPatchDiffLua(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local patch = json.patch_diff({a = 1, b = {1, 2}}, {a = 2, b = {1}, c = "x"})
+	assert(#patch == 3)
+	assert(patch[1].op == "replace" and patch[1].path == "/a" and patch[1].value == 2)
+	assert(patch[2].op == "remove" and patch[2].path == "/b/1" and patch[2].value == nil)
+	assert(patch[3].op == "add" and patch[3].path == "/c" and patch[3].value == "x")
+	assert(#json.patch_diff({a = {1}}, {a = {1}}) == 0)
+
+	local a = {{name = "x"}, {name = "y"}}
+	local patch = json.patch_diff(a, {a[2], a[1]}, {detect_moves = true})
+	assert(#patch == 1 and patch[1].op == "move" and patch[1].from == "/1" and patch[1].path == "/0")
+
+	local patch = json.patch_diff({{id = 1}, {id = 2, v = 1}}, {{id = 2, v = 2}}, {array_key = "id"})
+	assert(#patch == 2 and patch[1].op == "remove" and patch[2].path == "/0/v")
+	assert(not pcall(json.patch_diff, {}, {}, {arrays = "fuzzy"}))
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
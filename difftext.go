@@ -0,0 +1,195 @@
+package json
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// lineEdit is a line of a line diff: kept (' '), removed ('-') or added
+// ('+').
+type lineEdit struct {
+	kind byte
+	line string
+}
+
+// diffLines returns the shortest edit script turning the lines a into b,
+// found with the algorithm of Myers.
+func diffLines(a, b []string) []lineEdit {
+	n, m := len(a), len(b)
+	max := n + m
+	off := max + 1
+	v := make([]int, 2*max+3)
+	// trace[d] holds v[-d-1:d+2] before step d, as needed to backtrack.
+	var trace [][]int
+	d := 0
+search:
+	for ; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v[off-d-1:off+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[off+k-1] < v[off+k+1] {
+				x = v[off+k+1]
+			} else {
+				x = v[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	var edits []lineEdit
+	x, y := n, m
+	for ; d > 0; d-- {
+		prev := trace[d]
+		at := func(k int) int { return prev[k+d+1] }
+		k := x - y
+		prevK := k - 1
+		if k == -d || k != d && at(k-1) < at(k+1) {
+			prevK = k + 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			edits = append(edits, lineEdit{' ', a[x-1]})
+			x, y = x-1, y-1
+		}
+		if x == prevX {
+			edits = append(edits, lineEdit{'+', b[y-1]})
+			y--
+		} else {
+			edits = append(edits, lineEdit{'-', a[x-1]})
+			x--
+		}
+	}
+	for ; x > 0; x, y = x-1, y-1 {
+		edits = append(edits, lineEdit{' ', a[x-1]})
+	}
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
+
+// unifiedDiff formats edits as the hunks of a unified diff with context
+// lines around each change.
+func unifiedDiff(edits []lineEdit, context int) []string {
+	var lines []string
+	// aLine and bLine are the numbers of the lines of a and b before
+	// edits[i].
+	aLine, bLine := 0, 0
+	for i := 0; i < len(edits); {
+		if edits[i].kind == ' ' {
+			aLine, bLine, i = aLine+1, bLine+1, i+1
+			continue
+		}
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		end := i + 1
+		for j := i + 1; j < len(edits) && j-end <= 2*context; j++ {
+			if edits[j].kind != ' ' {
+				end = j + 1
+			}
+		}
+		stop := end + context
+		if stop > len(edits) {
+			stop = len(edits)
+		}
+		// Start from the numbers of the lines before the context.
+		aStart, bStart := aLine-(i-start), bLine-(i-start)
+		var aCount, bCount int
+		hunk := make([]string, 0, stop-start+1)
+		for _, e := range edits[start:stop] {
+			if e.kind != '+' {
+				aCount++
+			}
+			if e.kind != '-' {
+				bCount++
+			}
+			hunk = append(hunk, string(e.kind)+e.line)
+		}
+		lines = append(lines, fmt.Sprintf("@@ -%s +%s @@", hunkRange(aStart, aCount), hunkRange(bStart, bCount)))
+		lines = append(lines, hunk...)
+		aLine, bLine, i = aStart+aCount, bStart+bCount, stop
+	}
+	return lines
+}
+
+// hunkRange formats the range of a hunk, given the number of the line before
+// it and its length.
+func hunkRange(before, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	if count == 1 {
+		return fmt.Sprint(before + 1)
+	}
+	return fmt.Sprintf("%d,%d", before+1, count)
+}
+
+// prettyLines returns the lines of the indented canonical encoding of value.
+func prettyLines(L *lua.LState, value lua.LValue) ([]string, error) {
+	data, err := Encode(canonicalize(L, value, nil, nil))
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	if err := json.Indent(&b, data, "", "  "); err != nil {
+		return nil, err
+	}
+	return strings.Split(b.String(), "\n"), nil
+}
+
+// diffText returns the lines of a unified diff of the pretty-printed values,
+// or none if they are equal.
+func diffText(L *lua.LState, a, b lua.LValue, context int) ([]string, error) {
+	aLines, err := prettyLines(L, a)
+	if err != nil {
+		return nil, err
+	}
+	bLines, err := prettyLines(L, b)
+	if err != nil {
+		return nil, err
+	}
+	hunks := unifiedDiff(diffLines(aLines, bLines), context)
+	if len(hunks) == 0 {
+		return nil, nil
+	}
+	return append([]string{"--- a", "+++ b"}, hunks...), nil
+}
+
+func apiDiffText(L *lua.LState) int {
+	a := L.CheckAny(1)
+	b := L.CheckAny(2)
+	opts := checkOptions(L, 3)
+	maxLines := opts.int("max_lines", 0)
+
+	lines, err := diffText(L, a, b, opts.int("context", 3))
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	if maxLines > 0 && len(lines) > maxLines {
+		more := len(lines) - maxLines
+		lines = append(lines[:maxLines], fmt.Sprintf("... %d more lines", more))
+	}
+	var out strings.Builder
+	for _, line := range lines {
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	L.Push(lua.LString(out.String()))
+	return 1
+}
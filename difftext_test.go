@@ -0,0 +1,93 @@
+package json
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		a, b string
+	}{
+		{"", ""},
+		{"a", ""},
+		{"", "a b"},
+		{"a b c", "a b c"},
+		{"a b c d", "a x c d e"},
+		{"a b c a b b a", "c b a b a c"},
+		{"x y z", "p q"},
+	}
+	for _, test := range tests {
+		a, b := strings.Fields(test.a), strings.Fields(test.b)
+		var gotA, gotB []string
+		for _, e := range diffLines(a, b) {
+			if e.kind != '+' {
+				gotA = append(gotA, e.line)
+			}
+			if e.kind != '-' {
+				gotB = append(gotB, e.line)
+			}
+		}
+		if strings.Join(gotA, " ") != test.a || strings.Join(gotB, " ") != test.b {
+			t.Fatalf("%q -> %q: got %q -> %q", test.a, test.b, gotA, gotB)
+		}
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	a := strings.Fields("a b c d e f g h i j k")
+	b := strings.Fields("a B c d e f g h i k l")
+	expected := `@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -7,5 +7,5 @@
+ g
+ h
+ i
+-j
+ k
++l`
+	if got := strings.Join(unifiedDiff(diffLines(a, b), 3), "\n"); got != expected {
+		t.Fatalf("expecting\n%s\ngot\n%s", expected, got)
+	}
+	if got := strings.Join(unifiedDiff(diffLines([]string{"x", "y"}, []string{"y"}), 0), "\n"); got != "@@ -1 +0,0 @@\n-x" {
+		t.Fatalf("got\n%s", got)
+	}
+}
+
+func TestDiffTextLua(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local a = {name = "api", replicas = 2, ports = {80, 443}}
+	local b = {name = "api", replicas = 3, ports = {80, 443}}
+	assert(json.diff_text(a, a) == "")
+	assert(json.diff_text(a, b) == [[
+--- a
++++ b
+@@ -4,5 +4,5 @@
+     80,
+     443
+   ],
+-  "replicas": 2
++  "replicas": 3
+ }
+]])
+	assert(json.diff_text(a, b, {max_lines = 3}) == "--- a\n+++ b\n@@ -4,5 +4,5 @@\n... 6 more lines\n")
+	assert(json.diff_text(a, b, {context = 0}) == "--- a\n+++ b\n@@ -7 +7 @@\n-  \"replicas\": 2\n+  \"replicas\": 3\n")
+	local text, err = json.diff_text(a, {f = print})
+	assert(text == nil and err)
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
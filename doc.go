@@ -3,23 +3,584 @@
 // Documentation
 //
 // The following functions are exposed by the library:
-//  decode(string): Decodes a JSON string. Returns nil and an error string if
-//                  the string could not be decoded.
-//  encode(value):  Encodes a value into a JSON string. Returns nil and an error
+//  decode(string[, options]):
+//                  Decodes a JSON string. Returns nil and an error string if
+//                  the string could not be decoded, or an error object with
+//                  the option error_object (see try_decode).
+//  encode(value[, options]):
+//                  Encodes a value into a JSON string. Returns nil and an error
 //                  string if the value could not be encoded.
+//  stats(value):   Reports the size and complexity of a JSON string, or of the
+//                  encoding of any other value, as a table with the fields
+//                  objects, arrays, strings, numbers, booleans, nulls,
+//                  max_depth, longest_key and bytes.
+//  valid(string):  Returns whether the string is valid JSON, without decoding
+//                  it.
+//  typeof(string): Returns "object", "array", "string", "number", "bool" or
+//                  "null", the type of the JSON value in the string as told
+//                  by its first character, without checking the rest of the
+//                  string, or nil if no value starts there.
+//  object([table]), array([table]):
+//                  Marks table, or a new table, with a metatable whose
+//                  __jsontype field is "object" or "array", and returns it.
+//                  Empty tables marked as objects encode to {} instead of [].
+//                  Raises an error if table already has a metatable.
+//  int64(value):   Returns userdata holding the integer value, given as a
+//                  number or as a string of digits, as produced by the
+//                  big_ints decode option. Such userdata can be compared with
+//                  each other, concatenated and converted by tostring, and
+//                  encode to the exact integer.
+//  decode5(string[, options]):
+//                  Like decode, but the string is JSON5, as for hand-edited
+//                  configuration files (see the json5 grammar).
+//  decode_object(string[, options]), decode_array(string[, options]):
+//                  Like decode, but return nil and an error unless the
+//                  top-level value is an object or an array respectively.
+//  decode_range(string, start[, stop[, options]]):
+//                  Like decode, but decodes only the bytes from start to
+//                  stop, which are interpreted like the arguments of
+//                  string.sub, without creating the substring. Offsets in
+//                  error messages are relative to start.
+//  decode_opaque(string):
+//                  Checks a JSON string and returns userdata holding the
+//                  document, without converting it to Lua, for scripts that
+//                  forward documents and read little of them. Its method
+//                  get(pointer) converts the value at a JSON pointer, or
+//                  returns nil if there is none, parsing the document the
+//                  first time. encode(), also called by tostring, returns the
+//                  original text without whitespace, and json.encode writes
+//                  that text wherever it finds the userdata. Returns nil and
+//                  an error string if the string is not valid JSON.
+//  decode_file(file[, options]):
+//                  Like decode, but reads the JSON document from file, a
+//                  file opened by the io library, a userdata wrapping an
+//                  io.Reader or any value with a read method, decoding it as
+//                  it is read instead of first reading it into a string.
+//                  With max_bytes, fails as soon as more bytes are read.
+//  seal(doc[, options]):
+//                  Checks that the table doc only holds values that always
+//                  encode alike, without functions, userdata other than
+//                  json.null and int64, cycles or tables with metatables
+//                  other than those of json.object and json.array, and
+//                  encodes it with the options of encode. The tables of doc
+//                  then get metatables recording whether they are arrays or
+//                  objects, and adding members to them raises an error;
+//                  scripts must not modify them in any other way. Returns
+//                  doc, whose encoding json.encode(doc), without options,
+//                  returns from then on without encoding it again, or nil
+//                  and an error.
+//  decode_into(userdata, string):
+//                  Decodes a JSON string into userdata holding a Go value
+//                  whose type the host registered a decoder for with
+//                  RegisterDecoder, and returns the userdata. Returns nil
+//                  and an error if the string is not valid JSON or the
+//                  decoder fails. Userdata of types with an encoder
+//                  registered with RegisterEncoder are encoded by it.
+//  register_class(tag, metatable):
+//                  Registers a class for the encode and decode calls made
+//                  afterwards: its instances, the tables with the metatable,
+//                  encode with the tag as with the encode option classes,
+//                  and the objects with the tag decode back to instances,
+//                  without their "$type" member, as with the decode option
+//                  constructors.
+//  decode_columns(string, names):
+//                  Decodes an array of objects into one array per member
+//                  listed in names, skipping all other members. Returns a
+//                  table of the arrays keyed by member name, and the number
+//                  of rows.
+//  decode_projection(string, paths):
+//                  Decodes only the values at the given paths, which may use
+//                  * wildcards, in a single pass over the string. Everything
+//                  else is skipped without being converted. Array elements
+//                  keep their original positions.
+//  get_many(doc, paths[, options]):
+//                  Returns an array holding the value at each path, such as
+//                  "$.items[0].id", or nil where there is none, with the
+//                  number of paths as its n field. When doc is a JSON string,
+//                  it is decoded with the options in a single pass that only
+//                  converts those values. Paths cannot use * wildcards.
+//  destructure(doc, key...):
+//                  Returns the members of the object doc with the given keys
+//                  as multiple values, nil for those that are missing. A
+//                  JSON string is decoded first, skipping the other members.
+//                  Raises an error when doc is not an object.
+//  pick(doc, defaults):
+//                  Returns a new table holding only the members of doc, an
+//                  object or a JSON string, with the keys of defaults.
+//                  Missing and null members take a copy of their default;
+//                  the others must have the same type as it, unless the
+//                  default is json.null. Returns nil and an error naming the
+//                  first mismatched member otherwise.
+//  extract(string[, options]):
+//                  Finds the well-formed JSON objects and arrays embedded in
+//                  arbitrary text, such as logs or HTML. Returns an array of
+//                  tables with the fields value, the decoded document, and
+//                  start and stop, its position in the text as accepted by
+//                  string.sub. The options are those of decode.
+//  encode_rows(columns, count[, options]):
+//                  The inverse of decode_columns: encodes count rows from the
+//                  parallel arrays in columns as an array of objects,
+//                  omitting nil members. The options are those of encode.
+//  at(doc, ...):   Returns the value reached from doc by following each
+//                  argument in turn, a member name or an array index
+//                  counting from 1, as in json.at(doc, "a", "b", 3, "c"), or
+//                  nil as soon as a value along the way is missing, null or
+//                  not an object or array. It never raises an error for
+//                  such documents, unlike doc.a.b[3].c.
+//  pointer_get(doc, pointer):
+//                  Returns the value at an RFC 6901 JSON Pointer, such as
+//                  "/items/0/name", in which arrays are indexed from 0, so
+//                  that /items/0 is items[1] in Lua. Object and array
+//                  userdata are traversed like tables. When doc is a JSON
+//                  string, the value is returned as a JSON
+//                  string too, decoding only the containers along the path.
+//                  Returns nil and an error if there is no such value.
+//  pointer_set(doc, pointer, value):
+//                  Sets the value at a JSON Pointer, replacing the existing
+//                  value or adding a member, or an element for the index "-"
+//                  or the length of the array. A table doc is modified in
+//                  place; for a JSON string, value is a JSON string as well
+//                  and the new document is returned. Returns the document,
+//                  or nil and an error.
+//  patch_apply(doc, patch):
+//                  Applies an RFC 6902 patch, given as a JSON string or an
+//                  array of operation tables such as {op = "add", path =
+//                  "/tags/-", value = "new"}, to a copy of the table doc and
+//                  returns the copy; doc itself is left unchanged. All of
+//                  add, remove, replace, move, copy and test are supported.
+//                  Returns nil and an error if an operation fails, such as
+//                  a test that does not match or a path with no value.
+//  patch_apply_raw(string, patch):
+//                  Applies an RFC 6902 patch, given as a JSON string or an
+//                  array of operation tables, to a JSON string and returns the
+//                  patched string. Only the containers along the paths of the
+//                  operations are decoded; the rest of the document is copied
+//                  unchanged.
+//  patch_invert(patch, doc):
+//                  Returns the RFC 6902 patch undoing patch, given as for
+//                  patch_apply_raw, when it is applied to the table doc: the
+//                  operations restoring each removed or replaced value, in
+//                  reverse order. Returns nil and an error if patch does not
+//                  apply to doc.
+//  patch_compose(patch, ...):
+//                  Checks the syntax of the patches, given as for
+//                  patch_apply_raw, and combines them into a single patch
+//                  with the same effect, dropping the operations made
+//                  redundant by later ones, such as changes to a value that
+//                  is then replaced or removed.
+//  patch_diff(a, b[, options]):
+//                  Returns an RFC 6902 patch transforming the value a into b.
+//                  Arrays are compared element by element, unless the
+//                  option arrays is "lcs": the longest common subsequence of
+//                  the arrays is then kept and the other elements removed
+//                  or added around it; past a few million pairs of
+//                  elements, the parts of the arrays between their common
+//                  prefix and suffix are compared element by element
+//                  instead. The option array_key, which implies
+//                  "lcs", matches objects by the value of that member, so
+//                  that the changes to matched objects are patched in place.
+//                  With the option detect_moves, subtrees found elsewhere
+//                  in a are moved or copied from there rather than removed
+//                  and added anew, which keeps the patches of rearranged
+//                  documents small.
+//  diff_text(a, b[, options]):
+//                  Returns a unified diff of the pretty-printed encodings of
+//                  a and b, with sorted keys, or an empty string if they are
+//                  equal. The option context sets the number of unchanged
+//                  lines around each change (3 by default), and max_lines
+//                  caps the number of lines, the rest being summarized by a
+//                  final "... n more lines".
+//  merge(a, b[, options]):
+//                  Returns a new value deeply merging b into a: the members
+//                  of objects are merged recursively, and the values of b
+//                  take precedence over the other values of a. Arrays are
+//                  merged element by element, unless the option array_key
+//                  is set: the objects of b are then merged into the objects
+//                  of a with the same value for that member, and the other
+//                  elements of b appended.
+//  merge_patch(target, patch):
+//                  Returns a new value applying the RFC 7386 merge patch,
+//                  a table or a JSON string, to target: the members of an
+//                  object patch are merged recursively into target, those
+//                  set to json.null (or null in a JSON string) are removed,
+//                  and any other patch replaces target. Empty tables are
+//                  patched as objects.
+//  schema_compile(schema[, options]):
+//                  Compiles a JSON Schema, given as a table or a JSON string,
+//                  and returns it with the method validate(doc), which
+//                  returns true, or false and an array of errors, each with
+//                  the path of the invalid value. With the option
+//                  error_object, validate(doc, {error_object = true})
+//                  returns error objects instead, with the fields path,
+//                  pointer, the JSON Pointer to the value, and reason. The
+//                  keywords of drafts 7 to 2020-12 are supported, except
+//                  for anchors, $dynamicRef and the unevaluated keywords.
+//                  A $ref to another document is resolved against the $id
+//                  of the schema, or the option base_uri, and the document
+//                  loaded with the option loader, a function returning the
+//                  schema at a URI as a table or a JSON string, or else
+//                  with the loader of the host. References that lead back
+//                  to their schema without descending into a member or an
+//                  element, such as {"$ref": "#"}, are rejected.
+//                  With the option formats, strings must also be valid for
+//                  the format keyword: date-time, date, time, email,
+//                  hostname, uri, uri-reference, uuid, ipv4, ipv6 or regex.
+//                  Other formats are not checked.
+//                  Returns nil and an error for invalid schemas and
+//                  references that cannot be resolved.
+//  schema_register_keyword(name, fn):
+//                  Registers a custom keyword for the schemas compiled
+//                  afterwards. Values with the keyword in their schema are
+//                  passed to fn(value, keyword_value, path), which returns
+//                  true when the value is valid, or false and an optional
+//                  error message. Returns nothing. Registering a keyword
+//                  again replaces its function; redefining a standard
+//                  keyword raises an error.
+//  assert_equal(expected, actual[, options]):
+//                  Compares two values with JSON semantics, ignoring key
+//                  order. Returns true, or false and a report listing each
+//                  mismatch with its path. The options ignore_paths (an array
+//                  of paths, which may use * wildcards) and tolerance (for
+//                  numbers) relax the comparison.
+//  matches(doc, pattern):
+//                  Reports whether doc contains everything in pattern: each
+//                  member of a pattern object must match the member of doc
+//                  with the same key, and each element of a pattern array
+//                  some element of doc. The wildcards json.any,
+//                  json.any_string, json.any_number, json.any_boolean,
+//                  json.any_object and json.any_array match any value of
+//                  their kind. When doc does not match, the path of the
+//                  failing part of the pattern is returned as well.
+//  encode_chunks(value, size[, options]):
+//                  Like encode, but returns the JSON string split into an
+//                  array of chunks of at most size bytes.
+//  encode_to_buffer(value[, buffer[, options]]):
+//                  Like encode, but appends the JSON string to buffer, or to
+//                  a new buffer, and returns the buffer (see the buffer
+//                  option). Its method reset() empties it while keeping its
+//                  memory, so that encoding many values in a loop into the
+//                  same buffer allocates little. On error, returns nil and
+//                  an error string, leaving buffer unchanged.
+//  encode_to(writer, value[, options]):
+//                  Like encode, but writes the JSON string to writer, a
+//                  userdata wrapping an io.Writer or any value with a write
+//                  method, such as a file opened by the io library, as it is
+//                  produced, without holding it all in memory. Returns true,
+//                  or nil and an error string, in which case part of the
+//                  string may have been written.
+//  build(fn[, options]):
+//                  Calls fn with a builder that writes a document straight
+//                  to the output, without building the tables it would be
+//                  encoded from, and returns the JSON string. The builder
+//                  methods obj([key,] fn) and arr([key,] fn) write an object
+//                  or an array whose contents are written by fn, which may
+//                  also be an array of elements for arr; kv(key, value) and
+//                  value(value) write a member or an element. Keys are
+//                  required inside objects only, and members keep the order
+//                  they are written in unless sort_keys is set. The options
+//                  are those of encode.
+//  map(doc, fn):   Returns a copy of doc in which each leaf, any value that
+//                  is not a table, is replaced by the result of fn(path,
+//                  value). Leaves for which fn returns nil are removed.
+//  hash(value[, options]):
+//                  Returns the hexadecimal digest of the canonical encoding
+//                  of value, with sorted keys, so that equal documents hash
+//                  alike whatever the order of their members. The option
+//                  algo selects md5, sha1, sha256 (the default) or sha512,
+//                  and exclude lists the paths, which may use * wildcards,
+//                  of members and elements to leave out, such as timestamps.
+//  sign(doc, key, alg[, options]):
+//                  Returns the compact JWS of the canonical encoding of doc,
+//                  with sorted keys, signed with key, userdata provided by
+//                  the host. alg is HS256, HS384, HS512, RS256, RS384, RS512,
+//                  ES256, ES384, ES512 or EdDSA, and must suit the key. With
+//                  the option detached, the payload is left out of the JWS,
+//                  which is then sent alongside the document.
+//  verify(jws, key[, doc]):
+//                  Checks the signature of a JWS with key, and returns its
+//                  decoded payload and protected header. A detached payload
+//                  is given as doc, whose canonical encoding is verified;
+//                  when the JWS has a payload, doc must match it. Returns
+//                  nil and an error if the JWS is invalid.
+//  decode_jwt(token[, options]):
+//                  Decodes the claims and the header of a JWT, and returns
+//                  them as tables, without verifying its signature unless
+//                  the option verify is true. The signature is then checked
+//                  with the option key, as for verify, or else with the key
+//                  that the host resolves from the header. Claims such as
+//                  exp are not checked. The other options are those of
+//                  decode, and apply to the claims. Returns nil and an error
+//                  if the token is invalid or fails verification.
+//  envelope(data[, fields]):
+//                  Returns an object holding data, the members of the table
+//                  fields, such as type, an id and the time, in RFC 3339
+//                  format and UTC, at which it was built. Identifiers are
+//                  consecutive integers, as strings, unless the host
+//                  provides them, and so may the time.
+//  rpc_request(method[, params]):
+//                  Returns a JSON-RPC 2.0 request calling method with the
+//                  array or object params, identified as envelopes are.
+//  repair(string): Attempts to turn almost valid JSON, such as the output of a
+//                  careless generator or a truncated transfer, into valid
+//                  JSON. Returns the repaired string and an array of the
+//                  fixes applied, tables with the fields kind and offset
+//                  (zero-based, in the input). The kinds are
+//                  control_character (unescaped in a string), single_quotes,
+//                  unquoted_key (a bare identifier), trailing_comma,
+//                  unterminated_string, missing_value and unclosed (an array
+//                  or object left open). Returns nil and an error when the
+//                  repaired string is still not valid JSON.
+//  lines(string[, options]):
+//                  Returns an iterator over the documents of a JSON Lines
+//                  string, yielding the number and the decoded value of each
+//                  document. Blank lines and CRLF line endings are allowed,
+//                  and documents may span several lines. Raises an error on
+//                  the first invalid document.
+//  decode_stream(reader[, options]):
+//                  Like lines, but reads the documents from a string, a
+//                  userdata wrapping an io.Reader, or a value with a read
+//                  method such as a file, as the iterator is called: the
+//                  stream need not fit in memory. read(n) is called with the
+//                  number of bytes wanted and returns nil at the end.
+//  sse(reader[, options]):
+//                  Returns an iterator over the events of a Server-Sent
+//                  Events stream, read as for decode_stream, yielding the
+//                  type of each event ("message" unless set by an event
+//                  line), its data decoded as JSON and the last event ID, or
+//                  nil. The data lines of an event are joined by newlines;
+//                  comments and events without data are skipped. The option
+//                  done sets a data string, such as "[DONE]", that ends the
+//                  iteration. The other options are those of decode. Raises
+//                  an error on the first event that is not valid JSON.
+//  front_matter(string[, options]):
+//                  Splits the front matter at the start of a document, between
+//                  two lines of "---" (the second may be "..."), from the
+//                  body that follows, and returns the decoded front matter
+//                  and the body. Front matter starting with { is decoded as
+//                  JSON, and otherwise as YAML: mappings, sequences, plain,
+//                  quoted, literal (|) and folded (>) scalars, and flow
+//                  collections on a single line are supported, but anchors,
+//                  aliases and tags are not. Returns nil and the whole string
+//                  when the document has no front matter, and raises an
+//                  error when the front matter is invalid.
+//  push_parser(callbacks[, options]):
+//                  Returns a parser for a stream of documents received in
+//                  chunks of any size, such as from a socket. Its method
+//                  feed(chunk) parses the next chunk, and finish() checks
+//                  that the stream did not end inside a document. Both
+//                  return true, or nil and an error. Each complete document
+//                  is passed to callbacks.on_value as soon as its last byte
+//                  is fed. The options are those of decode.
+//  try_decode(string[, options]), try_encode(value[, options]):
+//                  Like decode and encode, but never raise an error. They
+//                  return true followed by the results, or false and an
+//                  error object: a table with the fields msg and kind that
+//                  converts to its message with tostring. The error objects
+//                  of syntax errors also have the fields offset, the number
+//                  of bytes read when the error was found, and line and col,
+//                  the position of the last byte read, counting from 1.
+//
+// The encode options table accepts the following fields:
+//  buffer:         When true, the result is a buffer userdata instead of a
+//                  string, with the methods len(), tostring(), reset() and
+//                  write_to(writer).
+//  warn_unsafe_int:
+//                  When true, a third result is returned: a report table
+//                  whose unsafe_ints field lists the paths of integers
+//                  beyond 2^53, which JavaScript cannot represent exactly.
+//  report_degraded:
+//                  When true, a third result is returned: a report table
+//                  whose degraded field lists the values that the lenient
+//                  policies of table_keys, cycles and truncate left out or
+//                  replaced, each a table with the fields path and reason.
+//  big_ints_as_strings:
+//                  When true, integers beyond 2^53, numbers or int64
+//                  userdata, are encoded as strings of their digits, such as
+//                  "9007199254740993", so that JavaScript reads them without
+//                  losing digits. They are then not listed by
+//                  warn_unsafe_int.
+//  extra_escapes:  A string of characters to escape as \u sequences in
+//                  addition to the default ones.
+//  escape_html:    When false, <, > and & are written verbatim in strings
+//                  rather than as \u003c, \u003e and \u0026, like
+//                  json.Encoder after SetEscapeHTML(false).
+//  escape_unicode: When true, the non-ASCII characters of strings are
+//                  escaped as \u sequences, so that the output is ASCII.
+//  max_depth:      Fails when tables are nested deeper than this.
+//  max_array_elems, max_object_members:
+//                  Fail when an array or object has more elements or
+//                  members than this.
+//  truncate:       When true, containers beyond these limits are truncated
+//                  instead: arrays end with an element {"$truncated": n} and
+//                  objects, which keep the members whose keys sort first,
+//                  get a member "$truncated": n, where n is the number of
+//                  values left out.
+//  timeout_ms:     Aborts the encode with an error, reporting how many values
+//                  were encoded, once it has run for longer than this many
+//                  milliseconds. It can shorten, but not lengthen, the
+//                  deadline set by the host.
+//  on_limit:       A function called with a table describing an exceeded
+//                  limit (limit, path, value and max) before failing.
+//  float_compat:   "go" (the default), "js" or "python": formats numbers
+//                  like the standard encoder of that language.
+//  float_format:   A format such as "%.17g" for the numbers that are not
+//                  integers: one of %e, %E, %f, %g and %G, with an
+//                  optional precision. Integers are formatted without a decimal
+//                  point, as tostring formats them. Takes precedence over
+//                  float_compat.
+//  table_keys:     "error" (the default), "skip" or "tojson": how tables used
+//                  as keys are encoded. With skip, their members are left
+//                  out; with tojson, the compact JSON encoding of the key is
+//                  used as the member name.
+//  cycles:         "error" (the default), "null" or "ref": how tables that
+//                  contain themselves are encoded. With error, tables found
+//                  more than once fail the encoding, even outside of a
+//                  cycle. With null, a table found again within itself is
+//                  encoded as null, and with ref as a JSON Reference to where
+//                  it was first found, such as {"$ref": "#/parent"}; other
+//                  shared tables are encoded each time they are found.
+//  sparse:         "error" (the default), "null" or "object": how tables with
+//                  numeric keys that are not a sequence from 1, such as
+//                  {[1] = "a", [3] = "c"}, are encoded. With null, they are
+//                  arrays up to their largest key, which must be at most
+//                  2^20, with null for the missing elements; with object,
+//                  objects whose member names are the keys.
+//  packed_arrays:  When true, tables with an integral "n" field of at most
+//                  2^20, as returned by table.pack, encode as arrays of
+//                  that length. Otherwise, only tables marked by json.array
+//                  do, and the others encode n as a member.
+//  reflect_userdata:
+//                  When true, userdata holding Go values, such as those
+//                  created by gopher-luar, are encoded with encoding/json
+//                  instead of raising an error.
+//  overrides:      A table mapping paths, which may use * wildcards, to a
+//                  policy for the values at those paths: "skip" leaves them
+//                  out, "base64" encodes strings in base64, "string" encodes
+//                  values as a string holding their JSON encoding, and "raw"
+//                  inserts strings holding JSON as they are.
+//  indent, prefix: Format the output over several lines, like MarshalIndent
+//                  in Go: each element and member starts a new line with
+//                  prefix, followed by indent once per level of nesting.
+//  enums:          A table mapping paths, which may use * wildcards, to
+//                  lookup tables from JSON values to Lua values, such as
+//                  {[200] = "ok", [404] = "not_found"}. Values at those paths
+//                  found in a lookup table are replaced by their key.
+//  sort_keys:      When true, the members of every object are sorted by
+//                  key, so that equal values always encode alike. Tables
+//                  always are, but without it the documents of
+//                  decode_opaque, Go values encoded by reflect_userdata,
+//                  raw overrides and the output of build keep their order.
+//  classes:        A table mapping metatables to tags. Tables with one of
+//                  the metatables encode as objects with a "$type" member,
+//                  or the member named by the option type_key, holding the
+//                  tag, in addition to their own.
+//
+// The decode options table accepts the following fields:
+//  warn_unsafe_int, max_depth, on_limit:
+//                  As for encode.
+//  max_bytes:      Fails when the input is longer than this.
+//  error_object:   When true, decode returns an error object instead of an
+//                  error string on failure.
+//  big_ints:       "float" (the default), "string" or "int64": how integers
+//                  beyond 2^53, which numbers cannot hold exactly, are
+//                  decoded. With string, they decode to strings of their
+//                  digits; with int64, those that fit in 64 bits decode to
+//                  userdata as returned by int64, so that IDs survive a
+//                  decode and encode round trip. Only integers decoded to
+//                  numbers are listed by warn_unsafe_int.
+//  big_ints_as_strings:
+//                  When true, strings holding only the digits of an integer
+//                  beyond 2^53, as encoded with the option of the same name,
+//                  are decoded like numbers, following big_ints.
+//  duplicate_keys: "last" (the default), "first" or "error": which of several
+//                  object members with the same key is kept, or, with error,
+//                  that decoding fails on such members.
+//  reject_duplicate_keys:
+//                  When true, the same as duplicate_keys = "error".
+//  report_duplicates:
+//                  When true, the duplicates field of the report lists the
+//                  paths of duplicate members, whichever member is kept.
+//  coerce:         A table mapping paths, which may use * wildcards, to
+//                  "number" or "boolean": string values at those paths are
+//                  converted to that type, and decoding fails on strings that
+//                  cannot be converted.
+//  allow_keys, deny_keys:
+//                  Arrays of object keys, which may use the * and ? globs.
+//                  Members whose key is not in allow_keys, when given, or is
+//                  in deny_keys are skipped without being decoded.
+//  reject_keys:    When true, decoding fails on such members instead.
+//  objects:        "table" (the default) or "userdata": decodes objects to
+//                  userdata whose members are read and written by indexing,
+//                  like a table, but which cost the garbage collector much
+//                  less. #obj is the number of members, obj:keys() returns
+//                  their keys, and obj:totable() a copy in which all objects
+//                  are tables. Members named like these methods hide them.
+//                  Such userdata are encoded as objects.
+//  array_threshold:
+//                  Arrays with more elements than this decode to userdata
+//                  holding the elements in Go, in chunks, so that huge arrays
+//                  do not lengthen the pauses of the garbage collector. Its
+//                  elements are read and written by indexing, like a table,
+//                  or with the methods get(i) and len(); #arr is also the
+//                  length, arr:ipairs() iterates over the elements, nil
+//                  ones included, and arr:totable() returns a copy in which
+//                  all such arrays and userdata objects are tables. Such
+//                  userdata are encoded as arrays.
+//  keep_nulls:     When true, null decodes to json.null instead of nil, so
+//                  that members and elements that are null are kept, and
+//                  encoding the result gives back the same document.
+//  preserve_order: When true, objects decode to tables that record the order
+//                  of their members, and of the members scripts add to
+//                  them, in the __jsonorder list of their metatable. encode
+//                  writes their members in that order, unless sort_keys is
+//                  set, rather than sorted, so that rewriting a document
+//                  changes it as little as possible.
+//  constructors:   A table mapping type names to functions. Objects whose
+//                  "$type" member, or the member named by the option
+//                  type_key, is one of the names are passed, once decoded,
+//                  to the function, and decode to the value it returns,
+//                  such as userdata or a table with a metatable. A function
+//                  may return nil and an error message to fail the decode.
+//                  Objects with other names decode as usual.
+//  grammar:        "ecma404" (the default), "rfc8259", "lenient" or
+//                  "json5". With rfc8259, invalid UTF-8 in strings is an
+//                  error instead of being replaced with U+FFFD. With
+//                  lenient, numbers may have a leading '+', leading zeros,
+//                  or a '.' without digits on one side, as in +1, 007, .5
+//                  and 5. With json5, the input is JSON5: it may also have
+//                  // and /* */ comments, trailing commas, strings in single
+//                  quotes with escapes such as \x41, member names that are
+//                  identifiers, and hexadecimal numbers such as 0xFF,
+//                  Infinity and NaN.
+//  enums:          As for encode, in the other direction: values at those
+//                  paths that are keys of a lookup table are replaced by the
+//                  corresponding Lua value.
+//
+// Paths in options and reports use the JSONPath style, such as
+// $.items[0].name, with zero-based array indexes.
 //
 // The following types are supported:
 //
 //  Lua      | JSON
 //  ---------+-----
 //  nil      | null
+//  json.null| null
 //  number   | number
 //  string   | string
 //  table    | object: when table is non-empty and has only string keys
-//           | array:  when table is empty, or has only sequential numeric keys
-//           |         starting from 1
+//           | object: when table is empty and its metatable has a
+//           |         __jsontype field of "object"
+//           | array:  when table is any other empty table, or has only
+//           |         sequential numeric keys starting from 1
+//           | array:  when table has a __jsonlen metafield, or an "n" field
+//           |         and is marked by json.array (see packed_arrays);
+//           |         missing elements up to that length are encoded as null
 //
-// Attempting to encode any other Lua type will result in an error.
+// Userdata whose metatable has a __tojson field are encoded as the value that
+// function returns when called with the userdata; otherwise, those with a
+// __tostring field are encoded as the string it returns. Attempting to
+// encode any other Lua type will result in an error, unless the
+// reflect_userdata option is set.
 //
 // Example
 //
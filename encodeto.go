@@ -0,0 +1,62 @@
+package json
+
+import (
+	"io"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// flushSize is the size of the output that EncodeTo buffers before writing
+// it out.
+const flushSize = 32 << 10
+
+// EncodeTo writes the JSON encoding of value with the given options to w as
+// it is produced, so that encoding large values does not hold the whole
+// output in memory. On error, part of the output may have been written.
+//
+// The options that need the complete output, such as Indent, Prefix and
+// RawHTML, or the paths of values, such as MaxDepth or Overrides, encode in
+// memory before writing.
+func EncodeTo(w io.Writer, value lua.LValue, opts *EncodeOptions) error {
+	if opts == nil {
+		opts = &EncodeOptions{}
+	}
+	if !appendable(opts) || opts.Indent != "" || opts.Prefix != "" || opts.rewritesEscapes() {
+		data, err := EncodeWithOptions(value, opts)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+	if err := checkFloatFormat(opts.FloatFormat); err != nil {
+		return err
+	}
+	buf := bufferPool.Get().(*[]byte)
+	e := encoderPool.Get().(*appendEncoder)
+	e.buf, e.opts, e.w, e.timer = (*buf)[:0], opts, w, newEncodeTimer(opts)
+	err := e.value(value)
+	if err == nil && len(e.buf) > 0 {
+		_, err = w.Write(e.buf)
+	}
+	putBuffer(e.buf)
+	e.release()
+	return err
+}
+
+// apiEncodeTo writes the encoding of a value to a userdata wrapping an
+// io.Writer, or to any value with a write method, such as a file opened by
+// the io library.
+func (m *module) apiEncodeTo(L *lua.LState) int {
+	w := checkWriter(L, 1)
+	value := L.CheckAny(2)
+	opts, _ := checkEncodeOptions(L, 3, m.encode)
+
+	if err := EncodeTo(w, value, &opts); err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	L.Push(lua.LTrue)
+	return 1 + pushReport(L, opts.Report)
+}
@@ -0,0 +1,103 @@
+package json
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// countingWriter records the sizes of the writes made to it.
+type countingWriter struct {
+	bytes.Buffer
+	writes []int
+	fail   error
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	if w.fail != nil {
+		return 0, w.fail
+	}
+	w.writes = append(w.writes, len(p))
+	return w.Buffer.Write(p)
+}
+
+func TestEncodeTo(t *testing.T) {
+	s := lua.NewState()
+	defer s.Close()
+
+	rows := s.CreateTable(5000, 0)
+	for i := 0; i < 5000; i++ {
+		row := s.CreateTable(0, 2)
+		row.RawSetString("id", lua.LNumber(i))
+		row.RawSetString("name", lua.LString("<row>"))
+		rows.Append(row)
+	}
+	want, err := Encode(rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, opts := range []*EncodeOptions{nil, {MaxDepth: 8}, {Indent: " "}} {
+		var w countingWriter
+		if err := EncodeTo(&w, rows, opts); err != nil {
+			t.Fatal(err)
+		}
+		expected := want
+		if opts != nil && opts.Indent != "" {
+			expected, _ = EncodeWithOptions(rows, opts)
+		}
+		if !bytes.Equal(w.Bytes(), expected) {
+			t.Errorf("%+v: output differs from Encode", opts)
+		}
+		if opts == nil {
+			if len(w.writes) < 2 {
+				t.Errorf("expecting several writes, got %v", w.writes)
+			}
+			for _, n := range w.writes {
+				if n > 2*flushSize {
+					t.Errorf("write of %d bytes", n)
+				}
+			}
+		}
+	}
+
+	w := countingWriter{fail: errors.New("disk full")}
+	if err := EncodeTo(&w, rows, nil); err == nil || err.Error() != "disk full" {
+		t.Errorf("got %v, want the error of the writer", err)
+	}
+	if err := EncodeTo(&countingWriter{}, s.NewFunction(nil), nil); err == nil {
+		t.Error("expecting an error for a function")
+	}
+}
+
+func TestEncodeToLua(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local f = assert(io.open(path, "w"))
+	assert(json.encode_to(f, {a = {1, 2}, b = "x"}))
+	f:close()
+	f = assert(io.open(path))
+	assert(f:read("*a") == '{"a":[1,2],"b":"x"}')
+	f:close()
+
+	local parts = {}
+	local sink = {write = function(self, s) table.insert(parts, s) return true end}
+	local ok, err, report = json.encode_to(sink, {2^53 + 2}, {warn_unsafe_int = true})
+	assert(ok and err == nil and #report.unsafe_ints == 1)
+	assert(table.concat(parts) == "[9007199254740994]")
+
+	local _, err = json.encode_to(sink, {f = print})
+	assert(err ~= nil)
+	assert(not pcall(json.encode_to, 1, {}))
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	s.SetGlobal("path", lua.LString(filepath.Join(t.TempDir(), "out.json")))
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
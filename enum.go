@@ -0,0 +1,90 @@
+package json
+
+import (
+	"fmt"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// Enum maps the values at the paths matching Path, which may use * wildcards.
+// Decoding replaces the JSON values that are keys of Values, such as status
+// codes, with the corresponding Lua values, such as names; encoding does the
+// opposite. Other values are left unchanged.
+type Enum struct {
+	Path   string
+	Values map[lua.LValue]lua.LValue
+}
+
+type enumRule struct {
+	pattern pathPattern
+	values  map[lua.LValue]lua.LValue
+}
+
+// compileEnums parses the patterns of enums. When inverse is set, the rules
+// map the values of each Enum back to its keys.
+func compileEnums(enums []Enum, inverse bool) ([]enumRule, error) {
+	rules := make([]enumRule, 0, len(enums))
+	for _, e := range enums {
+		pp, err := parsePathPattern(e.Path)
+		if err != nil {
+			return nil, err
+		}
+		values := e.Values
+		if inverse {
+			values = make(map[lua.LValue]lua.LValue, len(e.Values))
+			for from, to := range e.Values {
+				if _, ok := values[to]; ok {
+					return nil, fmt.Errorf("enum for %s maps several values to %s", e.Path, to)
+				}
+				values[to] = from
+			}
+		}
+		rules = append(rules, enumRule{pattern: pp, values: values})
+	}
+	return rules, nil
+}
+
+// mapEnum returns the value that value, found at path p, is mapped to by the
+// first matching rule, or value itself.
+func mapEnum(rules []enumRule, value lua.LValue, p path) lua.LValue {
+	switch value.(type) {
+	case lua.LString, lua.LNumber, lua.LBool:
+	default:
+		return value
+	}
+	for _, r := range rules {
+		if !r.pattern.match(p) {
+			continue
+		}
+		if mapped, ok := r.values[value]; ok {
+			return mapped
+		}
+	}
+	return value
+}
+
+// enums returns an option, a table mapping paths to tables of
+// values.
+func (o luaOptions) enums(name string) []Enum {
+	t, ok := o.get(name).(*lua.LTable)
+	if !ok {
+		if o.get(name) != lua.LNil {
+			o.L.ArgError(o.arg, "option '"+name+"' must be a table")
+		}
+		return nil
+	}
+	var enums []Enum
+	t.ForEach(func(key, value lua.LValue) {
+		s, ok := key.(lua.LString)
+		values, ok2 := value.(*lua.LTable)
+		if !ok || !ok2 {
+			o.L.ArgError(o.arg, "option '"+name+"' must map paths to tables")
+		}
+		e := Enum{Path: string(s), Values: make(map[lua.LValue]lua.LValue)}
+		values.ForEach(func(from, to lua.LValue) {
+			e.Values[from] = to
+		})
+		enums = append(enums, e)
+	})
+	return enums
+}
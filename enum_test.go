@@ -0,0 +1,68 @@
+package json
+
+import (
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestEnums(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	enums := []Enum{{
+		Path:   "$.items[*].status",
+		Values: map[lua.LValue]lua.LValue{lua.LNumber(200): lua.LString("ok"), lua.LNumber(404): lua.LString("not_found")},
+	}}
+	for _, threshold := range []int{0, -1} {
+		value, err := DecodeWithOptions(L, []byte(`{"items":[{"status":200},{"status":404},{"status":500}],"status":200}`), &DecodeOptions{
+			Enums:             enums,
+			FastPathThreshold: threshold,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		items := L.GetField(value, "items").(*lua.LTable)
+		for i, expected := range []lua.LValue{lua.LString("ok"), lua.LString("not_found"), lua.LNumber(500)} {
+			if status := L.GetField(items.RawGetInt(i+1), "status"); status != expected {
+				t.Errorf("expecting %v, got %v", expected, status)
+			}
+		}
+		if status := L.GetField(value, "status"); status != lua.LNumber(200) {
+			t.Errorf("expecting unmapped status, got %v", status)
+		}
+
+		data, err := EncodeWithOptions(value, &EncodeOptions{Enums: enums})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := `{"items":[{"status":200},{"status":404},{"status":500}],"status":200}`; string(data) != expected {
+			t.Errorf("expecting %s, got %s", expected, data)
+		}
+	}
+
+	ambiguous := []Enum{{Path: "$.a", Values: map[lua.LValue]lua.LValue{lua.LNumber(1): lua.LTrue, lua.LNumber(2): lua.LTrue}}}
+	if _, err := EncodeWithOptions(lua.LNil, &EncodeOptions{Enums: ambiguous}); err == nil {
+		t.Error("expecting error for enum that cannot be inverted")
+	}
+}
+
+func TestEnumsLua(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local enums = {["$.level"] = {[1] = "low", [2] = "high"}}
+	local value = json.decode('{"level":2}', {enums = enums})
+	assert(value.level == "high")
+	assert(json.encode(value, {enums = enums}) == '{"level":2}')
+	assert(json.encode({level = "medium"}, {enums = enums}) == '{"level":"medium"}')
+
+	assert(not pcall(json.decode, '{}', {enums = {["$.level"] = "low"}}))
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
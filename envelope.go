@@ -0,0 +1,82 @@
+package json
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// IDGenerator returns the identifiers of the envelopes and JSON-RPC requests
+// built by scripts. It is shared by every state loading the module, and must
+// be safe for concurrent use.
+type IDGenerator func() string
+
+// Clock returns the time stamped on the envelopes built by scripts.
+type Clock func() time.Time
+
+// WithIDGenerator makes json.envelope and json.rpc_request take their
+// identifiers from gen, instead of a counter starting at 1 for each loader.
+func WithIDGenerator(gen IDGenerator) Option {
+	return func(c *config) {
+		c.ids = gen
+	}
+}
+
+// WithClock makes json.envelope stamp envelopes with the times returned by
+// clock, instead of the current time.
+func WithClock(clock Clock) Option {
+	return func(c *config) {
+		c.clock = clock
+	}
+}
+
+// nextID returns the identifier of the next envelope.
+func (c *config) nextID() string {
+	if c.ids != nil {
+		return c.ids()
+	}
+	return strconv.FormatUint(c.lastID.Add(1), 10)
+}
+
+// now returns the time of the next envelope, in UTC.
+func (c *config) now() time.Time {
+	if c.clock != nil {
+		return c.clock().UTC()
+	}
+	return time.Now().UTC()
+}
+
+// apiEnvelope wraps data in an object with an id and the time it was built,
+// along with the members of the optional fields table.
+func (m *module) apiEnvelope(L *lua.LState) int {
+	data := L.CheckAny(1)
+	fields := L.OptTable(2, nil)
+	env := L.NewTable()
+	if fields != nil {
+		fields.ForEach(func(k, v lua.LValue) {
+			env.RawSet(k, v)
+		})
+	}
+	env.RawSetString("id", lua.LString(m.nextID()))
+	env.RawSetString("time", lua.LString(m.now().Format(time.RFC3339Nano)))
+	env.RawSetString("data", data)
+	L.Push(env)
+	return 1
+}
+
+// apiRPCRequest builds a JSON-RPC 2.0 request calling method, with the
+// optional params table.
+func (m *module) apiRPCRequest(L *lua.LState) int {
+	method := L.CheckString(1)
+	params := L.OptTable(2, nil)
+	req := L.CreateTable(0, 4)
+	req.RawSetString("jsonrpc", lua.LString("2.0"))
+	req.RawSetString("id", lua.LString(m.nextID()))
+	req.RawSetString("method", lua.LString(method))
+	if params != nil {
+		req.RawSetString("params", params)
+	}
+	L.Push(req)
+	return 1
+}
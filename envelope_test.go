@@ -0,0 +1,59 @@
+package json
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestEnvelope(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local env = json.envelope({n = 1}, {type = "created", id = "ignored"})
+	assert(env.id == "1" and env.type == "created" and env.data.n == 1)
+	assert(env.time:match("^%d%d%d%d%-%d%d%-%d%dT.*Z$"), env.time)
+	assert(json.envelope(nil).id == "2")
+
+	local req = json.rpc_request("sum", {1, 2})
+	assert(json.encode(req) == '{"id":"3","jsonrpc":"2.0","method":"sum","params":[1,2]}', json.encode(req))
+	assert(json.rpc_request("ping").params == nil)
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEnvelopeGenerators(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local env = json.envelope("x")
+	assert(env.id == "req-1" and env.time == "2024-05-01T12:00:00Z", env.time)
+	env = json.envelope("y")
+	assert(env.id == "req-2" and env.time == "2024-05-01T12:00:01.5Z", env.time)
+	assert(json.rpc_request("ping").id == "req-3")
+	`
+	n := 0
+	ids := func() string {
+		n++
+		return "req-" + strconv.Itoa(n)
+	}
+	at := time.Date(2024, 5, 1, 14, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	clock := func() time.Time {
+		t := at
+		at = at.Add(1500 * time.Millisecond)
+		return t
+	}
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s, WithIDGenerator(ids), WithClock(clock))
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
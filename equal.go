@@ -0,0 +1,216 @@
+package json
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// isArray reports whether a table is encoded as a JSON array, and returns
+// its length if so.
+func isArray(t *lua.LTable) (int, bool) {
+	if n, _, ok := explicitLen(t, false); ok {
+		return n, true
+	}
+	key, _ := t.Next(lua.LNil)
+	switch key.(type) {
+	case *lua.LNilType:
+		return 0, !isEmptyObject(t)
+	case lua.LNumber:
+		return t.Len(), true
+	}
+	return 0, false
+}
+
+// mismatch is a difference found by a comparer.
+type mismatch struct {
+	path     path
+	expected lua.LValue
+	actual   lua.LValue
+	reason   string
+}
+
+func (m mismatch) String() string {
+	return fmt.Sprintf("%s: %s (expected %s, got %s)", m.path, m.reason, describe(m.expected), describe(m.actual))
+}
+
+// describe formats a value for a mismatch report.
+func describe(v lua.LValue) string {
+	if v == lua.LNil {
+		return "nothing"
+	}
+	if data, err := Encode(v); err == nil {
+		if len(data) > 60 {
+			return string(data[:57]) + "..."
+		}
+		return string(data)
+	}
+	return v.String()
+}
+
+// comparer compares Lua values with JSON semantics.
+type comparer struct {
+	ignore    []pathPattern
+	tolerance float64
+
+	// first stops the comparison at the first mismatch.
+	first bool
+	diffs []mismatch
+
+	// active holds the pairs of tables being compared, so that tables
+	// containing themselves are only compared once.
+	active map[tablePair]bool
+}
+
+// tablePair is a pair of tables compared with each other.
+type tablePair [2]*lua.LTable
+
+func deepEqual(a, b lua.LValue) bool {
+	c := comparer{first: true}
+	c.compare(nil, a, b)
+	return len(c.diffs) == 0
+}
+
+func (c *comparer) fail(p path, expected, actual lua.LValue, reason string) {
+	c.diffs = append(c.diffs, mismatch{path: p, expected: expected, actual: actual, reason: reason})
+}
+
+func (c *comparer) ignored(p path) bool {
+	for _, pp := range c.ignore {
+		if pp.match(p) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *comparer) compare(p path, expected, actual lua.LValue) {
+	if c.first && len(c.diffs) > 0 || c.ignored(p) {
+		return
+	}
+	if expected == Null {
+		expected = lua.LNil
+	}
+	if actual == Null {
+		actual = lua.LNil
+	}
+	switch e := expected.(type) {
+	case lua.LNumber:
+		a, ok := actual.(lua.LNumber)
+		if !ok {
+			c.fail(p, expected, actual, "type mismatch")
+		} else if math.Abs(float64(e)-float64(a)) > c.tolerance || (c.tolerance == 0 && e != a) {
+			c.fail(p, expected, actual, "values differ")
+		}
+		return
+	case *lua.LTable:
+		a, ok := actual.(*lua.LTable)
+		if !ok {
+			c.fail(p, expected, actual, "type mismatch")
+			return
+		}
+		c.compareTables(p, e, a)
+		return
+	}
+	if expected.Type() != actual.Type() {
+		c.fail(p, expected, actual, "type mismatch")
+	} else if ei, ok := int64Value(expected); ok {
+		if ai, ok := int64Value(actual); !ok || ei != ai {
+			c.fail(p, expected, actual, "values differ")
+		}
+	} else if expected != actual {
+		c.fail(p, expected, actual, "values differ")
+	}
+}
+
+func (c *comparer) compareTables(p path, expected, actual *lua.LTable) {
+	// A pair already being compared is taken as equal: any difference
+	// is reported where it is first compared.
+	pair := tablePair{expected, actual}
+	if c.active[pair] {
+		return
+	}
+	if c.active == nil {
+		c.active = make(map[tablePair]bool)
+	}
+	c.active[pair] = true
+	defer delete(c.active, pair)
+
+	en, eIsArray := isArray(expected)
+	an, aIsArray := isArray(actual)
+	emptyE := eIsArray && en == 0
+	emptyA := aIsArray && an == 0
+	switch {
+	case eIsArray && aIsArray:
+		n := en
+		if an > n {
+			n = an
+		}
+		for i := 1; i <= n; i++ {
+			e, a := expected.RawGetInt(i), actual.RawGetInt(i)
+			if i > en || i > an {
+				c.fail(p.elem(i-1), e, a, "length differs")
+				continue
+			}
+			c.compare(p.elem(i-1), e, a)
+		}
+	case !eIsArray && !aIsArray, emptyE && !aIsArray, !eIsArray && emptyA:
+		keys := make(map[string]bool)
+		for _, t := range []*lua.LTable{expected, actual} {
+			t.ForEach(func(key, _ lua.LValue) {
+				keys[lua.LVAsString(key)] = true
+			})
+		}
+		sorted := make([]string, 0, len(keys))
+		for key := range keys {
+			sorted = append(sorted, key)
+		}
+		sort.Strings(sorted)
+		for _, key := range sorted {
+			e, a := expected.RawGetString(key), actual.RawGetString(key)
+			switch {
+			case c.ignored(p.child(key)):
+			case e == lua.LNil:
+				c.fail(p.child(key), e, a, "unexpected member")
+			case a == lua.LNil:
+				c.fail(p.child(key), e, a, "missing member")
+			default:
+				c.compare(p.child(key), e, a)
+			}
+		}
+	default:
+		c.fail(p, expected, actual, "type mismatch")
+	}
+}
+
+func (c *comparer) report() string {
+	lines := make([]string, len(c.diffs))
+	for i, m := range c.diffs {
+		lines[i] = m.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (m *module) apiAssertEqual(L *lua.LState) int {
+	expected := L.CheckAny(1)
+	actual := L.CheckAny(2)
+	opts := checkOptions(L, 3)
+
+	c := comparer{tolerance: opts.number("tolerance", 0)}
+	ignore, err := parsePathPatterns(opts.strings("ignore_paths"))
+	if err != nil {
+		L.ArgError(3, err.Error())
+	}
+	c.ignore = ignore
+	c.compare(nil, expected, actual)
+	if len(c.diffs) == 0 {
+		L.Push(lua.LTrue)
+		return 1
+	}
+	L.Push(lua.LFalse)
+	L.Push(lua.LString(c.report()))
+	return 2
+}
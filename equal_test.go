@@ -0,0 +1,78 @@
+package json
+
+import (
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestParsePathPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    path
+		match   bool
+	}{
+		{"$", nil, true},
+		{"$.a.b", path{}.child("a").child("b"), true},
+		{"a.b", path{}.child("a").child("b"), true},
+		{"$.items[*].sku", path{}.child("items").elem(3).child("sku"), true},
+		{"$.items[2].sku", path{}.child("items").elem(3).child("sku"), false},
+		{"$.secrets.*", path{}.child("secrets").child("key"), true},
+		{`$["a.b"]['c d']`, path{}.child("a.b").child("c d"), true},
+		{"$.a", path{}.child("a").child("b"), false},
+	}
+	for _, test := range tests {
+		pp, err := parsePathPattern(test.pattern)
+		if err != nil {
+			t.Fatalf("%s: %v", test.pattern, err)
+		}
+		if pp.match(test.path) != test.match {
+			t.Fatalf("%s: expecting match %v for %s", test.pattern, test.match, test.path)
+		}
+	}
+	for _, invalid := range []string{"$.", "$[", "$[x]", "$a", `$["a]`} {
+		if _, err := parsePathPattern(invalid); err == nil {
+			t.Fatalf("%s: expecting an error", invalid)
+		}
+	}
+	if s := (path{}).child("a b").elem(0).child("c").String(); s != `$["a b"][0].c` {
+		t.Fatalf("unexpected path %s", s)
+	}
+}
+
+func TestAssertEqual(t *testing.T) {
+	const str = `
+	local json = require("json")
+	assert(json.assert_equal({a = 1, b = {1, 2}}, json.decode('{"b":[1,2],"a":1}')))
+	assert(json.assert_equal({}, {}))
+
+	local ok, report = json.assert_equal({a = 1, b = {1, 2}, c = "x"}, {a = 2, b = {1}, d = true})
+	assert(ok == false)
+	assert(string.find(report, "$.a: values differ", 1, true))
+	assert(string.find(report, "$.b[1]: length differs", 1, true))
+	assert(string.find(report, "$.c: missing member", 1, true))
+	assert(string.find(report, "$.d: unexpected member", 1, true))
+
+	assert(json.assert_equal({t = 1, v = 0.1 + 0.2}, {t = 2, v = 0.3}, {ignore_paths = {"$.t"}, tolerance = 1e-9}))
+	assert(not json.assert_equal({v = 0.1 + 0.2}, {v = 0.3}))
+	assert(json.assert_equal({items = {{id = 1, at = 5}}}, {items = {{id = 1, at = 6}}}, {ignore_paths = {"$.items[*].at"}}))
+
+	local a, b = {name = "a"}, {name = "a"}
+	a.self, b.self = a, b
+	assert(json.assert_equal(a, b))
+	assert(json.assert_equal(a, a))
+	b.name = "b"
+	local ok, report = json.assert_equal(a, b)
+	assert(ok == false and report:find("$.name: values differ", 1, true), report)
+	local x, y = {}, {}
+	x.next, y.next = y, x
+	assert(json.assert_equal(x, y))
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,136 @@
+package json
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/yuin/gopher-lua"
+)
+
+const errorTypeName = "json.error"
+
+func registerError(L *lua.LState) {
+	mt := L.NewTypeMetatable(errorTypeName)
+	mt.RawSetString("__tostring", L.NewFunction(errorString))
+}
+
+// newError returns the structured error object passed to scripts: a table
+// with the fields msg and kind, where kind names the operation that failed.
+// The object converts to its message with tostring.
+func newError(L *lua.LState, kind string, msg string) *lua.LTable {
+	t := L.CreateTable(0, 2)
+	t.RawSetString("msg", lua.LString(msg))
+	t.RawSetString("kind", lua.LString(kind))
+	t.Metatable = L.GetTypeMetatable(errorTypeName)
+	return t
+}
+
+// WithErrorObjects makes json.decode return error objects instead of error
+// strings, as if scripts passed the error_object option.
+func WithErrorObjects() Option {
+	return func(c *config) {
+		c.errorObjects = true
+	}
+}
+
+// newDecodeError returns the error object for the failure to decode data.
+// Syntax errors also have the fields offset, the number of bytes read when
+// the error was found as in json.SyntaxError, and line and col, the position
+// of the last byte read as returned by Position.
+func newDecodeError(L *lua.LState, data []byte, err error) *lua.LTable {
+	t := newError(L, "decode", err.Error())
+	if offset, ok := syntaxOffset(err, len(data)); ok {
+		line, col := Position(data, offset)
+		t.RawSetString("offset", lua.LNumber(offset))
+		t.RawSetString("line", lua.LNumber(line))
+		t.RawSetString("col", lua.LNumber(col))
+	}
+	return t
+}
+
+// syntaxOffset returns the offset of the syntax error err in a document of n
+// bytes. Truncated documents fail at their end.
+func syntaxOffset(err error, n int) (int64, bool) {
+	var se *json.SyntaxError
+	if errors.As(err, &se) {
+		return se.Offset, true
+	}
+	var je *json5Error
+	if errors.As(err, &je) {
+		return int64(je.pos) + 1, true
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return int64(n), true
+	}
+	return 0, false
+}
+
+// Position returns the line and column, both starting at 1, of the byte
+// before offset in data, such as the offset of a json.SyntaxError. Columns
+// count bytes, and lines end with '\n'.
+func Position(data []byte, offset int64) (line, col int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	end := int(offset) - 1
+	if end < 0 {
+		return 1, 1
+	}
+	start := bytes.LastIndexByte(data[:end], '\n') + 1
+	return 1 + bytes.Count(data[:start], []byte{'\n'}), end - start + 1
+}
+
+// pushDecodeError pushes the nil and the error returned by a decode function
+// that failed to decode data: an error object when objects is set, and an
+// error string otherwise.
+func pushDecodeError(L *lua.LState, data []byte, err error, objects bool) int {
+	L.Push(lua.LNil)
+	if objects {
+		L.Push(newDecodeError(L, data, err))
+	} else {
+		L.Push(lua.LString(err.Error()))
+	}
+	return 2
+}
+
+func errorString(L *lua.LState) int {
+	t := L.CheckTable(1)
+	L.Push(L.ToStringMeta(t.RawGetString("msg")))
+	return 1
+}
+
+// protect returns a function that calls fn without raising errors. It
+// returns true followed by the results of fn, or false and an error object
+// if fn raised an error or returned nil and an error message.
+func protect(kind string, fn lua.LGFunction) lua.LGFunction {
+	return func(L *lua.LState) int {
+		nargs := L.GetTop()
+		L.Insert(L.NewFunction(fn), 1)
+		if err := L.PCall(nargs, lua.MultRet, nil); err != nil {
+			msg := err.Error()
+			if apiErr, ok := err.(*lua.ApiError); ok {
+				msg = apiErr.Object.String()
+			}
+			L.Push(lua.LFalse)
+			L.Push(newError(L, kind, msg))
+			return 2
+		}
+		nret := L.GetTop()
+		// A nil result is only a failure when it comes with an error, as
+		// decoding "null" gives nil alone.
+		if nret >= 2 && L.Get(1) == lua.LNil && L.Get(2) != lua.LNil {
+			errObj, ok := L.Get(2).(*lua.LTable)
+			if !ok || errObj.Metatable != L.GetTypeMetatable(errorTypeName) {
+				errObj = newError(L, kind, L.Get(2).String())
+			}
+			L.SetTop(0)
+			L.Push(lua.LFalse)
+			L.Push(errObj)
+			return 2
+		}
+		L.Insert(lua.LTrue, 1)
+		return nret + 1
+	}
+}
@@ -0,0 +1,71 @@
+package json
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+// htmlEscapes are the escape sequences that encoding/json writes for the
+// HTML characters, and that the RawHTML option turns back into the
+// characters.
+var htmlEscapes = map[string]rune{`\u003c`: '<', `\u003e`: '>', `\u0026`: '&'}
+
+// rewriteEscapes returns data, valid JSON, with the escapes of its strings
+// changed as the RawHTML and EscapeUnicode options of opts require. The
+// runes of the ExtraEscapes option stay escaped.
+func rewriteEscapes(data []byte, opts *EncodeOptions) []byte {
+	var b bytes.Buffer
+	b.Grow(len(data))
+	inString := false
+	for i := 0; i < len(data); {
+		c := data[i]
+		switch {
+		case c == '"':
+			inString = !inString
+		case !inString:
+		case c == '\\' && data[i+1] == 'u':
+			seq := string(data[i : i+6])
+			if r, ok := htmlEscapes[seq]; ok && opts.RawHTML && !containsRune(opts.ExtraEscapes, r) {
+				b.WriteRune(r)
+			} else {
+				b.WriteString(seq)
+			}
+			i += 6
+			continue
+		case c == '\\':
+			b.Write(data[i : i+2])
+			i += 2
+			continue
+		case c >= utf8.RuneSelf && opts.EscapeUnicode:
+			r, size := utf8.DecodeRune(data[i:])
+			writeRuneEscape(&b, r)
+			i += size
+			continue
+		}
+		b.WriteByte(c)
+		i++
+	}
+	return b.Bytes()
+}
+
+// rewritesEscapes reports whether opts changes the escapes of encoding/json.
+func (opts *EncodeOptions) rewritesEscapes() bool {
+	return opts.RawHTML || opts.EscapeUnicode
+}
+
+// WithoutHTMLEscape makes json.encode write <, > and & in strings verbatim,
+// as json.Encoder does after SetEscapeHTML(false), for output that is not
+// embedded in HTML.
+func WithoutHTMLEscape() Option {
+	return func(c *config) {
+		c.encode.RawHTML = true
+	}
+}
+
+// WithEscapeUnicode makes json.encode escape the non-ASCII characters of
+// strings as \u sequences, so that the output is plain ASCII.
+func WithEscapeUnicode() Option {
+	return func(c *config) {
+		c.encode.EscapeUnicode = true
+	}
+}
@@ -0,0 +1,45 @@
+package json
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestEscapeOptions(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local doc = {html = "<a href='x'>&amp;</a>", text = "héllo ✓ 😀", lit = "\\u003c"}
+	assert(json.encode(doc) == [[{"html":"\u003ca href='x'\u003e\u0026amp;\u003c/a\u003e","lit":"\\u003c","text":"héllo ✓ 😀"}]], json.encode(doc))
+	local raw = json.encode(doc, {escape_html = false})
+	assert(raw == [[{"html":"<a href='x'>&amp;</a>","lit":"\\u003c","text":"héllo ✓ 😀"}]], raw)
+	local ascii = json.encode(doc, {escape_html = false, escape_unicode = true})
+	assert(ascii == [[{"html":"<a href='x'>&amp;</a>","lit":"\\u003c","text":"h\u00e9llo \u2713 \ud83d\ude00"}]], ascii)
+	assert(json.decode(ascii).text == doc.text)
+	assert(json.encode({k = "<>"}, {escape_html = false, extra_escapes = "<"}) == [[{"k":"\u003c>"}]])
+	assert(json.encode({["<é>"] = 1}, {escape_html = false, escape_unicode = true, max_depth = 4}) == [[{"<\u00e9>":1}]])
+	assert(json.encode({s = "a\226\128\168b"}, {escape_html = false}) == [[{"s":"a\u2028b"}]])
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEscapeOptionsEncodeTo(t *testing.T) {
+	s := lua.NewState()
+	defer s.Close()
+
+	var b bytes.Buffer
+	value := lua.LString("<é>")
+	if err := EncodeTo(&b, value, &EncodeOptions{RawHTML: true, EscapeUnicode: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.String(); got != `"<\u00e9>"` {
+		t.Errorf("got %s", got)
+	}
+}
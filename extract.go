@@ -0,0 +1,92 @@
+package json
+
+import (
+	"encoding/json"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// span is the position of an embedded document in a larger text: the document
+// occupies data[start:end].
+type span struct {
+	start, end int
+}
+
+// extractDocuments finds the well-formed JSON objects and arrays embedded in
+// data, such as a log line or HTML page. Documents nested in one another are
+// only reported once, as the outermost document.
+func extractDocuments(data []byte) []span {
+	var spans []span
+	for i := 0; i < len(data); i++ {
+		if data[i] != '{' && data[i] != '[' {
+			continue
+		}
+		end := matchDelimiters(data, i)
+		if end < 0 || !json.Valid(data[i:end]) {
+			continue
+		}
+		spans = append(spans, span{start: i, end: end})
+		i = end - 1
+	}
+	return spans
+}
+
+// matchDelimiters returns the offset just past the bracket closing the one at
+// data[start], skipping over strings, or -1 when the brackets do not balance.
+func matchDelimiters(data []byte, start int) int {
+	var stack []byte
+	inString := false
+	for i := start; i < len(data); i++ {
+		c := data[i]
+		if inString {
+			switch c {
+			case '\\':
+				i++
+			case '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '{':
+			stack = append(stack, '}')
+		case '[':
+			stack = append(stack, ']')
+		case '}', ']':
+			if stack[len(stack)-1] != c {
+				return -1
+			}
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				return i + 1
+			}
+		}
+	}
+	return -1
+}
+
+func (m *module) apiExtract(L *lua.LState) int {
+	str := L.CheckString(1)
+	opts, _ := checkDecodeOptions(L, 2, m.decode)
+
+	data := []byte(str)
+	spans := extractDocuments(data)
+	result := L.CreateTable(len(spans), 0)
+	for _, s := range spans {
+		value, err := DecodeWithOptions(L, data[s.start:s.end], &opts)
+		if err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+		doc := L.CreateTable(0, 3)
+		doc.RawSetString("value", value)
+		doc.RawSetString("start", lua.LNumber(s.start+1))
+		doc.RawSetString("stop", lua.LNumber(s.end))
+		result.Append(doc)
+	}
+	L.Push(result)
+	return 1 + pushReport(L, opts.Report)
+}
@@ -0,0 +1,59 @@
+package json
+
+import (
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestExtractDocuments(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected []string
+	}{
+		{`no json here`, nil},
+		{`level=info msg={"a":1} extra=[1,2]`, []string{`{"a":1}`, `[1,2]`}},
+		{`{"s":"}{]["} tail`, []string{`{"s":"}{]["}`}},
+		{`{"nested":{"b":[1]}}`, []string{`{"nested":{"b":[1]}}`}},
+		{`[link] {broken:1} {"ok":true}`, []string{`{"ok":true}`}},
+		{`{"a":[1}] [2]`, []string{`[2]`}},
+		{`{"open":`, nil},
+	}
+	for _, test := range tests {
+		spans := extractDocuments([]byte(test.text))
+		var docs []string
+		for _, s := range spans {
+			docs = append(docs, test.text[s.start:s.end])
+		}
+		if len(docs) != len(test.expected) {
+			t.Errorf("%q: expecting %q, got %q", test.text, test.expected, docs)
+			continue
+		}
+		for i := range docs {
+			if docs[i] != test.expected[i] {
+				t.Errorf("%q: expecting %q, got %q", test.text, test.expected, docs)
+			}
+		}
+	}
+}
+
+func TestExtract(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local text = 'result: {"id": 7, "tags": ["x"]} and [1, 2]'
+	local docs = json.extract(text)
+	assert(#docs == 2)
+	assert(docs[1].value.id == 7 and docs[1].value.tags[1] == "x")
+	assert(text:sub(docs[1].start, docs[1].stop) == '{"id": 7, "tags": ["x"]}')
+	assert(docs[2].value[2] == 2)
+	assert(text:sub(docs[2].start, docs[2].stop) == '[1, 2]')
+	assert(#json.extract("nothing") == 0)
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
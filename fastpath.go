@@ -0,0 +1,474 @@
+package json
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// defaultFastPathThreshold is the FastPathThreshold used when none is set.
+const defaultFastPathThreshold = 1 << 20
+
+// maxNesting matches the nesting limit of encoding/json.
+const maxNesting = 10000
+
+// errSyntax is returned by the fast path for malformed input; the caller
+// replaces it with the more descriptive error of encoding/json.
+var errSyntax = errors.New("invalid JSON")
+
+// fastDecoder converts a complete document held in memory straight to Lua
+// values, without the intermediate tree of json.Unmarshal or the per-token
+// allocations of json.Decoder.
+type fastDecoder struct {
+	*decoder
+	data  []byte
+	pos   int
+	depth int
+}
+
+// decodeFast decodes data with the fast path.
+func decodeFast(d *decoder, data []byte) (lua.LValue, error) {
+	f := &fastDecoder{decoder: d, data: data}
+	value, err := f.value(nil)
+	if err == nil {
+		f.space()
+		if f.pos < len(f.data) {
+			err = errSyntax
+		}
+	}
+	if err == errSyntax && f.opts.Grammar == GrammarJSON5 {
+		err = &json5Error{pos: f.pos}
+	} else if err == errSyntax {
+		var v interface{}
+		if stdErr := json.Unmarshal(data, &v); stdErr != nil {
+			err = stdErr
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func (f *fastDecoder) space() {
+	if f.opts.Grammar == GrammarJSON5 {
+		f.space5()
+		return
+	}
+	for f.pos < len(f.data) {
+		switch f.data[f.pos] {
+		case ' ', '\t', '\n', '\r':
+			f.pos++
+		default:
+			return
+		}
+	}
+}
+
+// value decodes the value starting at the current position, found at path p.
+func (f *fastDecoder) value(p path) (lua.LValue, error) {
+	value, err := f.scan(p)
+	if f.enums != nil && err == nil {
+		value = mapEnum(f.enums, value, p)
+	}
+	return value, err
+}
+
+func (f *fastDecoder) scan(p path) (lua.LValue, error) {
+	f.space()
+	if f.pos >= len(f.data) {
+		return nil, errSyntax
+	}
+	switch c := f.data[f.pos]; {
+	case c == '{':
+		return f.object(p)
+	case c == '[':
+		return f.array(p)
+	case f.opts.Grammar == GrammarJSON5:
+		return f.scan5(p)
+	case c == '"':
+		s, err := f.string()
+		if err != nil {
+			return nil, err
+		}
+		value := f.text(s, p)
+		return value, f.err
+	case c == '-', c >= '0' && c <= '9':
+		return f.number(p)
+	case (c == '+' || c == '.') && f.opts.Grammar == GrammarLenient:
+		return f.number(p)
+	case c == 't':
+		return lua.LTrue, f.literal("true")
+	case c == 'f':
+		return lua.LFalse, f.literal("false")
+	case c == 'n':
+		return f.null(), f.literal("null")
+	}
+	return nil, errSyntax
+}
+
+func (f *fastDecoder) literal(s string) error {
+	if len(f.data)-f.pos < len(s) || string(f.data[f.pos:f.pos+len(s)]) != s {
+		return errSyntax
+	}
+	f.pos += len(s)
+	return nil
+}
+
+// open enters the container starting at the current position.
+func (f *fastDecoder) open(p path) error {
+	if f.depth++; f.depth > maxNesting {
+		return errSyntax
+	}
+	if !f.container(p) {
+		return f.err
+	}
+	f.pos++
+	return nil
+}
+
+// next consumes the separator after a member or element, reporting whether
+// another one follows. JSON5 also allows a comma after the last one.
+func (f *fastDecoder) next(end byte) (bool, error) {
+	f.space()
+	if f.pos < len(f.data) {
+		switch f.data[f.pos] {
+		case ',':
+			f.pos++
+			if f.opts.Grammar == GrammarJSON5 && f.empty(end) {
+				return false, nil
+			}
+			return true, nil
+		case end:
+			f.pos++
+			f.depth--
+			return false, nil
+		}
+	}
+	return false, errSyntax
+}
+
+// empty consumes the end of the container if it has no members or elements.
+func (f *fastDecoder) empty(end byte) bool {
+	f.space()
+	if f.pos < len(f.data) && f.data[f.pos] == end {
+		f.pos++
+		f.depth--
+		return true
+	}
+	return false
+}
+
+func (f *fastDecoder) object(p path) (lua.LValue, error) {
+	if err := f.open(p); err != nil {
+		return nil, err
+	}
+	tbl := f.newObject()
+	if f.empty('}') {
+		return tbl, nil
+	}
+	seen := f.duplicates()
+	for more := true; more; {
+		key, err := f.key()
+		if err != nil {
+			return nil, err
+		}
+		f.space()
+		if f.pos >= len(f.data) || f.data[f.pos] != ':' {
+			return nil, errSyntax
+		}
+		f.pos++
+		var kp path
+		if f.paths {
+			kp = p.child(key)
+		}
+		if f.member(seen, key, kp) {
+			value, err := f.value(kp)
+			if err != nil {
+				return nil, err
+			}
+			f.setMember(tbl, key, value, kp)
+		} else if f.err != nil {
+			return nil, f.err
+		} else if err := f.skip(); err != nil {
+			return nil, err
+		}
+		if more, err = f.next('}'); err != nil {
+			return nil, err
+		}
+	}
+	if value := f.construct(tbl, p); f.err == nil {
+		return value, nil
+	}
+	return nil, f.err
+}
+
+func (f *fastDecoder) array(p path) (lua.LValue, error) {
+	if err := f.open(p); err != nil {
+		return nil, err
+	}
+	var arr lua.LValue = f.newTable(true, 0, 0)
+	if f.empty(']') {
+		return arr, nil
+	}
+	for i, more := 0, true; more; i++ {
+		var ip path
+		if f.paths {
+			ip = p.elem(i)
+		}
+		value, err := f.value(ip)
+		if err != nil {
+			return nil, err
+		}
+		arr = f.appendElem(arr, value, ip)
+		if more, err = f.next(']'); err != nil {
+			return nil, err
+		}
+	}
+	return arr, nil
+}
+
+// key decodes the member name at the current position.
+func (f *fastDecoder) key() (string, error) {
+	f.space()
+	if f.opts.Grammar == GrammarJSON5 {
+		return f.key5()
+	}
+	if f.pos >= len(f.data) || f.data[f.pos] != '"' {
+		return "", errSyntax
+	}
+	return f.string()
+}
+
+// skipKey moves past the member name at the current position.
+func (f *fastDecoder) skipKey() error {
+	f.space()
+	if f.opts.Grammar == GrammarJSON5 {
+		_, err := f.key5()
+		return err
+	}
+	if f.pos >= len(f.data) || f.data[f.pos] != '"' {
+		return errSyntax
+	}
+	_, err := f.scanString()
+	return err
+}
+
+// string decodes the string starting at the current position. Strings
+// without escapes are sliced from the input; the others are left to
+// encoding/json, which also takes care of invalid UTF-8.
+func (f *fastDecoder) string() (string, error) {
+	start := f.pos
+	simple, err := f.scanString()
+	if err != nil {
+		return "", err
+	}
+	if simple {
+		return string(f.data[start+1 : f.pos-1]), nil
+	}
+	var s string
+	if err := json.Unmarshal(f.data[start:f.pos], &s); err != nil {
+		return "", errSyntax
+	}
+	return s, nil
+}
+
+// scanString moves past the string starting at the current position,
+// reporting whether it can be used as is, without escapes.
+func (f *fastDecoder) scanString() (simple bool, err error) {
+	f.pos++
+	simple = true
+	for f.pos < len(f.data) {
+		c := f.data[f.pos]
+		switch {
+		case c == '"':
+			f.pos++
+			return simple, nil
+		case c == '\\':
+			simple = false
+			if !f.escape() {
+				return false, errSyntax
+			}
+		case c < 0x20:
+			return false, errSyntax
+		case c >= utf8.RuneSelf:
+			r, size := utf8.DecodeRune(f.data[f.pos:])
+			if r == utf8.RuneError && size == 1 {
+				if f.opts.Grammar == GrammarRFC8259 {
+					return false, fmt.Errorf("invalid UTF-8 in string at offset %d", f.pos)
+				}
+				simple = false
+			}
+			f.pos += size
+		default:
+			f.pos++
+		}
+	}
+	return false, errSyntax
+}
+
+// escape moves past the escape sequence at the current position, reporting
+// whether it is valid.
+func (f *fastDecoder) escape() bool {
+	if f.pos+1 >= len(f.data) {
+		return false
+	}
+	switch f.data[f.pos+1] {
+	case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+		f.pos += 2
+		return true
+	case 'u':
+		if f.pos+6 > len(f.data) {
+			return false
+		}
+		for _, c := range f.data[f.pos+2 : f.pos+6] {
+			if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+				return false
+			}
+		}
+		f.pos += 6
+		return true
+	}
+	return false
+}
+
+// skip moves past the value starting at the current position, checking its
+// syntax without creating anything.
+func (f *fastDecoder) skip() error {
+	f.space()
+	if f.pos >= len(f.data) {
+		return errSyntax
+	}
+	switch c := f.data[f.pos]; c {
+	case '{', '[':
+		if f.depth++; f.depth > maxNesting {
+			return errSyntax
+		}
+		f.pos++
+		end := byte(']')
+		if c == '{' {
+			end = '}'
+		}
+		if f.empty(end) {
+			return nil
+		}
+		for more := true; more; {
+			if c == '{' {
+				if err := f.skipKey(); err != nil {
+					return err
+				}
+				f.space()
+				if f.pos >= len(f.data) || f.data[f.pos] != ':' {
+					return errSyntax
+				}
+				f.pos++
+			}
+			if err := f.skip(); err != nil {
+				return err
+			}
+			var err error
+			if more, err = f.next(end); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if f.opts.Grammar == GrammarJSON5 {
+		return f.skip5()
+	}
+	switch c := f.data[f.pos]; c {
+	case '"':
+		_, err := f.scanString()
+		return err
+	case 't':
+		return f.literal("true")
+	case 'f':
+		return f.literal("false")
+	case 'n':
+		return f.literal("null")
+	}
+	if c := f.data[f.pos]; c == '-' || c >= '0' && c <= '9' ||
+		(c == '+' || c == '.') && f.opts.Grammar == GrammarLenient {
+		return f.scanNumber()
+	}
+	return errSyntax
+}
+
+func (f *fastDecoder) number(p path) (lua.LValue, error) {
+	start := f.pos
+	if err := f.scanNumber(); err != nil {
+		return nil, err
+	}
+	return f.decoder.number(string(f.data[start:f.pos]), p)
+}
+
+// scanNumber moves past the number starting at the current position.
+func (f *fastDecoder) scanNumber() error {
+	if f.opts.Grammar == GrammarLenient {
+		return f.scanLenientNumber()
+	}
+	if f.data[f.pos] == '-' {
+		f.pos++
+	}
+	switch {
+	case f.pos < len(f.data) && f.data[f.pos] == '0':
+		f.pos++
+	case f.digits() == 0:
+		return errSyntax
+	}
+	if f.pos < len(f.data) && f.data[f.pos] == '.' {
+		f.pos++
+		if f.digits() == 0 {
+			return errSyntax
+		}
+	}
+	if f.pos < len(f.data) && (f.data[f.pos] == 'e' || f.data[f.pos] == 'E') {
+		f.pos++
+		if f.pos < len(f.data) && (f.data[f.pos] == '+' || f.data[f.pos] == '-') {
+			f.pos++
+		}
+		if f.digits() == 0 {
+			return errSyntax
+		}
+	}
+	return nil
+}
+
+// scanLenientNumber moves past the number starting at the current position,
+// also accepting a leading '+', leading zeros, and a '.' without digits on
+// one side, as in "+1", "007", ".5" and "5.".
+func (f *fastDecoder) scanLenientNumber() error {
+	if c := f.data[f.pos]; c == '-' || c == '+' {
+		f.pos++
+	}
+	n := f.digits()
+	if f.pos < len(f.data) && f.data[f.pos] == '.' {
+		f.pos++
+		n += f.digits()
+	}
+	if n == 0 {
+		return errSyntax
+	}
+	if f.pos < len(f.data) && (f.data[f.pos] == 'e' || f.data[f.pos] == 'E') {
+		f.pos++
+		if f.pos < len(f.data) && (f.data[f.pos] == '+' || f.data[f.pos] == '-') {
+			f.pos++
+		}
+		if f.digits() == 0 {
+			return errSyntax
+		}
+	}
+	return nil
+}
+
+// digits consumes a run of decimal digits and returns its length.
+func (f *fastDecoder) digits() int {
+	start := f.pos
+	for f.pos < len(f.data) && f.data[f.pos] >= '0' && f.data[f.pos] <= '9' {
+		f.pos++
+	}
+	return f.pos - start
+}
@@ -0,0 +1,168 @@
+package json
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+var fastPathInputs = []string{
+	`null`, `true`, `false`, `0`, `-0.5`, `1e3`, `-12.5E-2`, `"plain"`,
+	`"esc\"aped\né😀"`, `"héllo"`, "\"bad\xffutf8\"",
+	`[]`, `{}`, ` [ 1 , null , "x" , [ ] ] `, `{"a":{"b":[1,2,{"c":null}]},"d":""}`,
+	`{"a":1,"a":2}`,
+
+	``, ` `, `nul`, `tru`, `01`, `1.`, `.5`, `-`, `1e`, `+1`, `"open`, "\"ctl\x01\"",
+	`[1,]`, `[1 2]`, `{"a"}`, `{"a":}`, `{"a":1,}`, `{a:1}`, `{"a":1]`, `[1}`,
+	`1 2`, `{} x`, `1e400`, `"\x"`, strings.Repeat("[", maxNesting+1),
+}
+
+func TestFastPath(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	for _, input := range fastPathInputs {
+		fast, fastErr := DecodeWithOptions(L, []byte(input), &DecodeOptions{})
+		tokens, tokensErr := DecodeWithOptions(L, []byte(input), &DecodeOptions{FastPathThreshold: -1})
+		var v interface{}
+		stdErr := json.Unmarshal([]byte(input), &v)
+
+		if (fastErr == nil) != (stdErr == nil) || (fastErr != nil && fastErr.Error() != stdErr.Error()) {
+			t.Errorf("%q: expecting error %v, got %v", input, stdErr, fastErr)
+			continue
+		}
+		if (fastErr == nil) != (tokensErr == nil) {
+			t.Errorf("%q: fast path error %v, token stream error %v", input, fastErr, tokensErr)
+			continue
+		}
+		if fastErr == nil && !deepEqual(fast, tokens) {
+			t.Errorf("%q: fast path %v, token stream %v", input, fast, tokens)
+		}
+	}
+}
+
+func TestFastPathOptions(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	for _, threshold := range []int{0, -1} {
+		opts := DecodeOptions{
+			FastPathThreshold: threshold,
+			WarnUnsafeInts:    true,
+			ReportDuplicates:  true,
+			DuplicateKeys:     KeepFirst,
+			Report:            &Report{},
+		}
+		value, err := DecodeWithOptions(L, []byte(`{"a":[9007199254740994],"b":1,"b":2}`), &opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b := value.(*lua.LTable).RawGetString("b"); b != lua.LNumber(1) {
+			t.Errorf("threshold %d: expecting first member, got %v", threshold, b)
+		}
+		r := opts.Report
+		if len(r.UnsafeInts) != 1 || r.UnsafeInts[0] != "$.a[0]" || len(r.Duplicates) != 1 || r.Duplicates[0] != "$.b" {
+			t.Errorf("threshold %d: unexpected report %+v", threshold, r)
+		}
+
+		opts = DecodeOptions{FastPathThreshold: threshold, MaxDepth: 2}
+		if _, err := DecodeWithOptions(L, []byte(`[[[1]]]`), &opts); err == nil {
+			t.Errorf("threshold %d: expecting max_depth error", threshold)
+		}
+	}
+}
+
+var benchmarkDocument = []byte(`{"id":12345,"name":"gopher","tags":["lua","json","go"],` +
+	`"active":true,"score":98.6,"owner":{"id":1,"email":"team@example.com"},"parent":null}`)
+
+func benchmarkDecode(b *testing.B, threshold int) {
+	L := lua.NewState()
+	defer L.Close()
+
+	opts := DecodeOptions{FastPathThreshold: threshold}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchmarkDocument)))
+	for i := 0; i < b.N; i++ {
+		if _, err := DecodeWithOptions(L, benchmarkDocument, &opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeFastPath(b *testing.B) {
+	benchmarkDecode(b, 0)
+}
+
+func BenchmarkDecodeTokens(b *testing.B) {
+	benchmarkDecode(b, -1)
+}
+
+func BenchmarkDecodeUnmarshal(b *testing.B) {
+	L := lua.NewState()
+	defer L.Close()
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchmarkDocument)))
+	for i := 0; i < b.N; i++ {
+		var value interface{}
+		if err := json.Unmarshal(benchmarkDocument, &value); err != nil {
+			b.Fatal(err)
+		}
+		DecodeValue(L, value)
+	}
+}
+
+func TestGrammar(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	tests := []struct {
+		input   string
+		grammar Grammar
+		value   lua.LValue
+	}{
+		{`[+1]`, GrammarLenient, lua.LNumber(1)},
+		{`[007]`, GrammarLenient, lua.LNumber(7)},
+		{`[.5]`, GrammarLenient, lua.LNumber(0.5)},
+		{`[-5.]`, GrammarLenient, lua.LNumber(-5)},
+		{`[1e2]`, GrammarLenient, lua.LNumber(100)},
+		{`[+1]`, GrammarECMA404, nil},
+		{`[007]`, GrammarRFC8259, nil},
+		{`[.]`, GrammarLenient, nil},
+		{`[+]`, GrammarLenient, nil},
+		{"[\"\xff\"]", GrammarECMA404, lua.LString("�")},
+		{"[\"\xff\"]", GrammarRFC8259, nil},
+		{`["é"]`, GrammarRFC8259, lua.LString("é")},
+	}
+	for _, test := range tests {
+		for _, threshold := range []int{0, -1} {
+			value, err := DecodeWithOptions(L, []byte(test.input), &DecodeOptions{Grammar: test.grammar, FastPathThreshold: threshold})
+			if test.value == nil {
+				if err == nil {
+					t.Errorf("%q, grammar %d: expecting error", test.input, test.grammar)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%q, grammar %d: %v", test.input, test.grammar, err)
+				continue
+			}
+			if got := value.(*lua.LTable).RawGetInt(1); got != test.value {
+				t.Errorf("%q, grammar %d: expecting %v, got %v", test.input, test.grammar, test.value, got)
+			}
+		}
+	}
+
+	const str = `
+	local json = require("json")
+	assert(json.decode("[+1, .5]", {grammar = "lenient"})[2] == 0.5)
+	assert(json.decode("[+1]") == nil)
+	assert(not pcall(json.decode, "[]", {grammar = "yaml"}))
+	`
+	Preload(L)
+	if err := L.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,213 @@
+package json
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// WithFieldNameMapper makes json.encode name the fields of the Go structs
+// held by userdata, when reflect_userdata is enabled, with fn applied to
+// their Go names. Fields with a name in their json tag keep that name. For
+// example, WithFieldNameMapper(SnakeCase) encodes a field UserID as user_id.
+func WithFieldNameMapper(fn func(string) string) Option {
+	return func(c *config) {
+		c.encode.FieldNameMapper = fn
+	}
+}
+
+// SnakeCase converts a Go identifier to snake_case, keeping acronyms
+// together: UserID becomes user_id and HTTPServer http_server.
+func SnakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+var (
+	marshalerType     = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	interfaceType     = reflect.TypeOf((*interface{})(nil)).Elem()
+)
+
+// mapFields returns a value that encoding/json encodes like v, except that
+// the untagged fields of structs are named by mapper. Values implementing
+// json.Marshaler or encoding.TextMarshaler, and Lua values, are left as they
+// are.
+func mapFields(v reflect.Value, mapper func(string) string) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	if v.CanInterface() {
+		if lv, ok := v.Interface().(lua.LValue); ok {
+			return lv
+		}
+	}
+	if t := v.Type(); t.Implements(marshalerType) || t.Implements(textMarshalerType) {
+		return v.Interface()
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return mapFields(v.Elem(), mapper)
+	case reflect.Struct:
+		if reflect.PtrTo(v.Type()).Implements(marshalerType) && v.CanAddr() {
+			return v.Addr().Interface()
+		}
+		var fields orderedFields
+		addFields(&fields, v, mapper)
+		return fields
+	case reflect.Slice:
+		if v.IsNil() || v.Type().Elem().Kind() == reflect.Uint8 {
+			// Byte slices are encoded in base64.
+			return v.Interface()
+		}
+		fallthrough
+	case reflect.Array:
+		elems := make([]interface{}, v.Len())
+		for i := range elems {
+			elems[i] = mapFields(v.Index(i), mapper)
+		}
+		return elems
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		m := reflect.MakeMapWithSize(reflect.MapOf(v.Type().Key(), interfaceType), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			value := reflect.ValueOf(mapFields(iter.Value(), mapper))
+			if !value.IsValid() {
+				value = reflect.Zero(interfaceType)
+			}
+			m.SetMapIndex(iter.Key(), value)
+		}
+		return m.Interface()
+	}
+	return v.Interface()
+}
+
+// addFields appends the fields of the struct v to fields, following the
+// rules of encoding/json for tags and embedded structs: fields of embedded
+// structs are promoted, unless a field of the outer struct has their name.
+func addFields(fields *orderedFields, v reflect.Value, mapper func(string) string) {
+	t := v.Type()
+	var embedded []reflect.Value
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		fv := v.Field(i)
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				if fv.Kind() == reflect.Ptr {
+					if fv.IsNil() {
+						continue
+					}
+					fv = fv.Elem()
+				}
+				embedded = append(embedded, fv)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if strings.Contains(","+opts+",", ",omitempty,") && isEmptyValue(fv) {
+			continue
+		}
+		if name == "" {
+			name = mapper(f.Name)
+		}
+		fields.add(name, mapFields(fv, mapper), false)
+	}
+	for _, ev := range embedded {
+		var promoted orderedFields
+		addFields(&promoted, ev, mapper)
+		for _, f := range promoted {
+			fields.add(f.name, f.value, true)
+		}
+	}
+}
+
+// isEmptyValue reports whether v is empty in the sense of the omitempty
+// option of encoding/json.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+	return v.IsZero() && v.Kind() != reflect.Struct
+}
+
+// orderedFields is a JSON object whose members are encoded in order, as
+// those of structs are.
+type orderedFields []namedField
+
+type namedField struct {
+	name  string
+	value interface{}
+}
+
+// add appends a member, or replaces the member with the same name unless
+// promoted is set.
+func (o *orderedFields) add(name string, value interface{}, promoted bool) {
+	for i := range *o {
+		if (*o)[i].name == name {
+			if !promoted {
+				(*o)[i].value = value
+			}
+			return
+		}
+	}
+	*o = append(*o, namedField{name: name, value: value})
+}
+
+func (o orderedFields) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, f := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, err := json.Marshal(f.name)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
@@ -0,0 +1,84 @@
+package json
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestSnakeCase(t *testing.T) {
+	tests := map[string]string{
+		"Name":       "name",
+		"UserID":     "user_id",
+		"HTTPServer": "http_server",
+		"ID":         "id",
+		"Field2Name": "field2_name",
+		"already_ok": "already_ok",
+		"":           "",
+	}
+	for in, expected := range tests {
+		if got := SnakeCase(in); got != expected {
+			t.Errorf("%s: expecting %s, got %s", in, expected, got)
+		}
+	}
+}
+
+type mappedBase struct {
+	CreatedAt time.Time
+	Owner     string
+}
+
+type mappedUser struct {
+	*mappedBase
+	UserID   int
+	Name     string `json:"display"`
+	Nickname string `json:",omitempty"`
+	Secret   string `json:"-"`
+	Owner    string
+	Tags     []string
+	Extra    map[string]mappedTag
+	Raw      json.RawMessage
+	private  int
+}
+
+type mappedTag struct {
+	TagName string
+}
+
+func TestFieldNameMapper(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	user := &mappedUser{
+		mappedBase: &mappedBase{CreatedAt: created, Owner: "base"},
+		UserID:     7,
+		Name:       "gopher",
+		Secret:     "x",
+		Owner:      "outer",
+		Extra:      map[string]mappedTag{"k": {TagName: "v"}},
+		Raw:        json.RawMessage(`{"KeepCase":1}`),
+	}
+	data, err := EncodeWithOptions(&lua.LUserData{Value: user}, &EncodeOptions{ReflectUserData: true, FieldNameMapper: SnakeCase})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"user_id":7,"display":"gopher","owner":"outer","tags":null,"extra":{"k":{"tag_name":"v"}},"raw":{"KeepCase":1},"created_at":"2024-01-02T03:04:05Z"}`
+	if string(data) != expected {
+		t.Fatalf("expecting %s, got %s", expected, data)
+	}
+
+	const str = `
+	local json = require("json")
+	assert(json.encode({u = user}) == '{"u":{"tag_name":"lua"}}')
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s, WithUserDataReflection(), WithFieldNameMapper(SnakeCase))
+	ud := s.NewUserData()
+	ud.Value = mappedTag{TagName: "lua"}
+	s.SetGlobal("user", ud)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
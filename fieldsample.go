@@ -0,0 +1,72 @@
+package json
+
+import (
+	"sync/atomic"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// FieldSampler is called during a conversion with the path of each object
+// member and array element, such as $.items[0].id, and its JSON type:
+// "object", "array", "string", "number", "boolean" or "null".
+type FieldSampler func(path, kind string)
+
+// defaultFieldSampleRate is the rate used by WithFieldSampler unless
+// WithFieldSampleRate sets another.
+const defaultFieldSampleRate = 100
+
+// fieldSampling picks the conversions of scripts that call a FieldSampler.
+type fieldSampling struct {
+	sampler FieldSampler
+	rate    uint64
+	n       atomic.Uint64
+}
+
+// next returns the sampler if the next conversion is sampled, and nil
+// otherwise.
+func (s *fieldSampling) next() FieldSampler {
+	if s == nil || (s.n.Add(1)-1)%s.rate != 0 {
+		return nil
+	}
+	return s.sampler
+}
+
+// fieldSampling returns the sampling shared by the encode and decode options,
+// creating it on first use.
+func (c *config) fieldSampling() *fieldSampling {
+	if c.encode.sampling == nil {
+		s := &fieldSampling{rate: defaultFieldSampleRate}
+		c.encode.sampling = s
+		c.decode.sampling = s
+	}
+	return c.encode.sampling
+}
+
+// WithFieldSampler makes the conversions of scripts, both decoding and
+// encoding, call sampler with every value they read or write, so that hosts
+// can learn which fields scripts use without changing them. Only one
+// conversion in every 100 is sampled, unless WithFieldSampleRate sets
+// another rate.
+func WithFieldSampler(sampler FieldSampler) Option {
+	return func(c *config) {
+		c.fieldSampling().sampler = sampler
+	}
+}
+
+// WithFieldSampleRate makes the sampler of WithFieldSampler see one
+// conversion in every rate; 1 samples them all.
+func WithFieldSampleRate(rate int) Option {
+	return func(c *config) {
+		if rate < 1 {
+			rate = 1
+		}
+		c.fieldSampling().rate = uint64(rate)
+	}
+}
+
+// sample passes value, found at path p, to the FieldSampler option.
+func (d *decoder) sample(value lua.LValue, p path) {
+	if d.opts.FieldSampler != nil {
+		d.opts.FieldSampler(p.String(), jsonType(value))
+	}
+}
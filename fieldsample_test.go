@@ -0,0 +1,57 @@
+package json
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestFieldSampler(t *testing.T) {
+	const str = `
+	local json = require("json")
+	assert(json.decode('{"user": {"id": 1, "tags": ["a", null]}, "ok": true}', {keep_nulls = true}))
+	assert(json.decode('{"skipped": 1}'))
+	assert(json.encode({event = {at = 5}}))
+	assert(json.encode({skipped = 1}))
+	`
+	var got []string
+	sampler := func(path, kind string) {
+		got = append(got, path+" "+kind)
+	}
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s, WithFieldSampler(sampler), WithFieldSampleRate(2))
+	if err := s.DoString(str); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"$.user.id number",
+		"$.user.tags[0] string",
+		"$.user.tags[1] null",
+		"$.user.tags array",
+		"$.user object",
+		"$.ok boolean",
+		"$.event object",
+		"$.event.at number",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestFieldSamplerOptions(t *testing.T) {
+	s := lua.NewState()
+	defer s.Close()
+
+	kinds := make(map[string]string)
+	opts := &DecodeOptions{FieldSampler: func(path, kind string) { kinds[path] = kind }, FastPathThreshold: -1}
+	if _, err := DecodeWithOptions(s, []byte(`{"a": [1], "b": {"c": "x"}}`), opts); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"$.a[0]": "number", "$.a": "array", "$.b.c": "string", "$.b": "object"}
+	if !reflect.DeepEqual(kinds, want) {
+		t.Errorf("got %v, want %v", kinds, want)
+	}
+}
@@ -0,0 +1,74 @@
+package json
+
+import (
+	"net"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// formats holds the checks of the format keyword of JSON Schema, by format.
+// Strings with other formats are accepted.
+var formats = map[string]func(string) bool{
+	"date-time": func(s string) bool {
+		_, err := time.Parse(time.RFC3339Nano, strings.ToUpper(s))
+		return err == nil
+	},
+	"date": func(s string) bool {
+		_, err := time.Parse("2006-01-02", s)
+		return err == nil
+	},
+	"time": func(s string) bool {
+		_, err := time.Parse("15:04:05.999999999Z07:00", strings.ToUpper(s))
+		return err == nil
+	},
+	"email": func(s string) bool {
+		addr, err := mail.ParseAddress(s)
+		return err == nil && addr.Address == s
+	},
+	"hostname": isHostname,
+	"uri": func(s string) bool {
+		u, err := url.Parse(s)
+		return err == nil && u.IsAbs()
+	},
+	"uri-reference": func(s string) bool {
+		_, err := url.Parse(s)
+		return err == nil
+	},
+	"uuid": uuidPattern.MatchString,
+	"ipv4": func(s string) bool {
+		ip := net.ParseIP(s)
+		return ip != nil && !strings.Contains(s, ":")
+	},
+	"ipv6": func(s string) bool {
+		ip := net.ParseIP(s)
+		return ip != nil && strings.Contains(s, ":")
+	},
+	"regex": func(s string) bool {
+		_, err := regexp.Compile(s)
+		return err == nil
+	},
+}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// isHostname reports whether s is a valid host name as defined by RFC 1123.
+func isHostname(s string) bool {
+	if s == "" || len(s) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(s, "."), ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for i := 0; i < len(label); i++ {
+			c := label[i]
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,62 @@
+package json
+
+import (
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestFormats(t *testing.T) {
+	tests := []struct {
+		format string
+		valid  []string
+		bad    []string
+	}{
+		{"date-time", []string{"2024-02-29T12:30:00Z", "2024-01-01t00:00:00.5+02:00"}, []string{"2023-02-29T12:30:00Z", "2024-01-01 00:00:00Z", "2024-01-01T00:00:00"}},
+		{"date", []string{"2024-12-31"}, []string{"2024-13-01", "24-01-01"}},
+		{"time", []string{"23:59:59Z", "08:00:00.25-05:00"}, []string{"24:00:00Z", "08:00"}},
+		{"email", []string{"jo@example.com"}, []string{"jo", "Jo <jo@example.com>"}},
+		{"hostname", []string{"example.com", "a-b.c"}, []string{"-a.com", "a..b", "a_b.com"}},
+		{"uri", []string{"https://example.com/a?b#c", "urn:isbn:0451450523"}, []string{"/relative", "http://[::1"}},
+		{"uri-reference", []string{"/relative", "#frag"}, []string{"http://[::1"}},
+		{"uuid", []string{"123e4567-e89b-12d3-a456-426614174000"}, []string{"123e4567e89b12d3a456426614174000"}},
+		{"ipv4", []string{"192.168.0.1"}, []string{"256.0.0.1", "01.2.3.4", "::1"}},
+		{"ipv6", []string{"::1", "2001:db8::ff00:42:8329"}, []string{"192.168.0.1", "2001:db8:::1"}},
+		{"regex", []string{"^a+$"}, []string{"("}},
+	}
+	for _, test := range tests {
+		check := formats[test.format]
+		for _, s := range test.valid {
+			if !check(s) {
+				t.Errorf("%s: expecting %q to be valid", test.format, s)
+			}
+		}
+		for _, s := range test.bad {
+			if check(s) {
+				t.Errorf("%s: expecting %q to be invalid", test.format, s)
+			}
+		}
+	}
+}
+
+func TestSchemaFormatsLua(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local schema = {properties = {id = {format = "uuid"}, when = {format = "date-time"}, x = {format = "x-custom"}}}
+	local doc = {id = "nope", when = "yesterday", x = "anything"}
+
+	assert(json.schema_compile(schema):validate(doc))
+	local ok, errs = json.schema_compile(schema, {formats = true}):validate(doc)
+	assert(not ok and #errs == 2)
+	assert(errs[1] == "$.id: string is not a valid uuid")
+	assert(errs[2] == "$.when: string is not a valid date-time")
+	assert(json.schema_compile(schema, {formats = true}):validate({id = 1}) == true)
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,90 @@
+package json
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// splitFrontMatter splits the front matter delimited by lines of "---" at
+// the start of s from the body that follows. The closing line may also be
+// "...". ok is false when s does not start with front matter.
+func splitFrontMatter(s string) (meta, body string, ok bool) {
+	s = strings.TrimPrefix(s, "\ufeff")
+	first, rest, found := cutLine(s)
+	if !found || strings.TrimRight(first, " \t") != "---" {
+		return "", s, false
+	}
+	for offset := 0; ; {
+		text, next, found := cutLine(rest[offset:])
+		if t := strings.TrimRight(text, " \t"); t == "---" || t == "..." {
+			return rest[:offset], next, true
+		}
+		if !found {
+			return "", s, false
+		}
+		offset = len(rest) - len(next)
+	}
+}
+
+// cutLine returns the first line of s, without its line ending, and the rest
+// of s. found is false when s has no line ending.
+func cutLine(s string) (line, rest string, found bool) {
+	line, rest, found = strings.Cut(s, "\n")
+	return strings.TrimSuffix(line, "\r"), rest, found
+}
+
+// decodeFrontMatter decodes front matter written in JSON, when it starts with
+// a brace, and in YAML otherwise. Its first line is the second line of the
+// document.
+func decodeFrontMatter(L *lua.LState, meta string, opts *DecodeOptions) (lua.LValue, error) {
+	const line = 2
+	data := []byte(meta)
+	if trimmed := strings.TrimSpace(meta); strings.HasPrefix(trimmed, "{") {
+		data = []byte(trimmed)
+	} else {
+		value, err := parseYAML(meta, line)
+		if err != nil {
+			return nil, err
+		}
+		if value == nil {
+			value = map[string]interface{}{}
+		}
+		if _, ok := value.(map[string]interface{}); !ok {
+			return nil, fmt.Errorf("line %d: mapping expected", line)
+		}
+		// Encoding the values lets the decode options apply to them.
+		if data, err = json.Marshal(value); err != nil {
+			return nil, err
+		}
+	}
+	value, err := DecodeWithOptions(L, data, opts)
+	if tbl, ok := value.(*lua.LTable); ok && isEmptyTable(tbl) && tbl.Metatable == lua.LNil {
+		// Keep empty front matter an object when it is encoded again.
+		tbl.Metatable = L.GetTypeMetatable("json.object_hint")
+	}
+	return value, err
+}
+
+// apiFrontMatter returns the decoded front matter of a document, or nil when
+// it has none, and the body of the document.
+func (m *module) apiFrontMatter(L *lua.LState) int {
+	str := L.CheckString(1)
+	opts, _ := checkDecodeOptions(L, 2, m.decode)
+
+	meta, body, ok := splitFrontMatter(str)
+	if !ok {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(body))
+		return 2
+	}
+	value, err := decodeFrontMatter(L, meta, &opts)
+	if err != nil {
+		L.RaiseError("front matter: %s", err.Error())
+	}
+	L.Push(value)
+	L.Push(lua.LString(body))
+	return 2
+}
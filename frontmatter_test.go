@@ -0,0 +1,62 @@
+package json
+
+import (
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestSplitFrontMatter(t *testing.T) {
+	tests := []struct {
+		in, meta, body string
+		ok             bool
+	}{
+		{"---\na: 1\n---\nbody\n", "a: 1\n", "body\n", true},
+		{"---\r\na: 1\r\n...\r\nbody", "a: 1\r\n", "body", true},
+		{"\ufeff---\n---\n", "", "", true},
+		{"---\na: 1\n---", "a: 1\n", "", true},
+		{"--- \na: 1\n--- \nx", "a: 1\n", "x", true},
+		{"---\na: 1\n", "", "---\na: 1\n", false},
+		{"no front matter\n---\n", "", "no front matter\n---\n", false},
+		{"----\n---\n", "", "----\n---\n", false},
+	}
+	for _, test := range tests {
+		meta, body, ok := splitFrontMatter(test.in)
+		if meta != test.meta || body != test.body || ok != test.ok {
+			t.Errorf("%q: expecting %q, %q, %v, got %q, %q, %v", test.in, test.meta, test.body, test.ok, meta, body, ok)
+		}
+	}
+}
+
+func TestFrontMatter(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local meta, body = json.front_matter("---\ntitle: Hello\ntags: [go, lua]\ndraft: false\n---\n# Hello\n")
+	assert(meta.title == "Hello" and meta.tags[2] == "lua" and meta.draft == false)
+	assert(body == "# Hello\n")
+
+	meta, body = json.front_matter('---\n{"title": "JSON", "n": 2}\n---\nbody')
+	assert(meta.title == "JSON" and body == "body")
+
+	meta, body = json.front_matter("plain text")
+	assert(meta == nil and body == "plain text")
+
+	meta = json.front_matter("---\n---\n")
+	assert(next(meta) == nil and json.encode(meta) == "{}")
+
+	meta = json.front_matter("---\nsize: 12\n---\n", {coerce = {["$.size"] = "number"}})
+	assert(meta.size == 12)
+
+	local ok, err = pcall(json.front_matter, "---\ntitle: a\n  bad: 1\n---\n")
+	assert(not ok and err:find("front matter: line 3: unexpected indentation", 1, true), err)
+	ok, err = pcall(json.front_matter, "---\n- a\n---\n")
+	assert(not ok and err:find("front matter: line 2: mapping expected", 1, true), err)
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
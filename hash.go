@@ -0,0 +1,109 @@
+package json
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+
+	"github.com/yuin/gopher-lua"
+)
+
+var hashAlgorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// canonicalize returns a copy of value without the members and elements at
+// the paths matched by exclude, with the objects and arrays held by Object
+// and Array userdata converted to tables, so that it encodes with sorted keys.
+func canonicalize(L *lua.LState, value lua.LValue, p path, exclude []pathPattern) lua.LValue {
+	excluded := func(p path) bool {
+		for _, pp := range exclude {
+			if pp.match(p) {
+				return true
+			}
+		}
+		return false
+	}
+	switch v := value.(type) {
+	case *lua.LTable:
+		if n, array := isArray(v); array && n > 0 {
+			t := L.CreateTable(n, 0)
+			for i := 1; i <= n; i++ {
+				if !excluded(p.elem(i - 1)) {
+					elem := v.RawGetInt(i)
+					if elem == lua.LNil {
+						elem = Null
+					}
+					t.Append(canonicalize(L, elem, p.elem(i-1), exclude))
+				}
+			}
+			return t
+		}
+		t := L.CreateTable(0, 0)
+		v.ForEach(func(key, member lua.LValue) {
+			if k, ok := key.(lua.LString); ok && !excluded(p.child(string(k))) {
+				t.RawSet(key, canonicalize(L, member, p.child(string(k)), exclude))
+			}
+		})
+		return t
+	case *lua.LUserData:
+		if a, ok := v.Value.(*Array); ok {
+			t := L.CreateTable(a.Len(), 0)
+			for i := 0; i < a.Len(); i++ {
+				if !excluded(p.elem(i)) {
+					elem := a.Get(i)
+					if elem == lua.LNil {
+						elem = Null
+					}
+					t.Append(canonicalize(L, elem, p.elem(i), exclude))
+				}
+			}
+			return t
+		}
+		o, ok := v.Value.(*Object)
+		if !ok {
+			return value
+		}
+		t := L.CreateTable(0, len(o.keys))
+		for i, key := range o.keys {
+			if !excluded(p.child(key)) {
+				t.RawSetString(key, canonicalize(L, o.values[i], p.child(key), exclude))
+			}
+		}
+		return t
+	}
+	return value
+}
+
+// apiHash returns the hexadecimal digest of the canonical encoding of a
+// value.
+func apiHash(L *lua.LState) int {
+	value := L.CheckAny(1)
+	opts := checkOptions(L, 2)
+	algo := opts.string("algo", "sha256")
+	newHash, ok := hashAlgorithms[algo]
+	if !ok {
+		L.ArgError(2, "unknown hash algorithm "+algo)
+	}
+	exclude, err := parsePathPatterns(opts.strings("exclude"))
+	if err != nil {
+		L.ArgError(2, err.Error())
+	}
+
+	data, err := EncodeWithOptions(canonicalize(L, value, nil, exclude), &EncodeOptions{SortKeys: true})
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	h := newHash()
+	h.Write(data)
+	L.Push(lua.LString(hex.EncodeToString(h.Sum(nil))))
+	return 1
+}
@@ -0,0 +1,37 @@
+package json
+
+import (
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestHashLua(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local a = json.decode('{"id":1,"items":[{"sku":"x","at":5},{"sku":"y","at":6}],"timestamp":100}')
+	local b = json.decode('{"timestamp":200,"items":[{"at":7,"sku":"x"},{"at":8,"sku":"y"}],"id":1}')
+
+	assert(json.hash({}) == "4f53cda18c2baa0c0354bb5f9a3ecbe5ed12ab4d8e11ba873c2f11161202b945")
+	assert(json.hash(a) ~= json.hash(b))
+	local opts = {exclude = {"$.timestamp", "$.items[*].at"}}
+	assert(json.hash(a, opts) == json.hash(b, opts))
+	assert(#json.hash(a, {algo = "sha512"}) == 128)
+	assert(json.hash("x", {algo = "md5"}) == "3fbf839fa0e778a20326ddc34f5cd588")
+	assert(json.hash(a, {exclude = {"$.items[1]"}}) ~= json.hash(a))
+
+	local ordered = json.decode('{"b":1,"a":2}', {objects = "userdata"})
+	assert(json.hash(ordered) == json.hash({a = 2, b = 1}))
+
+	assert(not pcall(json.hash, a, {algo = "crc"}))
+	local digest, err = json.hash({f = print})
+	assert(digest == nil and err)
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,207 @@
+package json
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/yuin/gopher-lua"
+)
+
+const int64TypeName = "json.int64"
+
+// BigInts selects how decoding converts integers beyond 2^53, which a Lua
+// number, a float64, cannot represent exactly.
+type BigInts int
+
+const (
+	// BigIntsFloat converts them to the nearest number, like other numbers.
+	BigIntsFloat BigInts = iota
+	// BigIntsString converts them to strings holding their digits.
+	BigIntsString
+	// BigIntsInt64 converts those that fit in an int64 to Int64 userdata,
+	// which encode back as the same number.
+	BigIntsInt64
+)
+
+var bigIntsNames = map[string]BigInts{
+	"float":  BigIntsFloat,
+	"string": BigIntsString,
+	"int64":  BigIntsInt64,
+}
+
+// Int64 is the value of the userdata that hold the integers decoded with
+// BigIntsInt64. Scripts can compare them with each other and convert them
+// to strings; json.int64 creates them from strings.
+type Int64 int64
+
+// WithBigInts makes json.decode convert integers beyond 2^53 with policy,
+// unless scripts pass the big_ints option.
+func WithBigInts(policy BigInts) Option {
+	return func(c *config) {
+		c.decode.BigInts = policy
+	}
+}
+
+// WithBigIntStrings makes json.encode encode integers beyond 2^53 as
+// strings, which JavaScript reads without losing digits, and json.decode
+// convert such strings back with its BigInts policy, as if scripts passed
+// the big_ints_as_strings option to both.
+func WithBigIntStrings() Option {
+	return func(c *config) {
+		c.encode.BigInts = BigIntsString
+		c.decode.BigIntStrings = true
+	}
+}
+
+func registerInt64(L *lua.LState) {
+	mt := L.NewTypeMetatable(int64TypeName)
+	L.SetFuncs(mt, map[string]lua.LGFunction{
+		"__tostring": int64String,
+		"__eq":       int64Compare(func(a, b Int64) bool { return a == b }),
+		"__lt":       int64Compare(func(a, b Int64) bool { return a < b }),
+		"__le":       int64Compare(func(a, b Int64) bool { return a <= b }),
+		"__concat":   int64Concat,
+	})
+}
+
+func newInt64(L *lua.LState, n int64) *lua.LUserData {
+	ud := L.NewUserData()
+	ud.Value = Int64(n)
+	ud.Metatable = L.GetTypeMetatable(int64TypeName)
+	return ud
+}
+
+func checkInt64(L *lua.LState, n int) Int64 {
+	ud := L.CheckUserData(n)
+	i, ok := ud.Value.(Int64)
+	if !ok {
+		L.ArgError(n, "json int64 expected")
+	}
+	return i
+}
+
+// int64Value returns the integer held by v, when v is Int64 userdata.
+func int64Value(v lua.LValue) (Int64, bool) {
+	if ud, ok := v.(*lua.LUserData); ok {
+		i, ok := ud.Value.(Int64)
+		return i, ok
+	}
+	return 0, false
+}
+
+func int64String(L *lua.LState) int {
+	L.Push(lua.LString(strconv.FormatInt(int64(checkInt64(L, 1)), 10)))
+	return 1
+}
+
+func int64Compare(cmp func(a, b Int64) bool) lua.LGFunction {
+	return func(L *lua.LState) int {
+		L.Push(lua.LBool(cmp(checkInt64(L, 1), checkInt64(L, 2))))
+		return 1
+	}
+}
+
+// int64Concat concatenates integers as their digits, like numbers.
+func int64Concat(L *lua.LState) int {
+	var s string
+	for n := 1; n <= 2; n++ {
+		if i, ok := int64Value(L.Get(n)); ok {
+			s += strconv.FormatInt(int64(i), 10)
+		} else {
+			s += L.CheckString(n)
+		}
+	}
+	L.Push(lua.LString(s))
+	return 1
+}
+
+// apiInt64 creates an integer from a string of digits, or a number.
+func apiInt64(L *lua.LState) int {
+	var n int64
+	switch v := L.CheckAny(1).(type) {
+	case lua.LNumber:
+		if float64(v) != float64(int64(v)) {
+			L.ArgError(1, "integer expected")
+		}
+		n = int64(v)
+	case lua.LString:
+		var err error
+		if n, err = strconv.ParseInt(string(v), 10, 64); err != nil {
+			L.ArgError(1, "invalid int64 "+strconv.Quote(string(v)))
+		}
+	default:
+		L.TypeError(1, lua.LTString)
+	}
+	L.Push(newInt64(L, n))
+	return 1
+}
+
+// quoteBigInt returns the JSON string holding the digits of v when it is an
+// integer beyond 2^53, a number or Int64 userdata, and policy is
+// BigIntsString.
+func quoteBigInt(v lua.LValue, policy BigInts) ([]byte, bool) {
+	if policy != BigIntsString {
+		return nil, false
+	}
+	switch v := v.(type) {
+	case lua.LNumber:
+		if isUnsafeInt(float64(v)) {
+			return strconv.AppendQuote(nil, strconv.FormatFloat(float64(v), 'f', -1, 64)), true
+		}
+	case *lua.LUserData:
+		if i, ok := v.Value.(Int64); ok && (i > maxSafeInt || i < -maxSafeInt) {
+			return strconv.AppendQuote(nil, strconv.FormatInt(int64(i), 10)), true
+		}
+	}
+	return nil, false
+}
+
+// isBigIntString reports whether s holds the digits of an integer beyond
+// 2^53, as encoded with BigIntsString.
+func isBigIntString(s string) bool {
+	digits := strings.TrimPrefix(s, "-")
+	// 2^53 has 16 digits.
+	if len(digits) < 16 || digits[0] == '0' {
+		return false
+	}
+	for i := 0; i < len(digits); i++ {
+		if digits[i] < '0' || digits[i] > '9' {
+			return false
+		}
+	}
+	f, _ := strconv.ParseFloat(s, 64)
+	return f >= maxSafeInt || f <= -maxSafeInt
+}
+
+// number converts the JSON number s, found at path p, applying the BigInts
+// option to integers beyond 2^53.
+func (d *decoder) number(s string, p path) (lua.LValue, error) {
+	if integerNumbers {
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return lua.LNumber(i), nil
+		}
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, errSyntax
+	}
+	if d.opts.BigInts != BigIntsFloat && (f >= maxSafeInt || f <= -maxSafeInt) {
+		// Literals rounding to 2^53 may be beyond it.
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err == nil && (i > maxSafeInt || i < -maxSafeInt) {
+			if d.opts.BigInts == BigIntsString {
+				return d.str(s, false), nil
+			}
+			return newInt64(d.L, i), nil
+		}
+		// Strings keep the digits of integers beyond the int64 range too.
+		if errors.Is(err, strconv.ErrRange) && d.opts.BigInts == BigIntsString {
+			return d.str(s, false), nil
+		}
+	}
+	if d.opts.WarnUnsafeInts {
+		d.opts.Report.checkText(p, s)
+	}
+	return lua.LNumber(f), nil
+}
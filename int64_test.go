@@ -0,0 +1,105 @@
+package json
+
+import (
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestBigInts(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local doc = '{"id":9007199254740993,"n":-9223372036854775808,"small":42,"big":1e300,"huge":18446744073709551616}'
+
+	local v = json.decode(doc, {big_ints = "string"})
+	assert(v.id == "9007199254740993")
+	assert(v.n == "-9223372036854775808")
+	assert(v.small == 42)
+	assert(v.big == 1e300)
+	assert(v.huge == "18446744073709551616")
+	assert(json.decode("[-12345678901234567890]", {big_ints = "string"})[1] == "-12345678901234567890")
+
+	v = json.decode(doc, {big_ints = "int64"})
+	assert(type(v.id) == "userdata")
+	assert(tostring(v.id) == "9007199254740993")
+	assert(v.id == json.int64("9007199254740993"))
+	assert(v.id ~= json.int64("9007199254740992"))
+	assert(v.n < v.id and v.n <= v.n)
+	assert("id " .. v.id == "id 9007199254740993")
+	assert(json.encode(v.id) == "9007199254740993")
+	assert(json.encode({v.n}) == "[-9223372036854775808]")
+	assert(json.int64(12) == json.int64("12"))
+
+	local _, err, report = json.decode('[9007199254740993,18446744073709551616]', {big_ints = "int64", warn_unsafe_int = true})
+	assert(#report.unsafe_ints == 1 and report.unsafe_ints[1] == "$[1]", report.unsafe_ints[1])
+
+	assert(not pcall(json.decode, "1", {big_ints = "bignum"}))
+	assert(not pcall(json.int64, "12x"))
+	assert(not pcall(json.int64, 1.5))
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBigIntsTokenDecoder(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local v = json.decode('{"id":9007199254740993,"list":[1,2.5]}')
+	assert(tostring(v.id) == "9007199254740993")
+	assert(v.list[1] == 1 and v.list[2] == 2.5)
+	assert(json.encode(v.id) == "9007199254740993")
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s, WithBigInts(BigIntsInt64), WithFastPathThreshold(-1))
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFromLValueInt64(t *testing.T) {
+	s := lua.NewState()
+	defer s.Close()
+
+	v, err := FromLValue(newInt64(s, 1<<60))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != int64(1<<60) {
+		t.Fatalf("expecting 1<<60, got %v", v)
+	}
+}
+
+func TestBigIntsAsStrings(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local doc = json.decode('{"id":9007199254740993,"n":18014398509481984,"small":42}', {big_ints = "int64"})
+	local out = json.encode(doc, {big_ints_as_strings = true})
+	assert(out == '{"id":"9007199254740993","n":"18014398509481984","small":42}', out)
+	assert(json.encode(doc, {big_ints_as_strings = true, max_depth = 4}) == out)
+	assert(json.encode(doc) == '{"id":9007199254740993,"n":18014398509481984,"small":42}')
+	local _, _, report = json.encode(doc, {big_ints_as_strings = true, warn_unsafe_int = true})
+	assert(#report.unsafe_ints == 0)
+
+	local back = json.decode(out, {big_ints = "int64", big_ints_as_strings = true})
+	assert(back.id == doc.id and back.small == 42)
+	back = json.decode(out, {big_ints_as_strings = true})
+	assert(back.n == 2^54)
+	back = json.decode('["9007199254740992", "123", "09007199254740993", "-9007199254740993x"]', {big_ints_as_strings = true})
+	assert(back[1] == 2^53 and back[2] == "123" and back[3] == "09007199254740993" and back[4] == "-9007199254740993x")
+	assert(json.decode(out).id == "9007199254740993")
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,101 @@
+package json
+
+import (
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// checkWriter returns a writer for argument n, which is either a userdata
+// wrapping an io.Writer or a value with a write method.
+func checkWriter(L *lua.LState, n int) io.Writer {
+	v := L.CheckAny(n)
+	if ud, ok := v.(*lua.LUserData); ok {
+		if w, ok := ud.Value.(io.Writer); ok {
+			return w
+		}
+	}
+	if L.GetField(v, "write").Type() != lua.LTFunction {
+		L.ArgError(n, "writer expected")
+	}
+	return &luaWriter{L: L, obj: v}
+}
+
+// luaWriter writes to a Lua value by calling its write method.
+type luaWriter struct {
+	L   *lua.LState
+	obj lua.LValue
+}
+
+func (w *luaWriter) Write(p []byte) (int, error) {
+	err := w.L.CallByParam(lua.P{
+		Fn:      w.L.GetField(w.obj, "write"),
+		NRet:    2,
+		Protect: true,
+	}, w.obj, lua.LString(p))
+	if err != nil {
+		return 0, err
+	}
+	ret, msg := w.L.Get(-2), w.L.Get(-1)
+	w.L.Pop(2)
+	if ret == lua.LNil || ret == lua.LFalse {
+		if msg == lua.LNil {
+			return 0, errors.New("write failed")
+		}
+		return 0, errors.New(msg.String())
+	}
+	return len(p), nil
+}
+
+// checkReader returns a reader for argument n, which is either a string, a
+// userdata wrapping an io.Reader or a value with a read method, such as a
+// file opened by the io library.
+func checkReader(L *lua.LState, n int) io.Reader {
+	v := L.CheckAny(n)
+	switch v := v.(type) {
+	case lua.LString:
+		return strings.NewReader(string(v))
+	case *lua.LUserData:
+		if r, ok := v.Value.(io.Reader); ok {
+			return r
+		}
+	}
+	if L.GetField(v, "read").Type() != lua.LTFunction {
+		L.ArgError(n, "reader expected")
+	}
+	return &luaReader{L: L, obj: v}
+}
+
+// luaReader reads from a Lua value by calling its read method with the
+// number of bytes wanted. A nil result is the end of the stream, unless an
+// error message follows it.
+type luaReader struct {
+	L   *lua.LState
+	obj lua.LValue
+}
+
+func (r *luaReader) Read(p []byte) (int, error) {
+	err := r.L.CallByParam(lua.P{
+		Fn:      r.L.GetField(r.obj, "read"),
+		NRet:    2,
+		Protect: true,
+	}, r.obj, lua.LNumber(len(p)))
+	if err != nil {
+		return 0, err
+	}
+	ret, msg := r.L.Get(-2), r.L.Get(-1)
+	r.L.Pop(2)
+	s, ok := ret.(lua.LString)
+	if !ok {
+		if msg != lua.LNil {
+			return 0, errors.New(msg.String())
+		}
+		return 0, io.EOF
+	}
+	if len(s) > len(p) {
+		return 0, errors.New("read returned more bytes than requested")
+	}
+	return copy(p, s), nil
+}
@@ -1,8 +1,16 @@
 package json
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
 
 	"github.com/yuin/gopher-lua"
 )
@@ -11,47 +19,339 @@ import (
 // has been preloaded, it can be loaded using require:
 //
 //	local json = require("json")
-func Preload(L *lua.LState) {
-	L.PreloadModule("json", Loader)
+func Preload(L *lua.LState, opts ...Option) {
+	L.PreloadModule("json", NewLoader(opts...))
 }
 
 // Loader is the module loader function.
 func Loader(L *lua.LState) int {
-	t := L.NewTable()
-	L.SetFuncs(t, api)
-	L.Push(t)
-	return 1
+	return NewLoader()(L)
 }
 
-var api = map[string]lua.LGFunction{
-	"decode": apiDecode,
-	"encode": apiEncode,
+// NewLoader returns a module loader function configured with the given
+// options.
+func NewLoader(opts ...Option) lua.LGFunction {
+	c := newConfig(opts)
+	return func(L *lua.LState) int {
+		m := &module{config: c}
+		registerBuffer(L)
+		registerError(L)
+		registerPushParser(L)
+		registerObject(L)
+		registerArray(L)
+		registerSchema(L)
+		registerBuilder(L)
+		registerFrozen(L)
+		registerSealed(L)
+		registerTypeHints(L)
+		registerOpaque(L)
+		registerInt64(L)
+		t := L.NewTable()
+		L.SetFuncs(t, m.api())
+		t.RawSetString("null", Null)
+		for name, w := range wildcards {
+			t.RawSetString(name, w)
+		}
+		L.Push(t)
+		return 1
+	}
+}
+
+// module holds the state of a loaded json module.
+type module struct {
+	*config
+
+	// schemas caches the documents loaded by the schema loader of the host,
+	// and keywords holds the custom keywords registered by scripts.
+	schemas  map[string]lua.LValue
+	keywords map[string]*lua.LFunction
+}
+
+func (m *module) api() map[string]lua.LGFunction {
+	return map[string]lua.LGFunction{
+		"decode": m.apiDecode,
+		"encode": m.apiEncode,
+		"stats":  m.apiStats,
+		"valid":  apiValid,
+		"typeof": apiTypeOf,
+		"object": apiTypeHint("object"),
+		"array":  apiTypeHint("array"),
+		"int64":  apiInt64,
+
+		"decode5":           m.apiDecode5,
+		"decode_object":     m.apiDecodeKind("object"),
+		"decode_array":      m.apiDecodeKind("array"),
+		"decode_range":      m.apiDecodeRange,
+		"decode_opaque":     m.apiDecodeOpaque,
+		"decode_into":       apiDecodeInto,
+		"decode_file":       m.apiDecodeFile,
+		"seal":              m.apiSeal,
+		"register_class":    m.apiRegisterClass,
+		"decode_columns":    m.apiDecodeColumns,
+		"decode_projection": m.apiDecodeProjection,
+		"get_many":          m.apiGetMany,
+		"decode_jwt":        m.apiDecodeJWT,
+		"destructure":       m.apiDestructure,
+		"pick":              m.apiPick,
+		"extract":           m.apiExtract,
+		"encode_rows":       m.apiEncodeRows,
+		"encode_chunks":     m.apiEncodeChunks,
+		"encode_to_buffer":  m.apiEncodeToBuffer,
+		"encode_to":         m.apiEncodeTo,
+		"build":             m.apiBuild,
+		"lines":             m.apiLines,
+		"decode_stream":     m.apiDecodeStream,
+		"sse":               m.apiSSE,
+		"front_matter":      m.apiFrontMatter,
+		"push_parser":       m.apiPushParser,
+
+		"at":              apiAt,
+		"pointer_get":     apiPointerGet,
+		"pointer_set":     apiPointerSet,
+		"patch_apply":     apiPatchApply,
+		"patch_apply_raw": m.apiPatchApplyRaw,
+		"patch_invert":    apiPatchInvert,
+		"patch_compose":   apiPatchCompose,
+		"patch_diff":      apiPatchDiff,
+		"merge":           apiMerge,
+		"merge_patch":     apiMergePatch,
+		"diff_text":       apiDiffText,
+
+		"schema_compile":          m.apiSchemaCompile,
+		"schema_register_keyword": m.apiSchemaRegisterKeyword,
+
+		"assert_equal": m.apiAssertEqual,
+		"matches":      apiMatches,
+		"map":          apiMap,
+		"repair":       apiRepair,
+		"hash":         apiHash,
+		"sign":         apiSign,
+		"verify":       apiVerify,
+		"envelope":     m.apiEnvelope,
+		"rpc_request":  m.apiRPCRequest,
+
+		"try_decode": protect("decode", func(L *lua.LState) int { return m.decodeString(L, true) }),
+		"try_encode": protect("encode", m.apiEncode),
+	}
+}
+
+// Null is the sentinel value that encodes to JSON null. It is exposed to Lua
+// as json.null, and can be used to represent null array elements and object
+// members, which plain nil cannot.
+var Null = &lua.LUserData{Value: nullValue{}}
+
+type nullValue struct{}
+
+func (m *module) apiDecode(L *lua.LState) int {
+	return m.decodeString(L, false)
+}
+
+// decodeString decodes the string argument of json.decode, returning an error
+// object on failure when objects is set or the options ask for one.
+func (m *module) decodeString(L *lua.LState, objects bool) int {
+	str := L.CheckString(1)
+	cache := m.decodeCache
+	if L.Get(2) != lua.LNil || !cache.cacheable(&m.decode) {
+		cache = nil
+	}
+	opts, lopts := checkDecodeOptions(L, 2, m.decode)
+	objects = objects || lopts.bool("error_object", m.errorObjects)
+
+	var key [sha256.Size]byte
+	if cache != nil {
+		key = sha256.Sum256([]byte(str))
+		if value, ok := cache.get(key); ok {
+			L.Push(value)
+			return 1
+		}
+	}
+	value, err := DecodeWithOptions(L, []byte(str), &opts)
+	if err != nil {
+		return pushDecodeError(L, []byte(str), err, objects)
+	}
+	if cache != nil {
+		freeze(L, value)
+		cache.put(key, value)
+	}
+	L.Push(value)
+	return 1 + pushReport(L, opts.Report)
 }
 
-func apiDecode(L *lua.LState) int {
+// apiDecodeKind returns a decode function that fails unless the top-level
+// value of the string is of the given kind.
+func (m *module) apiDecodeKind(kind string) lua.LGFunction {
+	return func(L *lua.LState) int {
+		str := L.CheckString(1)
+		if got := peekKind([]byte(str)); got != kind {
+			err := fmt.Errorf("expected %s at offset 0, got %s", kind, got)
+			return pushDecodeError(L, []byte(str), err, checkOptions(L, 2).bool("error_object", m.errorObjects))
+		}
+		return m.apiDecode(L)
+	}
+}
+
+// apiDecodeRange decodes the bytes of a string from start to stop, which
+// are interpreted like the arguments of string.sub, without creating the
+// substring in Lua.
+func (m *module) apiDecodeRange(L *lua.LState) int {
 	str := L.CheckString(1)
+	start, stop := subRange(len(str), L.CheckInt(2), L.OptInt(3, -1))
+	opts, _ := checkDecodeOptions(L, 4, m.decode)
 
-	value, err := Decode(L, []byte(str))
+	value, err := DecodeWithOptions(L, []byte(str[start:stop]), &opts)
 	if err != nil {
 		L.Push(lua.LNil)
 		L.Push(lua.LString(err.Error()))
 		return 2
 	}
 	L.Push(value)
-	return 1
+	return 1 + pushReport(L, opts.Report)
 }
 
-func apiEncode(L *lua.LState) int {
+// subRange returns the bounds of the slice of a string of length n selected
+// by string.sub(s, i, j): the indexes are 1-based and inclusive, negative
+// indexes count from the end, and the range is clamped to the string.
+func subRange(n, i, j int) (int, int) {
+	if i < 0 {
+		i += n + 1
+	}
+	if j < 0 {
+		j += n + 1
+	}
+	if i < 1 {
+		i = 1
+	}
+	if j > n {
+		j = n
+	}
+	if i > j {
+		return 0, 0
+	}
+	return i - 1, j
+}
+
+// peekKind returns the kind of the top-level value of data, judging by its
+// first byte: "object", "array", "string", "number", "boolean" or "null",
+// or "invalid" when no value can start there.
+func peekKind(data []byte) string {
+	data = bytes.TrimLeft(data, " \t\r\n")
+	if len(data) == 0 {
+		return "invalid"
+	}
+	switch c := data[0]; {
+	case c == '{':
+		return "object"
+	case c == '[':
+		return "array"
+	case c == '"':
+		return "string"
+	case c == 't', c == 'f':
+		return "boolean"
+	case c == 'n':
+		return "null"
+	case c == '-', c >= '0' && c <= '9':
+		return "number"
+	}
+	return "invalid"
+}
+
+func (m *module) apiEncode(L *lua.LState) int {
 	value := L.CheckAny(1)
+	opts, lopts := checkEncodeOptions(L, 2, m.encode)
 
-	data, err := Encode(value)
+	// Sealed documents were encoded with the options of the module.
+	if L.Get(2) == lua.LNil && opts.Report == nil {
+		if text, ok := sealedText(value); ok {
+			L.Push(text)
+			return 1
+		}
+	}
+	if lopts.bool("buffer", false) {
+		data, err := EncodeWithOptions(value, &opts)
+		if err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+		L.Push(newBuffer(L, data))
+		return 1 + pushReport(L, opts.Report)
+	}
+	data, err := encodePooled(value, &opts)
 	if err != nil {
 		L.Push(lua.LNil)
 		L.Push(lua.LString(err.Error()))
 		return 2
 	}
 	L.Push(lua.LString(string(data)))
-	return 1
+	putBuffer(data)
+	return 1 + pushReport(L, opts.Report)
+}
+
+// apiEncodeToBuffer appends the encoding of a value to a buffer, or to a new
+// one, and returns the buffer.
+func (m *module) apiEncodeToBuffer(L *lua.LState) int {
+	value := L.CheckAny(1)
+	var ud *lua.LUserData
+	if L.Get(2) == lua.LNil {
+		ud = newBuffer(L, nil)
+	} else {
+		checkBuffer(L, 2)
+		ud = L.CheckUserData(2)
+	}
+	opts, _ := checkEncodeOptions(L, 3, m.encode)
+
+	b := ud.Value.(*Buffer)
+	var err error
+	if appendable(&opts) {
+		b.data, err = encodeAppend(b.data, value, &opts)
+	} else {
+		var data []byte
+		if data, err = marshalValue(value, &opts); err == nil {
+			b.data = append(b.data, data...)
+		}
+	}
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	L.Push(ud)
+	return 1 + pushReport(L, opts.Report)
+}
+
+func (m *module) apiEncodeChunks(L *lua.LState) int {
+	value := L.CheckAny(1)
+	size := L.CheckInt(2)
+	if size <= 0 {
+		L.ArgError(2, "chunk size must be positive")
+	}
+	opts, _ := checkEncodeOptions(L, 3, m.encode)
+
+	data, err := EncodeWithOptions(value, &opts)
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	chunks := L.CreateTable((len(data)+size-1)/size, 0)
+	for len(data) > size {
+		chunks.Append(lua.LString(data[:size]))
+		data = data[size:]
+	}
+	chunks.Append(lua.LString(data))
+	L.Push(chunks)
+	return 1 + pushReport(L, opts.Report)
+}
+
+// pushReport pushes the error placeholder and report that follow a
+// successful result when reporting is enabled.
+func pushReport(L *lua.LState, r *Report) int {
+	if r == nil {
+		return 0
+	}
+	L.Push(lua.LNil)
+	L.Push(r.toTable(L))
+	return 2
 }
 
 var (
@@ -68,68 +368,317 @@ func (i invalidTypeError) Error() string {
 
 // Encode returns the JSON encoding of value.
 func Encode(value lua.LValue) ([]byte, error) {
-	return json.Marshal(jsonValue{
-		LValue:  value,
-		visited: make(map[*lua.LTable]bool),
+	return EncodeWithOptions(value, nil)
+}
+
+// EncodeWithOptions returns the JSON encoding of value using the given
+// options. A nil opts is equivalent to the zero EncodeOptions.
+func EncodeWithOptions(value lua.LValue, opts *EncodeOptions) ([]byte, error) {
+	if opts == nil {
+		opts = &EncodeOptions{}
+	}
+	if err := checkFloatFormat(opts.FloatFormat); err != nil {
+		return nil, err
+	}
+	if appendable(opts) {
+		return encodeAppend(nil, value, opts)
+	}
+	return marshalValue(value, opts)
+}
+
+// marshalValue encodes value through encoding/json, as a tree of jsonValue
+// tracking the paths needed by some options.
+func marshalValue(value lua.LValue, opts *EncodeOptions) ([]byte, error) {
+	enums, err := compileEnums(opts.Enums, true)
+	if err != nil {
+		return nil, err
+	}
+	overrides, err := compileOverrides(opts.Overrides)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(jsonValue{
+		LValue: value,
+		state: &encodeState{
+			opts:      opts,
+			visited:   make(map[*lua.LTable]bool),
+			paths:     opts.WarnUnsafeInts || opts.MaxDepth > 0 || len(enums) > 0 || opts.MemoryBudget > 0 || len(overrides) > 0 || opts.Cycles == CyclesRef || opts.FieldSampler != nil || opts.ReportDegraded,
+			enums:     enums,
+			overrides: overrides,
+			timer:     newEncodeTimer(opts),
+		},
 	})
+	if err != nil {
+		return nil, unwrapMarshalerError(err)
+	}
+	if opts.rewritesEscapes() {
+		data = rewriteEscapes(data, opts)
+	}
+	if opts.Indent != "" || opts.Prefix != "" {
+		return indentJSON(data, opts.Prefix, opts.Indent), nil
+	}
+	return data, nil
+}
+
+// indentJSON returns data formatted like json.MarshalIndent.
+func indentJSON(data []byte, prefix, indent string) []byte {
+	var b bytes.Buffer
+	b.Grow(len(data) * 2)
+	// data is valid, having been produced by json.Marshal.
+	json.Indent(&b, data, prefix, indent)
+	return b.Bytes()
+}
+
+// unwrapMarshalerError returns the error returned by the innermost
+// jsonValue, without the context added by each level of json.Marshal.
+func unwrapMarshalerError(err error) error {
+	for {
+		var me *json.MarshalerError
+		if !errors.As(err, &me) {
+			return err
+		}
+		err = me.Err
+	}
+}
+
+type encodeState struct {
+	opts    *EncodeOptions
+	visited map[*lua.LTable]bool
+
+	// paths reports whether values track their path in the document.
+	paths bool
+
+	// enums holds the compiled Enums option, mapping Lua values to JSON.
+	enums []enumRule
+	// overrides holds the compiled Overrides option.
+	overrides []override
+	// ancestors maps the tables being encoded to their path, for the
+	// CyclesRef policy.
+	ancestors map[*lua.LTable]path
+	// converting holds the userdata whose metamethod results are being
+	// encoded, to reject those that contain the userdata again.
+	converting map[*lua.LUserData]bool
+	// used is the memory charged against the MemoryBudget option.
+	used int
+	// timer enforces the Timeout option.
+	timer *encodeTimer
 }
 
 type jsonValue struct {
 	lua.LValue
-	visited map[*lua.LTable]bool
+	state *encodeState
+	path  path
+
+	// overridden is set while the policy overriding the value is applied.
+	overridden bool
+}
+
+func (j jsonValue) child(value lua.LValue, key string) jsonValue {
+	c := jsonValue{LValue: value, state: j.state}
+	if j.state.paths {
+		c.path = j.path.child(key)
+	}
+	return c
+}
+
+func (j jsonValue) elem(value lua.LValue, index int) jsonValue {
+	c := jsonValue{LValue: value, state: j.state}
+	if j.state.paths {
+		c.path = j.path.elem(index)
+	}
+	return c
 }
 
 func (j jsonValue) MarshalJSON() (data []byte, err error) {
+	defer func() {
+		if max := j.state.opts.MemoryBudget; max > 0 && err == nil {
+			// Each level of json.Marshal copies the encoding of its children.
+			j.state.used += len(data)
+			if j.state.used > max {
+				err = limitHandler(j.state.opts.OnLimit).fail("memory_budget", j.path, j.state.used, max)
+			}
+		}
+	}()
+	if err := j.state.timer.tick(); err != nil {
+		return nil, err
+	}
+	if j.state.enums != nil {
+		j.LValue = mapEnum(j.state.enums, j.LValue, j.path)
+	}
+	if sampler := j.state.opts.FieldSampler; sampler != nil && len(j.path) > 0 {
+		sampler(j.path.String(), jsonType(j.LValue))
+	}
+	if j.state.overrides != nil && !j.overridden {
+		if policy := overrideAt(j.state.overrides, j.path); policy != "" {
+			return j.marshalOverride(policy)
+		}
+	}
+	if n, ok := j.LValue.(lua.LNumber); ok {
+		if data, ok := appendInteger(nil, n); ok {
+			return data, nil
+		}
+	}
+	if data, ok := quoteBigInt(j.LValue, j.state.opts.BigInts); ok {
+		return data, nil
+	}
 	switch converted := j.LValue.(type) {
 	case lua.LBool:
 		data, err = json.Marshal(bool(converted))
 	case lua.LNumber:
-		data, err = json.Marshal(float64(converted))
+		if j.state.opts.WarnUnsafeInts {
+			j.state.opts.Report.checkNumber(j.path, float64(converted))
+		}
+		if j.state.opts.FloatFormat != "" {
+			data, err = appendFloat(nil, float64(converted), j.state.opts.FloatFormat)
+		} else {
+			data, err = formatNumber(float64(converted), j.state.opts.FloatCompat)
+		}
 	case *lua.LNilType:
 		data = []byte(`null`)
+	case *lua.LUserData:
+		if o, ok := converted.Value.(*Object); ok {
+			obj := make(map[string]jsonValue, len(o.keys))
+			for i, key := range o.keys {
+				obj[key] = j.child(o.values[i], key)
+			}
+			return j.marshalObject(obj)
+		}
+		if a, ok := converted.Value.(*Array); ok {
+			arr := make([]jsonValue, a.Len())
+			for i := range arr {
+				arr[i] = j.elem(a.Get(i), i)
+			}
+			return j.marshalArray(arr)
+		}
+		if o, ok := converted.Value.(*Opaque); ok {
+			if j.state.opts.SortKeys {
+				return sortKeys(o.data)
+			}
+			// encoding/json compacts the text of the document.
+			return o.data, nil
+		}
+		if i, ok := converted.Value.(Int64); ok {
+			return strconv.AppendInt(nil, int64(i), 10), nil
+		}
+		if converted == Null {
+			data = []byte(`null`)
+			break
+		}
+		if data, ok, err := encodeRegistered(converted); ok {
+			if err == nil && j.state.opts.SortKeys {
+				data, err = sortKeys(data)
+			}
+			return data, err
+		}
+		if j.state.opts.State != nil {
+			if data, ok, err := j.marshalMetamethod(converted); ok {
+				return data, err
+			}
+		}
+		if !j.state.opts.ReflectUserData || converted.Value == nil {
+			return nil, invalidTypeError(lua.LTUserData)
+		}
+		// Userdata made by gopher-luar, or by hosts, hold plain Go values.
+		if mapper := j.state.opts.FieldNameMapper; mapper != nil {
+			data, err = json.Marshal(mapFields(reflect.ValueOf(converted.Value), mapper))
+		} else {
+			data, err = json.Marshal(converted.Value)
+		}
+		if err == nil && j.state.opts.SortKeys {
+			data, err = sortKeys(data)
+		}
 	case lua.LString:
-		data, err = json.Marshal(string(converted))
+		data, err = marshalString(string(converted), j.state.opts.ExtraEscapes)
 	case *lua.LTable:
-		if j.visited[converted] {
-			return nil, errNested
+		if j.state.visited[converted] {
+			return j.marshalCycle(converted)
+		}
+		if max := j.state.opts.MaxDepth; max > 0 && len(j.path) >= max {
+			return nil, limitHandler(j.state.opts.OnLimit).fail("max_depth", j.path, len(j.path)+1, max)
+		}
+		j.enter(converted)
+		defer j.leave(converted)
+		if j.state.opts.TableKeys != TableKeysError {
+			if converted, err = j.withoutTableKeys(converted); err != nil {
+				return nil, err
+			}
+		}
+
+		if n, field, ok := explicitLen(converted, j.state.opts.PackedArrays); ok {
+			arr := make([]jsonValue, 0, n)
+			for key, _ := converted.Next(lua.LNil); key != lua.LNil; key, _ = converted.Next(key) {
+				if field && key == lua.LString("n") {
+					continue
+				}
+				if k, ok := key.(lua.LNumber); !ok || k < 1 || k > lua.LNumber(n) || k != lua.LNumber(int(k)) {
+					return nil, invalidKey(key)
+				}
+			}
+			for i := 1; i <= n; i++ {
+				arr = append(arr, j.elem(converted.RawGetInt(i), i-1))
+			}
+			return j.marshalArray(arr)
 		}
-		j.visited[converted] = true
 
 		key, value := converted.Next(lua.LNil)
+		tag, instance := j.classTag(converted)
 
 		switch key.Type() {
 		case lua.LTNil: // empty table
-			data = []byte(`{}`)
+			if instance {
+				typeKey := j.state.opts.typeKey()
+				data, err = j.marshalObject(map[string]jsonValue{typeKey: j.child(lua.LString(tag), typeKey)})
+			} else if isEmptyObject(converted) {
+				data = []byte(`{}`)
+			} else {
+				data = []byte(`[]`)
+			}
 		case lua.LTNumber:
 			arr := make([]jsonValue, 0, converted.Len())
 			expectedKey := lua.LNumber(1)
 			for key != lua.LNil {
 				if key.Type() != lua.LTNumber {
-					err = errInvalidKeys
+					err = invalidKey(key)
 					return
 				}
 				if expectedKey != key {
+					if j.state.opts.SparseArrays != SparseError {
+						return j.marshalSparse(converted)
+					}
 					err = errSparseArray
 					return
 				}
-				arr = append(arr, jsonValue{value, j.visited})
+				arr = append(arr, j.elem(value, len(arr)))
 				expectedKey++
 				key, value = converted.Next(key)
 			}
-			data, err = json.Marshal(arr)
+			data, err = j.marshalArray(arr)
 		case lua.LTString:
 			obj := make(map[string]jsonValue)
 			for key != lua.LNil {
 				if key.Type() != lua.LTString {
-					err = errInvalidKeys
+					err = invalidKey(key)
 					return
 				}
-				obj[key.String()] = jsonValue{value, j.visited}
+				obj[key.String()] = j.child(value, key.String())
 				key, value = converted.Next(key)
 			}
-			data, err = json.Marshal(obj)
+			if instance {
+				typeKey := j.state.opts.typeKey()
+				obj[typeKey] = j.child(lua.LString(tag), typeKey)
+			}
+			if memberOrder(converted) != nil && !j.state.opts.SortKeys {
+				keys := make([]string, 0, len(obj))
+				for key := range obj {
+					keys = append(keys, key)
+				}
+				sortMembers(converted, keys, false)
+				data, err = j.marshalMembers(obj, keys)
+			} else {
+				data, err = j.marshalObject(obj)
+			}
 		default:
-			err = errInvalidKeys
+			err = invalidKey(key)
 		}
 	default:
 		err = invalidTypeError(j.LValue.Type())
@@ -137,14 +686,274 @@ func (j jsonValue) MarshalJSON() (data []byte, err error) {
 	return
 }
 
+// truncatedKey is the key of the marker added to containers truncated by the
+// MaxArrayElems and MaxObjectMembers options.
+const truncatedKey = "$truncated"
+
+// marshalArray encodes the elements of an array, applying MaxArrayElems.
+func (j jsonValue) marshalArray(arr []jsonValue) ([]byte, error) {
+	if j.state.overrides != nil {
+		arr = j.state.withoutSkipped(arr)
+	}
+	max := j.state.opts.MaxArrayElems
+	if max <= 0 || len(arr) <= max {
+		return json.Marshal(arr)
+	}
+	if !j.state.opts.Truncate {
+		return nil, limitHandler(j.state.opts.OnLimit).fail("max_array_elems", j.path, len(arr), max)
+	}
+	data, err := json.Marshal(arr[:max])
+	if err != nil {
+		return nil, err
+	}
+	j.state.degrade(j.path, "%d elements left out", len(arr)-max)
+	marker := fmt.Sprintf(`,{"%s":%d}]`, truncatedKey, len(arr)-max)
+	return append(data[:len(data)-1], marker...), nil
+}
+
+// marshalObject encodes the members of an object, applying MaxObjectMembers.
+// Truncated objects keep the members that sort first.
+func (j jsonValue) marshalObject(obj map[string]jsonValue) ([]byte, error) {
+	return j.marshalMembers(obj, nil)
+}
+
+// marshalMembers encodes the members of an object like marshalObject, in the
+// order of keys, which lists them all, or sorted by key when keys is nil.
+func (j jsonValue) marshalMembers(obj map[string]jsonValue, keys []string) ([]byte, error) {
+	if j.state.overrides != nil {
+		for key, v := range obj {
+			if overrideAt(j.state.overrides, v.path) == OverrideSkip {
+				delete(obj, key)
+			}
+		}
+	}
+	max := j.state.opts.MaxObjectMembers
+	if keys == nil {
+		if max <= 0 || len(obj) <= max {
+			return json.Marshal(obj)
+		}
+		keys = make([]string, 0, len(obj))
+		for key := range obj {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+	} else if len(keys) > len(obj) {
+		kept := keys[:0:0]
+		for _, key := range keys {
+			if _, ok := obj[key]; ok {
+				kept = append(kept, key)
+			}
+		}
+		keys = kept
+	}
+	left := 0
+	if max > 0 && len(obj) > max {
+		if !j.state.opts.Truncate {
+			return nil, limitHandler(j.state.opts.OnLimit).fail("max_object_members", j.path, len(obj), max)
+		}
+		left = len(obj) - max
+		keys = keys[:max]
+	}
+	data := []byte{'{'}
+	for i, key := range keys {
+		if i > 0 {
+			data = append(data, ',')
+		}
+		k, _ := json.Marshal(key)
+		v, err := json.Marshal(obj[key])
+		if err != nil {
+			return nil, err
+		}
+		data = append(append(append(data, k...), ':'), v...)
+	}
+	if left > 0 {
+		j.state.degrade(j.path, "%d members left out", left)
+		data = fmt.Appendf(data, `,"%s":%d`, truncatedKey, left)
+	}
+	return append(data, '}'), nil
+}
+
+// marshalString returns the JSON encoding of s, additionally escaping every
+// rune in extra as a \u sequence.
+func marshalString(s string, extra []rune) ([]byte, error) {
+	if len(extra) == 0 {
+		return json.Marshal(s)
+	}
+	var b bytes.Buffer
+	b.WriteByte('"')
+	start := 0
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if (r != utf8.RuneError || size > 1) && containsRune(extra, r) {
+			writeEscapedSegment(&b, s[start:i])
+			writeRuneEscape(&b, r)
+			start = i + size
+		}
+		i += size
+	}
+	writeEscapedSegment(&b, s[start:])
+	b.WriteByte('"')
+	return b.Bytes(), nil
+}
+
+func containsRune(runes []rune, r rune) bool {
+	for _, c := range runes {
+		if c == r {
+			return true
+		}
+	}
+	return false
+}
+
+// writeEscapedSegment writes s with the default escaping, without quotes.
+func writeEscapedSegment(b *bytes.Buffer, s string) {
+	if s == "" {
+		return
+	}
+	data, _ := json.Marshal(s)
+	b.Write(data[1 : len(data)-1])
+}
+
+func writeRuneEscape(b *bytes.Buffer, r rune) {
+	const hex = "0123456789abcdef"
+	write := func(r rune) {
+		b.WriteString(`\u`)
+		b.WriteByte(hex[r>>12&0xf])
+		b.WriteByte(hex[r>>8&0xf])
+		b.WriteByte(hex[r>>4&0xf])
+		b.WriteByte(hex[r&0xf])
+	}
+	if r1, r2 := utf16.EncodeRune(r); r1 != utf8.RuneError {
+		write(r1)
+		write(r2)
+		return
+	}
+	write(r)
+}
+
+// maxExplicitLen is the longest array length that explicitLen accepts, so
+// that a stray length cannot make encoders allocate without bound.
+const maxExplicitLen = 1 << 20
+
+// explicitLen returns the array length declared by the table, either through
+// the __jsonlen metafield or through an "n" field as produced by table.pack.
+// The "n" field only counts for tables marked by json.array, or for all
+// tables when packed is set, as it is by the PackedArrays option, since
+// objects may well have a member named n. Elements missing from a table with
+// an explicit length are encoded as null. field reports whether the length
+// came from the "n" field, which is then not part of the encoded array.
+func explicitLen(t *lua.LTable, packed bool) (n int, field bool, ok bool) {
+	if mt, ok := t.Metatable.(*lua.LTable); ok {
+		if n, ok := mt.RawGetString("__jsonlen").(lua.LNumber); ok && n >= 0 && n <= maxExplicitLen {
+			return int(n), false, true
+		}
+		packed = packed || mt.RawGetString("__jsontype") == lua.LString("array")
+	}
+	if !packed {
+		return 0, false, false
+	}
+	if n, ok := t.RawGetString("n").(lua.LNumber); ok && n >= 0 && n <= maxExplicitLen && n == lua.LNumber(int(n)) {
+		return int(n), true, true
+	}
+	return 0, false, false
+}
+
+// isEmptyObject reports whether an empty table is an object rather than an
+// array, as tables made by json.object are: their metatable has a __jsontype
+// field of "object".
+func isEmptyObject(t *lua.LTable) bool {
+	mt, ok := t.Metatable.(*lua.LTable)
+	return ok && mt.RawGetString("__jsontype") == lua.LString("object")
+}
+
+// apiTypeHint returns a function that marks a table, or a new table, with a
+// metatable whose __jsontype field is typ.
+func apiTypeHint(typ string) lua.LGFunction {
+	return func(L *lua.LState) int {
+		t, ok := L.Get(1).(*lua.LTable)
+		switch {
+		case !ok && L.Get(1) != lua.LNil:
+			L.TypeError(1, lua.LTTable)
+		case !ok:
+			t = L.NewTable()
+		case t.Metatable != lua.LNil:
+			L.ArgError(1, "table already has a metatable")
+		}
+		t.Metatable = L.GetTypeMetatable("json." + typ + "_hint")
+		L.Push(t)
+		return 1
+	}
+}
+
+func registerTypeHints(L *lua.LState) {
+	for _, typ := range []string{"object", "array"} {
+		L.NewTypeMetatable("json."+typ+"_hint").RawSetString("__jsontype", lua.LString(typ))
+	}
+}
+
 // Decode converts the JSON encoded data to Lua values.
 func Decode(L *lua.LState, data []byte) (lua.LValue, error) {
-	var value interface{}
-	err := json.Unmarshal(data, &value)
+	return DecodeWithOptions(L, data, nil)
+}
+
+// DecodeWithOptions converts the JSON encoded data to Lua values using the
+// given options. A nil opts is equivalent to the zero DecodeOptions.
+func DecodeWithOptions(L *lua.LState, data []byte, opts *DecodeOptions) (lua.LValue, error) {
+	if opts == nil {
+		opts = &DecodeOptions{}
+	}
+	if opts.MaxBytes > 0 && len(data) > opts.MaxBytes {
+		return nil, limitHandler(opts.OnLimit).fail("max_bytes", nil, len(data), opts.MaxBytes)
+	}
+	d := newDecoder(L, opts)
+	if err := d.compile(); err != nil {
+		return nil, err
+	}
+	threshold := opts.FastPathThreshold
+	if threshold == 0 {
+		threshold = defaultFastPathThreshold
+	}
+	var value lua.LValue
+	var err error
+	// Only the fast path implements the grammars other than the default.
+	if len(data) <= threshold || opts.Grammar != GrammarECMA404 {
+		value, err = decodeFast(d, data)
+	} else {
+		value, err = decodeTokens(d, data)
+	}
+	if err == nil && d.err != nil {
+		err = d.err
+	}
 	if err != nil {
 		return nil, err
 	}
-	return DecodeValue(L, value), nil
+	return value, nil
+}
+
+// DecodeBatch decodes each of the documents. The i-th value and error
+// correspond to docs[i]; values of documents that fail to decode are nil.
+//
+// Decoding a batch shares work across the documents, such as interning the
+// object keys and short strings they have in common.
+func DecodeBatch(L *lua.LState, docs [][]byte) ([]lua.LValue, []error) {
+	values := make([]lua.LValue, len(docs))
+	errs := make([]error, len(docs))
+	d := newDecoder(L, &DecodeOptions{})
+	d.strings = make(map[string]lua.LString)
+	for i, doc := range docs {
+		// The errors of a document do not carry over to the next.
+		d.err = nil
+		value, err := decodeFast(d, doc)
+		if err == nil && d.err != nil {
+			err = d.err
+		}
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		values[i] = value
+	}
+	return values, errs
 }
 
 // DecodeValue converts the value to a Lua value.
@@ -152,30 +961,257 @@ func Decode(L *lua.LState, data []byte) (lua.LValue, error) {
 // This function only converts values that the encoding/json package decodes to.
 // All other values will return lua.LNil.
 func DecodeValue(L *lua.LState, value interface{}) lua.LValue {
+	return newDecoder(L, &DecodeOptions{}).value(value, nil)
+}
+
+type decoder struct {
+	L    *lua.LState
+	opts *DecodeOptions
+	err  error
+
+	// paths reports whether values track their path in the document.
+	paths bool
+
+	// strings, when non-nil, interns object keys and short strings.
+	strings map[string]lua.LString
+
+	// coerce holds the compiled Coerce option.
+	coerce []coercion
+
+	// enums holds the compiled Enums option.
+	enums []enumRule
+	// used is the memory charged against the MemoryBudget option.
+	used int
+
+	// objectMetatable is the metatable of Object userdata, once needed.
+	objectMetatable lua.LValue
+	// orderedNewIndex is the __newindex metamethod of ordered tables, once
+	// needed.
+	orderedNewIndex lua.LValue
+}
+
+func newDecoder(L *lua.LState, opts *DecodeOptions) *decoder {
+	return &decoder{
+		L:    L,
+		opts: opts,
+		paths: opts.WarnUnsafeInts || opts.MaxDepth > 0 || opts.ReportDuplicates || opts.DuplicateKeys == RejectDuplicates ||
+			len(opts.Coerce) > 0 || len(opts.Enums) > 0 || opts.MemoryBudget > 0 || opts.RejectKeys || opts.FieldSampler != nil ||
+			len(opts.Constructors) > 0,
+	}
+}
+
+// compile prepares the options that transform values.
+func (d *decoder) compile() (err error) {
+	if d.coerce, err = compileCoercions(d.opts.Coerce); err != nil {
+		return err
+	}
+	d.enums, err = compileEnums(d.opts.Enums, false)
+	return err
+}
+
+// container checks the limits that apply to an array or object at path p,
+// recording the error on failure.
+func (d *decoder) container(p path) bool {
+	if d.err != nil {
+		return false
+	}
+	if max := d.opts.MaxDepth; max > 0 && len(p) >= max {
+		d.err = limitHandler(d.opts.OnLimit).fail("max_depth", p, len(p)+1, max)
+		return false
+	}
+	return d.charge(tableCost, p)
+}
+
+// Approximate sizes of the values created by decoding, in bytes.
+const (
+	tableCost  = 64
+	stringCost = 16
+	entryCost  = 24
+)
+
+// charge adds n bytes, allocated for the value at path p, to the memory used
+// by the conversion, recording the error when the budget is exceeded.
+func (d *decoder) charge(n int, p path) bool {
+	if d.opts.MemoryBudget <= 0 || d.err != nil {
+		return d.err == nil
+	}
+	d.used += n
+	if d.used > d.opts.MemoryBudget {
+		d.err = limitHandler(d.opts.OnLimit).fail("memory_budget", p, d.used, d.opts.MemoryBudget)
+		return false
+	}
+	return true
+}
+
+// setMember stores the member of an object found at path p.
+func (d *decoder) setMember(obj lua.LValue, key string, value lua.LValue, p path) {
+	d.sample(value, p)
+	if !d.charge(entryCost+stringCost+len(key), p) {
+		return
+	}
+	if tbl, ok := obj.(*lua.LTable); ok {
+		k := d.str(key, true)
+		if d.opts.PreserveOrder && value != lua.LNil {
+			if order := memberOrder(tbl); order != nil && tbl.RawGetH(k) == lua.LNil {
+				order.Append(k)
+			}
+		}
+		tbl.RawSetH(k, value)
+	} else {
+		obj.(*lua.LUserData).Value.(*Object).Set(key, value)
+	}
+}
+
+// appendElem stores the element of an array found at path p, and returns the
+// array, which is converted to Array userdata once it is longer than the
+// ArrayThreshold option.
+func (d *decoder) appendElem(arr lua.LValue, value lua.LValue, p path) lua.LValue {
+	d.sample(value, p)
+	if !d.charge(entryCost, p) {
+		return arr
+	}
+	if tbl, ok := arr.(*lua.LTable); ok {
+		if max := d.opts.ArrayThreshold; max <= 0 || tbl.Len() < max {
+			tbl.Append(value)
+			return tbl
+		}
+		arr = d.toArray(tbl)
+	}
+	// Like tables, arrays leave out nil elements.
+	if value != lua.LNil {
+		arr.(*lua.LUserData).Value.(*Array).Append(value)
+	}
+	return arr
+}
+
+// maxInternLen is the length of the longest string value that is interned.
+const maxInternLen = 32
+
+func (d *decoder) str(s string, key bool) lua.LString {
+	if d.strings == nil || (!key && len(s) > maxInternLen) {
+		return lua.LString(s)
+	}
+	if interned, ok := d.strings[s]; ok {
+		return interned
+	}
+	d.strings[s] = lua.LString(s)
+	return lua.LString(s)
+}
+
+// duplicates returns the set used to track the keys of an object, or nil
+// when the options do not care about duplicate keys.
+func (d *decoder) duplicates() map[string]bool {
+	if d.opts.ReportDuplicates || d.opts.DuplicateKeys != KeepLast {
+		return make(map[string]bool)
+	}
+	return nil
+}
+
+// member records the object member with the given key, found at path p, in
+// seen and reports whether its value is to be decoded. The value of a member
+// that is not decoded is skipped, or, when an error was recorded, the
+// conversion fails.
+func (d *decoder) member(seen map[string]bool, key string, p path) bool {
+	if !d.allowedKey(key, p) {
+		return false
+	}
+	if seen == nil {
+		return true
+	}
+	if !seen[key] {
+		seen[key] = true
+		return true
+	}
+	if d.opts.ReportDuplicates && d.opts.Report != nil {
+		d.opts.Report.Duplicates = append(d.opts.Report.Duplicates, p.String())
+	}
+	if d.opts.DuplicateKeys == RejectDuplicates {
+		if d.err == nil {
+			d.err = fmt.Errorf("duplicate key %q at %s", key, p)
+		}
+		return false
+	}
+	return d.opts.DuplicateKeys != KeepFirst
+}
+
+// newTable returns a table for a decoded array or object.
+func (d *decoder) newTable(array bool, narr, nhash int) *lua.LTable {
+	if d.opts.TableAllocator != nil {
+		if t := d.opts.TableAllocator(d.L, array, narr, nhash); t != nil {
+			return t
+		}
+	}
+	if d.opts.TablePool != nil {
+		return d.opts.TablePool.Get(d.L, narr, nhash)
+	}
+	return d.L.CreateTable(narr, nhash)
+}
+
+// value converts value, found at path p. The path is only tracked when an
+// option requires it.
+func (d *decoder) value(value interface{}, p path) lua.LValue {
 	switch converted := value.(type) {
 	case bool:
 		return lua.LBool(converted)
 	case float64:
+		if d.opts.WarnUnsafeInts {
+			d.opts.Report.checkNumber(p, converted)
+		}
 		return lua.LNumber(converted)
 	case string:
-		return lua.LString(converted)
+		return d.text(converted, p)
 	case json.Number:
-		return lua.LString(converted)
+		if d.opts.BigInts == BigIntsFloat {
+			return lua.LString(converted)
+		}
+		n, err := d.number(string(converted), p)
+		if err != nil {
+			if d.err == nil {
+				d.err = err
+			}
+			return lua.LNil
+		}
+		return n
 	case []interface{}:
-		arr := L.CreateTable(len(converted), 0)
-		for _, item := range converted {
-			arr.Append(DecodeValue(L, item))
+		if !d.container(p) {
+			return lua.LNil
+		}
+		var arr lua.LValue = d.newTable(true, len(converted), 0)
+		for i, item := range converted {
+			var ip path
+			if d.paths {
+				ip = p.elem(i)
+			}
+			arr = d.appendElem(arr, d.value(item, ip), ip)
 		}
 		return arr
 	case map[string]interface{}:
-		tbl := L.CreateTable(0, len(converted))
+		if !d.container(p) {
+			return lua.LNil
+		}
+		tbl := d.newObject()
 		for key, item := range converted {
-			tbl.RawSetH(lua.LString(key), DecodeValue(L, item))
+			var kp path
+			if d.paths {
+				kp = p.child(key)
+			}
+			if d.allowedKey(key, kp) {
+				d.setMember(tbl, key, d.value(item, kp), kp)
+			}
 		}
-		return tbl
+		return d.construct(tbl, p)
 	case nil:
-		return lua.LNil
+		return d.null()
 	}
 
 	return lua.LNil
 }
+
+// null returns the value of JSON null: Null when the KeepNulls option is
+// set, and nil otherwise.
+func (d *decoder) null() lua.LValue {
+	if d.opts.KeepNulls {
+		return Null
+	}
+	return lua.LNil
+}
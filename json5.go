@@ -0,0 +1,323 @@
+package json
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// json5Error reports malformed JSON5, which encoding/json cannot describe
+// since it stops at the first extension instead.
+type json5Error struct {
+	pos int
+}
+
+func (e *json5Error) Error() string {
+	return fmt.Sprintf("invalid JSON5 at offset %d", e.pos)
+}
+
+// apiDecode5 decodes a string of JSON5, taking the options of json.decode.
+func (m *module) apiDecode5(L *lua.LState) int {
+	str := L.CheckString(1)
+	opts, lopts := checkDecodeOptions(L, 2, m.decode)
+	opts.Grammar = GrammarJSON5
+	value, err := DecodeWithOptions(L, []byte(str), &opts)
+	if err != nil {
+		return pushDecodeError(L, []byte(str), err, lopts.bool("error_object", m.errorObjects))
+	}
+	L.Push(value)
+	return 1 + pushReport(L, opts.Report)
+}
+
+// space5 moves past white space and comments, which JSON5 extends with the
+// white space of ECMAScript.
+func (f *fastDecoder) space5() {
+	for f.pos < len(f.data) {
+		c := f.data[f.pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f':
+			f.pos++
+		case c == '/' && f.pos+1 < len(f.data) && f.data[f.pos+1] == '/':
+			if i := bytes.IndexAny(f.data[f.pos:], "\n\r\u2028\u2029"); i >= 0 {
+				f.pos += i
+			} else {
+				f.pos = len(f.data)
+			}
+		case c == '/' && f.pos+1 < len(f.data) && f.data[f.pos+1] == '*':
+			i := bytes.Index(f.data[f.pos+2:], []byte("*/"))
+			if i < 0 {
+				// Left for the caller to reject.
+				return
+			}
+			f.pos += i + 4
+		case c >= utf8.RuneSelf:
+			r, size := utf8.DecodeRune(f.data[f.pos:])
+			if r != '\ufeff' && r != '\u2028' && r != '\u2029' && !unicode.Is(unicode.Zs, r) {
+				return
+			}
+			f.pos += size
+		default:
+			return
+		}
+	}
+}
+
+// scan5 decodes the scalar starting at the current position.
+func (f *fastDecoder) scan5(p path) (lua.LValue, error) {
+	switch f.data[f.pos] {
+	case '"', '\'':
+		s, err := f.string5()
+		if err != nil {
+			return nil, err
+		}
+		value := f.text(s, p)
+		return value, f.err
+	case 't':
+		return lua.LTrue, f.literal("true")
+	case 'f':
+		return lua.LFalse, f.literal("false")
+	case 'n':
+		return f.null(), f.literal("null")
+	}
+	return f.number5(p)
+}
+
+// skip5 moves past the scalar starting at the current position.
+func (f *fastDecoder) skip5() error {
+	switch f.data[f.pos] {
+	case '"', '\'':
+		_, err := f.string5()
+		return err
+	case 't':
+		return f.literal("true")
+	case 'f':
+		return f.literal("false")
+	case 'n':
+		return f.literal("null")
+	}
+	_, err := f.scanNumber5()
+	return err
+}
+
+// key5 decodes the member name at the current position, a string or an
+// identifier.
+func (f *fastDecoder) key5() (string, error) {
+	if f.pos >= len(f.data) {
+		return "", errSyntax
+	}
+	if c := f.data[f.pos]; c == '"' || c == '\'' {
+		return f.string5()
+	}
+	start := f.pos
+	for f.pos < len(f.data) {
+		r, size := utf8.DecodeRune(f.data[f.pos:])
+		if !(r == '$' || r == '_' || unicode.In(r, unicode.L, unicode.Nl) ||
+			f.pos > start && (r == '\u200c' || r == '\u200d' || unicode.In(r, unicode.Nd, unicode.Mn, unicode.Mc, unicode.Pc))) {
+			break
+		}
+		f.pos += size
+	}
+	if f.pos == start {
+		return "", errSyntax
+	}
+	return string(f.data[start:f.pos]), nil
+}
+
+// string5 decodes the string starting at the current position, quoted with
+// either ' or ". Invalid UTF-8 is replaced with U+FFFD.
+func (f *fastDecoder) string5() (string, error) {
+	quote := f.data[f.pos]
+	f.pos++
+	// buf holds the decoded string up to lit, where the run of characters
+	// copied as is starts.
+	var buf []byte
+	lit := f.pos
+	for f.pos < len(f.data) {
+		switch c := f.data[f.pos]; {
+		case c == quote:
+			s := f.data[lit:f.pos]
+			f.pos++
+			if buf == nil {
+				return string(s), nil
+			}
+			return string(append(buf, s...)), nil
+		case c == '\\':
+			buf = append(buf, f.data[lit:f.pos]...)
+			var ok bool
+			if buf, ok = f.escape5(buf); !ok {
+				return "", errSyntax
+			}
+			lit = f.pos
+		case c == '\n' || c == '\r':
+			return "", errSyntax
+		case c >= utf8.RuneSelf:
+			r, size := utf8.DecodeRune(f.data[f.pos:])
+			if r == utf8.RuneError && size == 1 {
+				buf = utf8.AppendRune(append(buf, f.data[lit:f.pos]...), r)
+				lit = f.pos + 1
+			}
+			f.pos += size
+		default:
+			f.pos++
+		}
+	}
+	return "", errSyntax
+}
+
+// escape5 appends the character of the escape sequence at the current
+// position to buf, reporting whether the sequence is valid. Line
+// continuations append nothing, and characters without a meaning of their
+// own escape themselves.
+func (f *fastDecoder) escape5(buf []byte) ([]byte, bool) {
+	if f.pos+1 >= len(f.data) {
+		return buf, false
+	}
+	c := f.data[f.pos+1]
+	f.pos += 2
+	switch c {
+	case 'b':
+		return append(buf, '\b'), true
+	case 'f':
+		return append(buf, '\f'), true
+	case 'n':
+		return append(buf, '\n'), true
+	case 'r':
+		return append(buf, '\r'), true
+	case 't':
+		return append(buf, '\t'), true
+	case 'v':
+		return append(buf, '\v'), true
+	case '0':
+		if f.pos < len(f.data) && f.data[f.pos] >= '0' && f.data[f.pos] <= '9' {
+			return buf, false
+		}
+		return append(buf, 0), true
+	case '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		return buf, false
+	case 'x':
+		r, ok := f.hexRune(2)
+		return utf8.AppendRune(buf, r), ok
+	case 'u':
+		r, ok := f.hexRune(4)
+		if ok && utf16.IsSurrogate(r) {
+			r1 := r
+			r = utf8.RuneError
+			if f.pos+2 <= len(f.data) && f.data[f.pos] == '\\' && f.data[f.pos+1] == 'u' {
+				f.pos += 2
+				var r2 rune
+				if r2, ok = f.hexRune(4); ok {
+					r = utf16.DecodeRune(r1, r2)
+				}
+			}
+		}
+		return utf8.AppendRune(buf, r), ok
+	case '\r':
+		if f.pos < len(f.data) && f.data[f.pos] == '\n' {
+			f.pos++
+		}
+		return buf, true
+	case '\n':
+		return buf, true
+	}
+	if c >= utf8.RuneSelf {
+		r, size := utf8.DecodeRune(f.data[f.pos-1:])
+		f.pos += size - 1
+		if r == '\u2028' || r == '\u2029' {
+			return buf, true
+		}
+		return utf8.AppendRune(buf, r), true
+	}
+	return append(buf, c), true
+}
+
+// hexRune decodes the n hexadecimal digits at the current position.
+func (f *fastDecoder) hexRune(n int) (rune, bool) {
+	if f.pos+n > len(f.data) {
+		return 0, false
+	}
+	var r rune
+	for _, c := range f.data[f.pos : f.pos+n] {
+		d, ok := hexDigit(c)
+		if !ok {
+			return 0, false
+		}
+		r = r<<4 | rune(d)
+	}
+	f.pos += n
+	return r, true
+}
+
+func hexDigit(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+func (f *fastDecoder) number5(p path) (lua.LValue, error) {
+	start := f.pos
+	hex, err := f.scanNumber5()
+	if err != nil {
+		return nil, err
+	}
+	s := string(f.data[start:f.pos])
+	switch {
+	case hex:
+		sign := ""
+		if s[0] == '-' || s[0] == '+' {
+			sign, s = s[:1], s[1:]
+		}
+		n, _ := new(big.Int).SetString(s[2:], 16)
+		s = sign + n.String()
+	case strings.HasSuffix(s, "NaN"):
+		// strconv.ParseFloat rejects a sign before NaN.
+		s = "NaN"
+	}
+	return f.decoder.number(s, p)
+}
+
+// scanNumber5 moves past the number starting at the current position,
+// reporting whether it is hexadecimal. Besides the numbers of the lenient
+// grammar, JSON5 has Infinity, NaN and hexadecimal integers, all of which may
+// be signed.
+func (f *fastDecoder) scanNumber5() (hex bool, err error) {
+	start := f.pos
+	if c := f.data[f.pos]; c == '-' || c == '+' {
+		f.pos++
+	}
+	rest := f.data[f.pos:]
+	switch {
+	case bytes.HasPrefix(rest, []byte("Infinity")):
+		f.pos += len("Infinity")
+		return false, nil
+	case bytes.HasPrefix(rest, []byte("NaN")):
+		f.pos += len("NaN")
+		return false, nil
+	case len(rest) > 1 && rest[0] == '0' && (rest[1] == 'x' || rest[1] == 'X'):
+		f.pos += 2
+		n := 0
+		for ; f.pos < len(f.data); f.pos++ {
+			if _, ok := hexDigit(f.data[f.pos]); !ok {
+				break
+			}
+			n++
+		}
+		if n == 0 {
+			return false, errSyntax
+		}
+		return true, nil
+	}
+	f.pos = start
+	return false, f.scanLenientNumber()
+}
@@ -0,0 +1,78 @@
+package json
+
+import (
+	"math"
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestDecode5(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local config = assert(json.decode5([[
+	// Service configuration.
+	{
+		name: 'api',   /* single quotes */
+		$port: 0x1F90,
+		"ratio": .5,
+		limits: {max: +10, min: -0x10,},
+		hosts: ['a', "b",],
+		msg: 'it\'s \x41é \
+ok',
+	}
+	]]))
+	assert(config.name == "api")
+	assert(config["$port"] == 8080)
+	assert(config.ratio == 0.5)
+	assert(config.limits.max == 10 and config.limits.min == -16)
+	assert(#config.hosts == 2 and config.hosts[2] == "b")
+	assert(config.msg == "it's A\195\169 ok", config.msg)
+
+	assert(json.decode5("Infinity") == 1/0)
+	assert(json.decode5("-Infinity") == -1/0)
+	local nan = json.decode5("-NaN")
+	assert(nan ~= nan)
+	assert(json.decode('{a: 1}', {grammar = "json5"}).a == 1)
+
+	local _, err = json.decode5("{a: 1,, }")
+	assert(err == "invalid JSON5 at offset 6", err)
+	_, err = json.decode5("[1] /* open")
+	assert(err == "invalid JSON5 at offset 4", err)
+	_, err = json.decode5("'\\1'")
+	assert(err == "invalid JSON5 at offset 3", err)
+	_, err = json.decode("{a: 1}")
+	assert(err ~= nil)
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDecodeJSON5Strings(t *testing.T) {
+	s := lua.NewState()
+	defer s.Close()
+
+	opts := &DecodeOptions{Grammar: GrammarJSON5}
+	for in, want := range map[string]string{
+		`"\uD83D\uDE00"`: "\U0001F600",
+		`'\uD83D'`:       "\uFFFD",
+		`'a\0b'`:         "a\x00b",
+		"'a\\\r\nb'":     "ab",
+		`'\q\"'`:         `q"`,
+		"'\xff'":         "\uFFFD",
+	} {
+		value, err := DecodeWithOptions(s, []byte(in), opts)
+		if err != nil || value != lua.LString(want) {
+			t.Errorf("%s: got %v, %v, want %q", in, value, err, want)
+		}
+	}
+	value, err := DecodeWithOptions(s, []byte("-0x8000000000000000"), opts)
+	if err != nil || value != lua.LNumber(math.MinInt64) {
+		t.Errorf("got %v, %v", value, err)
+	}
+}
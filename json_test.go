@@ -97,3 +97,543 @@ func TestDecodeValue_jsonNumber(t *testing.T) {
 		t.Fatalf("expecting LString, got %T", v)
 	}
 }
+
+func TestEncodeNull(t *testing.T) {
+	const str = `
+	local json = require("json")
+	assert(json.encode({1, json.null, 3}) == "[1,null,3]")
+	assert(json.encode({a = json.null}) == '{"a":null}')
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEncodeExplicitLength(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local packed = {packed_arrays = true}
+	assert(json.encode({1, nil, 3, n = 4}, packed) == "[1,null,3,null]")
+	assert(json.encode({n = 0}, packed) == "[]")
+	assert(json.encode(json.array({1, nil, 3, n = 4})) == "[1,null,3,null]")
+	assert(json.encode({1, json.null, 3}) == "[1,null,3]")
+	assert(json.encode(setmetatable({"a", nil, "c"}, {__jsonlen = 4})) == '["a",null,"c",null]')
+
+	local _, err = json.encode({1, 2, 3, n = 2}, packed)
+	assert(string.find(err, "mixed or invalid key types"))
+
+	local _, err = json.encode({1, name = "Tim", n = 1}, packed)
+	assert(string.find(err, "mixed or invalid key types"))
+
+	-- Without packed_arrays, n is an ordinary member.
+	assert(json.encode(json.decode('{"n":2}')) == '{"n":2}')
+	assert(json.encode({n = 2, name = "x"}) == '{"n":2,"name":"x"}')
+	assert(json.schema_compile('{"properties":{"n":{"type":"object"}}}'):validate({n = {n = {n = 1}}}))
+
+	-- Lengths beyond 2^20 are ignored.
+	assert(json.encode({n = 1e15}, packed) == '{"n":1000000000000000}')
+	assert(json.encode(setmetatable({1}, {__jsonlen = 1e15})) == "[1]")
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDecodeBatch(t *testing.T) {
+	s := lua.NewState()
+	defer s.Close()
+
+	values, errs := DecodeBatch(s, [][]byte{
+		[]byte(`{"id":1}`),
+		[]byte(`{"id":`),
+		[]byte(`{"id":3}`),
+		[]byte(`{"id":4} x`),
+		[]byte(`[5, "five"]`),
+	})
+	if len(values) != 5 || len(errs) != 5 {
+		t.Fatalf("expecting 5 results, got %d values and %d errors", len(values), len(errs))
+	}
+	for i, failed := range []bool{false, true, false, true, false} {
+		if (errs[i] != nil) != failed || (values[i] == nil) != failed {
+			t.Fatalf("document %d: unexpected value %v and error %v", i, values[i], errs[i])
+		}
+	}
+	if id := values[2].(*lua.LTable).RawGetString("id"); id != lua.LNumber(3) {
+		t.Fatalf("expecting id = 3, got %v", id)
+	}
+	if v := values[4].(*lua.LTable).RawGetInt(2); v != lua.LString("five") {
+		t.Fatalf("expecting five, got %v", v)
+	}
+}
+
+func TestEncodeBuffer(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local buf = json.encode({1, 2, 3}, {buffer = true})
+	assert(type(buf) == "userdata")
+	assert(buf:len() == 7)
+	assert(#buf == 7)
+	assert(buf:tostring() == "[1,2,3]")
+	assert(tostring(buf) == "[1,2,3]")
+
+	local out = {}
+	local sink = {write = function(self, s) table.insert(out, s) return self end}
+	assert(buf:write_to(sink))
+	assert(table.concat(out) == "[1,2,3]")
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUnsafeIntWarnings(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local str, err, report = json.encode({id = 2^53 + 2, ok = 2^53, list = {1, -2^60}}, {warn_unsafe_int = true})
+	assert(str and err == nil)
+	assert(#report.unsafe_ints == 2)
+	assert(report.unsafe_ints[1] == "$.id")
+	assert(report.unsafe_ints[2] == "$.list[1]")
+
+	str, err, report = json.encode({2^64, 2^63, -2^70, 2^53, 0.5}, {warn_unsafe_int = true})
+	assert(#report.unsafe_ints == 3 and report.unsafe_ints[3] == "$[2]", #report.unsafe_ints)
+
+	local _, _, report = json.decode('[9007199254740993,9007199254740992,9007199254740991,12345678901234567890,-18446744073709551616,1e20,0.5]', {warn_unsafe_int = true})
+	assert(#report.unsafe_ints == 3 and report.unsafe_ints[1] == "$[0]" and report.unsafe_ints[3] == "$[4]")
+	local _, _, report = json.decode('[-9007199254740993,-9007199254740992]', {warn_unsafe_int = true})
+	assert(#report.unsafe_ints == 1 and report.unsafe_ints[1] == "$[0]")
+
+	local value, err, report = json.decode('{"a":{"b":[9007199254740994]},"c":1}', {warn_unsafe_int = true})
+	assert(value.c == 1 and err == nil)
+	assert(#report.unsafe_ints == 1)
+	assert(report.unsafe_ints[1] == "$.a.b[0]")
+
+	assert(select("#", json.decode("1")) == 1)
+	`
+	// Both the fast path and the token path classify the number text.
+	for _, threshold := range []int{0, -1} {
+		s := lua.NewState()
+		Preload(s, WithFastPathThreshold(threshold))
+		if err := s.DoString(str); err != nil {
+			t.Errorf("threshold %d: %v", threshold, err)
+		}
+		s.Close()
+	}
+}
+
+func TestReportDegraded(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local loop = {name = "loop"}
+	loop.self = loop
+	local doc = {loop = loop, list = {1, 2, 3}, obj = {a = 1, b = 2, c = 3, d = 4, e = 5}, keys = {[{}] = 1, x = 2}}
+	local str, err, report = json.encode(doc, {
+		report_degraded = true, cycles = "null", table_keys = "skip",
+		max_array_elems = 2, max_object_members = 4, truncate = true,
+	})
+	assert(str and err == nil, err)
+	assert(#report.degraded == 4, #report.degraded)
+	local reasons = {}
+	for _, d in ipairs(report.degraded) do
+		reasons[d.path] = d.reason
+	end
+	assert(reasons["$.keys"] == "member with a table key left out")
+	assert(reasons["$.list"] == "1 elements left out")
+	assert(reasons["$.loop.self"] == "cyclic table replaced by null")
+	assert(reasons["$.obj"] == "1 members left out")
+
+	local str, err, report = json.encode({1, 2}, {report_degraded = true})
+	assert(str == "[1,2]" and #report.degraded == 0)
+	assert(select("#", json.encode(doc, {cycles = "null", table_keys = "skip"})) == 1)
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestExtraEscapes(t *testing.T) {
+	data, err := EncodeWithOptions(lua.LString("a/b\U0001F600é"), &EncodeOptions{ExtraEscapes: []rune{'/', '\U0001F600', 'é'}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `"a\u002fb\ud83d\ude00\u00e9"`; string(data) != expected {
+		t.Fatalf("expecting %s, got %s", expected, data)
+	}
+
+	const str = `
+	local json = require("json")
+	assert(json.encode("<a|b>", {extra_escapes = "|"}) == [["\u003ca\u007cb\u003e"]])
+	assert(json.encode("a~b") == [["a\u007eb"]])
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s, WithExtraEscapes('~'))
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTryEncodeDecode(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local ok, value = json.try_decode('{"a":1}')
+	assert(ok == true and value.a == 1)
+	ok, value = json.try_decode("null")
+	assert(ok == true and value == nil)
+	ok, value = json.try_decode(" null ", {warn_unsafe_int = true})
+	assert(ok == true and value == nil)
+
+	local ok, err = json.try_decode("{")
+	assert(ok == false)
+	assert(err.kind == "decode")
+	assert(type(err.msg) == "string")
+	assert(tostring(err) == err.msg)
+
+	assert(err.offset == 1 and err.line == 1 and err.col == 1)
+
+	ok, err = json.try_decode('{\n  "a": 1,\n  "b": x\n}')
+	assert(ok == false and err.offset == 20 and err.line == 3 and err.col == 8, err.col)
+	ok, err = json.try_decode('{"a":1}', {max_bytes = 2})
+	assert(ok == false and err.offset == nil and err.kind == "decode")
+
+	local ok, err = json.try_decode()
+	assert(ok == false and err.kind == "decode")
+
+	local _, err = json.decode("[1,\n2,,3]")
+	assert(type(err) == "string")
+	_, err = json.decode("[1,\n2,,3]", {error_object = true})
+	assert(err.kind == "decode" and err.line == 2 and err.col == 3 and err.offset == 7)
+	_, err = json.decode_object("[]", {error_object = true})
+	assert(err.msg == "expected object at offset 0, got array")
+
+	local ok, str = json.try_encode({1, 2})
+	assert(ok == true and str == "[1,2]")
+
+	local ok, err = json.try_encode(function() end)
+	assert(ok == false and err.kind == "encode")
+	assert(string.find(err.msg, "cannot encode function"))
+
+	local ok, err = json.try_encode(1, {buffer = 1})
+	assert(ok == false and string.find(tostring(err), "buffer"))
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEncodeChunks(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local chunks = json.encode_chunks({1, 2, 3}, 3)
+	assert(#chunks == 3)
+	assert(chunks[1] == "[1," and chunks[2] == "2,3" and chunks[3] == "]")
+	assert(table.concat(json.encode_chunks({a = "hello"}, 100)) == '{"a":"hello"}')
+	assert(#json.encode_chunks({1, 2}, 5) == 1)
+	assert(not pcall(json.encode_chunks, 1, 0))
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDecodeObjectArray(t *testing.T) {
+	const str = `
+	local json = require("json")
+	assert(json.decode_object(' {"a":1}').a == 1)
+	assert(json.decode_array('[1]')[1] == 1)
+
+	local value, err = json.decode_object('[1]')
+	assert(value == nil and err == "expected object at offset 0, got array")
+
+	local value, err = json.decode_array('"x"')
+	assert(value == nil and err == "expected array at offset 0, got string")
+
+	local value, err = json.decode_array('')
+	assert(value == nil and err == "expected array at offset 0, got invalid")
+
+	local value, err = json.decode_object('{')
+	assert(value == nil and err)
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDuplicateKeys(t *testing.T) {
+	const str = `
+	local json = require("json")
+	assert(json.decode('{"a":1,"a":2}').a == 2)
+	assert(json.decode('{"a":1,"a":2}', {duplicate_keys = "first"}).a == 1)
+
+	local value, err, report = json.decode('{"a":1,"b":{"c":1,"c":null},"a":3}', {report_duplicates = true})
+	assert(value.a == 3 and value.b.c == nil and err == nil)
+	assert(#report.duplicates == 2)
+	assert(report.duplicates[1] == "$.b.c" and report.duplicates[2] == "$.a")
+
+	local value, err, report = json.decode('{"a":1,"a":2}', {report_duplicates = true, duplicate_keys = "first"})
+	assert(value.a == 1 and report.duplicates[1] == "$.a")
+
+	local _, err = json.decode('{"a":{"b":1,"b":2}}', {reject_duplicate_keys = true})
+	assert(err == 'duplicate key "b" at $.a.b', err)
+	_, err = json.decode('[{"x":1},{"x":1,"x":1}]', {duplicate_keys = "error"})
+	assert(err == 'duplicate key "x" at $[1].x', err)
+	assert(json.decode('{"a":1,"b":2}', {reject_duplicate_keys = true}).b == 2)
+
+	assert(not pcall(json.decode, '{}', {duplicate_keys = "error!"}))
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRejectDuplicates(t *testing.T) {
+	s := lua.NewState()
+	defer s.Close()
+
+	for _, threshold := range []int{0, -1} {
+		opts := &DecodeOptions{DuplicateKeys: RejectDuplicates, FastPathThreshold: threshold}
+		_, err := DecodeWithOptions(s, []byte(`{"a":[{"k":1,"k":1}]}`), opts)
+		if err == nil || err.Error() != `duplicate key "k" at $.a[0].k` {
+			t.Errorf("threshold %d: expecting duplicate key error, got %v", threshold, err)
+		}
+	}
+}
+
+func TestPosition(t *testing.T) {
+	data := []byte("{\n\t\"a\": tru\n}")
+	tests := []struct {
+		offset    int64
+		line, col int
+	}{{0, 1, 1}, {1, 1, 1}, {2, 1, 2}, {3, 2, 1}, {10, 2, 8}, {12, 2, 10}, {13, 3, 1}, {99, 3, 1}}
+	for _, test := range tests {
+		if line, col := Position(data, test.offset); line != test.line || col != test.col {
+			t.Errorf("offset %d: expecting %d:%d, got %d:%d", test.offset, test.line, test.col, line, col)
+		}
+	}
+}
+
+func TestWithErrorObjects(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local _, err = json.decode('[1,\n[2,')
+	assert(err.kind == "decode" and err.line == 2 and err.col == 3, tostring(err))
+	_, err = json.decode('[1,\n[2,', {error_object = false})
+	assert(type(err) == "string")
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s, WithErrorObjects(), WithFastPathThreshold(-1))
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
+
+type reflectedUser struct {
+	Name  string   `json:"name"`
+	Tags  []string `json:"tags,omitempty"`
+	token string
+}
+
+func TestReflectUserData(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	ud := L.NewUserData()
+	ud.Value = &reflectedUser{Name: "gopher", token: "secret"}
+	value := L.NewTable()
+	value.RawSetString("user", ud)
+
+	if _, err := Encode(value); err == nil {
+		t.Fatal("expecting error without reflection")
+	}
+	data, err := EncodeWithOptions(value, &EncodeOptions{ReflectUserData: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"user":{"name":"gopher"}}`; string(data) != expected {
+		t.Fatalf("expecting %s, got %s", expected, data)
+	}
+
+	ud.Value = make(chan int)
+	if _, err := EncodeWithOptions(value, &EncodeOptions{ReflectUserData: true}); err == nil {
+		t.Fatal("expecting error for unsupported Go value")
+	}
+
+	const str = `
+	local json = require("json")
+	assert(json.encode({u = user}) == '{"u":{"name":"lua","tags":["a"]}}')
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s, WithUserDataReflection())
+	user := s.NewUserData()
+	user.Value = reflectedUser{Name: "lua", Tags: []string{"a"}}
+	s.SetGlobal("user", user)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEncodeIndent(t *testing.T) {
+	s := lua.NewState()
+	defer s.Close()
+
+	value := s.NewTable()
+	value.RawSetString("b", lua.LString("x"))
+	value.RawSetString("a", s.NewTable())
+	list := s.NewTable()
+	list.Append(lua.LNumber(1))
+	list.Append(lua.LNumber(2))
+	value.RawSetString("list", list)
+	data, err := EncodeWithOptions(value, &EncodeOptions{Indent: "  ", Prefix: "> "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "{\n>   \"a\": [],\n>   \"b\": \"x\",\n>   \"list\": [\n>     1,\n>     2\n>   ]\n> }"
+	if string(data) != expected {
+		t.Fatalf("expecting %s, got %s", expected, data)
+	}
+
+	const str = `
+	local json = require("json")
+	assert(json.encode({a = {1}}, {indent = "\t"}) == '{\n\t"a": [\n\t\t1\n\t]\n}')
+	assert(json.encode({a = {1}}, {indent = ""}) == '{"a":[1]}')
+	assert(json.encode("x", {indent = "  "}) == '"x"')
+	local s = json.build(function(b) b:obj(function() b:arr("xs", {1}) end) end, {indent = " "})
+	assert(s == '{\n "xs": [\n  1\n ]\n}', s)
+	`
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDecodeRange(t *testing.T) {
+	tests := []struct {
+		i, j, start, stop int
+	}{
+		{1, -1, 0, 5},
+		{2, 3, 1, 3},
+		{-2, -1, 3, 5},
+		{0, 10, 0, 5},
+		{4, 2, 0, 0},
+		{-10, 1, 0, 1},
+	}
+	for _, test := range tests {
+		if start, stop := subRange(5, test.i, test.j); start != test.start || stop != test.stop {
+			t.Fatalf("%d, %d: expecting [%d:%d], got [%d:%d]", test.i, test.j, test.start, test.stop, start, stop)
+		}
+	}
+
+	const str = `
+	local json = require("json")
+	local buf = 'log: {"a":[1,2]} tail'
+	local doc = json.decode_range(buf, 6, 16)
+	assert(doc.a[2] == 2)
+	assert(json.decode_range(buf, -4) == nil)
+	assert(json.decode_range("[1] [2]", -3)[1] == 2)
+	local v, err = json.decode_range(buf, 6, 10)
+	assert(v == nil and err)
+	local v, err, report = json.decode_range("x[9007199254740994]", 2, -1, {warn_unsafe_int = true})
+	assert(report.unsafe_ints[1] == "$[0]")
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestKeepNulls(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local doc = '{"a":null,"b":[1,null,3],"c":{"d":null}}'
+	assert(json.decode(doc).a == nil)
+	local value = json.decode(doc, {keep_nulls = true})
+	assert(value.a == json.null and #value.b == 3 and value.b[2] == json.null and value.c.d == json.null)
+	assert(json.encode(value) == doc)
+	assert(json.decode("null", {keep_nulls = true}) == json.null)
+	local obj = json.decode(doc, {keep_nulls = true, objects = "userdata"})
+	assert(obj.a == json.null and #obj == 3)
+	`
+	for _, threshold := range []int{0, -1} {
+		s := lua.NewState()
+		Preload(s, WithFastPathThreshold(threshold))
+		if err := s.DoString(str); err != nil {
+			t.Errorf("threshold %d: %v", threshold, err)
+		}
+		s.Close()
+	}
+
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s, WithKeepNulls())
+	if err := s.DoString(`assert(require("json").decode('[null]')[1] == require("json").null)`); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTypeHints(t *testing.T) {
+	const str = `
+	local json = require("json")
+	assert(json.encode({}) == "[]")
+	assert(json.encode(json.object()) == "{}")
+	assert(json.encode(json.array()) == "[]")
+	assert(json.encode({a = json.object(), b = json.array({})}) == '{"a":{},"b":[]}')
+	local t = json.object({k = 1})
+	assert(json.encode(t) == '{"k":1}')
+	assert(getmetatable(json.object()).__jsontype == "object")
+	assert(json.encode(setmetatable({}, {__jsontype = "object"})) == "{}")
+	assert(not pcall(json.object, setmetatable({}, {})))
+	assert(not pcall(json.array, 1))
+
+	assert(json.patch_diff(json.object(), {a = 1})[1].path == "/a")
+	assert(json.schema_compile({type = "object"}):validate(json.object()))
+	assert(not json.schema_compile({type = "array"}):validate(json.object()))
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,105 @@
+// Package jsontest provides helpers for testing code that works with the
+// values of the json module, such as host extensions and handlers.
+package jsontest
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	luajson "github.com/dstgo/gopher-json"
+	"github.com/yuin/gopher-lua"
+)
+
+// RoundTrip encodes v and decodes the result in L, returning the value a
+// script would get after sending v through JSON.
+func RoundTrip(L *lua.LState, v lua.LValue) (lua.LValue, error) {
+	data, err := luajson.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	return luajson.Decode(L, data)
+}
+
+// Equal reports whether a and b encode to the same JSON document, ignoring
+// the order of object members. This is the equality the module guarantees
+// across a round trip: for instance, json.null and nil array elements
+// compare equal, as do null and absent object members, and an empty table
+// and an empty array. The error
+// describes the first difference, or why a value could not be encoded.
+func Equal(a, b lua.LValue) error {
+	x, err := canonical(a)
+	if err != nil {
+		return err
+	}
+	y, err := canonical(b)
+	if err != nil {
+		return err
+	}
+	return compare("$", x, y)
+}
+
+// canonical returns the encoding/json representation of the encoding of v.
+func canonical(v lua.LValue) (interface{}, error) {
+	data, err := luajson.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func compare(path string, a, b interface{}) error {
+	switch x := a.(type) {
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(x)+len(y))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		for k := range y {
+			if _, ok := x[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			// Absent members compare like null ones, which decode to nil.
+			if err := compare(path+"."+k, x[k], y[k]); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok {
+			break
+		}
+		if len(x) != len(y) {
+			return fmt.Errorf("%s: length %d != %d", path, len(x), len(y))
+		}
+		for i := range x {
+			if err := compare(path+"["+strconv.Itoa(i)+"]", x[i], y[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		if a == b {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: %s != %s", path, describe(a), describe(b))
+}
+
+func describe(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
@@ -0,0 +1,61 @@
+package jsontest
+
+import (
+	"testing"
+
+	luajson "github.com/dstgo/gopher-json"
+	"github.com/yuin/gopher-lua"
+)
+
+func TestRoundTrip(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	L.SetGlobal("null", luajson.Null)
+	if err := L.DoString(`value = {name = "gopher", list = {1, 2, {ok = true}}, none = null}`); err != nil {
+		t.Fatal(err)
+	}
+	value := L.GetGlobal("value")
+	decoded, err := RoundTrip(L, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Equal(value, decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := RoundTrip(L, L.NewFunction(func(*lua.LState) int { return 0 })); err == nil {
+		t.Fatal("expecting error for function")
+	}
+}
+
+func TestEqual(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	tests := []struct {
+		a, b  string
+		error string
+	}{
+		{`{a = 1, b = {2, 3}}`, `{b = {2, 3}, a = 1}`, ""},
+		{`setmetatable({1, nil, 3}, {__jsonlen = 3})`, `{1, null, 3}`, ""},
+		{`{}`, `setmetatable({}, {__jsonlen = 0})`, ""},
+		{`{a = {1, 2}}`, `{a = {1, 3}}`, "$.a[1]: 2 != 3"},
+		{`{a = {1, 2}}`, `{a = {1}}`, "$.a: length 2 != 1"},
+		{`{a = 1}`, `{a = 1, b = 2}`, "$.b: null != 2"},
+		{`{a = "1"}`, `{a = 1}`, `$.a: "1" != 1`},
+	}
+	L.SetGlobal("null", luajson.Null)
+	for _, test := range tests {
+		if err := L.DoString("a, b = " + test.a + ", " + test.b); err != nil {
+			t.Fatal(err)
+		}
+		err := Equal(L.GetGlobal("a"), L.GetGlobal("b"))
+		switch {
+		case test.error == "" && err != nil:
+			t.Errorf("%s, %s: unexpected error %v", test.a, test.b, err)
+		case test.error != "" && (err == nil || err.Error() != test.error):
+			t.Errorf("%s, %s: expecting %q, got %v", test.a, test.b, test.error, err)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package json
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// KeyResolver returns the key that verifies a JWT, given its decoded header,
+// which typically names the key with kid.
+type KeyResolver func(header map[string]interface{}) (*Key, error)
+
+// WithKeyResolver makes json.decode_jwt verify signatures with the keys
+// returned by fn, unless scripts pass a key.
+func WithKeyResolver(fn KeyResolver) Option {
+	return func(c *config) {
+		c.keyResolver = fn
+	}
+}
+
+// apiDecodeJWT decodes the header and claims of a JWT, verifying its
+// signature when asked to.
+func (m *module) apiDecodeJWT(L *lua.LState) int {
+	token := L.CheckString(1)
+	opts, lopts := checkDecodeOptions(L, 2, m.decode)
+	var key *Key
+	if v := lopts.get("key"); v != lua.LNil {
+		ud, ok := v.(*lua.LUserData)
+		if ok {
+			key, ok = ud.Value.(*Key)
+		}
+		if !ok {
+			L.ArgError(2, "option 'key' must be a json key")
+		}
+	}
+	verify := lopts.bool("verify", false)
+
+	claims, header, err := m.decodeJWT(token, key, verify)
+	var value lua.LValue
+	if err == nil {
+		value, err = DecodeWithOptions(L, claims, &opts)
+	}
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	L.Push(value)
+	L.Push(DecodeValue(L, header))
+	return 2
+}
+
+// decodeJWT returns the claims and the header of token. Its signature is
+// verified with key, or else the key returned by the key resolver, when
+// verify is set.
+func (m *module) decodeJWT(token string, key *Key, verify bool) ([]byte, map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[1] == "" {
+		return nil, nil, errors.New("invalid JWT: expecting three parts")
+	}
+	header, err := decodeJWSHeader(parts[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	var claims []byte
+	if verify {
+		if key == nil {
+			if m.keyResolver == nil {
+				return nil, nil, errors.New("no key to verify the JWT")
+			}
+			if key, err = m.keyResolver(header); err != nil {
+				return nil, nil, err
+			}
+			if !hasKeyMaterial(key) {
+				kid, _ := header["kid"].(string)
+				return nil, nil, fmt.Errorf("no key for kid %q", kid)
+			}
+		}
+		if claims, _, err = Verify(token, key, nil); err != nil {
+			return nil, nil, err
+		}
+	} else if claims, err = b64.DecodeString(parts[1]); err != nil {
+		return nil, nil, errors.New("invalid JWS payload encoding")
+	}
+	if peekKind(claims) != "object" {
+		return nil, nil, errors.New("JWT claims must be an object")
+	}
+	return claims, header, nil
+}
+
+// hasKeyMaterial reports whether a key returned by a key resolver can verify
+// a signature, which a nil key or an empty secret cannot.
+func hasKeyMaterial(k *Key) bool {
+	if k == nil || k.Key == nil {
+		return false
+	}
+	secret, ok := k.Key.([]byte)
+	return !ok || len(secret) > 0
+}
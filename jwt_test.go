@@ -0,0 +1,87 @@
+package json
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestDecodeJWT(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local token = json.sign({sub = "42", scope = "read", n = "7"}, secret, "HS256")
+
+	local claims, header = json.decode_jwt(token)
+	assert(claims.sub == "42" and claims.scope == "read" and header.alg == "HS256")
+
+	claims = json.decode_jwt(token, {verify = true})
+	assert(claims.sub == "42")
+	claims = json.decode_jwt(token, {verify = true, key = secret, coerce = {["$.n"] = "number"}})
+	assert(claims.n == 7)
+
+	local forged = token:gsub("%.[^.]+$", ".AAAA")
+	assert(json.decode_jwt(forged).sub == "42")
+	local _, err = json.decode_jwt(forged, {verify = true})
+	assert(err == "invalid signature", err)
+
+	local unknown = json.sign({sub = "1"}, other, "HS256")
+	_, err = json.decode_jwt(unknown, {verify = true})
+	assert(err == "unknown key other", err)
+	_, err = json.decode_jwt(json.sign({sub = "1"}, missing, "HS256"), {verify = true})
+	assert(err == 'no key for kid "missing"', err)
+	_, err = json.decode_jwt(json.sign({sub = "1"}, empty, "HS256"), {verify = true})
+	assert(err == 'no key for kid "empty"', err)
+
+	_, err = json.decode_jwt("abc")
+	assert(err == "invalid JWT: expecting three parts", err)
+	_, err = json.decode_jwt(json.sign({1, 2}, secret, "HS256"))
+	assert(err == "JWT claims must be an object", err)
+	assert(not pcall(json.decode_jwt, token, {verify = true, key = "k1"}))
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	secret := &Key{ID: "k1", Key: []byte("0123456789abcdef0123456789abcdef")}
+	for name, k := range map[string]*Key{
+		"secret":  secret,
+		"other":   {ID: "other", Key: []byte("fedcba9876543210fedcba9876543210")},
+		"missing": {ID: "missing", Key: []byte("0123456789abcdef0123456789abcdef")},
+		"empty":   {ID: "empty", Key: []byte("0123456789abcdef0123456789abcdef")},
+	} {
+		ud, err := NewKey(s, k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.SetGlobal(name, ud)
+	}
+	Preload(s, WithKeyResolver(func(header map[string]interface{}) (*Key, error) {
+		switch header["kid"] {
+		case secret.ID:
+			return secret, nil
+		case "missing":
+			return nil, nil
+		case "empty":
+			return &Key{ID: "empty", Key: []byte{}}, nil
+		}
+		return nil, errors.New("unknown key " + header["kid"].(string))
+	}))
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDecodeJWTWithoutResolver(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local _, err = json.decode_jwt("eyJhbGciOiJIUzI1NiJ9.e30.c2ln", {verify = true})
+	assert(err == "no key to verify the JWT", err)
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
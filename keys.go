@@ -0,0 +1,58 @@
+package json
+
+import (
+	"fmt"
+)
+
+// matchGlob reports whether s matches pattern, in which * matches any run of
+// characters, including none, and ? any single character.
+func matchGlob(pattern, s string) bool {
+	// star and next record the position after the last * and the position
+	// of s it was last tried at, to backtrack on a mismatch.
+	star, next := -1, 0
+	p, i := 0, 0
+	for i < len(s) {
+		switch {
+		case p < len(pattern) && pattern[p] == '*':
+			star, next = p+1, i
+			p++
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == s[i]):
+			p++
+			i++
+		case star >= 0:
+			next++
+			p, i = star, next
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+func matchAnyGlob(patterns []string, s string) bool {
+	for _, pattern := range patterns {
+		if matchGlob(pattern, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedKey reports whether the AllowKeys and DenyKeys options let members
+// with the given key be decoded, recording the error when RejectKeys is set
+// and the member, at path p, is not allowed.
+func (d *decoder) allowedKey(key string, p path) bool {
+	if d.opts.AllowKeys == nil && d.opts.DenyKeys == nil {
+		return true
+	}
+	if (d.opts.AllowKeys == nil || matchAnyGlob(d.opts.AllowKeys, key)) && !matchAnyGlob(d.opts.DenyKeys, key) {
+		return true
+	}
+	if d.opts.RejectKeys && d.err == nil {
+		d.err = fmt.Errorf("key %q is not allowed at %s", key, p)
+	}
+	return false
+}
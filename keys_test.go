@@ -0,0 +1,96 @@
+package json
+
+import (
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		expected   bool
+	}{
+		{"password", "password", true},
+		{"password", "passwords", false},
+		{"*_token", "access_token", true},
+		{"*_token", "token", false},
+		{"*", "", true},
+		{"a*b*c", "aXbYbZc", true},
+		{"a*b*c", "aXbYbZ", false},
+		{"?id", "uid", true},
+		{"?id", "id", false},
+	}
+	for _, test := range tests {
+		if got := matchGlob(test.pattern, test.s); got != test.expected {
+			t.Errorf("matchGlob(%q, %q) = %v, expecting %v", test.pattern, test.s, got, test.expected)
+		}
+	}
+}
+
+func TestKeyFilter(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	const doc = `{"id":1,"password":"x","user":{"name":"a","api_token":"t","tags":[{"id":2,"secret":{}}]}}`
+	const expected = `{"id":1,"user":{"name":"a","tags":[{"id":2}]}}`
+	for _, threshold := range []int{0, -1} {
+		opts := &DecodeOptions{DenyKeys: []string{"password", "*_token", "secret"}, FastPathThreshold: threshold}
+		value, err := DecodeWithOptions(L, []byte(doc), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data, _ := Encode(value); string(data) != expected {
+			t.Errorf("expecting %s, got %s", expected, data)
+		}
+
+		opts = &DecodeOptions{AllowKeys: []string{"id", "user", "tags"}, FastPathThreshold: threshold}
+		value, err = DecodeWithOptions(L, []byte(doc), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data, _ := Encode(value); string(data) != `{"id":1,"user":{"tags":[{"id":2}]}}` {
+			t.Errorf("unexpected allowed members %s", data)
+		}
+
+		opts.RejectKeys = true
+		if _, err := DecodeWithOptions(L, []byte(doc), opts); err == nil || err.Error() != `key "password" is not allowed at $.password` {
+			t.Errorf("expecting rejected key, got %v", err)
+		}
+	}
+
+	// Skipped values are still checked.
+	for _, input := range fastPathInputs {
+		if input == `1e400` {
+			// Valid syntax, but out of range once decoded.
+			continue
+		}
+		doc := []byte(`{"skipped":` + input + `}`)
+		_, err := DecodeWithOptions(L, doc, &DecodeOptions{})
+		_, skipErr := DecodeWithOptions(L, doc, &DecodeOptions{DenyKeys: []string{"skipped"}})
+		if (err == nil) != (skipErr == nil) {
+			t.Errorf("%s: decoding error %v, skipping error %v", doc, err, skipErr)
+		}
+	}
+}
+
+func TestKeyFilterLua(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local value = json.decode('{"a":1,"ssn":"123","b":{"ssn":"456"}}', {deny_keys = {"ssn"}})
+	assert(value.a == 1 and value.ssn == nil and value.b.ssn == nil)
+
+	local value = json.decode('{"a":1,"b":2}', {allow_keys = {"a"}})
+	assert(value.a == 1 and value.b == nil)
+
+	local value, err = json.decode('{"a":1,"b":2}', {allow_keys = {"a"}, reject_keys = true})
+	assert(value == nil and err:find('"b"'))
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
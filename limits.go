@@ -0,0 +1,62 @@
+package json
+
+import (
+	"fmt"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// LimitError is returned when a conversion exceeds one of the limits set in
+// its options.
+type LimitError struct {
+	// Limit is the name of the exceeded limit, such as "max_depth".
+	Limit string
+	// Path is where in the document the limit was exceeded.
+	Path string
+	// Value is the observed value, and Max the configured limit.
+	Value int
+	Max   int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s of %d exceeded at %s: %d", e.Limit, e.Max, e.Path, e.Value)
+}
+
+// limitHandler is called with each limit violation before the conversion
+// fails.
+type limitHandler func(*LimitError)
+
+func (h limitHandler) fail(limit string, p path, value, max int) *LimitError {
+	err := &LimitError{Limit: limit, Path: p.String(), Value: value, Max: max}
+	if h != nil {
+		h(err)
+	}
+	return err
+}
+
+// WithLimitHandler registers fn to be called whenever a conversion exceeds
+// one of its limits, before the conversion fails. It lets hosts log abuse
+// patterns in one place.
+func WithLimitHandler(fn func(*LimitError)) Option {
+	return func(c *config) {
+		c.encode.OnLimit = fn
+		c.decode.OnLimit = fn
+	}
+}
+
+// luaLimitHandler returns a handler calling the Lua function fn with a table
+// describing the violation. Errors raised by fn are ignored, so that the
+// conversion fails with the limit error.
+func luaLimitHandler(L *lua.LState, fn *lua.LFunction, next func(*LimitError)) func(*LimitError) {
+	return func(err *LimitError) {
+		if next != nil {
+			next(err)
+		}
+		t := L.CreateTable(0, 4)
+		t.RawSetString("limit", lua.LString(err.Limit))
+		t.RawSetString("path", lua.LString(err.Path))
+		t.RawSetString("value", lua.LNumber(err.Value))
+		t.RawSetString("max", lua.LNumber(err.Max))
+		L.CallByParam(lua.P{Fn: fn, Protect: true}, t)
+	}
+}
@@ -0,0 +1,113 @@
+package json
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestLimits(t *testing.T) {
+	s := lua.NewState()
+	defer s.Close()
+
+	var events []*LimitError
+	opts := &DecodeOptions{
+		MaxDepth: 2,
+		OnLimit:  func(err *LimitError) { events = append(events, err) },
+	}
+	_, err := DecodeWithOptions(s, []byte(`{"a":[[1]]}`), opts)
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != "max_depth" || limitErr.Path != "$.a[0]" {
+		t.Fatalf("expecting max_depth error at $.a[0], got %v", err)
+	}
+	if len(events) != 1 || events[0] != limitErr {
+		t.Fatalf("expecting the handler to be called with the error, got %v", events)
+	}
+	if _, err := DecodeWithOptions(s, []byte(`{"a":[1]}`), opts); err != nil {
+		t.Fatal(err)
+	}
+
+	const str = `
+	local json = require("json")
+	local seen
+	local value, err = json.decode('[1,2,3]', {max_bytes = 4, on_limit = function(e) seen = e end})
+	assert(value == nil and string.find(err, "max_bytes"))
+	assert(seen.limit == "max_bytes" and seen.path == "$" and seen.value == 7 and seen.max == 4)
+
+	local value, err = json.encode({{{}}}, {max_depth = 2})
+	assert(value == nil and string.find(err, "max_depth"))
+	assert(json.encode({{}}, {max_depth = 2}) == "[[]]")
+	assert(host_events == 2)
+	`
+	Preload(s, WithLimitHandler(func(*LimitError) {
+		s.SetGlobal("host_events", s.GetGlobal("host_events").(lua.LNumber)+1)
+	}))
+	s.SetGlobal("host_events", lua.LNumber(0))
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMemoryBudget(t *testing.T) {
+	s := lua.NewState()
+	defer s.Close()
+
+	big := `["` + strings.Repeat("x", 1000) + `"]`
+	for _, threshold := range []int{0, -1} {
+		opts := &DecodeOptions{MemoryBudget: 512, FastPathThreshold: threshold}
+		_, err := DecodeWithOptions(s, []byte(big), opts)
+		var limitErr *LimitError
+		if !errors.As(err, &limitErr) || limitErr.Limit != "memory_budget" || limitErr.Path != "$[0]" {
+			t.Fatalf("expecting memory_budget error at $[0], got %v", err)
+		}
+		if _, err := DecodeWithOptions(s, []byte(`{"a":[1,2,3]}`), opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	const str = `
+	local json = require("json")
+	local value, err = json.decode(big)
+	assert(value == nil and err:find("memory_budget"))
+	local value, err = json.encode({string.rep("x", 1000)})
+	assert(value == nil and err:find("memory_budget"))
+	assert(json.encode({a = {1, 2}}) == '{"a":[1,2]}')
+	assert(json.decode('{"a":[1,2]}').a[2] == 2)
+
+	-- The budget applies to each call, not to the state as a whole.
+	for i = 1, 100 do
+		assert(json.decode('{"a":"' .. string.rep("y", 100) .. '"}'))
+	end
+	`
+	Preload(s, WithMemoryBudget(512))
+	s.SetGlobal("big", lua.LString(big))
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestContainerLimits(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local list = {1, 2, 3, 4, 5}
+	local value, err = json.encode(list, {max_array_elems = 3})
+	assert(value == nil and err:find("max_array_elems"))
+	assert(json.encode(list, {max_array_elems = 3, truncate = true}) == '[1,2,3,{"$truncated":2}]')
+	assert(json.encode(list, {max_array_elems = 5}) == '[1,2,3,4,5]')
+
+	local obj = {d = 4, b = 2, a = 1, c = {1, 2}}
+	local value, err = json.encode(obj, {max_object_members = 2})
+	assert(value == nil and err:find("max_object_members"))
+	assert(json.encode(obj, {max_object_members = 3, max_array_elems = 1, truncate = true}) ==
+		'{"a":1,"b":2,"c":[1,{"$truncated":1}],"$truncated":1}')
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,99 @@
+package json
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// DocumentSplitter splits a stream of JSON documents, such as JSON Lines, into
+// the raw bytes of each document.
+//
+// Documents may be separated by any whitespace, including CRLF line endings
+// and blank lines, or not separated at all, and may themselves span several
+// lines.
+type DocumentSplitter struct {
+	dec *json.Decoder
+	doc json.RawMessage
+	err error
+}
+
+// SplitDocuments returns a splitter reading documents from r.
+func SplitDocuments(r io.Reader) *DocumentSplitter {
+	return &DocumentSplitter{dec: json.NewDecoder(r)}
+}
+
+// Next advances to the next document, which is then available through Bytes.
+// It returns false at the end of the stream or on the first error.
+func (s *DocumentSplitter) Next() bool {
+	if s.err != nil {
+		return false
+	}
+	s.doc = nil
+	if err := s.dec.Decode(&s.doc); err != nil {
+		if err != io.EOF {
+			s.err = err
+		}
+		return false
+	}
+	return true
+}
+
+// Bytes returns the current document. The slice is only valid until the next
+// call to Next.
+func (s *DocumentSplitter) Bytes() []byte {
+	return s.doc
+}
+
+// Err returns the first error encountered, or nil at the end of the stream.
+func (s *DocumentSplitter) Err() error {
+	return s.err
+}
+
+func (m *module) apiLines(L *lua.LState) int {
+	str := L.CheckString(1)
+	opts, _ := checkDecodeOptions(L, 2, m.decode)
+
+	L.Push(decodeStream(L, bytes.NewReader([]byte(str)), &opts))
+	return 1
+}
+
+// DecodeStream returns a Lua iterator over the documents read from r, as
+// json.decode_stream does, decoded with the default options. The stream is
+// read as the iterator is called, so it can be of any size.
+func DecodeStream(L *lua.LState, r io.Reader) *lua.LFunction {
+	return decodeStream(L, r, &DecodeOptions{})
+}
+
+// decodeStream returns an iterator yielding the number and the value of each
+// document read from r. It raises an error on the first invalid document.
+func decodeStream(L *lua.LState, r io.Reader, opts *DecodeOptions) *lua.LFunction {
+	s := SplitDocuments(r)
+	n := 0
+	return L.NewFunction(func(L *lua.LState) int {
+		if !s.Next() {
+			if err := s.Err(); err != nil {
+				L.RaiseError("document %d: %s", n+1, err.Error())
+			}
+			return 0
+		}
+		n++
+		value, err := DecodeWithOptions(L, s.Bytes(), opts)
+		if err != nil {
+			L.RaiseError("document %d: %s", n, err.Error())
+		}
+		L.Push(lua.LNumber(n))
+		L.Push(value)
+		return 2
+	})
+}
+
+func (m *module) apiDecodeStream(L *lua.LState) int {
+	r := checkReader(L, 1)
+	opts, _ := checkDecodeOptions(L, 2, m.decode)
+
+	L.Push(decodeStream(L, r, &opts))
+	return 1
+}
@@ -0,0 +1,113 @@
+package json
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestSplitDocuments(t *testing.T) {
+	input := "{\"a\":1}\r\n\r\n[1,\n2]\n\"x\"3 null{}\n"
+	expected := []string{`{"a":1}`, "[1,\n2]", `"x"`, `3`, `null`, `{}`}
+
+	s := SplitDocuments(strings.NewReader(input))
+	var docs []string
+	for s.Next() {
+		docs = append(docs, string(s.Bytes()))
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != len(expected) {
+		t.Fatalf("expecting %q, got %q", expected, docs)
+	}
+	for i := range docs {
+		if docs[i] != expected[i] {
+			t.Fatalf("expecting %q, got %q", expected, docs)
+		}
+	}
+}
+
+func TestSplitDocumentsError(t *testing.T) {
+	s := SplitDocuments(strings.NewReader("1\n{\"a\":}\n2\n"))
+	if !s.Next() || string(s.Bytes()) != "1" {
+		t.Fatal("expecting first document")
+	}
+	if s.Next() {
+		t.Fatal("expecting failure on second document")
+	}
+	if s.Err() == nil {
+		t.Fatal("expecting error")
+	}
+}
+
+func TestLines(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local values = {}
+	for i, value in json.lines('{"a":1}\r\n\r\nnull\n{\n  "a": 3\n}\n') do
+		values[i] = value
+	end
+	assert(values[1].a == 1 and values[2] == nil and values[3].a == 3)
+
+	local ok, err = pcall(function()
+		for i, value in json.lines('1\n[\n') do end
+	end)
+	assert(not ok and err:find("document 2"))
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDecodeStream(t *testing.T) {
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	s.SetGlobal("iter", DecodeStream(s, strings.NewReader("{\"a\":1}\n[2]\n")))
+	reader := s.NewUserData()
+	reader.Value = strings.NewReader("1 2 3")
+	s.SetGlobal("reader", reader)
+
+	const str = `
+	local json = require("json")
+	local n, value = iter()
+	assert(n == 1 and value.a == 1)
+	n, value = iter()
+	assert(n == 2 and value[1] == 2)
+	assert(iter() == nil)
+
+	local sum = 0
+	for _, v in json.decode_stream(reader) do sum = sum + v end
+	assert(sum == 6)
+
+	-- A reader handing out a few bytes at a time.
+	local data, pos, calls = '{"k":"v"}\n{"k":"w"}\n', 1, 0
+	local src = {read = function(self, n)
+		calls = calls + 1
+		if pos > #data then return nil end
+		local chunk = data:sub(pos, pos + math.min(n, 3) - 1)
+		pos = pos + #chunk
+		return chunk
+	end}
+	local keys = {}
+	for i, v in json.decode_stream(src) do keys[i] = v.k end
+	assert(keys[1] == "v" and keys[2] == "w" and calls > 4)
+
+	for i, v in json.decode_stream('{"x":null}', {keep_nulls = true}) do assert(v.x == json.null) end
+
+	local failing = {read = function() return nil, "disk on fire" end}
+	local ok, err = pcall(function() for _ in json.decode_stream(failing) do end end)
+	assert(not ok and string.find(err, "disk on fire"))
+	assert(not pcall(json.decode_stream, 1))
+	`
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
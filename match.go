@@ -0,0 +1,123 @@
+package json
+
+import (
+	"github.com/yuin/gopher-lua"
+)
+
+// wildcard is the value of the userdata that json.matches accepts in
+// patterns in place of concrete values.
+type wildcard int
+
+const (
+	anyValue wildcard = iota
+	anyString
+	anyNumber
+	anyBoolean
+	anyObject
+	anyArray
+)
+
+var wildcards = map[string]*lua.LUserData{
+	"any":         {Value: anyValue},
+	"any_string":  {Value: anyString},
+	"any_number":  {Value: anyNumber},
+	"any_boolean": {Value: anyBoolean},
+	"any_object":  {Value: anyObject},
+	"any_array":   {Value: anyArray},
+}
+
+func (w wildcard) matches(v lua.LValue) bool {
+	switch w {
+	case anyValue:
+		return v != lua.LNil
+	case anyString:
+		return v.Type() == lua.LTString
+	case anyNumber:
+		return v.Type() == lua.LTNumber
+	case anyBoolean:
+		return v.Type() == lua.LTBool
+	case anyObject, anyArray:
+		t, ok := v.(*lua.LTable)
+		if !ok {
+			return false
+		}
+		n, array := isArray(t)
+		return (array && n == 0) || array == (w == anyArray)
+	}
+	return false
+}
+
+// matchPattern reports whether doc contains everything in pattern. Objects
+// match when each member of the pattern matches the member of doc with the
+// same key, and arrays when each element of the pattern matches some element
+// of doc. It returns the path of the first part of the pattern that did not
+// match.
+func matchPattern(p path, doc, pattern lua.LValue, active map[tablePair]bool) (path, bool) {
+	if doc == Null {
+		doc = lua.LNil
+	}
+	switch pat := pattern.(type) {
+	case *lua.LUserData:
+		if w, ok := pat.Value.(wildcard); ok {
+			return p, w.matches(doc)
+		}
+		if pat == Null {
+			return p, doc == lua.LNil
+		}
+		return p, doc == pattern
+	case *lua.LTable:
+		d, ok := doc.(*lua.LTable)
+		if !ok {
+			return p, false
+		}
+		// Tables already being matched with each other match, as for
+		// comparer.compareTables.
+		pair := tablePair{d, pat}
+		if active[pair] {
+			return p, true
+		}
+		active[pair] = true
+		defer delete(active, pair)
+		if n, array := isArray(pat); array {
+			if _, docArray := isArray(d); !docArray && n > 0 {
+				return p, false
+			}
+			dn, _ := isArray(d)
+			for i := 1; i <= n; i++ {
+				found := false
+				for j := 1; j <= dn && !found; j++ {
+					_, found = matchPattern(p, d.RawGetInt(j), pat.RawGetInt(i), active)
+				}
+				if !found {
+					return p.elem(i - 1), false
+				}
+			}
+			return p, true
+		}
+		var failed path
+		matched := true
+		pat.ForEach(func(key, value lua.LValue) {
+			if !matched {
+				return
+			}
+			failed, matched = matchPattern(p.child(lua.LVAsString(key)), d.RawGet(key), value, active)
+		})
+		return failed, matched
+	case lua.LNumber:
+		return p, doc == pattern
+	}
+	return p, doc.Type() == pattern.Type() && doc == pattern
+}
+
+func apiMatches(L *lua.LState) int {
+	doc := L.CheckAny(1)
+	pattern := L.CheckAny(2)
+
+	failed, ok := matchPattern(nil, doc, pattern, make(map[tablePair]bool))
+	L.Push(lua.LBool(ok))
+	if !ok {
+		L.Push(lua.LString(failed.String()))
+		return 2
+	}
+	return 1
+}
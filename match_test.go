@@ -0,0 +1,44 @@
+package json
+
+import (
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestMatches(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local doc = json.decode('{"event":"push","repo":{"name":"x","stars":3},"tags":["a","b"],"none":null}')
+	assert(json.matches(doc, {event = "push"}))
+	assert(json.matches(doc, {repo = {name = json.any_string, stars = json.any_number}}))
+	assert(json.matches(doc, {tags = {"b"}}))
+	assert(json.matches(doc, {tags = json.any_array, repo = json.any_object}))
+	assert(json.matches(doc, {none = json.null}))
+
+	local ok, at = json.matches(doc, {repo = {name = json.any_number}})
+	assert(ok == false and at == "$.repo.name")
+
+	local ok, at = json.matches(doc, {tags = {"c"}})
+	assert(ok == false and at == "$.tags[0]")
+
+	assert(not json.matches(doc, {missing = json.any}))
+	assert(not json.matches(doc, {event = "pull"}))
+	assert(not json.matches(doc, {repo = json.any_array}))
+
+	local node = {kind = "loop"}
+	node.next = node
+	local pattern = {kind = "loop"}
+	pattern.next = pattern
+	assert(json.matches(node, pattern))
+	pattern.kind = "other"
+	assert(not json.matches(node, pattern))
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
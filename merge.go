@@ -0,0 +1,158 @@
+package json
+
+import (
+	"github.com/yuin/gopher-lua"
+)
+
+// merger deeply merges Lua documents.
+type merger struct {
+	L *lua.LState
+
+	// arrayKey, when set, makes arrays merge their objects by the value of
+	// this member rather than by position.
+	arrayKey string
+}
+
+// merge returns a new value combining a and b, the values of b taking
+// precedence.
+func (m *merger) merge(a, b lua.LValue) lua.LValue {
+	ta, okA := a.(*lua.LTable)
+	tb, okB := b.(*lua.LTable)
+	switch {
+	case b == lua.LNil:
+		return clone(m.L, a)
+	case !okA || !okB:
+		return clone(m.L, b)
+	}
+	if _, ok := nonEmpty(tb); !ok {
+		return clone(m.L, a)
+	}
+	if _, ok := nonEmpty(ta); !ok {
+		return clone(m.L, b)
+	}
+	na, arrayA := isArray(ta)
+	nb, arrayB := isArray(tb)
+	switch {
+	case arrayA && arrayB && m.arrayKey != "":
+		return m.mergeKeyed(ta, na, tb, nb)
+	case arrayA && arrayB:
+		n := na
+		if nb > n {
+			n = nb
+		}
+		t := m.L.CreateTable(n, 0)
+		for i := 1; i <= n; i++ {
+			t.RawSetInt(i, m.merge(ta.RawGetInt(i), tb.RawGetInt(i)))
+		}
+		return t
+	case !arrayA && !arrayB:
+		t := m.L.CreateTable(0, 0)
+		for _, key := range sortedKeys(ta, tb) {
+			t.RawSetString(key, m.merge(ta.RawGetString(key), tb.RawGetString(key)))
+		}
+		return t
+	}
+	return clone(m.L, b)
+}
+
+// mergeKeyed merges the elements of b into those of a with the same value
+// for arrayKey, appending the others.
+func (m *merger) mergeKeyed(a *lua.LTable, na int, b *lua.LTable, nb int) lua.LValue {
+	elems := make([]lua.LValue, 0, na+nb)
+	for i := 1; i <= na; i++ {
+		elems = append(elems, clone(m.L, a.RawGetInt(i)))
+	}
+	for i := 1; i <= nb; i++ {
+		elem := b.RawGetInt(i)
+		if j := m.match(elems[:na], elem); j >= 0 {
+			elems[j] = m.merge(elems[j], elem)
+		} else {
+			elems = append(elems, clone(m.L, elem))
+		}
+	}
+	t := m.L.CreateTable(len(elems), 0)
+	for _, elem := range elems {
+		t.Append(elem)
+	}
+	return t
+}
+
+// match returns the index of the element of elems with the same key as
+// elem, or -1.
+func (m *merger) match(elems []lua.LValue, elem lua.LValue) int {
+	t, ok := isObject(elem)
+	if !ok {
+		return -1
+	}
+	key := t.RawGetString(m.arrayKey)
+	if key == lua.LNil {
+		return -1
+	}
+	for i, e := range elems {
+		if o, ok := isObject(e); ok && deepEqual(o.RawGetString(m.arrayKey), key) {
+			return i
+		}
+	}
+	return -1
+}
+
+func apiMerge(L *lua.LState) int {
+	a := L.CheckAny(1)
+	b := L.CheckAny(2)
+	opts := checkOptions(L, 3)
+
+	m := &merger{L: L, arrayKey: opts.string("array_key", "")}
+	L.Push(m.merge(a, b))
+	return 1
+}
+
+// mergePatch returns a new value applying the RFC 7386 merge patch to
+// target: the members of an object patch are merged recursively into
+// target, Null removing them, and any other patch replaces target. Empty
+// tables are patched as objects.
+func mergePatch(L *lua.LState, target, patch lua.LValue) lua.LValue {
+	if patch == Null {
+		return lua.LNil
+	}
+	p, ok := patch.(*lua.LTable)
+	if !ok {
+		return clone(L, patch)
+	}
+	if n, array := isArray(p); array && n > 0 {
+		return clone(L, patch)
+	}
+	t := L.CreateTable(0, 0)
+	if o, ok := target.(*lua.LTable); ok {
+		if n, array := isArray(o); !array || n == 0 {
+			o.ForEach(func(key, value lua.LValue) {
+				t.RawSet(key, clone(L, value))
+			})
+		}
+	}
+	p.ForEach(func(key, value lua.LValue) {
+		if value == Null {
+			t.RawSet(key, lua.LNil)
+		} else {
+			t.RawSet(key, mergePatch(L, t.RawGet(key), value))
+		}
+	})
+	return t
+}
+
+// apiMergePatch applies a merge patch, given as a table or a JSON string
+// whose nulls remove members.
+func apiMergePatch(L *lua.LState) int {
+	target := L.CheckAny(1)
+	patch := L.CheckAny(2)
+	if s, ok := patch.(lua.LString); ok {
+		var err error
+		patch, err = DecodeWithOptions(L, []byte(s), &DecodeOptions{KeepNulls: true})
+		if err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+	}
+	L.Push(mergePatch(L, target, patch))
+	return 1
+}
@@ -0,0 +1,90 @@
+package json
+
+import (
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		a, b, key, expected string
+	}{
+		{`{"a":1,"b":{"c":2}}`, `{"b":{"d":3},"e":4}`, "", `{"a":1,"b":{"c":2,"d":3},"e":4}`},
+		{`{"a":{"b":1}}`, `{"a":2}`, "", `{"a":2}`},
+		{`{"a":[1,2,3]}`, `{"a":[4]}`, "", `{"a":[4,2,3]}`},
+		{`[{"x":1},{"y":2}]`, `[{"z":3}]`, "", `[{"x":1,"z":3},{"y":2}]`},
+		{`{"a":[1]}`, `{"a":{}}`, "", `{"a":[1]}`},
+		{`{"a":{}}`, `{"a":[1]}`, "", `{"a":[1]}`},
+		{
+			`{"containers":[{"name":"app","image":"app:1","env":{"A":"1"}},{"name":"proxy","image":"proxy:1"}]}`,
+			`{"containers":[{"name":"proxy","image":"proxy:2"},{"name":"app","env":{"B":"2"}},{"name":"sidecar"}]}`,
+			"name",
+			`{"containers":[{"env":{"A":"1","B":"2"},"image":"app:1","name":"app"},{"image":"proxy:2","name":"proxy"},{"name":"sidecar"}]}`,
+		},
+		{`[1,{"id":1},{"v":1}]`, `[2,{"id":1,"v":2},{"v":3}]`, "id", `[1,{"id":1,"v":2},{"v":1},2,{"v":3}]`},
+	}
+	for _, test := range tests {
+		s := lua.NewState()
+		a, _ := Decode(s, []byte(test.a))
+		b, _ := Decode(s, []byte(test.b))
+		m := &merger{L: s, arrayKey: test.key}
+		data, err := Encode(m.merge(a, b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != test.expected {
+			t.Fatalf("%s + %s: expecting %s, got %s", test.a, test.b, test.expected, data)
+		}
+		s.Close()
+	}
+}
+
+func TestMergeLua(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local a = {items = {{id = 1, v = "a"}, {id = 2, v = "b"}}}
+	local b = {items = {{id = 2, v = "c"}}}
+	local merged = json.merge(a, b, {array_key = "id"})
+	assert(#merged.items == 2 and merged.items[2].v == "c")
+	assert(a.items[2].v == "b" and merged.items[1] ~= a.items[1])
+
+	local merged = json.merge(a, b)
+	assert(#merged.items == 2 and merged.items[1].id == 2 and merged.items[1].v == "c")
+	assert(json.merge({x = 1}, "y") == "y")
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local config = {server = {host = "a", port = 80}, tags = {"x", "y"}, debug = true}
+	local patched = json.merge_patch(config, {server = {port = 8080, host = json.null}, tags = {"z"}, debug = json.null})
+	assert(json.encode(patched) == '{"server":{"port":8080},"tags":["z"]}', json.encode(patched))
+	assert(config.server.host == "a" and config.debug == true)
+
+	patched = assert(json.merge_patch(config, '{"server": {"tls": {"on": true}}, "tags": null}'))
+	assert(json.encode(patched) == '{"debug":true,"server":{"host":"a","port":80,"tls":{"on":true}}}', json.encode(patched))
+	assert(json.merge_patch({a = 1}, {}).a == 1)
+	assert(json.merge_patch({1, 2}, {a = 1}).a == 1)
+	assert(json.merge_patch({a = 1}, "[1]")[1] == 1)
+	assert(json.merge_patch({a = 1}, json.null) == nil)
+	assert(json.merge_patch("x", {a = {b = json.null}}).a ~= nil)
+	local _, err = json.merge_patch({}, "{")
+	assert(err ~= nil)
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
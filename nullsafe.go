@@ -0,0 +1,47 @@
+package json
+
+import (
+	"github.com/yuin/gopher-lua"
+)
+
+// apiAt returns the value reached from a document by following members and
+// elements, or nil as soon as one is missing or null.
+func apiAt(L *lua.LState) int {
+	v := L.CheckAny(1)
+	for n := 2; n <= L.GetTop(); n++ {
+		key := L.Get(n)
+		if t := key.Type(); t != lua.LTString && t != lua.LTNumber {
+			L.ArgError(n, "string or number expected, got "+t.String())
+		}
+		if v = memberOf(v, key); v == lua.LNil {
+			break
+		}
+	}
+	if v == Null {
+		v = lua.LNil
+	}
+	L.Push(v)
+	return 1
+}
+
+// memberOf returns the member or element key of v, counting elements from 1,
+// or nil when v holds no such value.
+func memberOf(v, key lua.LValue) lua.LValue {
+	switch v := v.(type) {
+	case *lua.LTable:
+		return v.RawGet(key)
+	case *lua.LUserData:
+		switch c := v.Value.(type) {
+		case *Object:
+			if k, ok := key.(lua.LString); ok {
+				value, _ := c.Get(string(k))
+				return value
+			}
+		case *Array:
+			if i, ok := key.(lua.LNumber); ok && i == lua.LNumber(int(i)) {
+				return c.Get(int(i) - 1)
+			}
+		}
+	}
+	return lua.LNil
+}
@@ -0,0 +1,35 @@
+package json
+
+import (
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestAt(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local doc = json.decode('{"a": {"b": [{"c": 1}, null, {"c": "x"}]}, "n": null}', {keep_nulls = true})
+	assert(json.at(doc, "a", "b", 3, "c") == "x")
+	assert(json.at(doc, "a", "b", 1, "c") == 1)
+	assert(json.at(doc, "a", "b", 2, "c") == nil)
+	assert(json.at(doc, "a", "b", 9, "c") == nil)
+	assert(json.at(doc, "a", "missing", 1) == nil)
+	assert(json.at(doc, "a", "b", 3, "c", "d") == nil)
+	assert(json.at(doc, "n") == nil)
+	assert(json.at(doc) == doc)
+	assert(json.at(nil, "a") == nil)
+
+	local obj = json.decode('{"a": {"b": [10, 20]}}', {objects = "userdata", array_threshold = 1})
+	assert(json.at(obj, "a", "b", 2) == 20)
+	assert(json.at(obj, "a", 1) == nil)
+	assert(not pcall(json.at, doc, "a", {}))
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
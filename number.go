@@ -0,0 +1,122 @@
+package json
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// integerNumbers reports whether lua.LNumber is an integer type, as in the
+// forks of gopher-lua built with integer numbers. Integers then decode and
+// encode without going through float64, which cannot hold all of them, and
+// the options about integers beyond 2^53 no longer apply to them.
+var integerNumbers = reflect.TypeOf(lua.LNumber(0)).Kind() != reflect.Float64
+
+// appendInteger appends n in decimal if numbers are integers, reporting
+// whether it did.
+func appendInteger(dst []byte, n lua.LNumber) ([]byte, bool) {
+	if !integerNumbers {
+		return dst, false
+	}
+	return strconv.AppendInt(dst, int64(n), 10), true
+}
+
+// FloatCompat selects the formatting of numbers, so that output matches
+// byte for byte what another language's standard encoder produces.
+type FloatCompat int
+
+const (
+	// FloatGo formats numbers like encoding/json.
+	FloatGo FloatCompat = iota
+	// FloatJS formats numbers like JavaScript's JSON.stringify.
+	FloatJS
+	// FloatPython formats numbers like Python's json module, with integral
+	// values within the safe integer range formatted as Python ints.
+	FloatPython
+)
+
+var floatCompatNames = map[string]FloatCompat{
+	"go":     FloatGo,
+	"js":     FloatJS,
+	"python": FloatPython,
+}
+
+func formatNumber(f float64, compat FloatCompat) ([]byte, error) {
+	switch compat {
+	case FloatJS:
+		if f == 0 {
+			// JSON.stringify drops the sign of negative zero.
+			f = 0
+		}
+	case FloatPython:
+		if !math.IsInf(f, 0) && !math.IsNaN(f) {
+			return formatPython(f), nil
+		}
+	}
+	return json.Marshal(f)
+}
+
+// formatPython formats f like Python's repr, which switches to exponent
+// notation outside of 1e-4 <= |f| < 1e16.
+func formatPython(f float64) []byte {
+	if f == math.Trunc(f) && math.Abs(f) <= maxSafeInt {
+		return strconv.AppendInt(nil, int64(f), 10)
+	}
+	s := strconv.FormatFloat(f, 'e', -1, 64)
+	mantissa, exp := s, 0
+	if i := strings.IndexByte(s, 'e'); i >= 0 {
+		mantissa = s[:i]
+		exp, _ = strconv.Atoi(s[i+1:])
+	}
+	if exp < -4 || exp >= 16 {
+		var b []byte
+		b = append(b, mantissa...)
+		b = append(b, 'e')
+		if exp < 0 {
+			b = append(b, '-')
+			exp = -exp
+		} else {
+			b = append(b, '+')
+		}
+		if exp < 10 {
+			b = append(b, '0')
+		}
+		return strconv.AppendInt(b, int64(exp), 10)
+	}
+	b := strconv.AppendFloat(nil, f, 'f', -1, 64)
+	if !strings.ContainsRune(string(b), '.') {
+		b = append(b, ".0"...)
+	}
+	return b
+}
+
+// floatFormatPattern matches the verbs accepted by the FloatFormat option:
+// those of fmt formatting floats as JSON numbers.
+var floatFormatPattern = regexp.MustCompile(`^%(\.[0-9]+)?[eEfgG]$`)
+
+// checkFloatFormat checks the FloatFormat option format.
+func checkFloatFormat(format string) error {
+	if format != "" && !floatFormatPattern.MatchString(format) {
+		return fmt.Errorf("invalid float format %q", format)
+	}
+	return nil
+}
+
+// appendFloat appends f formatted with format, the FloatFormat option.
+// Integers are appended without a decimal point, as tostring formats them.
+func appendFloat(b []byte, f float64, format string) ([]byte, error) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		_, err := json.Marshal(f)
+		return b, err
+	}
+	if f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+		return strconv.AppendInt(b, int64(f), 10), nil
+	}
+	return fmt.Appendf(b, format, f), nil
+}
@@ -0,0 +1,135 @@
+package json
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestFormatNumber(t *testing.T) {
+	tests := []struct {
+		f      float64
+		compat FloatCompat
+		out    string
+	}{
+		{3, FloatGo, "3"},
+		{1.5, FloatGo, "1.5"},
+		{1e21, FloatGo, "1e+21"},
+		{1e-7, FloatGo, "1e-7"},
+		{math.Copysign(0, -1), FloatGo, "-0"},
+		{math.Copysign(0, -1), FloatJS, "0"},
+		{1e-7, FloatJS, "1e-7"},
+		{3, FloatPython, "3"},
+		{1.5, FloatPython, "1.5"},
+		{1e16 + 2, FloatPython, "1.0000000000000002e+16"},
+		{1e22, FloatPython, "1e+22"},
+		{1e-5, FloatPython, "1e-05"},
+		{0.0001, FloatPython, "0.0001"},
+		{123456.789, FloatPython, "123456.789"},
+		{1.5e300, FloatPython, "1.5e+300"},
+	}
+	for _, test := range tests {
+		data, err := formatNumber(test.f, test.compat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != test.out {
+			t.Fatalf("%v (%d): expecting %s, got %s", test.f, test.compat, test.out, data)
+		}
+	}
+	if _, err := formatNumber(math.Inf(1), FloatPython); err == nil {
+		t.Fatal("expecting an error for infinity")
+	}
+}
+
+func TestFloatCompatOption(t *testing.T) {
+	const str = `
+	local json = require("json")
+	assert(json.encode({0.5, 1e-5}, {float_compat = "python"}) == "[0.5,1e-05]")
+	assert(json.encode({0.5, 1e-5}, {float_compat = "js"}) == "[0.5,0.00001]")
+	assert(not pcall(json.encode, 1, {float_compat = "ruby"}))
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFloatFormat(t *testing.T) {
+	const str = `
+	local json = require("json")
+	assert(json.encode({0.1, 3, -2, 1e20}, {float_format = "%.17g"}) == "[0.10000000000000001,3,-2,1e+20]")
+	assert(json.encode({x = 1/3}, {float_format = "%.3f", indent = " "}) == '{\n "x": 0.333\n}')
+	assert(json.encode(1.5e-7, {float_format = "%g"}) == "1.5e-07")
+	assert(json.encode(1e300, {float_format = "%.2e"}) == "1.00e+300")
+	assert(json.encode(-0.0, {float_format = "%g"}) == tostring(-0.0))
+	assert(json.encode(2^53 + 2, {float_format = "%g"}) == tostring(2^53 + 2))
+	assert(json.encode(2.5, {float_format = "%g", float_compat = "python"}) == "2.5")
+	assert(not pcall(json.encode, 1.5, {float_format = "%d"}))
+	assert(not pcall(json.encode, 1.5, {float_format = "%+g"}))
+	local _, err = json.encode(1/0, {float_format = "%g"})
+	assert(err ~= nil)
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+	if _, err := EncodeWithOptions(lua.LNumber(1.5), &EncodeOptions{FloatFormat: "%x"}); err == nil {
+		t.Error("expecting an error for an invalid format")
+	}
+}
+
+func TestIntegralNumbers(t *testing.T) {
+	for _, f := range []float64{3, -7, 1e15, 1 << 53, -(1 << 60)} {
+		for i, opts := range []*EncodeOptions{{}, {MaxDepth: 8}, {FloatCompat: FloatJS}, {FloatFormat: "%.17g"}} {
+			data, err := EncodeWithOptions(lua.LNumber(f), opts)
+			if err != nil || strings.ContainsAny(string(data), ".e") {
+				t.Errorf("%v (options %d): got %s, %v", f, i, data, err)
+			}
+		}
+	}
+	// With FloatFormat, integers are formatted exactly as by tostring.
+	for _, f := range []float64{-(1 << 60), 1<<63 - 1024, 1e20, 1e300} {
+		data, err := EncodeWithOptions(lua.LNumber(f), &EncodeOptions{FloatFormat: "%g"})
+		if err != nil || string(data) != lua.LNumber(f).String() {
+			t.Errorf("%v: got %s, %v, want %s", f, data, err, lua.LNumber(f).String())
+		}
+	}
+}
+
+func TestIntegerNumbers(t *testing.T) {
+	if integerNumbers {
+		t.Fatal("gopher-lua v1.1.0 has float numbers")
+	}
+	// The probe is forced on to check the integer paths with values that
+	// float numbers hold exactly.
+	integerNumbers = true
+	defer func() { integerNumbers = false }()
+
+	s := lua.NewState()
+	defer s.Close()
+
+	value, err := DecodeWithOptions(s, []byte(`[1152921504606846976, -42, 1.5]`), &DecodeOptions{BigInts: BigIntsInt64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	arr := value.(*lua.LTable)
+	if arr.RawGetInt(1) != lua.LNumber(1<<60) || arr.RawGetInt(2) != lua.LNumber(-42) || arr.RawGetInt(3) != lua.LNumber(1.5) {
+		t.Errorf("got %v", arr)
+	}
+	arr.RawSetInt(3, lua.LNumber(7))
+	for _, opts := range []*EncodeOptions{{BigInts: BigIntsString}, {WarnUnsafeInts: true, Report: &Report{}}} {
+		data, err := EncodeWithOptions(arr, opts)
+		if err != nil || string(data) != `[1152921504606846976,-42,7]` {
+			t.Errorf("got %s, %v", data, err)
+		}
+	}
+}
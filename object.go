@@ -0,0 +1,222 @@
+package json
+
+import (
+	"github.com/yuin/gopher-lua"
+)
+
+const objectTypeName = "json.object"
+
+// maxLinearKeys is the number of members up to which an Object looks up keys
+// by scanning them rather than through an index.
+const maxLinearKeys = 8
+
+// Object is a decoded JSON object held in Go rather than in a Lua table, as
+// returned to Lua as userdata when DecodeOptions.UserDataObjects is set.
+// Scripts read and write its members by indexing the userdata, as they would
+// a table. It costs the garbage collector far less than a table, which
+// matters for large documents of which scripts only read a few members.
+type Object struct {
+	keys   []string
+	values []lua.LValue
+	index  map[string]int
+
+	// frozen makes scripts fail to set members, for cached documents.
+	frozen bool
+}
+
+func (o *Object) find(key string) int {
+	if o.index != nil {
+		if i, ok := o.index[key]; ok {
+			return i
+		}
+		return -1
+	}
+	for i, k := range o.keys {
+		if k == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// Get returns the value of the member with the given key.
+func (o *Object) Get(key string) (lua.LValue, bool) {
+	if i := o.find(key); i >= 0 {
+		return o.values[i], true
+	}
+	return lua.LNil, false
+}
+
+// Set sets the value of the member with the given key, adding the member
+// after the others if it does not exist. Setting a nil value removes the
+// member.
+func (o *Object) Set(key string, value lua.LValue) {
+	i := o.find(key)
+	switch {
+	case value == lua.LNil && i >= 0:
+		o.keys = append(o.keys[:i], o.keys[i+1:]...)
+		o.values = append(o.values[:i], o.values[i+1:]...)
+		o.index = nil
+		if len(o.keys) > maxLinearKeys {
+			o.reindex()
+		}
+	case value == lua.LNil:
+	case i >= 0:
+		o.values[i] = value
+	default:
+		o.keys = append(o.keys, key)
+		o.values = append(o.values, value)
+		if o.index != nil {
+			o.index[key] = len(o.keys) - 1
+		} else if len(o.keys) > maxLinearKeys {
+			o.reindex()
+		}
+	}
+}
+
+func (o *Object) reindex() {
+	o.index = make(map[string]int, len(o.keys))
+	for i, k := range o.keys {
+		o.index[k] = i
+	}
+}
+
+// Len returns the number of members.
+func (o *Object) Len() int {
+	return len(o.keys)
+}
+
+// Keys returns the keys of the members, in document order.
+func (o *Object) Keys() []string {
+	return append([]string(nil), o.keys...)
+}
+
+func registerObject(L *lua.LState) *lua.LTable {
+	mt := L.NewTypeMetatable(objectTypeName)
+	mt.RawSetString("__index", L.NewFunction(objectIndex))
+	mt.RawSetString("__newindex", L.NewFunction(objectNewIndex))
+	mt.RawSetString("__len", L.NewFunction(objectLen))
+	return mt
+}
+
+// objectMetatable returns the metatable of Object userdata, registering it
+// when the module has not been loaded, as when hosts decode directly.
+func objectMetatable(L *lua.LState) lua.LValue {
+	if mt := L.GetTypeMetatable(objectTypeName); mt != lua.LNil {
+		return mt
+	}
+	return registerObject(L)
+}
+
+func (d *decoder) newObject() lua.LValue {
+	if d.opts.PreserveOrder && !d.opts.UserDataObjects {
+		return d.newOrderedTable()
+	}
+	if !d.opts.UserDataObjects {
+		return d.newTable(false, 0, 0)
+	}
+	if d.objectMetatable == nil {
+		d.objectMetatable = objectMetatable(d.L)
+	}
+	return &lua.LUserData{Value: &Object{}, Env: d.L.Env, Metatable: d.objectMetatable}
+}
+
+func checkObject(L *lua.LState, n int) *Object {
+	ud := L.CheckUserData(n)
+	o, ok := ud.Value.(*Object)
+	if !ok {
+		L.ArgError(n, "json object expected")
+	}
+	return o
+}
+
+var objectMethods = map[string]lua.LGFunction{
+	"totable": objectToTable,
+	"keys":    objectKeys,
+}
+
+// objectIndex returns the member with the given key or, when there is none,
+// the method with that name.
+func objectIndex(L *lua.LState) int {
+	o := checkObject(L, 1)
+	key := L.CheckString(2)
+	if value, ok := o.Get(key); ok {
+		L.Push(value)
+		return 1
+	}
+	if fn, ok := objectMethods[key]; ok {
+		L.Push(L.NewFunction(fn))
+		return 1
+	}
+	L.Push(lua.LNil)
+	return 1
+}
+
+func objectNewIndex(L *lua.LState) int {
+	o := checkObject(L, 1)
+	if o.frozen {
+		L.RaiseError("cannot modify a cached JSON document")
+	}
+	o.Set(L.CheckString(2), L.Get(3))
+	return 0
+}
+
+func objectLen(L *lua.LState) int {
+	L.Push(lua.LNumber(checkObject(L, 1).Len()))
+	return 1
+}
+
+func objectKeys(L *lua.LState) int {
+	o := checkObject(L, 1)
+	t := L.CreateTable(len(o.keys), 0)
+	for _, k := range o.keys {
+		t.Append(lua.LString(k))
+	}
+	L.Push(t)
+	return 1
+}
+
+// objectToTable converts an object, and all objects nested in it, to tables.
+func objectToTable(L *lua.LState) int {
+	checkObject(L, 1)
+	L.Push(materialize(L, L.Get(1), make(map[lua.LValue]lua.LValue)))
+	return 1
+}
+
+// materialize returns a copy of value in which every Object and Array is
+// replaced with a table. The copies of containers already converted are recorded in seen.
+func materialize(L *lua.LState, value lua.LValue, seen map[lua.LValue]lua.LValue) lua.LValue {
+	if copied, ok := seen[value]; ok {
+		return copied
+	}
+	switch v := value.(type) {
+	case *lua.LUserData:
+		if a, ok := v.Value.(*Array); ok {
+			t := L.CreateTable(a.Len(), 0)
+			seen[value] = t
+			for i := 0; i < a.Len(); i++ {
+				t.RawSetInt(i+1, materialize(L, a.Get(i), seen))
+			}
+			return t
+		}
+		o, ok := v.Value.(*Object)
+		if !ok {
+			return value
+		}
+		t := L.CreateTable(0, len(o.keys))
+		seen[value] = t
+		for i, k := range o.keys {
+			t.RawSetString(k, materialize(L, o.values[i], seen))
+		}
+		return t
+	case *lua.LTable:
+		t := L.CreateTable(v.Len(), 0)
+		seen[value] = t
+		v.ForEach(func(key, item lua.LValue) {
+			t.RawSet(key, materialize(L, item, seen))
+		})
+		t.Metatable = v.Metatable
+		return t
+	}
+	return value
+}
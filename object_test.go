@@ -0,0 +1,96 @@
+package json
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestObject(t *testing.T) {
+	o := &Object{}
+	for i := 0; i < 20; i++ {
+		o.Set(fmt.Sprint("k", i), lua.LNumber(i))
+	}
+	o.Set("k3", lua.LNil)
+	o.Set("k5", lua.LString("five"))
+	if o.Len() != 19 {
+		t.Fatalf("expecting 19 members, got %d", o.Len())
+	}
+	if _, ok := o.Get("k3"); ok {
+		t.Error("expecting k3 to be removed")
+	}
+	if v, _ := o.Get("k5"); v != lua.LString("five") {
+		t.Errorf("expecting k5 to be replaced, got %v", v)
+	}
+	if v, _ := o.Get("k19"); v != lua.LNumber(19) {
+		t.Errorf("expecting k19, got %v", v)
+	}
+	if keys := o.Keys(); keys[3] != "k4" || keys[18] != "k19" {
+		t.Errorf("unexpected key order %v", keys)
+	}
+}
+
+func TestUserDataObjects(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	for _, threshold := range []int{0, -1} {
+		value, err := DecodeWithOptions(L, []byte(`{"b":{"c":[{"d":1}]},"a":2}`), &DecodeOptions{
+			UserDataObjects:   true,
+			FastPathThreshold: threshold,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ud, ok := value.(*lua.LUserData)
+		if !ok {
+			t.Fatalf("expecting userdata, got %v", value)
+		}
+		if keys := ud.Value.(*Object).Keys(); len(keys) != 2 || keys[0] != "b" || keys[1] != "a" {
+			t.Errorf("expecting keys in document order, got %v", keys)
+		}
+		data, err := Encode(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != `{"a":2,"b":{"c":[{"d":1}]}}` {
+			t.Errorf("unexpected encoding %s", data)
+		}
+	}
+}
+
+func TestUserDataObjectsLua(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local doc = json.decode('{"user":{"name":"gopher","roles":[{"id":1}]},"n":2,"empty":{}}', {objects = "userdata"})
+	assert(type(doc) == "userdata")
+	assert(doc.user.name == "gopher" and doc.user.roles[1].id == 1)
+	assert(#doc == 3 and doc.missing == nil)
+	assert(json.encode(doc.empty) == "{}")
+
+	doc.n = nil
+	doc.added = true
+	local keys = doc:keys()
+	assert(#keys == 3 and keys[3] == "added")
+
+	-- An empty table would encode as an array.
+	doc.empty = nil
+
+	local t = doc:totable()
+	assert(type(t) == "table" and type(t.user) == "table" and type(t.user.roles[1]) == "table")
+	assert(t.user.roles[1].id == 1 and t.added == true)
+	assert(json.encode(doc) == json.encode(t))
+
+	local shadowed = json.decode('{"keys":1}', {objects = "userdata"})
+	assert(shadowed.keys == 1)
+	assert(not pcall(json.decode, '{}', {objects = "map"}))
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
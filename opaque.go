@@ -0,0 +1,152 @@
+package json
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+
+	"github.com/yuin/gopher-lua"
+)
+
+const opaqueTypeName = "json.opaque"
+
+// Opaque is a document decoded by json.decode_opaque and held as JSON rather
+// than converted to Lua. It suits scripts that route or forward documents and
+// read little of them: the document is only parsed, into the Go values of
+// encoding/json, once a script gets one of its values, and it encodes back
+// as the original text, without whitespace.
+type Opaque struct {
+	data []byte
+
+	// value is the parsed document, with numbers as json.Number, once
+	// needed.
+	value  interface{}
+	parsed bool
+
+	// decode holds the options of the module that decoded the document,
+	// used to convert the values that scripts get.
+	decode *DecodeOptions
+}
+
+// Value returns the parsed document, such as a map[string]interface{}.
+func (o *Opaque) Value() interface{} {
+	if !o.parsed {
+		dec := json.NewDecoder(bytes.NewReader(o.data))
+		dec.UseNumber()
+		// The document was validated by decodeOpaque.
+		dec.Decode(&o.value)
+		o.parsed = true
+	}
+	return o.value
+}
+
+// Bytes returns the JSON text of the document.
+func (o *Opaque) Bytes() []byte {
+	return o.data
+}
+
+// decodeOpaque checks that data holds a single JSON document.
+func decodeOpaque(data []byte) (*Opaque, error) {
+	if json.Valid(data) {
+		return &Opaque{data: data}, nil
+	}
+	// Decode the document to report the error.
+	dec := json.NewDecoder(bytes.NewReader(data))
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	return nil, errors.New("invalid character after top-level value")
+}
+
+// resolve returns the value at p, and whether there is one.
+func (o *Opaque) resolve(p Pointer) (interface{}, bool) {
+	v := o.Value()
+	for _, token := range p {
+		switch c := v.(type) {
+		case map[string]interface{}:
+			member, ok := c[token]
+			if !ok {
+				return nil, false
+			}
+			v = member
+		case []interface{}:
+			i, err := arrayIndex(token, len(c), false)
+			if err != nil || i == len(c) {
+				return nil, false
+			}
+			v = c[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+func registerOpaque(L *lua.LState) {
+	mt := L.NewTypeMetatable(opaqueTypeName)
+	methods := L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"get":    opaqueGet,
+		"encode": opaqueEncode,
+	})
+	mt.RawSetString("__index", methods)
+	mt.RawSetString("__tostring", L.NewFunction(opaqueEncode))
+}
+
+func checkOpaque(L *lua.LState, n int) *Opaque {
+	ud := L.CheckUserData(n)
+	o, ok := ud.Value.(*Opaque)
+	if !ok {
+		L.ArgError(n, "json opaque document expected")
+	}
+	return o
+}
+
+func (m *module) apiDecodeOpaque(L *lua.LState) int {
+	str := L.CheckString(1)
+
+	o, err := decodeOpaque([]byte(str))
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	o.decode = &m.decode
+	ud := L.NewUserData()
+	ud.Value = o
+	ud.Metatable = L.GetTypeMetatable(opaqueTypeName)
+	L.Push(ud)
+	return 1
+}
+
+// opaqueGet converts the value at a JSON pointer, or nil when there is none,
+// as json.decode would.
+func opaqueGet(L *lua.LState) int {
+	o := checkOpaque(L, 1)
+	p := checkPointer(L, 2)
+
+	v, ok := o.resolve(p)
+	if !ok {
+		L.Push(lua.LNil)
+		return 1
+	}
+	data, err := json.Marshal(v)
+	if err == nil {
+		var value lua.LValue
+		if value, err = DecodeWithOptions(L, data, o.decode); err == nil {
+			L.Push(value)
+			return 1
+		}
+	}
+	L.Push(lua.LNil)
+	L.Push(lua.LString(err.Error()))
+	return 2
+}
+
+func opaqueEncode(L *lua.LState) int {
+	o := checkOpaque(L, 1)
+	var b bytes.Buffer
+	json.Compact(&b, o.data)
+	L.Push(lua.LString(b.String()))
+	return 1
+}
@@ -0,0 +1,76 @@
+package json
+
+import (
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestDecodeOpaque(t *testing.T) {
+	o, err := decodeOpaque([]byte(`{"id":9007199254740993,"items":[{"name":"a"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.parsed {
+		t.Fatal("the document was parsed before being needed")
+	}
+	m, ok := o.Value().(map[string]interface{})
+	if !ok || len(m) != 2 {
+		t.Fatalf("got %#v", o.Value())
+	}
+	for _, s := range []string{"/items/1", "/items/x", "/id/0", "/missing"} {
+		p, _ := ParsePointer(s)
+		if _, ok := o.resolve(p); ok {
+			t.Fatalf("%s: expecting no value", s)
+		}
+	}
+	for _, data := range []string{`{`, `{} {}`, ``} {
+		if _, err := decodeOpaque([]byte(data)); err == nil {
+			t.Fatalf("%q: expecting an error", data)
+		}
+	}
+}
+
+func TestDecodeOpaqueLua(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local doc = json.decode_opaque('{"id": 9007199254740993, "route": "b", "items": [{"name": "a"}]}')
+	assert(type(doc) == "userdata")
+	assert(doc:get("/route") == "b")
+	assert(doc:get("/items/0").name == "a")
+	assert(doc:get("/items/1") == nil)
+	assert(doc:get("").route == "b")
+	assert(not pcall(doc.get, doc, "items"))
+	assert(doc:encode() == '{"id":9007199254740993,"route":"b","items":[{"name":"a"}]}')
+	assert(tostring(doc) == doc:encode())
+	assert(json.encode({doc = doc}) == '{"doc":{"id":9007199254740993,"route":"b","items":[{"name":"a"}]}}')
+	assert(json.encode(json.decode_opaque(' [1,  2] '), {indent = " "}) == "[\n 1,\n 2\n]")
+
+	local doc, err = json.decode_opaque("[1,")
+	assert(doc == nil and err)
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
+
+func BenchmarkOpaquePassThrough(b *testing.B) {
+	L := lua.NewState()
+	defer L.Close()
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchmarkDocument)))
+	for i := 0; i < b.N; i++ {
+		o, err := decodeOpaque(benchmarkDocument)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := Encode(&lua.LUserData{Value: o}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
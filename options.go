@@ -0,0 +1,687 @@
+package json
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// Option configures the module returned by NewLoader.
+type Option func(*config)
+
+type config struct {
+	encode EncodeOptions
+	decode DecodeOptions
+
+	schemaLoader SchemaLoader
+	decodeCache  *decodeCache
+	keyResolver  KeyResolver
+	errorObjects bool
+
+	// ids and clock generate the identifiers and times of envelopes;
+	// lastID is the counter used without ids.
+	ids    IDGenerator
+	clock  Clock
+	lastID atomic.Uint64
+}
+
+func newConfig(opts []Option) *config {
+	c := &config{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// EncodeOptions controls how Lua values are converted to JSON.
+type EncodeOptions struct {
+	// WarnUnsafeInts records the paths of integers beyond 2^53 in Report.
+	WarnUnsafeInts bool
+	// ReportDegraded records in Report the values left out or replaced by
+	// the lenient policies of TableKeys, Cycles and Truncate.
+	ReportDegraded bool
+
+	// BigInts selects how integers beyond 2^53, numbers or Int64 userdata,
+	// are converted: BigIntsString encodes them as strings of their digits,
+	// and the other policies as numbers. Only those converted to numbers
+	// are recorded by WarnUnsafeInts.
+	BigInts BigInts
+
+	// Report, when non-nil, receives the warnings of the conversion.
+	Report *Report
+
+	// ExtraEscapes lists runes that are escaped in strings in addition to
+	// those escaped by encoding/json.
+	ExtraEscapes []rune
+	// RawHTML writes <, > and & in strings verbatim instead of escaping them
+	// as \u003c, \u003e and \u0026.
+	RawHTML bool
+	// EscapeUnicode escapes the non-ASCII characters of strings as \u
+	// sequences.
+	EscapeUnicode bool
+
+	// MaxDepth, when positive, limits the nesting depth of tables.
+	MaxDepth int
+
+	// MaxArrayElems and MaxObjectMembers, when positive, limit the size of
+	// arrays and objects. Larger containers fail the conversion or, when
+	// Truncate is set, are cut to the limit and marked with a "$truncated"
+	// member, or element, giving the number of values left out.
+	MaxArrayElems    int
+	MaxObjectMembers int
+	Truncate         bool
+
+	// FloatCompat selects how numbers are formatted.
+	FloatCompat FloatCompat
+	// FloatFormat, when non-empty, formats the numbers that are not
+	// integers with this fmt verb, one of %e, %E, %f, %g and %G with an
+	// optional precision such as %.17g, instead of FloatCompat. Integers are
+	// formatted without a decimal point, as tostring formats them.
+	FloatFormat string
+
+	// TableKeys selects how tables used as keys are encoded.
+	TableKeys TableKeys
+
+	// SparseArrays selects how tables with numeric keys that are not a
+	// sequence are encoded.
+	SparseArrays SparseArrays
+
+	// PackedArrays encodes all tables with an integral "n" field, as made by
+	// table.pack, as arrays of that length, not only those marked by
+	// json.array.
+	PackedArrays bool
+
+	// Cycles selects how tables that contain themselves are encoded.
+	Cycles Cycles
+
+	// OnLimit, when non-nil, is called before failing on an exceeded limit.
+	OnLimit func(*LimitError)
+
+	// Enums maps Lua values at the given paths back to JSON values.
+	Enums []Enum
+	// MemoryBudget, when positive, limits the approximate memory allocated
+	// by the conversion, in bytes.
+	MemoryBudget int
+	// Timeout, when positive, aborts the conversion with a TimeoutError
+	// once it has run for longer.
+	Timeout time.Duration
+	// State, when non-nil, is used to call the __tojson and __tostring
+	// metamethods of userdata, which are then encoded as the value returned
+	// by __tojson, or else as the string returned by __tostring. The
+	// functions of the Lua module set it to the calling state.
+	State *lua.LState
+
+	// ReflectUserData encodes the Go values held by userdata, such as those
+	// created by gopher-luar, with encoding/json instead of failing.
+	ReflectUserData bool
+	// FieldNameMapper, when non-nil, names the untagged fields of the structs
+	// encoded by ReflectUserData.
+	FieldNameMapper func(string) string
+
+	// Overrides maps path patterns, which may use * wildcards, to the policy
+	// applied to the values at matching paths instead of encoding them as
+	// usual.
+	Overrides map[string]Override
+
+	// Indent and Prefix, when either is non-empty, format the output like
+	// json.MarshalIndent: each element or member on a new line starting
+	// with Prefix, followed by one copy of Indent per level of nesting.
+	Indent string
+	Prefix string
+
+	// SortKeys guarantees that the members of every object are sorted by
+	// key. Tables and Object userdata always are, and with SortKeys so are
+	// the documents of Opaque userdata, the Go values encoded by
+	// ReflectUserData, raw JSON inserted by Overrides and the documents
+	// written by json.build.
+	SortKeys bool
+
+	// Classes maps metatables to the tags of their instances, which encode
+	// as objects with a TypeKey member, "$type" when empty, holding the tag.
+	Classes map[*lua.LTable]string
+	TypeKey string
+
+	// FieldSampler, when non-nil, is called with each value encoded below
+	// the top level.
+	FieldSampler FieldSampler
+	// sampling, set by WithFieldSampler, selects the conversions of scripts
+	// that call its sampler.
+	sampling *fieldSampling
+}
+
+// DecodeOptions controls how JSON is converted to Lua values.
+type DecodeOptions struct {
+	// TablePool, when non-nil, supplies the tables created while decoding.
+	TablePool *TablePool
+	// TableAllocator, when non-nil, creates the tables of decoded arrays
+	// and objects, taking precedence over TablePool.
+	TableAllocator TableAllocator
+
+	// WarnUnsafeInts records the paths of integers beyond 2^53 in Report.
+	WarnUnsafeInts bool
+
+	// BigInts selects how integers beyond 2^53 are converted. Only those
+	// converted to numbers are recorded by WarnUnsafeInts.
+	BigInts BigInts
+	// BigIntStrings also converts strings holding the digits of integers
+	// beyond 2^53, as encoded with BigIntsString, with BigInts.
+	BigIntStrings bool
+
+	// Report, when non-nil, receives the warnings of the conversion.
+	Report *Report
+
+	// MaxDepth, when positive, limits the nesting depth of arrays and
+	// objects.
+	MaxDepth int
+
+	// MaxBytes, when positive, limits the size of the input.
+	MaxBytes int
+
+	// DuplicateKeys selects which member is kept when an object has
+	// several members with the same key.
+	DuplicateKeys DuplicatePolicy
+
+	// ReportDuplicates records the paths of duplicate members in Report,
+	// whichever member is kept.
+	ReportDuplicates bool
+
+	// OnLimit, when non-nil, is called before failing on an exceeded limit.
+	OnLimit func(*LimitError)
+
+	// Coerce maps path patterns, which may use * wildcards, to the type that
+	// string values at matching paths are converted to. Decoding fails on a
+	// string that cannot be converted; values of other types are kept.
+	Coerce map[string]Coercion
+
+	// Enums maps JSON values at the given paths to Lua values.
+	Enums []Enum
+
+	// MemoryBudget, when positive, limits the approximate memory allocated
+	// for the decoded values, in bytes.
+	MemoryBudget int
+
+	// AllowKeys, when non-nil, lists the only object keys that are decoded,
+	// and DenyKeys keys that are not. Both may use the * and ? globs. The
+	// members with other keys are skipped, and fail the conversion when
+	// RejectKeys is set.
+	AllowKeys  []string
+	DenyKeys   []string
+	RejectKeys bool
+
+	// UserDataObjects decodes objects to Object userdata instead of tables.
+	UserDataObjects bool
+	// PreserveOrder decodes objects to tables recording the order of their
+	// members, in which they are then encoded.
+	PreserveOrder bool
+
+	// ArrayThreshold, when positive, decodes the arrays longer than this to
+	// Array userdata instead of tables.
+	ArrayThreshold int
+
+	// KeepNulls decodes null to Null instead of nil, so that object members
+	// and array elements that are null are kept.
+	KeepNulls bool
+
+	// Constructors maps type names to the constructors of the objects whose
+	// TypeKey member, "$type" when empty, is one of them.
+	Constructors map[string]Constructor
+	TypeKey      string
+
+	// Grammar selects the syntax accepted.
+	Grammar Grammar
+
+	// FastPathThreshold is the size of the largest input decoded by the
+	// parser specialized for small documents; larger inputs are decoded from
+	// the token stream. Zero selects a default of 1 MiB, and a negative
+	// value always uses the token stream.
+	FastPathThreshold int
+
+	// FieldSampler, when non-nil, is called with each value decoded below
+	// the top level.
+	FieldSampler FieldSampler
+	// sampling, set by WithFieldSampler, selects the conversions of scripts
+	// that call its sampler.
+	sampling *fieldSampling
+}
+
+// Grammar selects the JSON syntax accepted by decoding.
+type Grammar int
+
+const (
+	// GrammarECMA404 accepts the syntax of ECMA-404, like encoding/json:
+	// invalid UTF-8 in strings is replaced with U+FFFD.
+	GrammarECMA404 Grammar = iota
+	// GrammarRFC8259 also rejects invalid UTF-8, which RFC 8259 forbids.
+	GrammarRFC8259
+	// GrammarLenient accepts numbers with a leading '+', leading zeros, or
+	// a '.' without digits on one side, such as +1, 007, .5 and 5.
+	GrammarLenient
+	// GrammarJSON5 accepts JSON5, the superset of JSON for files edited by
+	// hand: comments, trailing commas, single-quoted strings, unquoted
+	// member names, and hexadecimal, Infinity and NaN numbers, among others.
+	GrammarJSON5
+)
+
+var grammarNames = map[string]Grammar{
+	"ecma404": GrammarECMA404,
+	"rfc8259": GrammarRFC8259,
+	"lenient": GrammarLenient,
+	"json5":   GrammarJSON5,
+}
+
+// DuplicatePolicy selects which of several members with the same key is kept
+// by decoding.
+type DuplicatePolicy int
+
+const (
+	// KeepLast keeps the last member, like encoding/json.
+	KeepLast DuplicatePolicy = iota
+	// KeepFirst keeps the first member.
+	KeepFirst
+	// RejectDuplicates fails the conversion.
+	RejectDuplicates
+)
+
+var duplicatePolicyNames = map[string]DuplicatePolicy{
+	"last":  KeepLast,
+	"first": KeepFirst,
+	"error": RejectDuplicates,
+}
+
+// WithTablePool makes json.decode take its tables from p. The host returns
+// decoded values to the pool with TablePool.Put once scripts are done with
+// them.
+func WithTablePool(p *TablePool) Option {
+	return func(c *config) {
+		c.decode.TablePool = p
+	}
+}
+
+// WithTableAllocator makes json.decode create its tables with a, falling
+// back to the TablePool option, if any, when a returns nil.
+func WithTableAllocator(a TableAllocator) Option {
+	return func(c *config) {
+		c.decode.TableAllocator = a
+	}
+}
+
+// WithKeepNulls makes json.decode decode null to json.null instead of nil,
+// so that members and elements that are null are kept in decoded tables.
+func WithKeepNulls() Option {
+	return func(c *config) {
+		c.decode.KeepNulls = true
+	}
+}
+
+// luaOptions reads the options table passed as an argument to a Lua function.
+type luaOptions struct {
+	L   *lua.LState
+	t   *lua.LTable
+	arg int
+}
+
+// checkOptions returns the options table at argument n, which may be absent.
+func checkOptions(L *lua.LState, n int) luaOptions {
+	o := luaOptions{L: L, arg: n}
+	if L.Get(n) != lua.LNil {
+		o.t = L.CheckTable(n)
+	}
+	return o
+}
+
+func (o luaOptions) get(name string) lua.LValue {
+	if o.t == nil {
+		return lua.LNil
+	}
+	return o.t.RawGetString(name)
+}
+
+func (o luaOptions) bool(name string, def bool) bool {
+	switch v := o.get(name).(type) {
+	case *lua.LNilType:
+		return def
+	case lua.LBool:
+		return bool(v)
+	}
+	o.L.ArgError(o.arg, "option '"+name+"' must be a boolean")
+	return def
+}
+
+// WithFastPathThreshold sets the FastPathThreshold used by json.decode.
+func WithFastPathThreshold(n int) Option {
+	return func(c *config) {
+		c.decode.FastPathThreshold = n
+	}
+}
+
+// WithMemoryBudget limits the approximate memory that a single json.encode or
+// json.decode call may allocate, so that one script of a shared host cannot
+// exhaust its memory with a single huge document. The budget applies to each
+// call on its own: it is not shared by the calls of the state, so it does not
+// bound the total memory of a script that converts many documents. Unlike the
+// other limits, the budget cannot be changed from Lua.
+func WithMemoryBudget(bytes int) Option {
+	return func(c *config) {
+		c.encode.MemoryBudget = bytes
+		c.decode.MemoryBudget = bytes
+	}
+}
+
+// WithUserDataReflection makes json.encode encode the Go values held by
+// userdata with encoding/json, so that objects passed to scripts through
+// gopher-luar can be encoded as part of Lua values.
+func WithUserDataReflection() Option {
+	return func(c *config) {
+		c.encode.ReflectUserData = true
+	}
+}
+
+// WithSchemaLoader makes json.schema_compile load the documents that $ref
+// refers to with fn, unless the script passes a loader of its own. The loaded
+// documents are cached for the life of the state.
+func WithSchemaLoader(fn SchemaLoader) Option {
+	return func(c *config) {
+		c.schemaLoader = fn
+	}
+}
+
+// WithPackedArrays makes json.encode encode the tables with an "n" field, as
+// returned by table.pack, as arrays of that length.
+func WithPackedArrays() Option {
+	return func(c *config) {
+		c.encode.PackedArrays = true
+	}
+}
+
+// WithExtraEscapes makes json.encode escape the given runes in strings, in
+// addition to those escaped by default. This is useful when the output is
+// embedded in a format with stricter rules than JSON.
+func WithExtraEscapes(runes ...rune) Option {
+	return func(c *config) {
+		c.encode.ExtraEscapes = append(c.encode.ExtraEscapes, runes...)
+	}
+}
+
+// checkEncodeOptions applies the options table at argument n to base.
+func checkEncodeOptions(L *lua.LState, n int, base EncodeOptions) (EncodeOptions, luaOptions) {
+	o := checkOptions(L, n)
+	opts := base
+	opts.State = L
+	if opts.sampling != nil {
+		opts.FieldSampler = opts.sampling.next()
+	}
+	opts.WarnUnsafeInts = o.bool("warn_unsafe_int", opts.WarnUnsafeInts)
+	opts.SortKeys = o.bool("sort_keys", opts.SortKeys)
+	opts.Classes = o.classes("classes", opts.Classes)
+	opts.TypeKey = o.string("type_key", opts.TypeKey)
+	if o.bool("big_ints_as_strings", opts.BigInts == BigIntsString) {
+		opts.BigInts = BigIntsString
+	}
+	opts.ReportDegraded = o.bool("report_degraded", opts.ReportDegraded)
+	if opts.WarnUnsafeInts || opts.ReportDegraded {
+		opts.Report = &Report{}
+	}
+	if escapes := o.string("extra_escapes", ""); escapes != "" {
+		opts.ExtraEscapes = append(append([]rune(nil), opts.ExtraEscapes...), []rune(escapes)...)
+	}
+	opts.RawHTML = !o.bool("escape_html", !opts.RawHTML)
+	opts.EscapeUnicode = o.bool("escape_unicode", opts.EscapeUnicode)
+	opts.MaxDepth = o.int("max_depth", opts.MaxDepth)
+	// Scripts can only shorten the timeout set by the host.
+	if ms := o.int("timeout_ms", 0); ms > 0 {
+		if d := time.Duration(ms) * time.Millisecond; opts.Timeout <= 0 || d < opts.Timeout {
+			opts.Timeout = d
+		}
+	}
+	opts.ReflectUserData = o.bool("reflect_userdata", opts.ReflectUserData)
+	opts.Indent = o.string("indent", opts.Indent)
+	opts.Prefix = o.string("prefix", opts.Prefix)
+	opts.MaxArrayElems = o.int("max_array_elems", opts.MaxArrayElems)
+	opts.MaxObjectMembers = o.int("max_object_members", opts.MaxObjectMembers)
+	opts.Truncate = o.bool("truncate", opts.Truncate)
+	if fn := o.function("on_limit"); fn != nil {
+		opts.OnLimit = luaLimitHandler(L, fn, opts.OnLimit)
+	}
+	if name := o.string("float_compat", ""); name != "" {
+		compat, ok := floatCompatNames[name]
+		if !ok {
+			L.ArgError(n, "unknown float_compat "+name)
+		}
+		opts.FloatCompat = compat
+	}
+	opts.FloatFormat = o.string("float_format", opts.FloatFormat)
+	if err := checkFloatFormat(opts.FloatFormat); err != nil {
+		L.ArgError(n, err.Error())
+	}
+	if name := o.string("table_keys", ""); name != "" {
+		policy, ok := tableKeysNames[name]
+		if !ok {
+			L.ArgError(n, "unknown table_keys policy "+name)
+		}
+		opts.TableKeys = policy
+	}
+	if name := o.string("cycles", ""); name != "" {
+		policy, ok := cyclesNames[name]
+		if !ok {
+			L.ArgError(n, "unknown cycles policy "+name)
+		}
+		opts.Cycles = policy
+	}
+	if name := o.string("sparse", ""); name != "" {
+		policy, ok := sparseArraysNames[name]
+		if !ok {
+			L.ArgError(n, "unknown sparse policy "+name)
+		}
+		opts.SparseArrays = policy
+	}
+	opts.PackedArrays = o.bool("packed_arrays", opts.PackedArrays)
+	if enums := o.enums("enums"); enums != nil {
+		opts.Enums = append(append([]Enum(nil), opts.Enums...), enums...)
+		if _, err := compileEnums(opts.Enums, true); err != nil {
+			L.ArgError(n, err.Error())
+		}
+	}
+	if rules := o.stringMap("overrides"); rules != nil {
+		opts.Overrides = make(map[string]Override, len(rules)+len(base.Overrides))
+		for s, policy := range base.Overrides {
+			opts.Overrides[s] = policy
+		}
+		for s, policy := range rules {
+			opts.Overrides[s] = Override(policy)
+		}
+		if _, err := compileOverrides(opts.Overrides); err != nil {
+			L.ArgError(n, err.Error())
+		}
+	}
+	return opts, o
+}
+
+// checkDecodeOptions applies the options table at argument n to base.
+func checkDecodeOptions(L *lua.LState, n int, base DecodeOptions) (DecodeOptions, luaOptions) {
+	o := checkOptions(L, n)
+	opts := base
+	if opts.sampling != nil {
+		opts.FieldSampler = opts.sampling.next()
+	}
+	opts.WarnUnsafeInts = o.bool("warn_unsafe_int", opts.WarnUnsafeInts)
+	opts.ReportDuplicates = o.bool("report_duplicates", opts.ReportDuplicates)
+	if opts.WarnUnsafeInts || opts.ReportDuplicates {
+		opts.Report = &Report{}
+	}
+	if name := o.string("big_ints", ""); name != "" {
+		policy, ok := bigIntsNames[name]
+		if !ok {
+			L.ArgError(n, "unknown big_ints policy "+name)
+		}
+		opts.BigInts = policy
+	}
+	opts.BigIntStrings = o.bool("big_ints_as_strings", opts.BigIntStrings)
+	opts.MaxDepth = o.int("max_depth", opts.MaxDepth)
+	opts.MaxBytes = o.int("max_bytes", opts.MaxBytes)
+	if name := o.string("duplicate_keys", ""); name != "" {
+		policy, ok := duplicatePolicyNames[name]
+		if !ok {
+			L.ArgError(n, "unknown duplicate_keys policy "+name)
+		}
+		opts.DuplicateKeys = policy
+	}
+	if o.bool("reject_duplicate_keys", false) {
+		opts.DuplicateKeys = RejectDuplicates
+	}
+	if fn := o.function("on_limit"); fn != nil {
+		opts.OnLimit = luaLimitHandler(L, fn, opts.OnLimit)
+	}
+	if rules := o.stringMap("coerce"); rules != nil {
+		opts.Coerce = make(map[string]Coercion, len(rules)+len(base.Coerce))
+		for s, to := range base.Coerce {
+			opts.Coerce[s] = to
+		}
+		for s, to := range rules {
+			opts.Coerce[s] = Coercion(to)
+		}
+		if _, err := compileCoercions(opts.Coerce); err != nil {
+			L.ArgError(n, err.Error())
+		}
+	}
+	if keys := o.strings("allow_keys"); keys != nil {
+		opts.AllowKeys = keys
+	}
+	if keys := o.strings("deny_keys"); keys != nil {
+		opts.DenyKeys = append(append([]string(nil), opts.DenyKeys...), keys...)
+	}
+	opts.RejectKeys = o.bool("reject_keys", opts.RejectKeys)
+	opts.ArrayThreshold = o.int("array_threshold", opts.ArrayThreshold)
+	opts.KeepNulls = o.bool("keep_nulls", opts.KeepNulls)
+	opts.PreserveOrder = o.bool("preserve_order", opts.PreserveOrder)
+	opts.Constructors = o.constructors("constructors", opts.Constructors)
+	opts.TypeKey = o.string("type_key", opts.TypeKey)
+	if name := o.string("grammar", ""); name != "" {
+		grammar, ok := grammarNames[name]
+		if !ok {
+			L.ArgError(n, "unknown grammar "+name)
+		}
+		opts.Grammar = grammar
+	}
+	switch o.string("objects", "") {
+	case "":
+	case "table":
+		opts.UserDataObjects = false
+	case "userdata":
+		opts.UserDataObjects = true
+	default:
+		L.ArgError(n, "option 'objects' must be \"table\" or \"userdata\"")
+	}
+	if enums := o.enums("enums"); enums != nil {
+		opts.Enums = append(append([]Enum(nil), opts.Enums...), enums...)
+		if _, err := compileEnums(opts.Enums, false); err != nil {
+			L.ArgError(n, err.Error())
+		}
+	}
+	return opts, o
+}
+
+func (o luaOptions) string(name string, def string) string {
+	switch v := o.get(name).(type) {
+	case *lua.LNilType:
+		return def
+	case lua.LString:
+		return string(v)
+	}
+	o.L.ArgError(o.arg, "option '"+name+"' must be a string")
+	return def
+}
+
+func (o luaOptions) int(name string, def int) int {
+	switch v := o.get(name).(type) {
+	case *lua.LNilType:
+		return def
+	case lua.LNumber:
+		return int(v)
+	}
+	o.L.ArgError(o.arg, "option '"+name+"' must be a number")
+	return def
+}
+
+func (o luaOptions) function(name string) *lua.LFunction {
+	switch v := o.get(name).(type) {
+	case *lua.LNilType:
+		return nil
+	case *lua.LFunction:
+		return v
+	}
+	o.L.ArgError(o.arg, "option '"+name+"' must be a function")
+	return nil
+}
+
+func (o luaOptions) number(name string, def float64) float64 {
+	switch v := o.get(name).(type) {
+	case *lua.LNilType:
+		return def
+	case lua.LNumber:
+		return float64(v)
+	}
+	o.L.ArgError(o.arg, "option '"+name+"' must be a number")
+	return def
+}
+
+// strings returns an option given as an array of strings.
+func (o luaOptions) strings(name string) []string {
+	switch v := o.get(name).(type) {
+	case *lua.LNilType:
+		return nil
+	case *lua.LTable:
+		list := make([]string, 0, v.Len())
+		for i := 1; i <= v.Len(); i++ {
+			s, ok := v.RawGetInt(i).(lua.LString)
+			if !ok {
+				break
+			}
+			list = append(list, string(s))
+		}
+		if len(list) == v.Len() {
+			return list
+		}
+	}
+	o.L.ArgError(o.arg, "option '"+name+"' must be an array of strings")
+	return nil
+}
+
+// checkStrings returns argument n, which must be an array of strings.
+func checkStrings(L *lua.LState, n int) []string {
+	t := L.CheckTable(n)
+	list := make([]string, 0, t.Len())
+	for i := 1; i <= t.Len(); i++ {
+		s, ok := t.RawGetInt(i).(lua.LString)
+		if !ok {
+			L.ArgError(n, "array of strings expected")
+		}
+		list = append(list, string(s))
+	}
+	return list
+}
+
+// stringMap returns an option given as a table of strings keyed by strings.
+func (o luaOptions) stringMap(name string) map[string]string {
+	switch v := o.get(name).(type) {
+	case *lua.LNilType:
+		return nil
+	case *lua.LTable:
+		m := make(map[string]string)
+		valid := true
+		v.ForEach(func(key, value lua.LValue) {
+			k, ok1 := key.(lua.LString)
+			s, ok2 := value.(lua.LString)
+			if !ok1 || !ok2 {
+				valid = false
+				return
+			}
+			m[string(k)] = string(s)
+		})
+		if valid {
+			return m
+		}
+	}
+	o.L.ArgError(o.arg, "option '"+name+"' must be a table of strings keyed by strings")
+	return nil
+}
@@ -0,0 +1,93 @@
+package json
+
+import (
+	"sort"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// Objects decoded with the PreserveOrder option are tables with a metatable
+// of their own, whose __jsonorder field lists their keys in the order of the
+// document. Keys added by scripts are appended to it, so that the tables
+// encode with their members in that order.
+
+// newOrderedTable returns an empty object recording the order of its keys.
+func (d *decoder) newOrderedTable() *lua.LTable {
+	if d.orderedNewIndex == nil {
+		d.orderedNewIndex = d.L.NewFunction(orderedNewIndex)
+	}
+	mt := d.L.CreateTable(0, 3)
+	mt.RawSetString("__jsontype", lua.LString("object"))
+	mt.RawSetString("__jsonorder", d.L.NewTable())
+	mt.RawSetString("__newindex", d.orderedNewIndex)
+	t := d.newTable(false, 0, 0)
+	t.Metatable = mt
+	return t
+}
+
+// memberOrder returns the keys of t in the order they were added, if t
+// records it.
+func memberOrder(t *lua.LTable) *lua.LTable {
+	mt, ok := t.Metatable.(*lua.LTable)
+	if !ok {
+		return nil
+	}
+	order, _ := mt.RawGetString("__jsonorder").(*lua.LTable)
+	return order
+}
+
+// addMember records key as the last member of the ordered table t, unless it
+// is already listed, as a member removed and set again is.
+func addMember(order *lua.LTable, key lua.LValue) {
+	n := order.Len()
+	for i := 1; i <= n; i++ {
+		if order.RawGetInt(i) == key {
+			return
+		}
+	}
+	order.Append(key)
+}
+
+// orderedNewIndex sets the new member of an ordered table, after the others.
+func orderedNewIndex(L *lua.LState) int {
+	t := L.CheckTable(1)
+	key, value := L.CheckAny(2), L.CheckAny(3)
+	if order := memberOrder(t); order != nil && value != lua.LNil {
+		if _, ok := key.(lua.LString); ok {
+			addMember(order, key)
+		}
+	}
+	L.RawSet(t, key, value)
+	return 0
+}
+
+// sortMembers sorts keys, the keys of the object t, in the order recorded by
+// ordered tables, placing the keys missing from it after the others. Keys
+// are sorted by name when t records no order or when sorted is set.
+func sortMembers(t *lua.LTable, keys []string, sorted bool) {
+	order := memberOrder(t)
+	if order == nil || sorted {
+		sort.Strings(keys)
+		return
+	}
+	rank := make(map[string]int, len(keys))
+	n := order.Len()
+	for i := 1; i <= n; i++ {
+		if k, ok := order.RawGetInt(i).(lua.LString); ok {
+			if _, seen := rank[string(k)]; !seen {
+				rank[string(k)] = i
+			}
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		ri, iok := rank[keys[i]]
+		rj, jok := rank[keys[j]]
+		switch {
+		case iok && jok:
+			return ri < rj
+		case iok != jok:
+			return iok
+		}
+		return keys[i] < keys[j]
+	})
+}
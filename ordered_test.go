@@ -0,0 +1,61 @@
+package json
+
+import (
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestPreserveOrder(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local text = '{"name":"api","port":8080,"tls":{"enabled":true,"cert":"a.pem"},"hosts":["b","a"],"empty":{}}'
+	local doc = json.decode(text, {preserve_order = true})
+	assert(json.encode(doc) == text, json.encode(doc))
+	assert(json.encode(doc, {indent = "  "}):find('"name": "api",\n  "port"'))
+	assert(json.encode(doc, {sort_keys = true}) == '{"empty":{},"hosts":["b","a"],"name":"api","port":8080,"tls":{"cert":"a.pem","enabled":true}}')
+
+	doc.port = nil
+	doc.added = 1
+	doc.port = 9090
+	doc.tls.enabled = false
+	rawset(doc, "raw", 2)
+	assert(json.encode(doc) == '{"name":"api","port":9090,"tls":{"enabled":false,"cert":"a.pem"},"hosts":["b","a"],"empty":{},"added":1,"raw":2}', json.encode(doc))
+	assert(json.encode(doc, {overrides = {["$.tls"] = "skip"}}) == '{"name":"api","port":9090,"hosts":["b","a"],"empty":{},"added":1,"raw":2}')
+	local truncated = json.encode(doc, {max_object_members = 2, truncate = true})
+	assert(truncated == '{"name":"api","port":9090,"$truncated":5}', truncated)
+
+	local dup = json.decode('{"b":1,"a":2,"b":3}', {preserve_order = true})
+	assert(json.encode(dup) == '{"b":3,"a":2}')
+	assert(json.encode(json.decode('{"b":1,"a":2}')) == '{"a":2,"b":1}')
+	assert(json.encode(json.seal(json.decode('{"z":1,"y":{"x":1,"w":2}}', {preserve_order = true}))) == '{"z":1,"y":{"x":1,"w":2}}')
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPreserveOrderDecoders(t *testing.T) {
+	s := lua.NewState()
+	defer s.Close()
+
+	const text = `{"z":{"y":1,"x":[{"w":1,"v":2}]},"u":null}`
+	const want = `{"z":{"y":1,"x":[{"w":1,"v":2}]}}`
+	for _, threshold := range []int{0, -1} {
+		opts := &DecodeOptions{PreserveOrder: true, FastPathThreshold: threshold}
+		value, err := DecodeWithOptions(s, []byte(text), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, encode := range []*EncodeOptions{{}, {WarnUnsafeInts: true, Report: &Report{}}} {
+			data, err := EncodeWithOptions(value, encode)
+			if err != nil || string(data) != want {
+				t.Errorf("threshold %d: got %s, %v, want %s", threshold, data, err, want)
+			}
+		}
+	}
+}
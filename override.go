@@ -0,0 +1,107 @@
+package json
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// Override is a policy applied by encoding to the values at some paths.
+type Override string
+
+const (
+	// OverrideSkip leaves the members and elements out of their container.
+	OverrideSkip Override = "skip"
+	// OverrideBase64 encodes strings, such as binary blobs, in base64.
+	OverrideBase64 Override = "base64"
+	// OverrideString encodes values as a string holding their JSON
+	// encoding, as some APIs expect of embedded documents.
+	OverrideString Override = "string"
+	// OverrideRaw inserts strings holding JSON in the output as they are.
+	OverrideRaw Override = "raw"
+)
+
+type override struct {
+	pattern pathPattern
+	policy  Override
+}
+
+// compileOverrides parses the path patterns of the Overrides option.
+func compileOverrides(rules map[string]Override) ([]override, error) {
+	// Apply overlapping patterns in a deterministic order.
+	patterns := make([]string, 0, len(rules))
+	for s := range rules {
+		patterns = append(patterns, s)
+	}
+	sort.Strings(patterns)
+
+	compiled := make([]override, 0, len(rules))
+	for _, s := range patterns {
+		policy := rules[s]
+		switch policy {
+		case OverrideSkip, OverrideBase64, OverrideString, OverrideRaw:
+		default:
+			return nil, fmt.Errorf("unknown override %q for %s", string(policy), s)
+		}
+		pp, err := parsePathPattern(s)
+		if err != nil {
+			return nil, err
+		}
+		if len(pp) == 0 && policy == OverrideSkip {
+			return nil, fmt.Errorf("cannot skip the document root")
+		}
+		compiled = append(compiled, override{pattern: pp, policy: policy})
+	}
+	return compiled, nil
+}
+
+// overrideAt returns the policy of the first override whose pattern matches
+// p, or "".
+func overrideAt(rules []override, p path) Override {
+	for _, r := range rules {
+		if r.pattern.match(p) {
+			return r.policy
+		}
+	}
+	return ""
+}
+
+// marshalOverride encodes the value of j with the policy overriding it.
+func (j jsonValue) marshalOverride(policy Override) ([]byte, error) {
+	if policy == OverrideString {
+		j.overridden = true
+		data, err := j.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		return marshalString(string(data), j.state.opts.ExtraEscapes)
+	}
+	s, ok := j.LValue.(lua.LString)
+	if !ok {
+		return nil, fmt.Errorf("cannot encode %s at %s as %s", j.LValue.Type(), j.path, string(policy))
+	}
+	if policy == OverrideRaw {
+		if !json.Valid([]byte(s)) {
+			return nil, fmt.Errorf("invalid raw JSON at %s", j.path)
+		}
+		if j.state.opts.SortKeys {
+			return sortKeys([]byte(s))
+		}
+		return []byte(s), nil
+	}
+	return json.Marshal(base64.StdEncoding.EncodeToString([]byte(s)))
+}
+
+// withoutSkipped returns the values of a container that are not skipped.
+func (s *encodeState) withoutSkipped(values []jsonValue) []jsonValue {
+	kept := values[:0:0]
+	for _, v := range values {
+		if overrideAt(s.overrides, v.path) != OverrideSkip {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
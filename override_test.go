@@ -0,0 +1,57 @@
+package json
+
+import (
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestCompileOverrides(t *testing.T) {
+	for _, rules := range []map[string]Override{
+		{"$.a": "bogus"},
+		{"$.a[": OverrideSkip},
+		{"$": OverrideSkip},
+	} {
+		if _, err := compileOverrides(rules); err == nil {
+			t.Fatalf("%v: expecting an error", rules)
+		}
+	}
+}
+
+func TestOverridesLua(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local doc = {
+		name = "svc",
+		secrets = {token = "t", key = "k"},
+		blob = "\0\1binary",
+		config = {retries = 3},
+		raw = '{"pre":"encoded"}',
+		list = {1, 2, 3},
+	}
+	local s = json.encode(doc, {overrides = {
+		["$.secrets.*"] = "skip",
+		["$.blob"] = "base64",
+		["$.config"] = "string",
+		["$.raw"] = "raw",
+		["$.list[1]"] = "skip",
+	}})
+	assert(s == '{"blob":"AAFiaW5hcnk=","config":"{\\"retries\\":3}","list":[1,3],"name":"svc","raw":{"pre":"encoded"},"secrets":{}}', s)
+
+	assert(json.encode({a = {1, 2}}, {overrides = {["$.a"] = "string"}}) == '{"a":"[1,2]"}')
+	assert(json.encode({"x", 1}, {overrides = {["[*]"] = "string"}}) == '["\\"x\\"","1"]')
+
+	local s, err = json.encode({blob = 1}, {overrides = {["$.blob"] = "base64"}})
+	assert(s == nil and err == "cannot encode number at $.blob as base64")
+	local s, err = json.encode({raw = "{"}, {overrides = {["$.raw"] = "raw"}})
+	assert(s == nil and err == "invalid raw JSON at $.raw")
+	assert(not pcall(json.encode, {}, {overrides = {["$.a"] = "drop"}}))
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,642 @@
+package json
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// patchOp is an RFC 6902 operation on Lua values.
+type patchOp struct {
+	op    string
+	path  Pointer
+	from  Pointer
+	value lua.LValue
+}
+
+// parsePatch converts a patch, either a JSON string or an array of operation
+// tables, to operations, checking their syntax.
+func parsePatch(L *lua.LState, patch lua.LValue) ([]patchOp, error) {
+	if s, ok := patch.(lua.LString); ok {
+		table, err := decodePatch(L, []byte(s))
+		if err != nil {
+			return nil, err
+		}
+		patch = table
+	}
+	t, ok := patch.(*lua.LTable)
+	if !ok {
+		return nil, errors.New("patch must be an array of operations")
+	}
+	ops := make([]patchOp, 0, t.Len())
+	for i := 1; i <= t.Len(); i++ {
+		op, err := parsePatchOp(t.RawGetInt(i))
+		if err != nil {
+			return nil, fmt.Errorf("patch operation %d: %v", i, err)
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+// decodePatch decodes a JSON patch to an array of operation tables, keeping
+// null values, which Decode would drop, as Null.
+func decodePatch(L *lua.LState, data []byte) (*lua.LTable, error) {
+	var raw []rawOp
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	t := L.CreateTable(len(raw), 0)
+	for _, op := range raw {
+		ot := L.CreateTable(0, 4)
+		ot.RawSetString("op", lua.LString(op.Op))
+		ot.RawSetString("path", lua.LString(op.Path))
+		if op.Op == "move" || op.Op == "copy" {
+			ot.RawSetString("from", lua.LString(op.From))
+		}
+		if len(op.Value) > 0 {
+			value, err := decodePatchValue(L, op.Value)
+			if err != nil {
+				return nil, err
+			}
+			if value == lua.LNil {
+				value = Null
+			}
+			ot.RawSetString("value", value)
+		}
+		t.Append(ot)
+	}
+	return t, nil
+}
+
+// decodePatchValue decodes the value of a patch operation, marking its empty
+// objects as json.object does, so that they encode back to {} rather than [].
+func decodePatchValue(L *lua.LState, data []byte) (lua.LValue, error) {
+	var objects []*lua.LTable
+	opts := &DecodeOptions{TableAllocator: func(L *lua.LState, array bool, narr, nhash int) *lua.LTable {
+		if array {
+			return nil
+		}
+		t := L.CreateTable(narr, nhash)
+		objects = append(objects, t)
+		return t
+	}}
+	value, err := DecodeWithOptions(L, data, opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range objects {
+		if isEmptyTable(t) {
+			t.Metatable = L.GetTypeMetatable("json.object_hint")
+		}
+	}
+	return value, nil
+}
+
+func parsePatchOp(v lua.LValue) (patchOp, error) {
+	t, ok := v.(*lua.LTable)
+	if !ok {
+		return patchOp{}, errors.New("operation must be a table")
+	}
+	op := patchOp{op: lua.LVAsString(t.RawGetString("op"))}
+	path, ok := t.RawGetString("path").(lua.LString)
+	if !ok {
+		return patchOp{}, errors.New("missing path")
+	}
+	var err error
+	if op.path, err = ParsePointer(string(path)); err != nil {
+		return patchOp{}, err
+	}
+	switch op.op {
+	case "add", "replace", "test":
+		if op.value = t.RawGetString("value"); op.value == lua.LNil {
+			return patchOp{}, errors.New("missing value")
+		}
+	case "move", "copy":
+		from, ok := t.RawGetString("from").(lua.LString)
+		if !ok {
+			return patchOp{}, errors.New("missing from")
+		}
+		if op.from, err = ParsePointer(string(from)); err != nil {
+			return patchOp{}, err
+		}
+		if op.op == "move" && op.from.isPrefixOf(op.path) {
+			return patchOp{}, errors.New("cannot move a value into itself")
+		}
+	case "remove":
+		if len(op.path) == 0 {
+			return patchOp{}, errors.New("cannot remove the document root")
+		}
+	default:
+		return patchOp{}, fmt.Errorf("unknown operation %q", op.op)
+	}
+	return op, nil
+}
+
+func (op patchOp) toTable(L *lua.LState) *lua.LTable {
+	t := L.CreateTable(0, 4)
+	t.RawSetString("op", lua.LString(op.op))
+	t.RawSetString("path", lua.LString(op.path.String()))
+	switch op.op {
+	case "move", "copy":
+		t.RawSetString("from", lua.LString(op.from.String()))
+	case "add", "replace", "test":
+		t.RawSetString("value", op.value)
+	}
+	return t
+}
+
+func patchTable(L *lua.LState, ops []patchOp) *lua.LTable {
+	t := L.CreateTable(len(ops), 0)
+	for _, op := range ops {
+		t.Append(op.toTable(L))
+	}
+	return t
+}
+
+// cloneValue returns a deep copy of value. Copies of the containers already
+// cloned are recorded in seen, so that shared and cyclic values stay so.
+func cloneValue(L *lua.LState, value lua.LValue, seen map[lua.LValue]lua.LValue) lua.LValue {
+	if copied, ok := seen[value]; ok {
+		return copied
+	}
+	switch v := value.(type) {
+	case *lua.LTable:
+		t := L.CreateTable(v.Len(), 0)
+		seen[value] = t
+		v.ForEach(func(key, item lua.LValue) {
+			t.RawSet(key, cloneValue(L, item, seen))
+		})
+		t.Metatable = v.Metatable
+		return t
+	case *lua.LUserData:
+		if a, ok := v.Value.(*Array); ok {
+			c := &Array{}
+			copied := &lua.LUserData{Value: c, Env: v.Env, Metatable: v.Metatable}
+			seen[value] = copied
+			for i := 0; i < a.Len(); i++ {
+				c.Append(cloneValue(L, a.Get(i), seen))
+			}
+			return copied
+		}
+		o, ok := v.Value.(*Object)
+		if !ok {
+			return value
+		}
+		c := &Object{}
+		copied := &lua.LUserData{Value: c, Env: v.Env, Metatable: v.Metatable}
+		seen[value] = copied
+		for i, k := range o.keys {
+			c.Set(k, cloneValue(L, o.values[i], seen))
+		}
+		return copied
+	}
+	return value
+}
+
+func clone(L *lua.LState, value lua.LValue) lua.LValue {
+	return cloneValue(L, value, make(map[lua.LValue]lua.LValue))
+}
+
+// patchDoc is a Lua document modified in place by patch operations.
+type patchDoc struct {
+	L    *lua.LState
+	root lua.LValue
+}
+
+// container is an array or object of a patchDoc.
+type container struct {
+	table  *lua.LTable
+	object *Object
+	elems  *Array
+	array  bool
+}
+
+var errNotContainer = errors.New("not a container")
+
+// containerFor returns the container v, judging whether a table is an array
+// by its contents or, when it is empty, by the token used to index it.
+func containerFor(v lua.LValue, token string) (container, error) {
+	switch v := v.(type) {
+	case *lua.LTable:
+		if v.Len() == 0 {
+			if key, _ := v.Next(lua.LNil); key == lua.LNil {
+				_, err := arrayIndex(token, 0, true)
+				return container{table: v, array: err == nil}, nil
+			}
+		}
+		_, array := isArray(v)
+		return container{table: v, array: array}, nil
+	case *lua.LUserData:
+		switch c := v.Value.(type) {
+		case *Object:
+			return container{object: c}, nil
+		case *Array:
+			return container{elems: c, array: true}, nil
+		}
+	}
+	return container{}, errNotContainer
+}
+
+func (c container) len() int {
+	if c.elems != nil {
+		return c.elems.Len()
+	}
+	return c.table.Len()
+}
+
+// elem returns the element of an array at index i, counting from 0.
+func (c container) elem(i int) lua.LValue {
+	if c.elems != nil {
+		return c.elems.Get(i)
+	}
+	return c.table.RawGetInt(i + 1)
+}
+
+// setElem sets the element of an array at index i, counting from 0, which
+// may be the length of the array.
+func (c container) setElem(i int, value lua.LValue) {
+	if c.elems != nil {
+		c.elems.Set(i, value)
+	} else {
+		c.table.RawSetInt(i+1, value)
+	}
+}
+
+func (c container) get(token string) (lua.LValue, error) {
+	switch {
+	case c.object != nil:
+		if v, ok := c.object.Get(token); ok {
+			return v, nil
+		}
+	case c.array:
+		i, err := arrayIndex(token, c.len()-1, false)
+		if err != nil {
+			return nil, err
+		}
+		return c.elem(i), nil
+	default:
+		if v := c.table.RawGetString(token); v != lua.LNil {
+			return v, nil
+		}
+	}
+	return nil, errors.New("member " + token + " not found")
+}
+
+// add inserts value before the element of an array referenced by token, or
+// sets the member of an object, returning the value it replaced, if any.
+func (c container) add(token string, value lua.LValue) (lua.LValue, error) {
+	switch {
+	case c.object != nil:
+		old, _ := c.object.Get(token)
+		c.object.Set(token, value)
+		return old, nil
+	case c.array:
+		i, err := arrayIndex(token, c.len(), true)
+		if err != nil {
+			return nil, err
+		}
+		for k := c.len(); k > i; k-- {
+			c.setElem(k, c.elem(k-1))
+		}
+		c.setElem(i, value)
+		return lua.LNil, nil
+	}
+	old := c.table.RawGetString(token)
+	c.table.RawSetString(token, value)
+	return old, nil
+}
+
+func (c container) remove(token string) (lua.LValue, error) {
+	old, err := c.get(token)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case c.object != nil:
+		c.object.Set(token, lua.LNil)
+	case c.array:
+		i, _ := arrayIndex(token, c.len()-1, false)
+		n := c.len()
+		for k := i + 1; k < n; k++ {
+			c.setElem(k-1, c.elem(k))
+		}
+		if c.elems != nil {
+			c.elems.pop()
+		} else {
+			c.table.RawSetInt(n, lua.LNil)
+		}
+	default:
+		c.table.RawSetString(token, lua.LNil)
+	}
+	return old, nil
+}
+
+func (d *patchDoc) get(p Pointer) (lua.LValue, error) {
+	v := d.root
+	for _, token := range p {
+		c, err := containerFor(v, token)
+		if err != nil {
+			return nil, err
+		}
+		if v, err = c.get(token); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// parent returns the container holding the value at p, which must not be
+// the root.
+func (d *patchDoc) parent(p Pointer) (container, error) {
+	v, err := d.get(p[:len(p)-1])
+	if err != nil {
+		return container{}, err
+	}
+	return containerFor(v, p[len(p)-1])
+}
+
+// add adds value at p, returning the value it replaced, if any.
+func (d *patchDoc) add(p Pointer, value lua.LValue) (lua.LValue, error) {
+	if len(p) == 0 {
+		old := d.root
+		d.root = value
+		return old, nil
+	}
+	c, err := d.parent(p)
+	if err != nil {
+		return nil, err
+	}
+	return c.add(p[len(p)-1], value)
+}
+
+// replace replaces the existing value at p.
+func (d *patchDoc) replace(p Pointer, value lua.LValue) error {
+	if len(p) == 0 {
+		d.root = value
+		return nil
+	}
+	c, err := d.parent(p)
+	if err != nil {
+		return err
+	}
+	token := p[len(p)-1]
+	if _, err := c.get(token); err != nil {
+		return err
+	}
+	if c.array {
+		i, _ := arrayIndex(token, c.len()-1, false)
+		c.setElem(i, value)
+		return nil
+	}
+	_, err = c.add(token, value)
+	return err
+}
+
+func (d *patchDoc) remove(p Pointer) (lua.LValue, error) {
+	if len(p) == 0 {
+		return nil, errors.New("cannot remove the document root")
+	}
+	c, err := d.parent(p)
+	if err != nil {
+		return nil, err
+	}
+	return c.remove(p[len(p)-1])
+}
+
+// apply applies a single operation.
+func (d *patchDoc) apply(op patchOp) error {
+	switch op.op {
+	case "add":
+		_, err := d.add(op.path, clone(d.L, op.value))
+		return err
+	case "remove":
+		_, err := d.remove(op.path)
+		return err
+	case "replace":
+		return d.replace(op.path, clone(d.L, op.value))
+	case "move":
+		value, err := d.remove(op.from)
+		if err != nil {
+			return err
+		}
+		_, err = d.add(op.path, value)
+		return err
+	case "copy":
+		value, err := d.get(op.from)
+		if err != nil {
+			return err
+		}
+		_, err = d.add(op.path, clone(d.L, value))
+		return err
+	case "test":
+		value, err := d.get(op.path)
+		if err != nil {
+			return err
+		}
+		if !deepEqual(value, op.value) {
+			return errors.New("test failed")
+		}
+		return nil
+	}
+	return errors.New("unknown operation")
+}
+
+// applyPatch applies ops to a copy of doc.
+func applyPatch(L *lua.LState, doc lua.LValue, ops []patchOp) (lua.LValue, error) {
+	d := &patchDoc{L: L, root: clone(L, doc)}
+	for i, op := range ops {
+		if err := d.apply(op); err != nil {
+			return nil, fmt.Errorf("patch operation %d (%s %s): %v", i+1, op.op, op.path, err)
+		}
+	}
+	return d.root, nil
+}
+
+// resolveEnd replaces a final "-" token of p, valid for adding to an array,
+// with the index it refers to in d.
+func (d *patchDoc) resolveEnd(p Pointer) Pointer {
+	if len(p) == 0 || p[len(p)-1] != "-" {
+		return p
+	}
+	c, err := d.parent(p)
+	if err != nil || !c.array {
+		return p
+	}
+	resolved := append(Pointer(nil), p[:len(p)-1]...)
+	return append(resolved, strconv.Itoa(c.len()))
+}
+
+// invertPatch returns the patch undoing ops, which transform doc.
+func invertPatch(L *lua.LState, doc lua.LValue, ops []patchOp) ([]patchOp, error) {
+	d := &patchDoc{L: L, root: clone(L, doc)}
+	var blocks [][]patchOp
+	for i, op := range ops {
+		inverse, err := d.invert(op)
+		if err == nil {
+			err = d.apply(op)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("patch operation %d (%s %s): %v", i+1, op.op, op.path, err)
+		}
+		blocks = append(blocks, inverse)
+	}
+	var inverse []patchOp
+	for i := len(blocks) - 1; i >= 0; i-- {
+		inverse = append(inverse, blocks[i]...)
+	}
+	return inverse, nil
+}
+
+// invert returns the operations undoing op, which is about to be applied.
+func (d *patchDoc) invert(op patchOp) ([]patchOp, error) {
+	switch op.op {
+	case "add", "copy":
+		return d.undoAdd(d.resolveEnd(op.path))
+	case "remove":
+		old, err := d.get(op.path)
+		if err != nil {
+			return nil, err
+		}
+		return []patchOp{{op: "add", path: op.path, value: clone(d.L, old)}}, nil
+	case "replace":
+		old, err := d.get(op.path)
+		if err != nil {
+			return nil, err
+		}
+		return []patchOp{{op: "replace", path: op.path, value: clone(d.L, old)}}, nil
+	case "move":
+		if _, err := d.get(op.from); err != nil {
+			return nil, err
+		}
+		path := d.resolveEnd(op.path)
+		if len(path) > 0 && op.path[len(op.path)-1] == "-" &&
+			path[:len(path)-1].String() == op.from[:len(op.from)-1].String() {
+			// The end of the array moves back when the value is removed.
+			i, _ := strconv.Atoi(path[len(path)-1])
+			path[len(path)-1] = strconv.Itoa(i - 1)
+		}
+		undo, err := d.undoAdd(path)
+		if err != nil {
+			return nil, err
+		}
+		// Moving the value back leaves the target as it was before the
+		// move, with the overwritten member, if any, to be restored.
+		back := patchOp{op: "move", from: path, path: op.from}
+		if undo[0].op == "replace" {
+			return []patchOp{back, {op: "add", path: path, value: undo[0].value}}, nil
+		}
+		return []patchOp{back}, nil
+	case "test":
+		return []patchOp{op}, nil
+	}
+	return nil, errors.New("unknown operation")
+}
+
+// undoAdd returns the operation undoing the addition of a value at p.
+func (d *patchDoc) undoAdd(p Pointer) ([]patchOp, error) {
+	if len(p) == 0 {
+		return []patchOp{{op: "replace", path: p, value: clone(d.L, d.root)}}, nil
+	}
+	c, err := d.parent(p)
+	if err != nil {
+		return nil, err
+	}
+	if !c.array {
+		if old, err := c.get(p[len(p)-1]); err == nil {
+			return []patchOp{{op: "replace", path: p, value: clone(d.L, old)}}, nil
+		}
+	}
+	return []patchOp{{op: "remove", path: p}}, nil
+}
+
+// apiPatchApply returns a copy of a Lua document with a patch applied.
+func apiPatchApply(L *lua.LState) int {
+	doc := L.CheckAny(1)
+	ops, err := parsePatch(L, L.CheckAny(2))
+	if err != nil {
+		L.ArgError(2, err.Error())
+	}
+	patched, err := applyPatch(L, doc, ops)
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	L.Push(patched)
+	return 1
+}
+
+func apiPatchInvert(L *lua.LState) int {
+	ops, err := parsePatch(L, L.CheckAny(1))
+	if err != nil {
+		L.ArgError(1, err.Error())
+	}
+	inverse, err := invertPatch(L, L.CheckAny(2), ops)
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	L.Push(patchTable(L, inverse))
+	return 1
+}
+
+// composePatch returns a patch equivalent to ops, which are assumed to apply,
+// with the operations made redundant by later ones removed: the changes to a
+// value that is then replaced or removed, and the replacement of a value just
+// added.
+func composePatch(ops []patchOp) []patchOp {
+	var composed []patchOp
+	for _, op := range ops {
+		composed = squash(composed, op)
+	}
+	return composed
+}
+
+// squash appends op to ops, first merging it with or dropping the
+// operations at the end of ops that it makes redundant.
+func squash(ops []patchOp, op patchOp) []patchOp {
+	for len(ops) > 0 {
+		last := ops[len(ops)-1]
+		if op.op != "replace" && op.op != "remove" {
+			break
+		}
+		if op.path.isPrefixOf(last.path) {
+			// The value changed by last is replaced or removed as a whole.
+			// Tests and moves of values from elsewhere have effects of their
+			// own and are kept.
+			if last.op == "test" || last.op == "move" && !op.path.isPrefixOf(last.from) {
+				break
+			}
+		} else if last.path.String() == op.path.String() {
+			switch {
+			case last.op == "replace":
+			case last.op == "add" && op.op == "replace":
+				op.op = "add"
+			default:
+				return append(ops, op)
+			}
+		} else {
+			break
+		}
+		ops = ops[:len(ops)-1]
+	}
+	return append(ops, op)
+}
+
+func apiPatchCompose(L *lua.LState) int {
+	var ops []patchOp
+	for i := 1; i <= L.GetTop(); i++ {
+		patch, err := parsePatch(L, L.Get(i))
+		if err != nil {
+			L.ArgError(i, err.Error())
+		}
+		ops = append(ops, patch...)
+	}
+	L.Push(patchTable(L, composePatch(ops)))
+	return 1
+}
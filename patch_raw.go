@@ -0,0 +1,351 @@
+package json
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// rawOp is an RFC 6902 operation whose value is raw JSON.
+type rawOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// rawNode is a JSON value that is only decoded when a patch operation needs
+// to look inside it. Untouched values are written back byte for byte.
+type rawNode struct {
+	raw json.RawMessage
+
+	// kind is '{' or '[' once the node has been expanded, and 0 before.
+	kind  byte
+	keys  []string
+	elems []*rawNode
+}
+
+func (n *rawNode) expand() error {
+	if n.kind != 0 {
+		return nil
+	}
+	data := bytes.TrimLeft(n.raw, " \t\r\n")
+	if len(data) == 0 || (data[0] != '{' && data[0] != '[') {
+		return errors.New("not a container")
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	for dec.More() {
+		if data[0] == '{' {
+			tok, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			n.keys = append(n.keys, tok.(string))
+		}
+		elem := &rawNode{}
+		if err := dec.Decode(&elem.raw); err != nil {
+			return err
+		}
+		n.elems = append(n.elems, elem)
+	}
+	n.kind = data[0]
+	n.raw = nil
+	return nil
+}
+
+func (n *rawNode) index(key string) int {
+	for i, k := range n.keys {
+		if k == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// child returns the child of a container referenced by token.
+func (n *rawNode) child(token string) (*rawNode, error) {
+	if err := n.expand(); err != nil {
+		return nil, err
+	}
+	if n.kind == '{' {
+		i := n.index(token)
+		if i < 0 {
+			return nil, errors.New("member " + token + " not found")
+		}
+		return n.elems[i], nil
+	}
+	i, err := arrayIndex(token, len(n.elems)-1, false)
+	if err != nil {
+		return nil, err
+	}
+	return n.elems[i], nil
+}
+
+func (n *rawNode) resolve(p Pointer) (*rawNode, error) {
+	for _, token := range p {
+		c, err := n.child(token)
+		if err != nil {
+			return nil, err
+		}
+		n = c
+	}
+	return n, nil
+}
+
+func (n *rawNode) add(token string, value *rawNode) error {
+	if err := n.expand(); err != nil {
+		return err
+	}
+	if n.kind == '{' {
+		if i := n.index(token); i >= 0 {
+			n.elems[i] = value
+		} else {
+			n.keys = append(n.keys, token)
+			n.elems = append(n.elems, value)
+		}
+		return nil
+	}
+	i, err := arrayIndex(token, len(n.elems), true)
+	if err != nil {
+		return err
+	}
+	n.elems = append(n.elems, nil)
+	copy(n.elems[i+1:], n.elems[i:])
+	n.elems[i] = value
+	return nil
+}
+
+// set replaces the member or element of a container referenced by token, or
+// adds it as by add when it does not exist yet.
+func (n *rawNode) set(token string, value *rawNode) error {
+	if err := n.expand(); err != nil {
+		return err
+	}
+	if n.kind == '[' && token != "-" {
+		i, err := arrayIndex(token, len(n.elems), false)
+		if err != nil {
+			return err
+		}
+		if i < len(n.elems) {
+			n.elems[i] = value
+			return nil
+		}
+	}
+	return n.add(token, value)
+}
+
+func (n *rawNode) remove(token string) (*rawNode, error) {
+	if err := n.expand(); err != nil {
+		return nil, err
+	}
+	i := -1
+	if n.kind == '{' {
+		if i = n.index(token); i < 0 {
+			return nil, errors.New("member " + token + " not found")
+		}
+		n.keys = append(n.keys[:i], n.keys[i+1:]...)
+	} else {
+		var err error
+		if i, err = arrayIndex(token, len(n.elems)-1, false); err != nil {
+			return nil, err
+		}
+	}
+	removed := n.elems[i]
+	n.elems = append(n.elems[:i], n.elems[i+1:]...)
+	return removed, nil
+}
+
+func (n *rawNode) writeTo(b *bytes.Buffer) {
+	switch n.kind {
+	case 0:
+		b.Write(n.raw)
+	case '{':
+		b.WriteByte('{')
+		for i, key := range n.keys {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			data, _ := json.Marshal(key)
+			b.Write(data)
+			b.WriteByte(':')
+			n.elems[i].writeTo(b)
+		}
+		b.WriteByte('}')
+	case '[':
+		b.WriteByte('[')
+		for i, elem := range n.elems {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			elem.writeTo(b)
+		}
+		b.WriteByte(']')
+	}
+}
+
+func (n *rawNode) bytes() []byte {
+	var b bytes.Buffer
+	n.writeTo(&b)
+	return b.Bytes()
+}
+
+// applyRawPatch applies an RFC 6902 patch to the JSON encoded doc, decoding
+// only the containers along the paths of the operations.
+func applyRawPatch(doc []byte, ops []rawOp) ([]byte, error) {
+	if !json.Valid(doc) {
+		return nil, errors.New("invalid JSON document")
+	}
+	root := &rawNode{raw: doc}
+	for i, op := range ops {
+		if err := root.apply(op); err != nil {
+			return nil, fmt.Errorf("patch operation %d (%s %s): %v", i+1, op.Op, op.Path, err)
+		}
+	}
+	return root.bytes(), nil
+}
+
+// apply applies a single operation to the document rooted at root.
+func (root *rawNode) apply(op rawOp) error {
+	p, err := ParsePointer(op.Path)
+	if err != nil {
+		return err
+	}
+	var value *rawNode
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return errors.New("missing value")
+		}
+		value = &rawNode{raw: op.Value}
+	case "move", "copy":
+		from, err := ParsePointer(op.From)
+		if err != nil {
+			return err
+		}
+		if op.Op == "move" {
+			if from.isPrefixOf(p) {
+				return errors.New("cannot move a value into itself")
+			}
+			if value, err = root.removeAt(from); err != nil {
+				return err
+			}
+		} else {
+			src, err := root.resolve(from)
+			if err != nil {
+				return err
+			}
+			value = &rawNode{raw: src.bytes()}
+		}
+	case "remove":
+	default:
+		return errors.New("unknown operation")
+	}
+
+	switch op.Op {
+	case "remove":
+		_, err = root.removeAt(p)
+		return err
+	case "test":
+		target, err := root.resolve(p)
+		if err != nil {
+			return err
+		}
+		if !rawEqual(target.bytes(), value.bytes()) {
+			return errors.New("test failed")
+		}
+		return nil
+	case "replace":
+		if _, err := root.resolve(p); err != nil {
+			return err
+		}
+	}
+	if len(p) == 0 {
+		*root = *value
+		return nil
+	}
+	parent, err := root.resolve(p[:len(p)-1])
+	if err != nil {
+		return err
+	}
+	if op.Op == "replace" {
+		// The target exists, so it is replaced rather than added.
+		return parent.set(p[len(p)-1], value)
+	}
+	return parent.add(p[len(p)-1], value)
+}
+
+func (root *rawNode) removeAt(p Pointer) (*rawNode, error) {
+	if len(p) == 0 {
+		return nil, errors.New("cannot remove the document root")
+	}
+	parent, err := root.resolve(p[:len(p)-1])
+	if err != nil {
+		return nil, err
+	}
+	return parent.remove(p[len(p)-1])
+}
+
+// rawEqual reports whether the JSON encoded values a and b are equal.
+func rawEqual(a, b []byte) bool {
+	var va, vb interface{}
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+// checkRawPatch converts the patch at argument n, either a JSON string or an
+// array of operation tables, to raw operations.
+func checkRawPatch(L *lua.LState, n int, opts *EncodeOptions) []rawOp {
+	var ops []rawOp
+	switch patch := L.Get(n).(type) {
+	case lua.LString:
+		if err := json.Unmarshal([]byte(patch), &ops); err != nil {
+			L.ArgError(n, "invalid patch: "+err.Error())
+		}
+	case *lua.LTable:
+		for i := 1; i <= patch.Len(); i++ {
+			t, ok := patch.RawGetInt(i).(*lua.LTable)
+			if !ok {
+				L.ArgError(n, "patch operations must be tables")
+			}
+			op := rawOp{
+				Op:   lua.LVAsString(t.RawGetString("op")),
+				Path: lua.LVAsString(t.RawGetString("path")),
+				From: lua.LVAsString(t.RawGetString("from")),
+			}
+			if value := t.RawGetString("value"); value != lua.LNil {
+				data, err := EncodeWithOptions(value, opts)
+				if err != nil {
+					L.ArgError(n, "invalid patch value: "+err.Error())
+				}
+				op.Value = data
+			}
+			ops = append(ops, op)
+		}
+	default:
+		L.TypeError(n, lua.LTTable)
+	}
+	return ops
+}
+
+func (m *module) apiPatchApplyRaw(L *lua.LState) int {
+	str := L.CheckString(1)
+	ops := checkRawPatch(L, 2, &m.encode)
+
+	data, err := applyRawPatch([]byte(str), ops)
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	L.Push(lua.LString(data))
+	return 1
+}
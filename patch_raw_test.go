@@ -0,0 +1,63 @@
+package json
+
+import (
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestApplyRawPatch(t *testing.T) {
+	tests := []struct {
+		doc, patch, expected string
+	}{
+		{`{"b": [1, 2], "a": {"x" : 1}}`, `[{"op":"add","path":"/c","value":3}]`, `{"b":[1, 2],"a":{"x" : 1},"c":3}`},
+		{`{"a":[1,2,3]}`, `[{"op":"add","path":"/a/1","value":9}]`, `{"a":[1,9,2,3]}`},
+		{`{"a":[1,2,3]}`, `[{"op":"add","path":"/a/-","value":9}]`, `{"a":[1,2,3,9]}`},
+		{`{"a":[1,2,3]}`, `[{"op":"remove","path":"/a/0"}]`, `{"a":[2,3]}`},
+		{`{"a":{"b":1}}`, `[{"op":"replace","path":"/a/b","value":"x"}]`, `{"a":{"b":"x"}}`},
+		{`[1,2,3]`, `[{"op":"replace","path":"/1","value":9}]`, `[1,9,3]`},
+		{`{"a":[1,2]}`, `[{"op":"replace","path":"/a/1","value":{"b":[]}},{"op":"replace","path":"/a/0","value":0}]`, `{"a":[0,{"b":[]}]}`},
+		{`{"a":{"b":1},"c":[]}`, `[{"op":"move","from":"/a/b","path":"/c/0"}]`, `{"a":{},"c":[1]}`},
+		{`{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"}]`, `{"a":{"b":1},"c":{"b":1}}`},
+		{`{"a":1.0}`, `[{"op":"test","path":"/a","value":1},{"op":"replace","path":"","value":[]}]`, `[]`},
+		{`{"a/b":{"~":1}}`, `[{"op":"remove","path":"/a~1b/~0"}]`, `{"a/b":{}}`},
+	}
+	for _, test := range tests {
+		s := lua.NewState()
+		s.Push(lua.LString(test.patch))
+		ops := checkRawPatch(s, 1, &EncodeOptions{})
+		s.Close()
+
+		data, err := applyRawPatch([]byte(test.doc), ops)
+		if err != nil {
+			t.Fatalf("%s: %v", test.patch, err)
+		}
+		if string(data) != test.expected {
+			t.Fatalf("%s: expecting %s, got %s", test.patch, test.expected, data)
+		}
+	}
+}
+
+func TestPatchApplyRawLua(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local out = json.patch_apply_raw('{"a":1}', {{op = "add", path = "/b", value = {1, 2}}})
+	assert(out == '{"a":1,"b":[1,2]}')
+
+	local out, err = json.patch_apply_raw('{"a":1}', {{op = "test", path = "/a", value = 2}})
+	assert(out == nil and string.find(err, "test failed"))
+
+	local out, err = json.patch_apply_raw('{"a":1}', '[{"op":"remove","path":"/x"}]')
+	assert(out == nil and string.find(err, "not found"))
+
+	local out, err = json.patch_apply_raw('{"a":{}}', {{op = "move", from = "/a", path = "/a/b"}})
+	assert(out == nil and string.find(err, "into itself"))
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
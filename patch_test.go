@@ -0,0 +1,197 @@
+package json
+
+import (
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestInvertPatch(t *testing.T) {
+	tests := []struct {
+		doc, patch string
+	}{
+		{`{"a":1}`, `[{"op":"add","path":"/b","value":2}]`},
+		{`{"a":1}`, `[{"op":"add","path":"/a","value":2}]`},
+		{`{"a":[1,2,3]}`, `[{"op":"add","path":"/a/1","value":9},{"op":"add","path":"/a/-","value":10}]`},
+		{`{"a":[1,2,3]}`, `[{"op":"remove","path":"/a/0"},{"op":"remove","path":"/a/1"}]`},
+		{`{"a":{"b":1}}`, `[{"op":"replace","path":"/a/b","value":"x"},{"op":"replace","path":"/a","value":null}]`},
+		{`{"a":{"b":1},"c":[]}`, `[{"op":"move","from":"/a/b","path":"/c/0"}]`},
+		{`{"a":{"b":1},"c":2}`, `[{"op":"move","from":"/a","path":"/c"}]`},
+		{`{"a":[1,2,3]}`, `[{"op":"move","from":"/a/0","path":"/a/-"}]`},
+		{`{"a":{"b":1},"c":2}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"copy","from":"/a","path":"/d"}]`},
+		{`{"a":1}`, `[{"op":"test","path":"/a","value":1},{"op":"replace","path":"","value":[]}]`},
+		{`{"a/b":{"~":1}}`, `[{"op":"remove","path":"/a~1b/~0"},{"op":"add","path":"/a~1b/x","value":[1]}]`},
+	}
+	for _, test := range tests {
+		s := lua.NewState()
+		doc, err := Decode(s, []byte(test.doc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ops, err := parsePatch(s, lua.LString(test.patch))
+		if err != nil {
+			t.Fatalf("%s: %v", test.patch, err)
+		}
+		patched, err := applyPatch(s, doc, ops)
+		if err != nil {
+			t.Fatalf("%s: %v", test.patch, err)
+		}
+		inverse, err := invertPatch(s, doc, ops)
+		if err != nil {
+			t.Fatalf("%s: %v", test.patch, err)
+		}
+		restored, err := applyPatch(s, patched, inverse)
+		if err != nil {
+			t.Fatalf("%s: inverse: %v", test.patch, err)
+		}
+		if !deepEqual(doc, restored) {
+			data, _ := Encode(restored)
+			t.Fatalf("%s: expecting %s, got %s", test.patch, test.doc, data)
+		}
+		s.Close()
+	}
+}
+
+func TestPatchApplyLua(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local doc = {name = "a", tags = {"x", "y"}, meta = {v = 1}}
+	local patched = assert(json.patch_apply(doc, {
+		{op = "test", path = "/name", value = "a"},
+		{op = "add", path = "/tags/0", value = "w"},
+		{op = "remove", path = "/tags/2"},
+		{op = "replace", path = "/name", value = "b"},
+		{op = "copy", from = "/meta", path = "/copy"},
+		{op = "move", from = "/meta/v", path = "/version"},
+	}))
+	assert(json.encode(patched) == '{"copy":{"v":1},"meta":[],"name":"b","tags":["w","x"],"version":1}', json.encode(patched))
+	assert(doc.name == "a" and #doc.tags == 2 and doc.meta.v == 1)
+
+	assert(json.patch_apply(doc, '[{"op":"add","path":"/n","value":null}]').n == json.null)
+	local back = json.patch_apply(patched, json.patch_diff(patched, doc))
+	assert(json.encode(back) == json.encode(doc))
+
+	local v, err = json.patch_apply(doc, {{op = "test", path = "/name", value = "z"}})
+	assert(v == nil and err == "patch operation 1 (test /name): test failed", err)
+	v, err = json.patch_apply(doc, {{op = "remove", path = "/missing"}})
+	assert(v == nil and string.find(err, "not found"))
+	assert(not pcall(json.patch_apply, doc, {{op = "frobnicate", path = ""}}))
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPatchInvertLua(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local doc = {name = "a", tags = {"x", "y"}}
+	local inverse = json.patch_invert({
+		{op = "replace", path = "/name", value = "b"},
+		{op = "add", path = "/tags/-", value = "z"},
+	}, doc)
+	assert(#inverse == 2)
+	assert(inverse[1].op == "remove" and inverse[1].path == "/tags/2")
+	assert(inverse[2].op == "replace" and inverse[2].path == "/name" and inverse[2].value == "a")
+	assert(doc.name == "a" and #doc.tags == 2)
+
+	local inverse = json.patch_invert('[{"op":"test","path":"/o","value":{}},{"op":"replace","path":"/o","value":{"x":{}}}]', {o = json.object()})
+	assert(json.encode(inverse) == '[{"op":"replace","path":"/o","value":{}},{"op":"test","path":"/o","value":{}}]')
+
+	local inverse, err = json.patch_invert('[{"op":"remove","path":"/x"}]', {})
+	assert(inverse == nil and string.find(err, "not found"))
+
+	assert(not pcall(json.patch_invert, {{op = "frobnicate", path = ""}}, {}))
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestComposePatch(t *testing.T) {
+	tests := []struct {
+		doc, patch string
+		ops        int
+	}{
+		{`{"a":1}`, `[{"op":"replace","path":"/a","value":2},{"op":"replace","path":"/a","value":3}]`, 1},
+		{`{"a":1}`, `[{"op":"add","path":"/b","value":2},{"op":"replace","path":"/b","value":3}]`, 1},
+		{`{"a":1}`, `[{"op":"replace","path":"/a","value":2},{"op":"remove","path":"/a"}]`, 1},
+		{`{"a":{"b":1}}`, `[{"op":"add","path":"/a/c","value":2},{"op":"remove","path":"/a/b"},{"op":"replace","path":"/a","value":0}]`, 1},
+		{`{"a":{"b":1},"c":2}`, `[{"op":"move","from":"/c","path":"/a/c"},{"op":"replace","path":"/a","value":0}]`, 2},
+		{`{"a":{"b":1}}`, `[{"op":"test","path":"/a/b","value":1},{"op":"remove","path":"/a"}]`, 2},
+		{`{"a":[1,2]}`, `[{"op":"add","path":"/a/0","value":0},{"op":"remove","path":"/a/0"}]`, 2},
+		{`{"a":[1,2]}`, `[{"op":"add","path":"/a/-","value":3},{"op":"add","path":"/b","value":{}},{"op":"add","path":"/b/x","value":1},{"op":"replace","path":"","value":[]}]`, 1},
+	}
+	for _, test := range tests {
+		s := lua.NewState()
+		doc, err := Decode(s, []byte(test.doc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ops, err := parsePatch(s, lua.LString(test.patch))
+		if err != nil {
+			t.Fatalf("%s: %v", test.patch, err)
+		}
+		composed := composePatch(ops)
+		if len(composed) != test.ops {
+			t.Fatalf("%s: expecting %d operations, got %d", test.patch, test.ops, len(composed))
+		}
+		expected, err := applyPatch(s, doc, ops)
+		if err != nil {
+			t.Fatalf("%s: %v", test.patch, err)
+		}
+		actual, err := applyPatch(s, doc, composed)
+		if err != nil {
+			t.Fatalf("%s: composed: %v", test.patch, err)
+		}
+		if !deepEqual(expected, actual) {
+			data, _ := Encode(actual)
+			t.Fatalf("%s: got %s", test.patch, data)
+		}
+		s.Close()
+	}
+}
+
+func TestPatchComposeLua(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local patch = json.patch_compose(
+		{{op = "add", path = "/name", value = "a"}},
+		'[{"op":"replace","path":"/name","value":"b"}]',
+		{{op = "replace", path = "/name", value = "c"}, {op = "remove", path = "/tmp"}}
+	)
+	assert(#patch == 2)
+	assert(patch[1].op == "add" and patch[1].path == "/name" and patch[1].value == "c")
+	assert(patch[2].op == "remove" and patch[2].path == "/tmp")
+	assert(#json.patch_compose() == 0)
+
+	local patch = json.patch_compose(
+		'[{"op":"add","path":"/o","value":{}}]',
+		'[{"op":"add","path":"/p","value":{"q":{}}},{"op":"replace","path":"/p","value":{}}]'
+	)
+	assert(json.encode(patch) == '[{"op":"add","path":"/o","value":{}},{"op":"add","path":"/p","value":{}}]')
+	local doc = json.patch_apply({}, patch)
+	doc = json.patch_apply(doc, {{op = "add", path = "/o/b", value = 1}})
+	assert(doc.o.b == 1 and json.encode(doc.p) == "{}")
+
+	local ok, err = pcall(json.patch_compose, {}, {{op = "add", path = "x", value = 1}})
+	assert(not ok and string.find(err, "#2") and string.find(err, "invalid JSON pointer"))
+	local ok, err = pcall(json.patch_compose, {{op = "copy", path = "/x"}})
+	assert(not ok and string.find(err, "missing from"))
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,193 @@
+package json
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// pathElem is a single step of a path: an object key, or a zero-based array
+// index.
+type pathElem struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// path locates a value within a document. Paths are formatted in the
+// JSONPath style used by options and reports, for example $.items[0].name.
+type path []pathElem
+
+func (p path) child(key string) path {
+	return append(p[:len(p):len(p)], pathElem{key: key})
+}
+
+func (p path) elem(index int) path {
+	return append(p[:len(p):len(p)], pathElem{index: index, isIndex: true})
+}
+
+func (p path) String() string {
+	var b strings.Builder
+	b.WriteByte('$')
+	for _, e := range p {
+		switch {
+		case e.isIndex:
+			b.WriteByte('[')
+			b.WriteString(strconv.Itoa(e.index))
+			b.WriteByte(']')
+		case isIdentifier(e.key):
+			b.WriteByte('.')
+			b.WriteString(e.key)
+		default:
+			b.WriteByte('[')
+			b.WriteString(strconv.Quote(e.key))
+			b.WriteByte(']')
+		}
+	}
+	return b.String()
+}
+
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// pathPattern is a parsed path that may contain wildcards. Patterns use the
+// same syntax as formatted paths; the leading $ is optional, and * or [*]
+// matches any single member or element.
+type pathPattern []patternElem
+
+type patternElem struct {
+	pathElem
+	wildcard bool
+}
+
+func parsePathPattern(s string) (pathPattern, error) {
+	invalid := func() (pathPattern, error) {
+		return nil, errors.New("invalid path " + strconv.Quote(s))
+	}
+	rest := strings.TrimPrefix(s, "$")
+	var pp pathPattern
+	for first := len(rest) == len(s); rest != ""; first = false {
+		switch {
+		case rest[0] == '[' && len(rest) > 1 && (rest[1] == '"' || rest[1] == '\''):
+			quote := rest[1]
+			end := 2
+			for ; end < len(rest) && rest[end] != quote; end++ {
+				if rest[end] == '\\' {
+					end++
+				}
+			}
+			if end+1 >= len(rest) || rest[end+1] != ']' {
+				return invalid()
+			}
+			quoted := rest[2:end]
+			if quote == '\'' {
+				quoted = strings.ReplaceAll(strings.ReplaceAll(quoted, `\'`, `'`), `"`, `\"`)
+			}
+			key, err := strconv.Unquote(`"` + quoted + `"`)
+			if err != nil {
+				return invalid()
+			}
+			pp = append(pp, patternElem{pathElem: pathElem{key: key}})
+			rest = rest[end+2:]
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return invalid()
+			}
+			if inner := rest[1:end]; inner == "*" {
+				pp = append(pp, patternElem{wildcard: true})
+			} else {
+				i, err := strconv.Atoi(inner)
+				if err != nil || i < 0 {
+					return invalid()
+				}
+				pp = append(pp, patternElem{pathElem: pathElem{index: i, isIndex: true}})
+			}
+			rest = rest[end+1:]
+		case rest[0] == '.' || first:
+			if rest[0] == '.' {
+				rest = rest[1:]
+			}
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			key := rest[:end]
+			if key == "" {
+				return invalid()
+			}
+			if key == "*" {
+				pp = append(pp, patternElem{wildcard: true})
+			} else {
+				pp = append(pp, patternElem{pathElem: pathElem{key: key}})
+			}
+			rest = rest[end:]
+		default:
+			return invalid()
+		}
+	}
+	return pp, nil
+}
+
+func (e patternElem) matches(p pathElem) bool {
+	if e.wildcard {
+		return true
+	}
+	return e.isIndex == p.isIndex && e.index == p.index && e.key == p.key
+}
+
+// match reports whether p is matched by the pattern.
+func (pp pathPattern) match(p path) bool {
+	if len(p) != len(pp) {
+		return false
+	}
+	for i := range p {
+		if !pp[i].matches(p[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// within reports whether p is matched by the pattern or lies below a path
+// matched by it.
+func (pp pathPattern) within(p path) bool {
+	return len(p) >= len(pp) && pp.match(p[:len(pp)])
+}
+
+// leadsTo reports whether p is a prefix of a path matched by the pattern.
+func (pp pathPattern) leadsTo(p path) bool {
+	if len(p) > len(pp) {
+		return false
+	}
+	for i := range p {
+		if !pp[i].matches(p[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func parsePathPatterns(list []string) ([]pathPattern, error) {
+	patterns := make([]pathPattern, 0, len(list))
+	for _, s := range list {
+		pp, err := parsePathPattern(s)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pp)
+	}
+	return patterns, nil
+}
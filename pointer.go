@@ -0,0 +1,220 @@
+package json
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/yuin/gopher-lua"
+)
+
+var errInvalidPointer = errors.New("invalid JSON pointer")
+
+// Pointer is a parsed RFC 6901 JSON Pointer: the unescaped reference tokens.
+// The empty pointer refers to the whole document. The same pointers are used
+// by the Lua functions of the package, such as patch_apply_raw.
+type Pointer []string
+
+// ParsePointer parses the JSON Pointer s, such as "/items/0/name".
+func ParsePointer(s string) (Pointer, error) {
+	if s == "" {
+		return Pointer{}, nil
+	}
+	if s[0] != '/' {
+		return nil, errInvalidPointer
+	}
+	tokens := strings.Split(s[1:], "/")
+	for i, token := range tokens {
+		if strings.Contains(token, "~") {
+			for j := 0; j < len(token); j++ {
+				if token[j] == '~' && (j+1 == len(token) || (token[j+1] != '0' && token[j+1] != '1')) {
+					return nil, errInvalidPointer
+				}
+			}
+			token = strings.ReplaceAll(token, "~1", "/")
+			token = strings.ReplaceAll(token, "~0", "~")
+			tokens[i] = token
+		}
+	}
+	return tokens, nil
+}
+
+// String returns the JSON Pointer syntax of p.
+func (p Pointer) String() string {
+	var b strings.Builder
+	for _, token := range p {
+		b.WriteByte('/')
+		token = strings.ReplaceAll(token, "~", "~0")
+		token = strings.ReplaceAll(token, "/", "~1")
+		b.WriteString(token)
+	}
+	return b.String()
+}
+
+// isPrefixOf reports whether p is a proper prefix of q.
+func (p Pointer) isPrefixOf(q Pointer) bool {
+	if len(p) >= len(q) {
+		return false
+	}
+	for i := range p {
+		if p[i] != q[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// arrayIndex parses a reference token as a zero-based array index smaller
+// than or equal to max. The token "-", which refers to the position after
+// the last element, is accepted when end is true.
+func arrayIndex(token string, max int, end bool) (int, error) {
+	if token == "-" && end {
+		return max, nil
+	}
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, errors.New("invalid array index " + strconv.Quote(token))
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 {
+		return 0, errors.New("invalid array index " + strconv.Quote(token))
+	}
+	if i > max {
+		return 0, errors.New("array index " + token + " out of range")
+	}
+	return i, nil
+}
+
+// Resolve returns the value at p in the Lua document v. Arrays are
+// indexed from 0, as in JSON.
+func (p Pointer) Resolve(v lua.LValue) (lua.LValue, error) {
+	d := &patchDoc{root: v}
+	return d.get(p)
+}
+
+// Set sets the value at p in the Lua document v, modifying it in place, and
+// returns the document, which is value itself for the empty pointer. The
+// existing value at p is replaced; otherwise value is added as a new member,
+// or appended to an array for the index "-" or the length of the array.
+func (p Pointer) Set(v, value lua.LValue) (lua.LValue, error) {
+	d := &patchDoc{root: v}
+	var err error
+	if _, err = d.get(p); err == nil {
+		err = d.replace(p, value)
+	} else if d.appends(p) {
+		_, err = d.add(p, value)
+	}
+	return d.root, err
+}
+
+// appends reports whether setting the value at p adds it to its parent.
+func (d *patchDoc) appends(p Pointer) bool {
+	if len(p) == 0 {
+		return false
+	}
+	c, err := d.parent(p)
+	if err != nil {
+		return false
+	}
+	if !c.array {
+		return true
+	}
+	i, err := arrayIndex(p[len(p)-1], c.len(), true)
+	return err == nil && i == c.len()
+}
+
+// ResolveRaw returns the JSON encoding of the value at p in the JSON
+// document data, decoding only the containers along p.
+func (p Pointer) ResolveRaw(data []byte) ([]byte, error) {
+	if !json.Valid(data) {
+		return nil, errors.New("invalid JSON document")
+	}
+	n, err := (&rawNode{raw: data}).resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	return n.bytes(), nil
+}
+
+// SetRaw returns the JSON document data with the value at p set to the JSON
+// encoded value, as by Set. Only the containers along p are decoded; the
+// rest of the document is copied unchanged.
+func (p Pointer) SetRaw(data, value []byte) ([]byte, error) {
+	if !json.Valid(data) {
+		return nil, errors.New("invalid JSON document")
+	}
+	if !json.Valid(value) {
+		return nil, errors.New("invalid JSON value")
+	}
+	if len(p) == 0 {
+		return value, nil
+	}
+	root := &rawNode{raw: data}
+	parent, err := root.resolve(p[:len(p)-1])
+	if err != nil {
+		return nil, err
+	}
+	if err := parent.set(p[len(p)-1], &rawNode{raw: value}); err != nil {
+		return nil, err
+	}
+	return root.bytes(), nil
+}
+
+func checkPointer(L *lua.LState, n int) Pointer {
+	p, err := ParsePointer(L.CheckString(n))
+	if err != nil {
+		L.ArgError(n, err.Error())
+	}
+	return p
+}
+
+// apiPointerGet returns the value at a pointer in a Lua document or, for a
+// JSON string, the JSON encoding of the value.
+func apiPointerGet(L *lua.LState) int {
+	doc := L.CheckAny(1)
+	p := checkPointer(L, 2)
+
+	var value lua.LValue
+	var err error
+	if s, ok := doc.(lua.LString); ok {
+		var data []byte
+		if data, err = p.ResolveRaw([]byte(s)); err == nil {
+			value = lua.LString(data)
+		}
+	} else {
+		value, err = p.Resolve(doc)
+	}
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	L.Push(value)
+	return 1
+}
+
+// apiPointerSet sets the value at a pointer in a Lua document, or in a JSON
+// string given the JSON encoding of the value, and returns the document.
+func apiPointerSet(L *lua.LState) int {
+	doc := L.CheckAny(1)
+	p := checkPointer(L, 2)
+	value := L.CheckAny(3)
+
+	var result lua.LValue
+	var err error
+	if s, ok := doc.(lua.LString); ok {
+		var data []byte
+		if data, err = p.SetRaw([]byte(s), []byte(L.CheckString(3))); err == nil {
+			result = lua.LString(data)
+		}
+	} else {
+		result, err = p.Set(doc, value)
+	}
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	L.Push(result)
+	return 1
+}
@@ -0,0 +1,143 @@
+package json
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestParsePointer(t *testing.T) {
+	tests := []struct {
+		s      string
+		tokens []string
+	}{
+		{"", nil},
+		{"/", []string{""}},
+		{"/a/0", []string{"a", "0"}},
+		{"/a~1b/~0c", []string{"a/b", "~c"}},
+	}
+	for _, test := range tests {
+		p, err := ParsePointer(test.s)
+		if err != nil {
+			t.Fatalf("%q: %v", test.s, err)
+		}
+		if len(p) != len(test.tokens) {
+			t.Fatalf("%q: got %q", test.s, p)
+		}
+		for i := range p {
+			if p[i] != test.tokens[i] {
+				t.Fatalf("%q: got %q", test.s, p)
+			}
+		}
+		if p.String() != test.s {
+			t.Fatalf("%q: formatted as %q", test.s, p)
+		}
+	}
+	for _, s := range []string{"a", "/~2", "/a~"} {
+		if _, err := ParsePointer(s); err == nil {
+			t.Fatalf("%q: expecting an error", s)
+		}
+	}
+}
+
+func TestPointerRaw(t *testing.T) {
+	const doc = `{"a": [1, {"b": "x"}], "c": true}`
+	tests := []struct {
+		pointer, value, expected string
+	}{
+		{"/a/1/b", `"y"`, `{"a":[1,{"b":"y"}],"c":true}`},
+		{"/a/0", `0`, `{"a":[0,{"b": "x"}],"c":true}`},
+		{"/a/-", `2`, `{"a":[1,{"b": "x"},2],"c":true}`},
+		{"/a/2", `2`, `{"a":[1,{"b": "x"},2],"c":true}`},
+		{"/d", `null`, `{"a":[1, {"b": "x"}],"c":true,"d":null}`},
+		{"", `[]`, `[]`},
+	}
+	for _, test := range tests {
+		p, _ := ParsePointer(test.pointer)
+		data, err := p.SetRaw([]byte(doc), []byte(test.value))
+		if err != nil {
+			t.Fatalf("%s: %v", test.pointer, err)
+		}
+		if string(data) != test.expected {
+			t.Fatalf("%s: expecting %s, got %s", test.pointer, test.expected, data)
+		}
+		if test.pointer == "/a/-" {
+			continue
+		}
+		value, err := p.ResolveRaw(data)
+		if err != nil || string(value) != test.value {
+			t.Fatalf("%s: resolved to %s, %v", test.pointer, value, err)
+		}
+	}
+	for _, s := range []string{"/a/3", "/x/y", "/c/0"} {
+		p, _ := ParsePointer(s)
+		if _, err := p.SetRaw([]byte(doc), []byte(`1`)); err == nil {
+			t.Fatalf("%s: expecting an error", s)
+		}
+	}
+}
+
+func TestPointerLua(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local doc = {items = {{name = "a"}, {name = "b"}}}
+	assert(json.pointer_get(doc, "/items/1/name") == "b")
+	assert(json.pointer_get(doc, "") == doc)
+	local v, err = json.pointer_get(doc, "/items/2")
+	assert(v == nil and string.find(err, "out of range"))
+
+	assert(json.pointer_set(doc, "/items/0/name", "z") == doc and doc.items[1].name == "z")
+	json.pointer_set(doc, "/items/-", {name = "c"})
+	assert(#doc.items == 3 and doc.items[3].name == "c")
+	json.pointer_set(doc, "/count", 3)
+	assert(doc.count == 3)
+	local v, err = json.pointer_set(doc, "/missing/x", 1)
+	assert(v == nil and string.find(err, "not found"))
+	assert(json.pointer_set(doc, "", 1) == 1)
+
+	assert(json.pointer_get('{"a":{"b":[1,2]}}', "/a/b") == "[1,2]")
+	assert(json.pointer_set('{"a":{"b":[1,2]}}', "/a/b/0", '"x"') == '{"a":{"b":["x",2]}}')
+	assert(not pcall(json.pointer_get, doc, "items"))
+
+	local big = json.decode('{"a": [{"k": "x~y/z"}, 2, 3]}', {objects = "userdata", array_threshold = 2})
+	assert(json.pointer_get(big, "/a/0/k") == "x~y/z")
+	assert(json.pointer_get(big, "/a/2") == 3)
+	json.pointer_set(big, "/a/1", 20)
+	json.pointer_set(big, "/a/-", 4)
+	assert(big.a:len() == 4 and big.a[2] == 20 and big.a[4] == 4)
+	json.pointer_set(big, "/a/0/x~1~0", true)
+	assert(json.pointer_get(big, "/a/0/x~1~0") == true and big.a[1]["x/~"] == true)
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPointerArrayUserData(t *testing.T) {
+	a := &Array{}
+	for i := 0; i < arrayChunkSize+2; i++ {
+		a.Append(lua.LNumber(i))
+	}
+	d := &patchDoc{root: &lua.LUserData{Value: a}}
+	if _, err := d.remove(Pointer{"0"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.add(Pointer{"1"}, lua.LString("x")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.remove(Pointer{strconv.Itoa(arrayChunkSize + 1)}); err != nil {
+		t.Fatal(err)
+	}
+	if a.Len() != arrayChunkSize+1 || a.Get(0) != lua.LNumber(1) || a.Get(1) != lua.LString("x") ||
+		a.Get(arrayChunkSize) != lua.LNumber(arrayChunkSize) {
+		t.Errorf("got length %d, elements %v %v %v", a.Len(), a.Get(0), a.Get(1), a.Get(arrayChunkSize))
+	}
+	if len(a.chunks) != 2 {
+		t.Errorf("got %d chunks", len(a.chunks))
+	}
+}
@@ -0,0 +1,90 @@
+package json
+
+import (
+	"sync"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// TableAllocator creates the table of a decoded array or object. narr and
+// nhash are the capacity hints known to the decoder; they are often zero,
+// since most of the decoders create a table before reading its contents.
+// Returning nil leaves the table to the decoder.
+//
+// Allocators let hosts size tables from their own knowledge of the documents,
+// or take them from arenas or pools filled in advance.
+type TableAllocator func(L *lua.LState, array bool, narr, nhash int) *lua.LTable
+
+// TablePool recycles the tables created by decoding. It can be shared by
+// multiple Lua states and is safe for concurrent use.
+//
+// Only the tables that held array elements alone are recycled: a table
+// keeps track of every key it has held, so that objects would grow with
+// each reuse.
+//
+// A value must only be returned to the pool once no script holds a reference
+// to it, or to any table nested in it.
+type TablePool struct {
+	mu     sync.Mutex
+	tables []*lua.LTable
+	size   int
+}
+
+// NewTablePool returns a pool that keeps at most size idle tables.
+func NewTablePool(size int) *TablePool {
+	return &TablePool{size: size}
+}
+
+// Get returns an empty table from the pool, or a new table with the given
+// capacity hints if the pool is empty.
+func (p *TablePool) Get(L *lua.LState, narr, nhash int) *lua.LTable {
+	p.mu.Lock()
+	if n := len(p.tables); n > 0 {
+		t := p.tables[n-1]
+		p.tables[n-1] = nil
+		p.tables = p.tables[:n-1]
+		p.mu.Unlock()
+		return t
+	}
+	p.mu.Unlock()
+	return L.CreateTable(narr, nhash)
+}
+
+// Put clears value, and every table nested in it, and returns the arrays
+// among them to the pool. Values that are not tables are ignored.
+func (p *TablePool) Put(value lua.LValue) {
+	p.put(value, make(map[*lua.LTable]bool))
+}
+
+func (p *TablePool) put(value lua.LValue, seen map[*lua.LTable]bool) {
+	t, ok := value.(*lua.LTable)
+	if !ok || seen[t] {
+		return
+	}
+	seen[t] = true
+
+	var keys, values []lua.LValue
+	array := true
+	t.ForEach(func(key, value lua.LValue) {
+		// The elements of arrays come first, in order.
+		array = array && key == lua.LNumber(len(keys)+1)
+		keys = append(keys, key)
+		values = append(values, value)
+	})
+	for _, key := range keys {
+		t.RawSet(key, lua.LNil)
+	}
+	t.Metatable = lua.LNil
+
+	if array {
+		p.mu.Lock()
+		if len(p.tables) < p.size {
+			p.tables = append(p.tables, t)
+		}
+		p.mu.Unlock()
+	}
+
+	for _, value := range values {
+		p.put(value, seen)
+	}
+}
@@ -0,0 +1,114 @@
+package json
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestTablePool(t *testing.T) {
+	s := lua.NewState()
+	defer s.Close()
+
+	pool := NewTablePool(8)
+	opts := &DecodeOptions{TablePool: pool}
+
+	first, err := DecodeWithOptions(s, []byte(`{"a":{"b":[1,2,3]}}`), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.Put(first)
+	if n := len(pool.tables); n != 1 {
+		t.Fatalf("expecting 1 pooled table, got %d", n)
+	}
+	if b := first.(*lua.LTable).RawGetString("a"); b != lua.LNil {
+		t.Fatalf("expecting a cleared object, got %v", b)
+	}
+
+	second, err := DecodeWithOptions(s, []byte(`[{"x":1}]`), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(pool.tables); n != 0 {
+		t.Fatalf("expecting no pooled table, got %d", n)
+	}
+	arr := second.(*lua.LTable)
+	if arr.Len() != 1 || arr.RawGetString("a") != lua.LNil {
+		t.Fatalf("expecting a cleared table, got %v", arr)
+	}
+	if x := arr.RawGetInt(1).(*lua.LTable).RawGetString("x"); x != lua.LNumber(1) {
+		t.Fatalf("expecting x = 1, got %v", x)
+	}
+}
+
+func TestTablePoolReuse(t *testing.T) {
+	s := lua.NewState()
+	defer s.Close()
+
+	// tableSize returns the number of array slots and keys held by t.
+	tableSize := func(t *lua.LTable) int {
+		v := reflect.ValueOf(t).Elem()
+		return v.FieldByName("array").Len() + v.FieldByName("keys").Len()
+	}
+	pool := NewTablePool(8)
+	opts := &DecodeOptions{TablePool: pool}
+	var objSize, arrSize int
+	for i := 0; i < 100; i++ {
+		doc := fmt.Sprintf(`{"key%d":[%d,%d,%d]}`, i, i, i+1, i+2)
+		value, err := DecodeWithOptions(s, []byte(doc), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		obj := value.(*lua.LTable)
+		arr := obj.RawGetString(fmt.Sprintf("key%d", i)).(*lua.LTable)
+		if i == 1 {
+			objSize, arrSize = tableSize(obj), tableSize(arr)
+		} else if i > 1 && (tableSize(obj) != objSize || tableSize(arr) != arrSize) {
+			t.Fatalf("reuse %d: sizes grew from %d and %d to %d and %d", i, objSize, arrSize, tableSize(obj), tableSize(arr))
+		}
+		pool.Put(value)
+	}
+}
+
+func TestTableAllocator(t *testing.T) {
+	s := lua.NewState()
+	defer s.Close()
+
+	var arrays, objects int
+	alloc := func(L *lua.LState, array bool, narr, nhash int) *lua.LTable {
+		if array {
+			arrays++
+			return L.CreateTable(8, 0)
+		}
+		objects++
+		return nil
+	}
+	pool := NewTablePool(8)
+	for _, threshold := range []int{0, -1} {
+		arrays, objects = 0, 0
+		opts := &DecodeOptions{TableAllocator: alloc, TablePool: pool, FastPathThreshold: threshold}
+		value, err := DecodeWithOptions(s, []byte(`{"a":[1,{"b":[]}],"c":{}}`), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if arrays != 2 || objects != 3 {
+			t.Errorf("threshold %d: got %d arrays and %d objects, want 2 and 3", threshold, arrays, objects)
+		}
+		if data, _ := Encode(value); string(data) != `{"a":[1,{"b":[]}],"c":[]}` {
+			t.Errorf("threshold %d: got %s", threshold, data)
+		}
+	}
+
+	L := lua.NewState()
+	defer L.Close()
+	Preload(L, WithTableAllocator(alloc))
+	arrays = 0
+	if err := L.DoString(`assert(#require("json").decode("[[1], [2]]") == 2)`); err != nil {
+		t.Fatal(err)
+	}
+	if arrays != 3 {
+		t.Errorf("got %d arrays, want 3", arrays)
+	}
+}
@@ -0,0 +1,147 @@
+package json
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// project decodes the value starting with tok, keeping only the parts matched
+// by the patterns. It reports whether anything was kept.
+func (t *tokenDecoder) project(tok json.Token, p path, patterns []pathPattern) (lua.LValue, bool, error) {
+	descend := false
+	for _, pp := range patterns {
+		if pp.within(p) {
+			value, err := t.build(tok, p)
+			return value, true, err
+		}
+		descend = descend || pp.leadsTo(p)
+	}
+	if !descend || (tok != json.Delim('{') && tok != json.Delim('[')) {
+		return nil, false, t.skip(tok)
+	}
+
+	tbl := t.newTable(tok == json.Delim('['), 0, 0)
+	kept := false
+	for i := 0; t.dec.More(); i++ {
+		var cp path
+		if tok == json.Delim('{') {
+			key, err := t.key()
+			if err != nil {
+				return nil, false, err
+			}
+			cp = p.child(key)
+		} else {
+			cp = p.elem(i)
+		}
+		next, err := t.dec.Token()
+		if err != nil {
+			return nil, false, err
+		}
+		value, ok, err := t.project(next, cp, patterns)
+		if err != nil {
+			return nil, false, err
+		}
+		if !ok {
+			continue
+		}
+		kept = true
+		if e := cp[len(cp)-1]; e.isIndex {
+			tbl.RawSetInt(e.index+1, value)
+		} else {
+			tbl.RawSetH(t.str(e.key, true), value)
+		}
+	}
+	return tbl, kept, t.end()
+}
+
+// decodeProjection decodes only the parts of data matched by the patterns,
+// in a single pass. Array elements keep their original positions.
+func decodeProjection(d *decoder, data []byte, patterns []pathPattern) (lua.LValue, error) {
+	d.paths = true
+	t := newTokenDecoder(d, bytes.NewReader(data))
+	tok, err := t.dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	value, ok, err := t.project(tok, nil, patterns)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.finish(); err != nil {
+		return nil, err
+	}
+	if !ok {
+		return d.newTable(false, 0, 0), nil
+	}
+	return value, nil
+}
+
+func (m *module) apiDecodeProjection(L *lua.LState) int {
+	str := L.CheckString(1)
+	patterns, err := parsePathPatterns(checkStrings(L, 2))
+	if err != nil {
+		L.ArgError(2, err.Error())
+	}
+
+	value, err := decodeProjection(newDecoder(L, &m.decode), []byte(str), patterns)
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	L.Push(value)
+	return 1
+}
+
+// resolve returns the value at pp, which has no wildcards, in the Lua
+// document v, or nil when there is none.
+func (pp pathPattern) resolve(v lua.LValue) lua.LValue {
+	for _, e := range pp {
+		var key lua.LValue = lua.LString(e.key)
+		if e.isIndex {
+			key = lua.LNumber(e.index + 1)
+		}
+		if v = memberOf(v, key); v == lua.LNil {
+			break
+		}
+	}
+	return v
+}
+
+// apiGetMany returns the values at several paths of a Lua document, or of a
+// JSON string decoded in a single pass, as an array with an n field.
+func (m *module) apiGetMany(L *lua.LState) int {
+	doc := L.CheckAny(1)
+	patterns, err := parsePathPatterns(checkStrings(L, 2))
+	if err != nil {
+		L.ArgError(2, err.Error())
+	}
+	for _, pp := range patterns {
+		for _, e := range pp {
+			if e.wildcard {
+				L.ArgError(2, "paths cannot use wildcards")
+			}
+		}
+	}
+	if s, ok := doc.(lua.LString); ok {
+		opts, _ := checkDecodeOptions(L, 3, m.decode)
+		d := newDecoder(L, &opts)
+		if err = d.compile(); err == nil {
+			doc, err = decodeProjection(d, []byte(s), patterns)
+		}
+		if err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+	}
+	results := L.CreateTable(len(patterns), 1)
+	for i, pp := range patterns {
+		results.RawSetInt(i+1, pp.resolve(doc))
+	}
+	results.RawSetString("n", lua.LNumber(len(patterns)))
+	L.Push(results)
+	return 1
+}
@@ -0,0 +1,67 @@
+package json
+
+import (
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestDecodeProjection(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local doc = json.decode_projection(
+		'{"user":{"id":7,"email":"a@b.c","ssn":"x"},"items":[{"sku":"a","price":1},{"price":2},{"sku":"c"}],"other":[1,2]}',
+		{"user.id", "user.email", "items[*].sku"})
+	assert(doc.user.id == 7 and doc.user.email == "a@b.c" and doc.user.ssn == nil)
+	assert(doc.items[1].sku == "a" and doc.items[1].price == nil)
+	assert(doc.items[2] == nil and doc.items[3].sku == "c")
+	assert(doc.other == nil)
+
+	local doc = json.decode_projection('{"a":{"b":[1,2]}}', {"$.a"})
+	assert(doc.a.b[2] == 2)
+
+	local doc = json.decode_projection('{"a":1}', {"$.x.y"})
+	assert(next(doc) == nil)
+
+	local doc, err = json.decode_projection('{"a":1', {"$.a"})
+	assert(doc == nil and err)
+
+	assert(not pcall(json.decode_projection, '{}', {"$["}))
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetMany(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local text = '{"a": 1, "b": {"c": "x", "d": [true]}, "items": [{"id": 3}, {"id": 4}], "n": null}'
+	local paths = {"$.a", "$.b.c", "$.items[1].id", "$.missing", "$.items[5]", "$.b.c.d", "$['n']", "$.b"}
+	for _, doc in ipairs({text, json.decode(text)}) do
+		local r = json.get_many(doc, paths)
+		assert(r.n == 8)
+		assert(r[1] == 1 and r[2] == "x" and r[3] == 4)
+		assert(r[4] == nil and r[5] == nil and r[6] == nil and r[7] == nil)
+		assert(r[8].d[1] == true and r[8].c == "x")
+	end
+	local r = json.get_many(text, {"$.n", "$"}, {keep_nulls = true})
+	assert(r[1] == json.null and r[2].a == 1)
+
+	local _, err = json.get_many('{"a": ', {"$.a"})
+	assert(err ~= nil)
+	assert(not pcall(json.get_many, text, {"$.items[*].id"}))
+	assert(not pcall(json.get_many, text, {"$["}))
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,370 @@
+package json
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/yuin/gopher-lua"
+)
+
+const pushParserTypeName = "json.push_parser"
+
+type pushState int
+
+const (
+	pushValue     pushState = iota // expecting a value
+	pushFirstElem                  // after '[': an element or ']'
+	pushFirstKey                   // after '{': a key or '}'
+	pushKey                        // after ',' in an object: a key
+	pushColon                      // after a key: ':'
+	pushAfter                      // after a value in a container: ',' or the end
+	pushString                     // inside a string
+	pushScalar                     // inside a number or literal
+)
+
+// pushFrame is a container being decoded.
+type pushFrame struct {
+	value  lua.LValue
+	object bool
+	path   path
+	seen   map[string]bool
+
+	// key and keep describe the object member being decoded; index counts
+	// the array elements decoded so far.
+	key   string
+	keep  bool
+	index int
+}
+
+// PushDecoder decodes a stream of JSON documents fed in chunks of any size,
+// such as the reads of a network connection, building each document as its
+// bytes arrive rather than buffering it whole. Each complete top-level value
+// is passed to the callback given to NewPushDecoder, so that hosts only need
+// to enter Lua once a document is complete.
+//
+// A PushDecoder creates its values in the LState it was created with and,
+// like the LState, must not be used concurrently.
+type PushDecoder struct {
+	*decoder
+	onValue func(lua.LValue) error
+
+	state pushState
+	stack []pushFrame
+
+	// tok holds the string, number or literal being read; key reports
+	// whether the string is an object key, and escape whether its last byte
+	// was an unescaped backslash.
+	tok    []byte
+	key    bool
+	escape bool
+
+	// offset is the offset in the stream of the start of the current chunk,
+	// and start that of tok.
+	offset int
+	start  int
+}
+
+// NewPushDecoder returns a decoder that calls onValue with each document of
+// the stream. A nil opts is equivalent to the zero DecodeOptions. An error
+// returned by onValue stops decoding and is returned by Feed.
+func NewPushDecoder(L *lua.LState, opts *DecodeOptions, onValue func(lua.LValue) error) (*PushDecoder, error) {
+	if opts == nil {
+		opts = &DecodeOptions{}
+	}
+	d := newDecoder(L, opts)
+	if err := d.compile(); err != nil {
+		return nil, err
+	}
+	return &PushDecoder{decoder: d, onValue: onValue}, nil
+}
+
+// Feed decodes the next chunk of the stream, calling the callback for every
+// document it completes. After an error, the decoder returns the same error
+// for all further input.
+func (p *PushDecoder) Feed(data []byte) error {
+	if p.err != nil {
+		return p.err
+	}
+	for i := 0; i < len(data); i++ {
+		if p.err = p.next(data[i], p.offset+i); p.err != nil {
+			return p.err
+		}
+	}
+	p.offset += len(data)
+	return nil
+}
+
+// Close ends the stream, completing a final top-level number or literal, and
+// returns io.ErrUnexpectedEOF when the stream ends inside a document.
+// The decoder can then be fed a new stream.
+func (p *PushDecoder) Close() error {
+	if p.err != nil {
+		return p.err
+	}
+	if p.state == pushScalar {
+		if p.err = p.endScalar(); p.err != nil {
+			return p.err
+		}
+	}
+	if p.state != pushValue || len(p.stack) > 0 {
+		p.err = io.ErrUnexpectedEOF
+		return p.err
+	}
+	p.offset = 0
+	return nil
+}
+
+func isScalarByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '+' || c == '.' || c == 'E'
+}
+
+// next processes the byte c, found at offset in the stream.
+func (p *PushDecoder) next(c byte, offset int) error {
+	switch p.state {
+	case pushString:
+		p.tok = append(p.tok, c)
+		switch {
+		case p.escape:
+			p.escape = false
+		case c == '\\':
+			p.escape = true
+		case c == '"':
+			return p.endString()
+		}
+		return nil
+	case pushScalar:
+		if isScalarByte(c) {
+			p.tok = append(p.tok, c)
+			return nil
+		}
+		if err := p.endScalar(); err != nil {
+			return err
+		}
+	}
+	switch c {
+	case ' ', '\t', '\n', '\r':
+		return nil
+	}
+
+	switch p.state {
+	case pushFirstElem:
+		if c == ']' {
+			return p.pop()
+		}
+		fallthrough
+	case pushValue:
+		return p.begin(c, offset)
+	case pushFirstKey:
+		if c == '}' {
+			return p.pop()
+		}
+		fallthrough
+	case pushKey:
+		if c == '"' {
+			p.state, p.key, p.start = pushString, true, offset
+			p.tok = append(p.tok[:0], c)
+			return nil
+		}
+	case pushColon:
+		if c == ':' {
+			p.state = pushValue
+			return nil
+		}
+	case pushAfter:
+		top := &p.stack[len(p.stack)-1]
+		switch {
+		case c == ',' && top.object:
+			p.state = pushKey
+			return nil
+		case c == ',':
+			p.state = pushValue
+			return nil
+		case c == '}' && top.object, c == ']' && !top.object:
+			return p.pop()
+		}
+	}
+	return fmt.Errorf("invalid character %q at offset %d", c, offset)
+}
+
+// path returns the path of the value about to be decoded.
+func (p *PushDecoder) path() path {
+	if !p.paths || len(p.stack) == 0 {
+		return nil
+	}
+	top := &p.stack[len(p.stack)-1]
+	if top.object {
+		return top.path.child(top.key)
+	}
+	return top.path.elem(top.index)
+}
+
+// begin starts the value whose first byte is c.
+func (p *PushDecoder) begin(c byte, offset int) error {
+	switch {
+	case c == '{', c == '[':
+		vp := p.path()
+		if !p.container(vp) {
+			return p.err
+		}
+		frame := pushFrame{object: c == '{', path: vp}
+		if frame.object {
+			frame.value = p.newObject()
+			frame.seen = p.duplicates()
+			p.state = pushFirstKey
+		} else {
+			frame.value = p.newTable(true, 0, 0)
+			p.state = pushFirstElem
+		}
+		p.stack = append(p.stack, frame)
+		return nil
+	case c == '"':
+		p.state, p.key, p.start = pushString, false, offset
+	case c == '-', c >= '0' && c <= '9', c == 't', c == 'f', c == 'n',
+		(c == '+' || c == '.') && p.opts.Grammar == GrammarLenient:
+		p.state, p.start = pushScalar, offset
+	default:
+		return fmt.Errorf("invalid character %q at offset %d", c, offset)
+	}
+	p.tok = append(p.tok[:0], c)
+	return nil
+}
+
+// scalar decodes tok, a complete string, number or literal.
+func (p *PushDecoder) scalar() (lua.LValue, error) {
+	f := &fastDecoder{decoder: p.decoder, data: p.tok}
+	value, err := f.value(p.path())
+	if err == nil && f.pos < len(p.tok) {
+		err = errSyntax
+	}
+	if err == errSyntax {
+		err = fmt.Errorf("invalid value %q at offset %d", p.tok, p.start)
+	}
+	return value, err
+}
+
+func (p *PushDecoder) endString() error {
+	if !p.key {
+		value, err := p.scalar()
+		if err != nil {
+			return err
+		}
+		return p.emit(value)
+	}
+	f := &fastDecoder{decoder: p.decoder, data: p.tok}
+	key, err := f.string()
+	if err != nil {
+		return fmt.Errorf("invalid key %q at offset %d", p.tok, p.start)
+	}
+	top := &p.stack[len(p.stack)-1]
+	top.key = key
+	top.keep = p.member(top.seen, key, p.path())
+	if p.err != nil {
+		return p.err
+	}
+	p.state = pushColon
+	return nil
+}
+
+func (p *PushDecoder) endScalar() error {
+	value, err := p.scalar()
+	if err != nil {
+		return err
+	}
+	return p.emit(value)
+}
+
+// pop ends the innermost container.
+func (p *PushDecoder) pop() error {
+	top := p.stack[len(p.stack)-1]
+	p.stack = p.stack[:len(p.stack)-1]
+	if top.object {
+		if top.value = p.construct(top.value, top.path); p.err != nil {
+			return p.err
+		}
+	}
+	return p.emit(top.value)
+}
+
+// emit stores a complete value in its container, or passes it to onValue at
+// the top level.
+func (p *PushDecoder) emit(value lua.LValue) error {
+	if len(p.stack) == 0 {
+		// The memory budget applies to each document.
+		p.state, p.used = pushValue, 0
+		return p.onValue(value)
+	}
+	top := &p.stack[len(p.stack)-1]
+	if top.object {
+		if top.keep {
+			p.setMember(top.value, top.key, value, p.path())
+		}
+	} else {
+		top.value = p.appendElem(top.value, value, p.path())
+		top.index++
+	}
+	p.state = pushAfter
+	return nil
+}
+
+func registerPushParser(L *lua.LState) {
+	mt := L.NewTypeMetatable(pushParserTypeName)
+	methods := L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"feed":   pushParserFeed,
+		"finish": pushParserFinish,
+	})
+	mt.RawSetString("__index", methods)
+}
+
+// apiPushParser returns a parser that calls callbacks.on_value with each
+// document of the stream fed to it.
+func (m *module) apiPushParser(L *lua.LState) int {
+	callbacks := L.CheckTable(1)
+	opts, _ := checkDecodeOptions(L, 2, m.decode)
+	fn, ok := callbacks.RawGetString("on_value").(*lua.LFunction)
+	if !ok {
+		L.ArgError(1, "on_value callback expected")
+	}
+
+	p, err := NewPushDecoder(L, &opts, func(value lua.LValue) error {
+		return L.CallByParam(lua.P{Fn: fn, Protect: true}, value)
+	})
+	if err != nil {
+		L.ArgError(2, err.Error())
+	}
+	ud := L.NewUserData()
+	ud.Value = p
+	ud.Metatable = L.GetTypeMetatable(pushParserTypeName)
+	L.Push(ud)
+	return 1
+}
+
+func checkPushParser(L *lua.LState, n int) *PushDecoder {
+	ud := L.CheckUserData(n)
+	p, ok := ud.Value.(*PushDecoder)
+	if !ok {
+		L.ArgError(n, "json push parser expected")
+	}
+	return p
+}
+
+func pushParserFeed(L *lua.LState) int {
+	p := checkPushParser(L, 1)
+	if err := p.Feed([]byte(L.CheckString(2))); err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	L.Push(lua.LTrue)
+	return 1
+}
+
+func pushParserFinish(L *lua.LState) int {
+	p := checkPushParser(L, 1)
+	if err := p.Close(); err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	L.Push(lua.LTrue)
+	return 1
+}
@@ -0,0 +1,131 @@
+package json
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestPushDecoder(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	const stream = "{\"a\":[1,\"two\",{\"b\":null}],\"c\":\"\\u00e9\\\"\"}\n[] 42 true \"s\" {\"d\":-1.5e2}"
+	var expected []lua.LValue
+	for _, doc := range []string{`{"a":[1,"two",{"b":null}],"c":"é\""}`, `[]`, `42`, `true`, `"s"`, `{"d":-1.5e2}`} {
+		value, err := Decode(L, []byte(doc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected = append(expected, value)
+	}
+
+	// Feed the stream in chunks of every size, splitting tokens anywhere.
+	for size := 1; size <= len(stream); size++ {
+		var values []lua.LValue
+		p, err := NewPushDecoder(L, &DecodeOptions{}, func(value lua.LValue) error {
+			values = append(values, value)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < len(stream); i += size {
+			end := i + size
+			if end > len(stream) {
+				end = len(stream)
+			}
+			if err := p.Feed([]byte(stream[i:end])); err != nil {
+				t.Fatalf("size %d: %v", size, err)
+			}
+		}
+		if err := p.Close(); err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		if len(values) != len(expected) {
+			t.Fatalf("size %d: expecting %d values, got %d", size, len(expected), len(values))
+		}
+		for i := range values {
+			if !deepEqual(values[i], expected[i]) {
+				t.Fatalf("size %d: expecting %v, got %v", size, expected[i], values[i])
+			}
+		}
+	}
+}
+
+func TestPushDecoderErrors(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	for _, input := range []string{`{"a" 1}`, `[1,]`, `{"a":1]`, `tru e`, `01`, `{,}`, `"x`, `{"a":`, `[`} {
+		p, err := NewPushDecoder(L, &DecodeOptions{}, func(lua.LValue) error { return nil })
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Feed([]byte(input)); err == nil {
+			if err := p.Close(); err == nil {
+				t.Errorf("%q: expecting error", input)
+			}
+		}
+	}
+}
+
+func TestPushParser(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local docs = {}
+	local p = json.push_parser({on_value = function(value) docs[#docs + 1] = value end})
+	assert(p:feed('{"id":1,"na'))
+	assert(#docs == 0)
+	assert(p:feed('me":"x"}\n{"id"'))
+	assert(#docs == 1 and docs[1].name == "x")
+	assert(p:feed(':2}'))
+	assert(#docs == 2 and docs[2].id == 2)
+	assert(p:finish())
+
+	local p = json.push_parser({on_value = function() end})
+	assert(p:feed('[1,'))
+	local ok, err = p:finish()
+	assert(not ok and err)
+
+	local p = json.push_parser({on_value = function() end})
+	local ok, err = p:feed('[1}')
+	assert(not ok and err:find("offset 2"))
+
+	local p = json.push_parser({on_value = function(value) error("stop") end})
+	local ok, err = p:feed('1 ')
+	assert(not ok and err:find("stop"))
+
+	local p = json.push_parser({on_value = function() end}, {max_depth = 1})
+	assert(not p:feed('[[1]]'))
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPushDecoderCallbackError(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	stop := errors.New("stop")
+	count := 0
+	p, err := NewPushDecoder(L, nil, func(lua.LValue) error {
+		count++
+		return stop
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Feed([]byte(`{} {}`)); err != stop {
+		t.Fatalf("expecting callback error, got %v", err)
+	}
+	if err := p.Feed([]byte(`{}`)); err != stop || count != 1 {
+		t.Fatalf("expecting decoder to stay stopped, got %v after %d values", err, count)
+	}
+}
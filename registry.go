@@ -0,0 +1,102 @@
+package json
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// UserDataEncoder returns the JSON encoding of the Go value held by ud.
+type UserDataEncoder func(ud *lua.LUserData) (json.RawMessage, error)
+
+// UserDataDecoder sets the Go value held by ud from the JSON document data.
+type UserDataDecoder func(ud *lua.LUserData, data json.RawMessage) error
+
+// registry holds the encoders and decoders of the userdata values of the Go
+// types registered with RegisterEncoder and RegisterDecoder. It is shared by
+// all states.
+var registry struct {
+	sync.RWMutex
+	encoders map[reflect.Type]UserDataEncoder
+	decoders map[reflect.Type]UserDataDecoder
+}
+
+// RegisterEncoder makes json.encode encode the userdata holding values of the
+// type of typ, such as (*Point)(nil), with fn. Registered encoders take
+// precedence over the metamethods of userdata and over reflection. A nil fn
+// removes the encoder of the type.
+func RegisterEncoder(typ interface{}, fn UserDataEncoder) {
+	registry.Lock()
+	defer registry.Unlock()
+	if registry.encoders == nil {
+		registry.encoders = make(map[reflect.Type]UserDataEncoder)
+	}
+	if fn == nil {
+		delete(registry.encoders, reflect.TypeOf(typ))
+	} else {
+		registry.encoders[reflect.TypeOf(typ)] = fn
+	}
+}
+
+// RegisterDecoder makes json.decode_into decode JSON into the userdata
+// holding values of the type of typ with fn. A nil fn removes the decoder of
+// the type.
+func RegisterDecoder(typ interface{}, fn UserDataDecoder) {
+	registry.Lock()
+	defer registry.Unlock()
+	if registry.decoders == nil {
+		registry.decoders = make(map[reflect.Type]UserDataDecoder)
+	}
+	if fn == nil {
+		delete(registry.decoders, reflect.TypeOf(typ))
+	} else {
+		registry.decoders[reflect.TypeOf(typ)] = fn
+	}
+}
+
+// encodeRegistered encodes ud with the encoder registered for the type of
+// its value, reporting whether there is one.
+func encodeRegistered(ud *lua.LUserData) (data []byte, ok bool, err error) {
+	registry.RLock()
+	fn, ok := registry.encoders[reflect.TypeOf(ud.Value)]
+	registry.RUnlock()
+	if !ok {
+		return nil, false, nil
+	}
+	data, err = fn(ud)
+	if err != nil {
+		return nil, true, err
+	}
+	if !json.Valid(data) {
+		return nil, true, fmt.Errorf("encoder of %T returned invalid JSON", ud.Value)
+	}
+	return data, true, nil
+}
+
+// apiDecodeInto decodes a JSON string into a userdata with the decoder
+// registered for the type of its value, and returns the userdata.
+func apiDecodeInto(L *lua.LState) int {
+	ud := L.CheckUserData(1)
+	str := L.CheckString(2)
+	registry.RLock()
+	fn, ok := registry.decoders[reflect.TypeOf(ud.Value)]
+	registry.RUnlock()
+	if !ok {
+		L.ArgError(1, fmt.Sprintf("no decoder registered for %T", ud.Value))
+	}
+	var raw json.RawMessage
+	err := json.Unmarshal([]byte(str), &raw)
+	if err == nil {
+		err = fn(ud, raw)
+	}
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	L.Push(ud)
+	return 1
+}
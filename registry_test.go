@@ -0,0 +1,75 @@
+package json
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+type registryPoint struct {
+	X, Y int
+}
+
+func TestRegistry(t *testing.T) {
+	const str = `
+	local json = require("json")
+	assert(json.encode({p = point}) == '{"p":[1,2]}')
+	assert(json.encode({p = point}, {indent = "  "}) == '{\n  "p": [\n    1,\n    2\n  ]\n}')
+	assert(json.decode_into(point, "[3, 4]") == point)
+	assert(json.encode(point) == "[3,4]")
+
+	local _, err = json.decode_into(point, "[3]")
+	assert(err == "expected 2 coordinates", err)
+	_, err = json.decode_into(point, "[3,")
+	assert(err ~= nil)
+	assert(not pcall(json.decode_into, other, "1"))
+
+	_, err = json.encode(bad)
+	assert(err ~= nil and string.find(err, "invalid JSON"), err)
+	_, err = json.encode(other)
+	assert(err ~= nil)
+	`
+	RegisterEncoder((*registryPoint)(nil), func(ud *lua.LUserData) (json.RawMessage, error) {
+		p := ud.Value.(*registryPoint)
+		return json.RawMessage(fmt.Sprintf("[%d, %d]", p.X, p.Y)), nil
+	})
+	RegisterDecoder((*registryPoint)(nil), func(ud *lua.LUserData, data json.RawMessage) error {
+		var xy []int
+		if err := json.Unmarshal(data, &xy); err != nil {
+			return err
+		}
+		if len(xy) != 2 {
+			return errors.New("expected 2 coordinates")
+		}
+		*ud.Value.(*registryPoint) = registryPoint{xy[0], xy[1]}
+		return nil
+	})
+	RegisterEncoder(registryPoint{}, func(ud *lua.LUserData) (json.RawMessage, error) {
+		return json.RawMessage("{"), nil
+	})
+	defer func() {
+		RegisterEncoder((*registryPoint)(nil), nil)
+		RegisterDecoder((*registryPoint)(nil), nil)
+		RegisterEncoder(registryPoint{}, nil)
+	}()
+
+	s := lua.NewState()
+	defer s.Close()
+
+	for name, value := range map[string]interface{}{
+		"point": &registryPoint{1, 2},
+		"bad":   registryPoint{},
+		"other": struct{}{},
+	} {
+		ud := s.NewUserData()
+		ud.Value = value
+		s.SetGlobal(name, ud)
+	}
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
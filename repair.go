@@ -0,0 +1,224 @@
+package json
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// fix describes a change made by repair, at an offset of the input.
+type fix struct {
+	kind   string
+	offset int
+}
+
+// repairer rewrites almost valid JSON, as produced by careless generators or
+// cut short by a transfer, into valid JSON.
+type repairer struct {
+	in    []byte
+	out   bytes.Buffer
+	fixes []fix
+
+	// stack holds the closing delimiter of each open container.
+	stack []byte
+	// last is the class of the last significant token: one of '{', '[',
+	// ',', ':', 'k' for an object key and 'v' for any other value.
+	last byte
+	// comma holds the offset of a comma whose output is delayed until the
+	// next token, with the whitespace that followed it, or -1.
+	comma int
+	space []byte
+}
+
+// repair returns the repaired data and the fixes applied to it.
+func repair(data []byte) ([]byte, []fix) {
+	r := &repairer{in: data, comma: -1}
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch c {
+		case ' ', '\t', '\n', '\r':
+			if r.comma >= 0 {
+				r.space = append(r.space, c)
+			} else {
+				r.out.WriteByte(c)
+			}
+			continue
+		case ',':
+			r.flush()
+			r.comma = i
+			r.last = ','
+			continue
+		case '}', ']':
+			if r.comma >= 0 {
+				r.fixes = append(r.fixes, fix{"trailing_comma", r.comma})
+				r.comma = -1
+				r.out.Write(r.space)
+				r.space = r.space[:0]
+			}
+			if len(r.stack) > 0 && r.stack[len(r.stack)-1] == c {
+				r.stack = r.stack[:len(r.stack)-1]
+			}
+			r.out.WriteByte(c)
+			r.last = 'v'
+			continue
+		}
+		r.flush()
+		switch c {
+		case '{':
+			r.stack = append(r.stack, '}')
+			r.last = '{'
+			r.out.WriteByte(c)
+		case '[':
+			r.stack = append(r.stack, ']')
+			r.last = '['
+			r.out.WriteByte(c)
+		case ':':
+			r.last = ':'
+			r.out.WriteByte(c)
+		case '"', '\'':
+			i = r.string(i)
+			if r.inObject() && (r.last == '{' || r.last == ',') {
+				r.last = 'k'
+			} else {
+				r.last = 'v'
+			}
+		default:
+			if r.inObject() && (r.last == '{' || r.last == ',') && isIdentStart(c) {
+				i = r.key(i)
+				r.last = 'k'
+				continue
+			}
+			r.last = 'v'
+			r.out.WriteByte(c)
+		}
+	}
+	r.finish()
+	return r.out.Bytes(), r.fixes
+}
+
+func (r *repairer) inObject() bool {
+	return len(r.stack) > 0 && r.stack[len(r.stack)-1] == '}'
+}
+
+// flush writes the delayed comma, which turned out to be followed by a token.
+func (r *repairer) flush() {
+	if r.comma < 0 {
+		return
+	}
+	r.out.WriteByte(',')
+	r.out.Write(r.space)
+	r.comma = -1
+	r.space = r.space[:0]
+}
+
+// string copies the string starting at offset start, quoted with either
+// double or single quotes, and returns the offset of its closing quote.
+func (r *repairer) string(start int) int {
+	quote := r.in[start]
+	if quote == '\'' {
+		r.fixes = append(r.fixes, fix{"single_quotes", start})
+	}
+	r.out.WriteByte('"')
+	reported := false
+	for i := start + 1; i < len(r.in); i++ {
+		c := r.in[i]
+		switch {
+		case c == '\\' && i+1 < len(r.in):
+			i++
+			if quote == '\'' && r.in[i] == '\'' {
+				r.out.WriteByte('\'')
+			} else {
+				r.out.WriteByte('\\')
+				r.out.WriteByte(r.in[i])
+			}
+		case c == quote:
+			r.out.WriteByte('"')
+			return i
+		case c == '"':
+			r.out.WriteString(`\"`)
+		case c < 0x20:
+			if !reported {
+				r.fixes = append(r.fixes, fix{"control_character", i})
+				reported = true
+			}
+			switch c {
+			case '\n':
+				r.out.WriteString(`\n`)
+			case '\r':
+				r.out.WriteString(`\r`)
+			case '\t':
+				r.out.WriteString(`\t`)
+			default:
+				fmt.Fprintf(&r.out, `\u%04x`, c)
+			}
+		default:
+			r.out.WriteByte(c)
+		}
+	}
+	r.fixes = append(r.fixes, fix{"unterminated_string", start})
+	r.out.WriteByte('"')
+	return len(r.in)
+}
+
+// key quotes the bare identifier starting at offset start, used as an object
+// key, and returns the offset of its last byte.
+func (r *repairer) key(start int) int {
+	r.fixes = append(r.fixes, fix{"unquoted_key", start})
+	end := start + 1
+	for end < len(r.in) && (isIdentStart(r.in[end]) || r.in[end] >= '0' && r.in[end] <= '9') {
+		end++
+	}
+	r.out.WriteByte('"')
+	r.out.Write(r.in[start:end])
+	r.out.WriteByte('"')
+	return end - 1
+}
+
+func isIdentStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == '$'
+}
+
+// finish completes a truncated document.
+func (r *repairer) finish() {
+	end := len(r.in)
+	if r.comma >= 0 {
+		r.fixes = append(r.fixes, fix{"trailing_comma", r.comma})
+		r.comma = -1
+	}
+	switch r.last {
+	case ':':
+		r.fixes = append(r.fixes, fix{"missing_value", end})
+		r.out.WriteString("null")
+	case 'k':
+		r.fixes = append(r.fixes, fix{"missing_value", end})
+		r.out.WriteString(":null")
+	}
+	for i := len(r.stack) - 1; i >= 0; i-- {
+		r.fixes = append(r.fixes, fix{"unclosed", end})
+		r.out.WriteByte(r.stack[i])
+	}
+}
+
+func apiRepair(L *lua.LState) int {
+	str := L.CheckString(1)
+
+	repaired, fixes := repair([]byte(str))
+	var v interface{}
+	if err := json.Unmarshal(repaired, &v); err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString("cannot repair JSON: " + err.Error()))
+		return 2
+	}
+	list := L.CreateTable(len(fixes), 0)
+	for _, f := range fixes {
+		t := L.CreateTable(0, 2)
+		t.RawSetString("kind", lua.LString(f.kind))
+		t.RawSetString("offset", lua.LNumber(f.offset))
+		list.Append(t)
+	}
+	L.Push(lua.LString(repaired))
+	L.Push(list)
+	return 2
+}
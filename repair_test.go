@@ -0,0 +1,72 @@
+package json
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestRepair(t *testing.T) {
+	tests := []struct {
+		input, expected string
+		kinds           []string
+	}{
+		{`{"a":1}`, `{"a":1}`, nil},
+		{`{"a":[1,2,],}`, `{"a":[1,2]}`, []string{"trailing_comma", "trailing_comma"}},
+		{"{\"text\":\"line 1\nline 2\"}", `{"text":"line 1\nline 2"}`, []string{"control_character"}},
+		{`{'a':'it\'s "x"'}`, `{"a":"it's \"x\""}`, []string{"single_quotes", "single_quotes"}},
+		{`{"a":[1,{"b":"tru`, `{"a":[1,{"b":"tru"}]}`, []string{"unterminated_string", "unclosed", "unclosed", "unclosed"}},
+		{`{"a":1,"b":`, `{"a":1,"b":null}`, []string{"missing_value", "unclosed"}},
+		{`{"a":1, "b"`, `{"a":1, "b":null}`, []string{"missing_value", "unclosed"}},
+		{`[1, 2, `, `[1, 2]`, []string{"trailing_comma", "unclosed"}},
+		{`{a: 1, $b_2: {c: "x"}}`, `{"a": 1, "$b_2": {"c": "x"}}`, []string{"unquoted_key", "unquoted_key", "unquoted_key"}},
+	}
+	for _, test := range tests {
+		repaired, fixes := repair([]byte(test.input))
+		if string(repaired) != test.expected {
+			t.Errorf("%q: expecting %s, got %s", test.input, test.expected, repaired)
+		}
+		if !json.Valid(repaired) {
+			t.Errorf("%q: repaired %s is not valid", test.input, repaired)
+		}
+		var kinds []string
+		for _, f := range fixes {
+			kinds = append(kinds, f.kind)
+		}
+		if len(kinds) != len(test.kinds) {
+			t.Errorf("%q: expecting fixes %v, got %v", test.input, test.kinds, kinds)
+			continue
+		}
+		for i := range kinds {
+			if kinds[i] != test.kinds[i] {
+				t.Errorf("%q: expecting fixes %v, got %v", test.input, test.kinds, kinds)
+			}
+		}
+	}
+}
+
+func TestRepairLua(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local repaired, fixes = json.repair("[1, 2,]")
+	assert(repaired == "[1, 2]")
+	assert(#fixes == 1 and fixes[1].kind == "trailing_comma" and fixes[1].offset == 5)
+	assert(json.decode(repaired)[2] == 2)
+
+	local repaired, fixes = json.repair('{"ok":true}')
+	assert(repaired == '{"ok":true}' and #fixes == 0)
+
+	local repaired, fixes = json.repair("{id: 1, tags: ['a',]}")
+	assert(repaired == '{"id": 1, "tags": ["a"]}' and #fixes == 4 and fixes[1].kind == "unquoted_key")
+	local repaired, err = json.repair('{"a": undefined}')
+	assert(repaired == nil and string.find(err, "cannot repair JSON"), err)
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,102 @@
+package json
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// maxSafeInt is the largest integer magnitude that survives a round trip
+// through an IEEE 754 double, and therefore through JavaScript.
+const maxSafeInt = 1 << 53
+
+// Report collects the warnings produced by a conversion.
+type Report struct {
+	// UnsafeInts lists the paths of integers whose magnitude exceeds 2^53.
+	UnsafeInts []string
+
+	// Duplicates lists the paths of object members whose key was already
+	// used by a previous member of the same object.
+	Duplicates []string
+
+	// Degraded lists the values that an encoding left out or replaced.
+	Degraded []Degradation
+}
+
+// Degradation is a value that a lenient encoding left out or replaced, at
+// the path of the value or of its container.
+type Degradation struct {
+	Path   string
+	Reason string
+}
+
+// isUnsafeInt reports whether n is an integer beyond 2^53, which may not be
+// the integer it was meant to be.
+func isUnsafeInt(n float64) bool {
+	return math.Trunc(n) == n && math.Abs(n) > maxSafeInt && !math.IsInf(n, 0)
+}
+
+// isUnsafeIntText reports whether the JSON number s is an integer literal
+// beyond 2^53, as isUnsafeInt does for encoded numbers. Numbers are
+// classified from their text since, once parsed, 2^53 + 1 has already been
+// rounded to 2^53.
+func isUnsafeIntText(s string) bool {
+	digits := strings.TrimLeft(strings.TrimLeft(s, "+-"), "0")
+	for i := 0; i < len(digits); i++ {
+		if digits[i] < '0' || digits[i] > '9' {
+			return false
+		}
+	}
+	const maxSafeDigits = "9007199254740992"
+	return len(digits) > len(maxSafeDigits) || len(digits) == len(maxSafeDigits) && digits > maxSafeDigits
+}
+
+// checkNumber records the encoded number n, found at path p, if it is an
+// unsafe integer.
+func (r *Report) checkNumber(p path, n float64) {
+	if r != nil && isUnsafeInt(n) {
+		r.UnsafeInts = append(r.UnsafeInts, p.String())
+	}
+}
+
+// checkText records the decoded number s, found at path p, if it is an
+// unsafe integer.
+func (r *Report) checkText(p path, s string) {
+	if r != nil && isUnsafeIntText(s) {
+		r.UnsafeInts = append(r.UnsafeInts, p.String())
+	}
+}
+
+// toTable converts the report to the table returned to Lua.
+func (r *Report) toTable(L *lua.LState) *lua.LTable {
+	t := L.NewTable()
+	t.RawSetString("unsafe_ints", stringList(L, r.UnsafeInts))
+	t.RawSetString("duplicates", stringList(L, r.Duplicates))
+	degraded := L.CreateTable(len(r.Degraded), 0)
+	for _, d := range r.Degraded {
+		dt := L.CreateTable(0, 2)
+		dt.RawSetString("path", lua.LString(d.Path))
+		dt.RawSetString("reason", lua.LString(d.Reason))
+		degraded.Append(dt)
+	}
+	t.RawSetString("degraded", degraded)
+	return t
+}
+
+// degrade records in the report that the encoding of the value at path p
+// lost data, when the ReportDegraded option is set.
+func (s *encodeState) degrade(p path, format string, args ...interface{}) {
+	if s.opts.ReportDegraded && s.opts.Report != nil {
+		s.opts.Report.Degraded = append(s.opts.Report.Degraded, Degradation{Path: p.String(), Reason: fmt.Sprintf(format, args...)})
+	}
+}
+
+func stringList(L *lua.LState, list []string) *lua.LTable {
+	t := L.CreateTable(len(list), 0)
+	for _, s := range list {
+		t.Append(lua.LString(s))
+	}
+	return t
+}
@@ -0,0 +1,1076 @@
+package json
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/yuin/gopher-lua"
+)
+
+const schemaTypeName = "json.schema"
+
+// SchemaLoader returns the JSON document at an absolute URI, which a $ref of
+// a schema compiled with json.schema_compile refers to.
+type SchemaLoader func(uri string) ([]byte, error)
+
+// schema is a compiled JSON Schema. Only the keywords present are set.
+type schema struct {
+	// never is set for the schema false, which nothing is valid against.
+	never bool
+	// key locates the schema, as the URI of its document and a fragment.
+	key string
+
+	ref *schema
+
+	types    []string
+	enum     []lua.LValue
+	constant lua.LValue
+
+	allOf, anyOf, oneOf []*schema
+	not                 *schema
+	ifThen              *schema
+	then, otherwise     *schema
+
+	minimum, maximum                   *float64
+	exclusiveMinimum, exclusiveMaximum *float64
+	multipleOf                         *float64
+
+	minLength, maxLength *int
+	pattern              *regexp.Regexp
+
+	// format is only set when formats are asserted, with check, the check
+	// of the format.
+	format string
+	check  func(string) bool
+
+	items                *schema
+	prefixItems          []*schema
+	contains             *schema
+	minContains          *int
+	maxContains          *int
+	minItems, maxItems   *int
+	uniqueItems          bool
+	properties           map[string]*schema
+	patternProperties    []patternSchema
+	additionalProperties *schema
+	propertyNames        *schema
+	required             []string
+	minProperties        *int
+	maxProperties        *int
+	dependentRequired    map[string][]string
+	dependentSchemas     map[string]*schema
+
+	custom []customKeyword
+}
+
+// customKeyword is a keyword validated by a Lua function registered with
+// json.schema_register_keyword.
+type customKeyword struct {
+	name string
+	arg  lua.LValue
+	fn   *lua.LFunction
+}
+
+type patternSchema struct {
+	re     *regexp.Regexp
+	schema *schema
+}
+
+// schemaCompiler compiles a schema and the schemas its references lead to.
+type schemaCompiler struct {
+	L *lua.LState
+
+	// load returns the document at an absolute URI without fragment.
+	load func(uri string) (lua.LValue, error)
+
+	// formats makes the format keyword an assertion rather than an
+	// annotation.
+	formats bool
+
+	// keywords holds the validators of custom keywords.
+	keywords map[string]*lua.LFunction
+
+	// docs holds the documents by URI, and compiled the schemas by URI and
+	// JSON Pointer fragment, so that recursive schemas are only compiled
+	// once.
+	docs     map[string]lua.LValue
+	compiled map[string]*schema
+}
+
+func newSchemaCompiler(L *lua.LState, load func(string) (lua.LValue, error)) *schemaCompiler {
+	return &schemaCompiler{
+		L:        L,
+		load:     load,
+		docs:     make(map[string]lua.LValue),
+		compiled: make(map[string]*schema),
+	}
+}
+
+// compileRoot compiles the schema document v, found at uri.
+func (c *schemaCompiler) compileRoot(v lua.LValue, uri string) (*schema, error) {
+	c.docs[uri] = v
+	s, err := c.compile(v, uri, uri+"#")
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(c.compiled))
+	for key := range c.compiled {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	active := make(map[*schema]bool)
+	for _, key := range keys {
+		if err := checkCycles(c.compiled[key], active); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// inPlace returns the subschemas that s applies to the instance it
+// validates itself, rather than to its members or elements.
+func (s *schema) inPlace() []*schema {
+	subs := []*schema{s.ref, s.not, s.ifThen, s.then, s.otherwise}
+	subs = append(subs, s.allOf...)
+	subs = append(subs, s.anyOf...)
+	subs = append(subs, s.oneOf...)
+	for _, sub := range s.dependentSchemas {
+		subs = append(subs, sub)
+	}
+	return subs
+}
+
+// checkCycles rejects the references that lead back to s without
+// descending into the instance, since validating against them would never
+// end. active maps the schemas being checked to true and those already
+// checked to false.
+func checkCycles(s *schema, active map[*schema]bool) error {
+	if s == nil {
+		return nil
+	}
+	if on, seen := active[s]; seen {
+		if on {
+			return fmt.Errorf("%s: reference cycle validating the same value", s.key)
+		}
+		return nil
+	}
+	active[s] = true
+	for _, sub := range s.inPlace() {
+		if err := checkCycles(sub, active); err != nil {
+			return err
+		}
+	}
+	active[s] = false
+	return nil
+}
+
+// compile compiles the schema v with the base URI base. key identifies the
+// schema: the URI of its document and its location as a fragment.
+func (c *schemaCompiler) compile(v lua.LValue, base, key string) (*schema, error) {
+	if s, ok := c.compiled[key]; ok {
+		return s, nil
+	}
+	s := &schema{key: key}
+	c.compiled[key] = s
+	switch v := v.(type) {
+	case lua.LBool:
+		s.never = !bool(v)
+		return s, nil
+	case *lua.LTable:
+		if id, ok := v.RawGetString("$id").(lua.LString); ok {
+			uri, err := resolveURI(base, string(id))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", key, err)
+			}
+			base, _ = splitFragment(uri)
+			c.docs[base] = v
+			c.compiled[base+"#"] = s
+			key = base + "#"
+		}
+		if err := c.compileKeywords(s, v, base, key); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	return nil, fmt.Errorf("%s: schema must be an object or a boolean", key)
+}
+
+// compileKeywords compiles the keywords of the schema object t into s.
+func (c *schemaCompiler) compileKeywords(s *schema, t *lua.LTable, base, key string) error {
+	var err error
+	fail := func(keyword string, e error) error {
+		return fmt.Errorf("%s%s: %v", key, Pointer{keyword}, e)
+	}
+	sub := func(v lua.LValue, tokens ...string) (*schema, error) {
+		return c.compile(v, base, key+Pointer(tokens).String())
+	}
+	subs := func(keyword string) ([]*schema, error) {
+		v := t.RawGetString(keyword)
+		if v == lua.LNil {
+			return nil, nil
+		}
+		list, ok := v.(*lua.LTable)
+		if !ok {
+			return nil, fail(keyword, errors.New("must be an array of schemas"))
+		}
+		schemas := make([]*schema, 0, list.Len())
+		for i := 1; i <= list.Len(); i++ {
+			s, err := sub(list.RawGetInt(i), keyword, fmt.Sprint(i-1))
+			if err != nil {
+				return nil, err
+			}
+			schemas = append(schemas, s)
+		}
+		return schemas, nil
+	}
+	single := func(keyword string) (*schema, error) {
+		v := t.RawGetString(keyword)
+		if v == lua.LNil {
+			return nil, nil
+		}
+		return sub(v, keyword)
+	}
+	number := func(keyword string) (*float64, error) {
+		switch v := t.RawGetString(keyword).(type) {
+		case *lua.LNilType:
+			return nil, nil
+		case lua.LNumber:
+			n := float64(v)
+			return &n, nil
+		}
+		return nil, fail(keyword, errors.New("must be a number"))
+	}
+	count := func(keyword string) (*int, error) {
+		n, err := number(keyword)
+		if n == nil || err != nil {
+			return nil, err
+		}
+		if *n < 0 || *n != math.Trunc(*n) {
+			return nil, fail(keyword, errors.New("must be a non-negative integer"))
+		}
+		i := int(*n)
+		return &i, nil
+	}
+	regexpOf := func(keyword string, v lua.LValue) (*regexp.Regexp, error) {
+		s, ok := v.(lua.LString)
+		if !ok {
+			return nil, fail(keyword, errors.New("must be a string"))
+		}
+		re, err := regexp.Compile(string(s))
+		if err != nil {
+			return nil, fail(keyword, err)
+		}
+		return re, nil
+	}
+
+	if ref, ok := t.RawGetString("$ref").(lua.LString); ok {
+		if s.ref, err = c.reference(base, string(ref)); err != nil {
+			return fail("$ref", err)
+		}
+	}
+
+	switch v := t.RawGetString("type").(type) {
+	case *lua.LNilType:
+	case lua.LString:
+		s.types = []string{string(v)}
+	case *lua.LTable:
+		for i := 1; i <= v.Len(); i++ {
+			s.types = append(s.types, lua.LVAsString(v.RawGetInt(i)))
+		}
+	default:
+		return fail("type", errors.New("must be a string or an array"))
+	}
+	for _, typ := range s.types {
+		switch typ {
+		case "null", "boolean", "number", "integer", "string", "array", "object":
+		default:
+			return fail("type", fmt.Errorf("unknown type %q", typ))
+		}
+	}
+	switch v := t.RawGetString("enum").(type) {
+	case *lua.LNilType:
+	case *lua.LTable:
+		n, _ := isArray(v)
+		for i := 1; i <= n; i++ {
+			s.enum = append(s.enum, v.RawGetInt(i))
+		}
+	default:
+		return fail("enum", errors.New("must be an array"))
+	}
+	if v := t.RawGetString("const"); v != lua.LNil {
+		s.constant = v
+	}
+
+	if s.allOf, err = subs("allOf"); err != nil {
+		return err
+	}
+	if s.anyOf, err = subs("anyOf"); err != nil {
+		return err
+	}
+	if s.oneOf, err = subs("oneOf"); err != nil {
+		return err
+	}
+	if s.not, err = single("not"); err != nil {
+		return err
+	}
+	if s.ifThen, err = single("if"); err != nil {
+		return err
+	}
+	if s.then, err = single("then"); err != nil {
+		return err
+	}
+	if s.otherwise, err = single("else"); err != nil {
+		return err
+	}
+
+	if s.minimum, err = number("minimum"); err != nil {
+		return err
+	}
+	if s.maximum, err = number("maximum"); err != nil {
+		return err
+	}
+	if s.exclusiveMinimum, err = number("exclusiveMinimum"); err != nil {
+		return err
+	}
+	if s.exclusiveMaximum, err = number("exclusiveMaximum"); err != nil {
+		return err
+	}
+	if s.multipleOf, err = number("multipleOf"); err != nil {
+		return err
+	}
+	if s.multipleOf != nil && *s.multipleOf <= 0 {
+		return fail("multipleOf", errors.New("must be greater than 0"))
+	}
+
+	if s.minLength, err = count("minLength"); err != nil {
+		return err
+	}
+	if s.maxLength, err = count("maxLength"); err != nil {
+		return err
+	}
+	if v := t.RawGetString("pattern"); v != lua.LNil {
+		if s.pattern, err = regexpOf("pattern", v); err != nil {
+			return err
+		}
+	}
+	if format, ok := t.RawGetString("format").(lua.LString); ok && c.formats {
+		if check, ok := formats[string(format)]; ok {
+			s.format, s.check = string(format), check
+		}
+	}
+
+	// The array form of items is that of drafts before 2020-12, where
+	// additionalItems applies to the elements after those it lists.
+	if v, ok := t.RawGetString("items").(*lua.LTable); ok && isNonEmptyArray(v) {
+		if s.prefixItems, err = subs("items"); err != nil {
+			return err
+		}
+		if s.items, err = single("additionalItems"); err != nil {
+			return err
+		}
+	} else if s.items, err = single("items"); err != nil {
+		return err
+	}
+	if t.RawGetString("prefixItems") != lua.LNil {
+		if s.prefixItems, err = subs("prefixItems"); err != nil {
+			return err
+		}
+	}
+	if s.contains, err = single("contains"); err != nil {
+		return err
+	}
+	if s.minContains, err = count("minContains"); err != nil {
+		return err
+	}
+	if s.maxContains, err = count("maxContains"); err != nil {
+		return err
+	}
+	if s.minItems, err = count("minItems"); err != nil {
+		return err
+	}
+	if s.maxItems, err = count("maxItems"); err != nil {
+		return err
+	}
+	s.uniqueItems = lua.LVAsBool(t.RawGetString("uniqueItems"))
+
+	switch v := t.RawGetString("properties").(type) {
+	case *lua.LNilType:
+	case *lua.LTable:
+		s.properties = make(map[string]*schema)
+		for _, name := range sortedKeys(v) {
+			if s.properties[name], err = sub(v.RawGetString(name), "properties", name); err != nil {
+				return err
+			}
+		}
+	default:
+		return fail("properties", errors.New("must be an object"))
+	}
+	switch v := t.RawGetString("patternProperties").(type) {
+	case *lua.LNilType:
+	case *lua.LTable:
+		for _, pattern := range sortedKeys(v) {
+			re, err := regexpOf("patternProperties", lua.LString(pattern))
+			if err != nil {
+				return err
+			}
+			ps, err := sub(v.RawGetString(pattern), "patternProperties", pattern)
+			if err != nil {
+				return err
+			}
+			s.patternProperties = append(s.patternProperties, patternSchema{re: re, schema: ps})
+		}
+	default:
+		return fail("patternProperties", errors.New("must be an object"))
+	}
+	if s.additionalProperties, err = single("additionalProperties"); err != nil {
+		return err
+	}
+	if s.propertyNames, err = single("propertyNames"); err != nil {
+		return err
+	}
+	switch v := t.RawGetString("required").(type) {
+	case *lua.LNilType:
+	case *lua.LTable:
+		for i := 1; i <= v.Len(); i++ {
+			s.required = append(s.required, lua.LVAsString(v.RawGetInt(i)))
+		}
+	default:
+		return fail("required", errors.New("must be an array"))
+	}
+	names := func(keyword, name string, v lua.LValue) ([]string, error) {
+		list, ok := v.(*lua.LTable)
+		if !ok {
+			return nil, fail(keyword, fmt.Errorf("%s must be an array", name))
+		}
+		required := make([]string, 0, list.Len())
+		for i := 1; i <= list.Len(); i++ {
+			required = append(required, lua.LVAsString(list.RawGetInt(i)))
+		}
+		return required, nil
+	}
+	// dependencies is the keyword of draft 7, which 2019-09 split into
+	// dependentRequired and dependentSchemas.
+	for _, keyword := range []string{"dependencies", "dependentRequired", "dependentSchemas"} {
+		switch v := t.RawGetString(keyword).(type) {
+		case *lua.LNilType:
+		case *lua.LTable:
+			for _, name := range sortedKeys(v) {
+				dep := v.RawGetString(name)
+				list, ok := dep.(*lua.LTable)
+				if keyword == "dependentRequired" || keyword == "dependencies" && ok && isNonEmptyArray(list) {
+					required, err := names(keyword, name, dep)
+					if err != nil {
+						return err
+					}
+					if s.dependentRequired == nil {
+						s.dependentRequired = make(map[string][]string)
+					}
+					s.dependentRequired[name] = append(s.dependentRequired[name], required...)
+					continue
+				}
+				ds, err := sub(dep, keyword, name)
+				if err != nil {
+					return err
+				}
+				if s.dependentSchemas == nil {
+					s.dependentSchemas = make(map[string]*schema)
+				}
+				if prev, ok := s.dependentSchemas[name]; ok {
+					ds = &schema{allOf: []*schema{prev, ds}}
+				}
+				s.dependentSchemas[name] = ds
+			}
+		default:
+			return fail(keyword, errors.New("must be an object"))
+		}
+	}
+	if s.minProperties, err = count("minProperties"); err != nil {
+		return err
+	}
+	if s.maxProperties, err = count("maxProperties"); err != nil {
+		return err
+	}
+	for _, name := range sortedKeys(t) {
+		if fn, ok := c.keywords[name]; ok {
+			s.custom = append(s.custom, customKeyword{name: name, arg: t.RawGetString(name), fn: fn})
+		}
+	}
+	return nil
+}
+
+// schemaKeywords are the keywords known to schema_compile, which cannot be
+// registered as custom keywords.
+var schemaKeywords = map[string]bool{
+	"$id": true, "$ref": true, "$schema": true, "$defs": true, "definitions": true,
+	"type": true, "enum": true, "const": true,
+	"allOf": true, "anyOf": true, "oneOf": true, "not": true, "if": true, "then": true, "else": true,
+	"minimum": true, "maximum": true, "exclusiveMinimum": true, "exclusiveMaximum": true, "multipleOf": true,
+	"minLength": true, "maxLength": true, "pattern": true, "format": true,
+	"items": true, "prefixItems": true, "additionalItems": true, "contains": true, "minContains": true, "maxContains": true,
+	"minItems": true, "maxItems": true, "uniqueItems": true,
+	"properties": true, "patternProperties": true, "additionalProperties": true, "propertyNames": true,
+	"required": true, "minProperties": true, "maxProperties": true,
+	"dependencies": true, "dependentRequired": true, "dependentSchemas": true,
+}
+
+// reference compiles the schema that ref, found in a schema with the base
+// URI base, refers to.
+func (c *schemaCompiler) reference(base, ref string) (*schema, error) {
+	uri, err := resolveURI(base, ref)
+	if err != nil {
+		return nil, err
+	}
+	docURI, fragment := splitFragment(uri)
+	doc, ok := c.docs[docURI]
+	if !ok {
+		if c.load == nil {
+			return nil, fmt.Errorf("cannot load %s: no schema loader", docURI)
+		}
+		if doc, err = c.load(docURI); err != nil {
+			return nil, fmt.Errorf("cannot load %s: %v", docURI, err)
+		}
+		c.docs[docURI] = doc
+	}
+	p, err := ParsePointer(fragment)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported fragment %q", fragment)
+	}
+	target := &patchDoc{L: c.L, root: doc}
+	v, err := target.get(p)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", uri, err)
+	}
+	return c.compile(v, docURI, docURI+"#"+p.String())
+}
+
+// resolveURI resolves the reference ref against the URI base.
+func resolveURI(base, ref string) (string, error) {
+	r, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	if base == "" {
+		return r.String(), nil
+	}
+	b, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	return b.ResolveReference(r).String(), nil
+}
+
+// splitFragment splits a URI into the URI without fragment and the
+// unescaped fragment.
+func splitFragment(uri string) (string, string) {
+	i := strings.IndexByte(uri, '#')
+	if i < 0 {
+		return uri, ""
+	}
+	fragment, err := url.PathUnescape(uri[i+1:])
+	if err != nil {
+		fragment = uri[i+1:]
+	}
+	return uri[:i], fragment
+}
+
+// schemaValidator collects the errors found validating a value.
+type schemaValidator struct {
+	// L runs the validators of custom keywords.
+	L *lua.LState
+
+	errors []schemaError
+}
+
+// schemaError is a reason for a value at path to be invalid.
+type schemaError struct {
+	path path
+	msg  string
+}
+
+func (e schemaError) String() string {
+	return e.path.String() + ": " + e.msg
+}
+
+func (v *schemaValidator) fail(p path, format string, args ...interface{}) {
+	v.errors = append(v.errors, schemaError{path: p, msg: fmt.Sprintf(format, args...)})
+}
+
+// valid reports whether value is valid against s, discarding the errors.
+func (s *schema) valid(v *schemaValidator, p path, value lua.LValue) bool {
+	sub := schemaValidator{L: v.L}
+	s.validate(&sub, p, value)
+	return len(sub.errors) == 0
+}
+
+// custom calls the validator of the custom keyword k, which returns true,
+// or false and an optional message.
+func (v *schemaValidator) custom(p path, k customKeyword, value lua.LValue) {
+	v.L.CallByParam(lua.P{Fn: k.fn, NRet: 2}, value, k.arg, lua.LString(p.String()))
+	ok, msg := v.L.Get(-2), v.L.Get(-1)
+	v.L.Pop(2)
+	switch {
+	case lua.LVAsBool(ok):
+	case msg != lua.LNil:
+		v.fail(p, "%s", lua.LVAsString(msg))
+	default:
+		v.fail(p, "value does not satisfy %s", k.name)
+	}
+}
+
+// jsonType returns the JSON type of value. Empty tables are arrays.
+func jsonType(value lua.LValue) string {
+	switch value := value.(type) {
+	case *lua.LNilType:
+		return "null"
+	case lua.LBool:
+		return "boolean"
+	case lua.LNumber:
+		return "number"
+	case lua.LString:
+		return "string"
+	case *lua.LTable:
+		if _, array := isArray(value); array {
+			return "array"
+		}
+		return "object"
+	case *lua.LUserData:
+		switch value.Value.(type) {
+		case nullValue:
+			return "null"
+		case *Object:
+			return "object"
+		case *Array:
+			return "array"
+		case Int64:
+			return "number"
+		}
+	}
+	return value.Type().String()
+}
+
+func (s *schema) hasType(typ string, value lua.LValue) bool {
+	actual := jsonType(value)
+	switch {
+	case typ == actual:
+		return true
+	case typ == "integer":
+		n, ok := value.(lua.LNumber)
+		return ok && float64(n) == math.Trunc(float64(n)) && !math.IsInf(float64(n), 0)
+	case typ == "object" && actual == "array":
+		return isEmptyTable(value)
+	}
+	return false
+}
+
+func isNonEmptyArray(t *lua.LTable) bool {
+	n, array := isArray(t)
+	return array && n > 0
+}
+
+func isEmptyTable(value lua.LValue) bool {
+	t, ok := value.(*lua.LTable)
+	if !ok {
+		return false
+	}
+	key, _ := t.Next(lua.LNil)
+	return key == lua.LNil
+}
+
+func (s *schema) validate(v *schemaValidator, p path, value lua.LValue) {
+	if s.never {
+		v.fail(p, "not allowed")
+		return
+	}
+	if s.ref != nil {
+		s.ref.validate(v, p, value)
+	}
+	if s.types != nil {
+		matched := false
+		for _, typ := range s.types {
+			if s.hasType(typ, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.fail(p, "expected %s, got %s", strings.Join(s.types, " or "), jsonType(value))
+			return
+		}
+	}
+	if s.enum != nil {
+		found := false
+		for _, e := range s.enum {
+			if deepEqual(e, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.fail(p, "value is not one of the enumerated values")
+		}
+	}
+	if s.constant != nil && !deepEqual(s.constant, value) {
+		v.fail(p, "value does not match const")
+	}
+
+	for _, sub := range s.allOf {
+		sub.validate(v, p, value)
+	}
+	if s.anyOf != nil {
+		matched := false
+		for _, sub := range s.anyOf {
+			if sub.valid(v, p, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.fail(p, "value does not match any schema of anyOf")
+		}
+	}
+	if s.oneOf != nil {
+		matched := 0
+		for _, sub := range s.oneOf {
+			if sub.valid(v, p, value) {
+				matched++
+			}
+		}
+		if matched != 1 {
+			v.fail(p, "value matches %d schemas of oneOf", matched)
+		}
+	}
+	if s.not != nil && s.not.valid(v, p, value) {
+		v.fail(p, "value matches the schema of not")
+	}
+	if s.ifThen != nil {
+		if s.ifThen.valid(v, p, value) {
+			if s.then != nil {
+				s.then.validate(v, p, value)
+			}
+		} else if s.otherwise != nil {
+			s.otherwise.validate(v, p, value)
+		}
+	}
+
+	for _, k := range s.custom {
+		v.custom(p, k, value)
+	}
+
+	switch value := value.(type) {
+	case lua.LNumber:
+		s.validateNumber(v, p, float64(value))
+	case lua.LString:
+		s.validateString(v, p, string(value))
+	case *lua.LTable:
+		if n, array := isArray(value); array {
+			s.validateArray(v, p, value, n)
+		}
+		if n, array := isArray(value); !array || n == 0 {
+			s.validateObject(v, p, value, tableMembers(value))
+		}
+	case *lua.LUserData:
+		switch u := value.Value.(type) {
+		case *Object:
+			s.validateObject(v, p, value, objectMembers(u))
+		case Int64:
+			s.validateNumber(v, p, float64(u))
+		}
+	}
+}
+
+func (s *schema) validateNumber(v *schemaValidator, p path, n float64) {
+	if s.minimum != nil && n < *s.minimum {
+		v.fail(p, "%v is less than the minimum %v", n, *s.minimum)
+	}
+	if s.maximum != nil && n > *s.maximum {
+		v.fail(p, "%v is greater than the maximum %v", n, *s.maximum)
+	}
+	if s.exclusiveMinimum != nil && n <= *s.exclusiveMinimum {
+		v.fail(p, "%v is not greater than %v", n, *s.exclusiveMinimum)
+	}
+	if s.exclusiveMaximum != nil && n >= *s.exclusiveMaximum {
+		v.fail(p, "%v is not less than %v", n, *s.exclusiveMaximum)
+	}
+	if s.multipleOf != nil {
+		if q := n / *s.multipleOf; math.Abs(q-math.Round(q)) > 1e-9 {
+			v.fail(p, "%v is not a multiple of %v", n, *s.multipleOf)
+		}
+	}
+}
+
+func (s *schema) validateString(v *schemaValidator, p path, str string) {
+	n := utf8.RuneCountInString(str)
+	if s.minLength != nil && n < *s.minLength {
+		v.fail(p, "string is shorter than %d characters", *s.minLength)
+	}
+	if s.maxLength != nil && n > *s.maxLength {
+		v.fail(p, "string is longer than %d characters", *s.maxLength)
+	}
+	if s.pattern != nil && !s.pattern.MatchString(str) {
+		v.fail(p, "string does not match the pattern %s", s.pattern)
+	}
+	if s.check != nil && !s.check(str) {
+		v.fail(p, "string is not a valid %s", s.format)
+	}
+}
+
+func (s *schema) validateArray(v *schemaValidator, p path, t *lua.LTable, n int) {
+	if s.minItems != nil && n < *s.minItems {
+		v.fail(p, "array has fewer than %d elements", *s.minItems)
+	}
+	if s.maxItems != nil && n > *s.maxItems {
+		v.fail(p, "array has more than %d elements", *s.maxItems)
+	}
+	for i := 1; i <= n; i++ {
+		elem := t.RawGetInt(i)
+		switch {
+		case i <= len(s.prefixItems):
+			s.prefixItems[i-1].validate(v, p.elem(i-1), elem)
+		case s.items != nil:
+			s.items.validate(v, p.elem(i-1), elem)
+		}
+	}
+	if s.contains != nil {
+		// Without maxContains, counting stops at the first match needed.
+		least, found := 1, 0
+		if s.minContains != nil {
+			least = *s.minContains
+		}
+		for i := 1; i <= n && (found < least || s.maxContains != nil); i++ {
+			if s.contains.valid(v, p.elem(i-1), t.RawGetInt(i)) {
+				found++
+			}
+		}
+		switch {
+		case found < least && least == 1:
+			v.fail(p, "array does not contain a matching element")
+		case found < least:
+			v.fail(p, "array contains fewer than %d matching elements", least)
+		case s.maxContains != nil && found > *s.maxContains:
+			v.fail(p, "array contains more than %d matching elements", *s.maxContains)
+		}
+	}
+	if s.uniqueItems {
+		for i := 1; i <= n; i++ {
+			for j := i + 1; j <= n; j++ {
+				if deepEqual(t.RawGetInt(i), t.RawGetInt(j)) {
+					v.fail(p, "elements %d and %d are equal", i-1, j-1)
+					return
+				}
+			}
+		}
+	}
+}
+
+// schemaMember is a member of an object being validated.
+type schemaMember struct {
+	key   string
+	value lua.LValue
+}
+
+func tableMembers(t *lua.LTable) []schemaMember {
+	var members []schemaMember
+	for _, key := range sortedKeys(t) {
+		members = append(members, schemaMember{key: key, value: t.RawGetString(key)})
+	}
+	return members
+}
+
+func objectMembers(o *Object) []schemaMember {
+	members := make([]schemaMember, len(o.keys))
+	for i, key := range o.keys {
+		members[i] = schemaMember{key: key, value: o.values[i]}
+	}
+	return members
+}
+
+func (s *schema) validateObject(v *schemaValidator, p path, value lua.LValue, members []schemaMember) {
+	if s.minProperties != nil && len(members) < *s.minProperties {
+		v.fail(p, "object has fewer than %d members", *s.minProperties)
+	}
+	if s.maxProperties != nil && len(members) > *s.maxProperties {
+		v.fail(p, "object has more than %d members", *s.maxProperties)
+	}
+	present := make(map[string]bool, len(members))
+	for _, m := range members {
+		present[m.key] = true
+		mp := p.child(m.key)
+		if s.propertyNames != nil && !s.propertyNames.valid(v, mp, lua.LString(m.key)) {
+			v.fail(mp, "invalid member name")
+		}
+		matched := false
+		if sub, ok := s.properties[m.key]; ok {
+			sub.validate(v, mp, m.value)
+			matched = true
+		}
+		for _, ps := range s.patternProperties {
+			if ps.re.MatchString(m.key) {
+				ps.schema.validate(v, mp, m.value)
+				matched = true
+			}
+		}
+		if !matched && s.additionalProperties != nil {
+			if s.additionalProperties.never {
+				v.fail(mp, "unexpected member")
+			} else {
+				s.additionalProperties.validate(v, mp, m.value)
+			}
+		}
+	}
+	for _, key := range s.required {
+		if !present[key] {
+			v.fail(p, "missing member %q", key)
+		}
+	}
+	for _, m := range members {
+		for _, key := range s.dependentRequired[m.key] {
+			if !present[key] {
+				v.fail(p, "missing member %q, required by %q", key, m.key)
+			}
+		}
+	}
+	if s.dependentSchemas != nil {
+		for _, m := range members {
+			if ds, ok := s.dependentSchemas[m.key]; ok {
+				ds.validate(v, p, value)
+			}
+		}
+	}
+}
+
+func registerSchema(L *lua.LState) {
+	mt := L.NewTypeMetatable(schemaTypeName)
+	methods := L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"validate": schemaValidate,
+	})
+	mt.RawSetString("__index", methods)
+}
+
+// schemaLoad returns the function loading the documents referred to by a
+// schema: fn, a Lua function returning a schema or its JSON text, or else
+// the loader of the host, whose documents are cached for the life of the
+// state.
+func (m *module) schemaLoad(L *lua.LState, fn *lua.LFunction) func(string) (lua.LValue, error) {
+	if fn != nil {
+		return func(uri string) (lua.LValue, error) {
+			if err := L.CallByParam(lua.P{Fn: fn, NRet: 2, Protect: true}, lua.LString(uri)); err != nil {
+				return nil, err
+			}
+			doc, msg := L.Get(-2), L.Get(-1)
+			L.Pop(2)
+			if doc == lua.LNil {
+				return nil, errors.New(lua.LVAsString(msg))
+			}
+			if s, ok := doc.(lua.LString); ok {
+				return decodeSchema(L, []byte(s))
+			}
+			return doc, nil
+		}
+	}
+	if m.schemaLoader == nil {
+		return nil
+	}
+	return func(uri string) (lua.LValue, error) {
+		if doc, ok := m.schemas[uri]; ok {
+			return doc, nil
+		}
+		data, err := m.schemaLoader(uri)
+		if err != nil {
+			return nil, err
+		}
+		doc, err := decodeSchema(L, data)
+		if err != nil {
+			return nil, err
+		}
+		if m.schemas == nil {
+			m.schemas = make(map[string]lua.LValue)
+		}
+		m.schemas[uri] = doc
+		return doc, nil
+	}
+}
+
+// decodeSchema decodes the JSON text of a schema, keeping its nulls as
+// json.null so that keywords such as const and enum can hold them.
+func decodeSchema(L *lua.LState, data []byte) (lua.LValue, error) {
+	return DecodeWithOptions(L, data, &DecodeOptions{KeepNulls: true})
+}
+
+// apiSchemaCompile compiles the schema given as a table or a JSON string.
+func (m *module) apiSchemaCompile(L *lua.LState) int {
+	v := L.CheckAny(1)
+	opts := checkOptions(L, 2)
+	if s, ok := v.(lua.LString); ok {
+		decoded, err := decodeSchema(L, []byte(s))
+		if err != nil {
+			L.ArgError(1, err.Error())
+		}
+		v = decoded
+	}
+
+	c := newSchemaCompiler(L, m.schemaLoad(L, opts.function("loader")))
+	c.formats = opts.bool("formats", false)
+	c.keywords = m.keywords
+	s, err := c.compileRoot(v, opts.string("base_uri", ""))
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	ud := L.NewUserData()
+	ud.Value = s
+	ud.Metatable = L.GetTypeMetatable(schemaTypeName)
+	L.Push(ud)
+	return 1
+}
+
+func schemaValidate(L *lua.LState) int {
+	ud := L.CheckUserData(1)
+	s, ok := ud.Value.(*schema)
+	if !ok {
+		L.ArgError(1, "json schema expected")
+	}
+	v := schemaValidator{L: L}
+	s.validate(&v, nil, L.CheckAny(2))
+	if len(v.errors) == 0 {
+		L.Push(lua.LTrue)
+		return 1
+	}
+	objects := checkOptions(L, 3).bool("error_object", false)
+	errs := L.CreateTable(len(v.errors), 0)
+	for _, e := range v.errors {
+		if !objects {
+			errs.Append(lua.LString(e.String()))
+			continue
+		}
+		t := newError(L, "schema", e.String())
+		t.RawSetString("path", lua.LString(e.path.String()))
+		t.RawSetString("pointer", lua.LString(e.path.pointer().String()))
+		t.RawSetString("reason", lua.LString(e.msg))
+		errs.Append(t)
+	}
+	L.Push(lua.LFalse)
+	L.Push(errs)
+	return 2
+}
+
+// apiSchemaRegisterKeyword registers fn as the validator of the custom
+// keyword name in the schemas compiled afterwards.
+func (m *module) apiSchemaRegisterKeyword(L *lua.LState) int {
+	name := L.CheckString(1)
+	fn := L.CheckFunction(2)
+	if schemaKeywords[name] {
+		L.ArgError(1, "cannot redefine the keyword "+name)
+	}
+	if m.keywords == nil {
+		m.keywords = make(map[string]*lua.LFunction)
+	}
+	m.keywords[name] = fn
+	return 0
+}
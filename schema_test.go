@@ -0,0 +1,243 @@
+package json
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestSchema(t *testing.T) {
+	tests := []struct {
+		schema, doc string
+		errors      int
+	}{
+		{`{"type":"string"}`, `"x"`, 0},
+		{`{"type":"string"}`, `1`, 1},
+		{`{"type":["integer","null"]}`, `1.5`, 1},
+		{`{"type":"object"}`, `{}`, 0},
+		{`{"enum":["a","b"]}`, `"c"`, 1},
+		{`{"const":{"a":[1]}}`, `{"a":[1]}`, 0},
+		{`{"const":null}`, `5`, 1},
+		{`{"const":null}`, `null`, 0},
+		{`{"enum":[1,null]}`, `null`, 0},
+		{`{"enum":[1,null]}`, `2`, 1},
+		{`{"minimum":1,"exclusiveMaximum":3,"multipleOf":0.5}`, `3`, 1},
+		{`{"minLength":2,"maxLength":3,"pattern":"^a"}`, `"bcde"`, 2},
+		{`{"minLength":2}`, `"é"`, 1},
+		{`{"items":{"type":"number"},"maxItems":2,"uniqueItems":true}`, `[1,1,"x"]`, 3},
+		{`{"prefixItems":[{"type":"string"}],"items":false}`, `["a",1]`, 1},
+		{`{"items":[{"type":"string"}],"additionalItems":{"type":"number"}}`, `["a",1,2]`, 0},
+		{`{"contains":{"const":2}}`, `[1,3]`, 1},
+		{`{"properties":{"a":{"type":"number"}},"required":["a","b"],"additionalProperties":false}`, `{"a":"x","c":1}`, 3},
+		{`{"patternProperties":{"^x-":{"type":"string"}},"additionalProperties":{"type":"number"}}`, `{"x-a":"s","b":1}`, 0},
+		{`{"propertyNames":{"maxLength":2},"minProperties":2}`, `{"abc":1}`, 2},
+		{`{"contains":{"type":"number"},"minContains":2,"maxContains":3}`, `[1,"a"]`, 1},
+		{`{"contains":{"type":"number"},"maxContains":1}`, `[1,2]`, 1},
+		{`{"contains":{"type":"number"},"minContains":0}`, `["a"]`, 0},
+		{`{"dependentRequired":{"a":["b","c"]}}`, `{"a":1,"c":1}`, 1},
+		{`{"dependentSchemas":{"a":{"required":["b"]}}}`, `{"b":1}`, 0},
+		{`{"dependentSchemas":{"a":{"properties":{"b":{"type":"string"}}}}}`, `{"a":1,"b":1}`, 1},
+		{`{"dependencies":{"a":["b"],"c":{"maxProperties":1}}}`, `{"a":1,"c":1}`, 2},
+		{`{"anyOf":[{"type":"string"},{"type":"number"}]}`, `true`, 1},
+		{`{"oneOf":[{"type":"number"},{"type":"integer"}]}`, `1`, 1},
+		{`{"not":{"type":"null"},"allOf":[{"minimum":0}]}`, `-1`, 1},
+		{`{"if":{"type":"number"},"then":{"minimum":0},"else":{"type":"string"}}`, `true`, 1},
+		{`{"$defs":{"node":{"type":"object","properties":{"next":{"$ref":"#/$defs/node"}}}},"$ref":"#/$defs/node"}`, `{"next":{"next":{"next":1}}}`, 1},
+		{`false`, `1`, 1},
+		{`true`, `1`, 0},
+	}
+	for _, test := range tests {
+		s := lua.NewState()
+		v, _ := decodeSchema(s, []byte(test.schema))
+		compiled, err := newSchemaCompiler(s, nil).compileRoot(v, "")
+		if err != nil {
+			t.Fatalf("%s: %v", test.schema, err)
+		}
+		doc, _ := Decode(s, []byte(test.doc))
+		var validator schemaValidator
+		compiled.validate(&validator, nil, doc)
+		if len(validator.errors) != test.errors {
+			t.Fatalf("%s, %s: expecting %d errors, got %q", test.schema, test.doc, test.errors, validator.errors)
+		}
+		s.Close()
+	}
+}
+
+func TestSchemaErrors(t *testing.T) {
+	tests := []struct {
+		schema, err string
+	}{
+		{`{"type":"text"}`, `#/type: unknown type "text"`},
+		{`{"minLength":-1}`, `#/minLength: must be a non-negative integer`},
+		{`{"properties":{"a":{"pattern":"("}}}`, "#/properties/a/pattern: error parsing regexp: missing closing ): `(`"},
+		{`{"$ref":"#/$defs/missing"}`, `#/$ref: #/$defs/missing: member $defs not found`},
+		{`{"$ref":"other.json"}`, `#/$ref: cannot load other.json: no schema loader`},
+		{`1`, `#: schema must be an object or a boolean`},
+		{`{"$ref":"#"}`, `#: reference cycle validating the same value`},
+		{`{"$defs":{"a":{"$ref":"#/$defs/b"},"b":{"allOf":[{"$ref":"#/$defs/a"}]}},"properties":{"x":{"$ref":"#/$defs/a"}}}`, `#/$defs/a: reference cycle validating the same value`},
+	}
+	for _, test := range tests {
+		s := lua.NewState()
+		v, _ := decodeSchema(s, []byte(test.schema))
+		_, err := newSchemaCompiler(s, nil).compileRoot(v, "")
+		if err == nil || err.Error() != test.err {
+			t.Fatalf("%s: expecting error %s, got %v", test.schema, test.err, err)
+		}
+		s.Close()
+	}
+}
+
+func TestSchemaLoader(t *testing.T) {
+	loads := 0
+	loader := func(uri string) ([]byte, error) {
+		loads++
+		switch uri {
+		case "https://example.com/schemas/name.json":
+			return []byte(`{"type":"string","minLength":1}`), nil
+		case "https://example.com/schemas/defs.json":
+			return []byte(`{"$defs":{"port":{"type":"integer","maximum":65535}}}`), nil
+		}
+		return nil, errors.New("not found")
+	}
+	const str = `
+	local json = require("json")
+	local schema = {
+		["$id"] = "https://example.com/schemas/service.json",
+		properties = {
+			name = {["$ref"] = "name.json"},
+			port = {["$ref"] = "defs.json#/$defs/port"},
+		},
+	}
+	for i = 1, 2 do
+		local s = assert(json.schema_compile(schema))
+		assert(s:validate({name = "api", port = 80}))
+		local ok, errs = s:validate({name = "", port = 70000})
+		assert(not ok and #errs == 2)
+		assert(errs[1] == "$.name: string is shorter than 1 characters")
+		assert(errs[2] == "$.port: 70000 is greater than the maximum 65535")
+	end
+
+	local s, err = json.schema_compile({["$ref"] = "missing.json"}, {base_uri = "https://example.com/"})
+	assert(s == nil and err == "https://example.com/#/$ref: cannot load https://example.com/missing.json: not found")
+
+	local uris = {}
+	local s = assert(json.schema_compile('{"items":{"$ref":"mem:item"}}', {
+		loader = function(uri)
+			table.insert(uris, uri)
+			if uri == "mem:item" then
+				return '{"type":"boolean"}'
+			end
+			return nil, "unknown"
+		end,
+	}))
+	assert(#uris == 1 and uris[1] == "mem:item")
+	assert(s:validate({true, false}))
+	local ok, errs = s:validate({true, 1})
+	assert(not ok and errs[1] == "$[1]: expected boolean, got number")
+
+	local s = assert(json.schema_compile('{"properties":{"a":{"const":null},"b":{"$ref":"mem:b"}}}', {
+		loader = function(uri)
+			return '{"enum":[1,null]}'
+		end,
+	}))
+	assert(s:validate({a = json.null, b = json.null}))
+	assert(s:validate({b = 1}))
+	local ok, errs = s:validate({a = 5, b = 2})
+	assert(not ok and #errs == 2)
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s, WithSchemaLoader(loader))
+	if err := s.DoString(str); err != nil {
+		t.Fatal(err)
+	}
+	if loads != 3 {
+		t.Fatalf("expecting 3 loads, got %d", loads)
+	}
+}
+
+func TestSchemaCustomKeywords(t *testing.T) {
+	const str = `
+	local json = require("json")
+	json.schema_register_keyword("x-range", function(value, range, path)
+		if type(value) ~= "number" then
+			return true
+		end
+		if value < range[1] or value > range[2] then
+			return false, string.format("%s is outside [%d, %d]", path, range[1], range[2])
+		end
+		return true
+	end)
+	json.schema_register_keyword("x-even", function(value)
+		return value % 2 == 0
+	end)
+
+	local s = assert(json.schema_compile({
+		properties = {
+			port = {["x-range"] = {1, 1024}},
+			count = {["x-even"] = true},
+		},
+	}))
+	assert(s:validate({port = 80, count = 2}))
+	local ok, errs = s:validate({port = 8080, count = 3})
+	assert(not ok and #errs == 2)
+	assert(errs[1] == "$.count: value does not satisfy x-even")
+	assert(errs[2] == "$.port: $.port is outside [1, 1024]")
+
+	local ok, err = pcall(s.validate, s, {count = "x"})
+	assert(not ok and string.find(err, "cannot perform mod"))
+	assert(not pcall(json.schema_register_keyword, "minimum", function() end))
+	assert(not pcall(json.schema_register_keyword, "dependentRequired", function() end))
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSchemaErrorObjects(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local s = assert(json.schema_compile('{"properties": {"a/b": {"items": {"type": "string"}}}, "required": ["id"]}'))
+	local ok, errs = s:validate({["a/b"] = {"x", 1}}, {error_object = true})
+	assert(not ok and #errs == 2)
+	assert(errs[1].pointer == "/a~1b/1", errs[1].pointer)
+	assert(errs[1].path == '$["a/b"][1]' and errs[1].reason == "expected string, got number")
+	assert(errs[1].kind == "schema" and tostring(errs[1]) == '$["a/b"][1]: expected string, got number')
+	assert(errs[2].pointer == "" and errs[2].reason == 'missing member "id"')
+	assert(s:validate({id = 1}, {error_object = true}))
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSchemaRecursion(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local tree = assert(json.schema_compile('{"type":"object","properties":{"children":{"type":"array","items":{"$ref":"#"}}},"allOf":[{"$ref":"#/$defs/named"}],"$defs":{"named":{"required":["name"]}}}'))
+	assert(tree:validate({name = "a", children = {{name = "b", children = {{name = "c"}}}}}))
+	assert(not tree:validate({name = "a", children = {{children = {}}}}))
+
+	local _, err = json.schema_compile('{"$ref":"#"}')
+	assert(err == "#: reference cycle validating the same value", err)
+	_, err = json.schema_compile('{"anyOf":[{"$ref":"#/$defs/b"}],"$defs":{"b":{"not":{"$ref":"#"}}}}')
+	assert(err ~= nil)
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
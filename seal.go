@@ -0,0 +1,150 @@
+package json
+
+import (
+	"fmt"
+
+	"github.com/yuin/gopher-lua"
+)
+
+const (
+	sealedObjectTypeName = "json.sealed_object"
+	sealedArrayTypeName  = "json.sealed_array"
+)
+
+func registerSealed(L *lua.LState) {
+	for typeName, typ := range map[string]string{sealedObjectTypeName: "object", sealedArrayTypeName: "array"} {
+		mt := L.NewTypeMetatable(typeName)
+		setSealedFields(L, mt, typ)
+	}
+}
+
+// setSealedFields sets the fields of the metatable of sealed tables of the
+// kind typ.
+func setSealedFields(L *lua.LState, mt *lua.LTable, typ string) {
+	mt.RawSetString("__jsontype", lua.LString(typ))
+	mt.RawSetString("__newindex", L.NewFunction(sealedNewIndex))
+	mt.RawSetString("__metatable", lua.LString("sealed"))
+}
+
+func sealedNewIndex(L *lua.LState) int {
+	L.RaiseError("cannot modify a sealed JSON document")
+	return 0
+}
+
+// sealable reports whether the metatable of a table, if any, may be
+// replaced when it is sealed: only type hints and sealed metatables, which
+// do not change how it encodes, can be. Ordered tables keep theirs.
+func sealable(L *lua.LState, t *lua.LTable) bool {
+	mt, ok := t.Metatable.(*lua.LTable)
+	if !ok {
+		return true
+	}
+	if mt.RawGetString("__jsonsealed") != lua.LNil || mt.RawGetString("__jsonorder") != lua.LNil {
+		return true
+	}
+	for _, name := range []string{"json.object_hint", "json.array_hint", sealedObjectTypeName, sealedArrayTypeName} {
+		if L.GetTypeMetatable(name) == mt {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSealable checks that value, found at path p, holds only values that
+// always encode alike, with tables ancestors being the tables containing it.
+func checkSealable(L *lua.LState, value lua.LValue, p path, ancestors map[*lua.LTable]bool) error {
+	switch v := value.(type) {
+	case *lua.LNilType, lua.LBool, lua.LNumber, lua.LString:
+		return nil
+	case *lua.LUserData:
+		if _, ok := v.Value.(Int64); ok || v == Null {
+			return nil
+		}
+		return fmt.Errorf("cannot seal userdata at %s", p)
+	case *lua.LTable:
+		if ancestors[v] {
+			return fmt.Errorf("cannot seal cyclic table at %s", p)
+		}
+		if !sealable(L, v) {
+			return fmt.Errorf("cannot seal table with a metatable at %s", p)
+		}
+		ancestors[v] = true
+		defer delete(ancestors, v)
+		var err error
+		v.ForEach(func(key, elem lua.LValue) {
+			if err != nil {
+				return
+			}
+			switch key := key.(type) {
+			case lua.LNumber:
+				err = checkSealable(L, elem, p.elem(int(key)-1), ancestors)
+			default:
+				err = checkSealable(L, elem, p.child(lua.LVAsString(key)), ancestors)
+			}
+		})
+		return err
+	}
+	return fmt.Errorf("cannot seal %s at %s", value.Type(), p)
+}
+
+// seal sets the sealed metatables on the tables of value.
+func seal(L *lua.LState, value lua.LValue) {
+	t, ok := value.(*lua.LTable)
+	if !ok {
+		return
+	}
+	typeName := sealedObjectTypeName
+	if n, array := isArray(t); array && (n > 0 || !isEmptyObject(t)) {
+		typeName = sealedArrayTypeName
+	}
+	if memberOrder(t) != nil {
+		setSealedFields(L, t.Metatable.(*lua.LTable), "object")
+	} else {
+		t.Metatable = L.GetTypeMetatable(typeName)
+	}
+	t.ForEach(func(_, elem lua.LValue) {
+		seal(L, elem)
+	})
+}
+
+// sealedText returns the encoding cached by json.seal for value.
+func sealedText(value lua.LValue) (lua.LString, bool) {
+	t, ok := value.(*lua.LTable)
+	if !ok {
+		return "", false
+	}
+	mt, ok := t.Metatable.(*lua.LTable)
+	if !ok {
+		return "", false
+	}
+	text, ok := mt.RawGetString("__jsonsealed").(lua.LString)
+	return text, ok
+}
+
+// apiSeal checks that a table is encodable, makes it and the tables it
+// contains read-only and caches its encoding for json.encode.
+func (m *module) apiSeal(L *lua.LState) int {
+	t := L.CheckTable(1)
+	if err := checkSealable(L, t, nil, make(map[*lua.LTable]bool)); err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	opts, _ := checkEncodeOptions(L, 2, m.encode)
+	data, err := EncodeWithOptions(t, &opts)
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	seal(L, t)
+	// The root has a metatable of its own, holding its encoding.
+	mt := L.CreateTable(0, 4)
+	t.Metatable.(*lua.LTable).ForEach(func(key, value lua.LValue) {
+		mt.RawSet(key, value)
+	})
+	mt.RawSetString("__jsonsealed", lua.LString(data))
+	t.Metatable = mt
+	L.Push(t)
+	return 1
+}
@@ -0,0 +1,48 @@
+package json
+
+import (
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestSeal(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local doc = {name = "api", tags = {}, meta = json.object(), list = {1, {x = true}}, id = json.int64("9007199254740993")}
+	assert(json.seal(doc) == doc)
+	local text = json.encode(doc)
+	assert(text == '{"id":9007199254740993,"list":[1,{"x":true}],"meta":{},"name":"api","tags":[]}', text)
+	assert(json.encode(doc) == text)
+	assert(json.encode({doc = doc}) == '{"doc":' .. text .. '}')
+	assert(json.encode(doc, {indent = " "}) ~= text)
+	assert(getmetatable(doc) == "sealed")
+
+	assert(not pcall(function() doc.extra = 1 end))
+	assert(not pcall(function() doc.list[2].y = 1 end))
+	assert(not pcall(function() doc.tags[1] = "x" end))
+	assert(not pcall(setmetatable, doc, nil))
+	assert(json.seal({wrapped = doc}))
+
+	local _, err = json.seal({f = print})
+	assert(err == "cannot seal function at $.f", err)
+	local loop = {}
+	loop[1] = {loop}
+	_, err = json.seal(loop)
+	assert(err == "cannot seal cyclic table at $[0][0]", err)
+	_, err = json.seal({a = setmetatable({}, {})})
+	assert(err == "cannot seal table with a metatable at $.a", err)
+	_, err = json.seal({[true] = 1})
+	assert(err ~= nil)
+
+	local pretty = assert(json.seal({b = 1, a = {1}}, {indent = "  "}))
+	assert(json.encode(pretty) == '{\n  "a": [\n    1\n  ],\n  "b": 1\n}')
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
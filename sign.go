@@ -0,0 +1,328 @@
+package json
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/yuin/gopher-lua"
+)
+
+const keyTypeName = "json.key"
+
+// Key is a key used by json.sign and json.verify. Hosts pass keys to scripts
+// as the userdata returned by NewKey, so that scripts can sign and verify
+// documents without reading the key material.
+type Key struct {
+	// ID, when non-empty, is written to the kid header of signatures.
+	ID string
+	// Key is a []byte secret for the HS256, HS384 and HS512 algorithms, an
+	// *rsa.PrivateKey for RS256, RS384 and RS512, an *ecdsa.PrivateKey for
+	// ES256, ES384 and ES512, or an ed25519.PrivateKey for EdDSA. The
+	// corresponding public keys can only verify signatures.
+	Key interface{}
+}
+
+// NewKey returns userdata holding k, to be passed to scripts.
+func NewKey(L *lua.LState, k *Key) (*lua.LUserData, error) {
+	switch k.Key.(type) {
+	case []byte, *rsa.PrivateKey, *rsa.PublicKey, *ecdsa.PrivateKey, *ecdsa.PublicKey,
+		ed25519.PrivateKey, ed25519.PublicKey:
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", k.Key)
+	}
+	ud := L.NewUserData()
+	ud.Value = k
+	ud.Metatable = registerKey(L)
+	return ud, nil
+}
+
+// registerKey returns the metatable of keys, which hosts may create before
+// the module is loaded.
+func registerKey(L *lua.LState) *lua.LTable {
+	mt := L.NewTypeMetatable(keyTypeName)
+	mt.RawSetString("__tostring", L.NewFunction(keyString))
+	return mt
+}
+
+func checkSigningKey(L *lua.LState, n int) *Key {
+	ud := L.CheckUserData(n)
+	k, ok := ud.Value.(*Key)
+	if !ok {
+		L.ArgError(n, "json key expected")
+	}
+	return k
+}
+
+// keyString describes a key without revealing it.
+func keyString(L *lua.LState) int {
+	k := checkSigningKey(L, 1)
+	if k.ID == "" {
+		L.Push(lua.LString(keyTypeName))
+	} else {
+		L.Push(lua.LString(keyTypeName + " " + k.ID))
+	}
+	return 1
+}
+
+// signingAlg is a JWS algorithm of RFC 7518.
+type signingAlg struct {
+	hash crypto.Hash
+	// kind is "hmac", "rsa", "ecdsa" or "ed25519".
+	kind string
+	// size is the size of each of the two halves of ECDSA signatures.
+	size int
+}
+
+var signingAlgs = map[string]signingAlg{
+	"HS256": {crypto.SHA256, "hmac", 0},
+	"HS384": {crypto.SHA384, "hmac", 0},
+	"HS512": {crypto.SHA512, "hmac", 0},
+	"RS256": {crypto.SHA256, "rsa", 0},
+	"RS384": {crypto.SHA384, "rsa", 0},
+	"RS512": {crypto.SHA512, "rsa", 0},
+	"ES256": {crypto.SHA256, "ecdsa", 32},
+	"ES384": {crypto.SHA384, "ecdsa", 48},
+	"ES512": {crypto.SHA512, "ecdsa", 66},
+	"EdDSA": {0, "ed25519", 0},
+}
+
+var errKeyMismatch = errors.New("key cannot be used with the algorithm")
+
+func (a signingAlg) digest(input []byte) []byte {
+	h := a.hash.New()
+	h.Write(input)
+	return h.Sum(nil)
+}
+
+// sign returns the signature of input.
+func (a signingAlg) sign(key interface{}, input []byte) ([]byte, error) {
+	switch key := key.(type) {
+	case []byte:
+		if a.kind == "hmac" {
+			mac := hmac.New(a.hash.New, key)
+			mac.Write(input)
+			return mac.Sum(nil), nil
+		}
+	case *rsa.PrivateKey:
+		if a.kind == "rsa" {
+			return rsa.SignPKCS1v15(rand.Reader, key, a.hash, a.digest(input))
+		}
+	case *ecdsa.PrivateKey:
+		if a.kind == "ecdsa" && (key.Curve.Params().BitSize+7)/8 == a.size {
+			r, s, err := ecdsa.Sign(rand.Reader, key, a.digest(input))
+			if err != nil {
+				return nil, err
+			}
+			sig := make([]byte, 2*a.size)
+			r.FillBytes(sig[:a.size])
+			s.FillBytes(sig[a.size:])
+			return sig, nil
+		}
+	case ed25519.PrivateKey:
+		if a.kind == "ed25519" {
+			return ed25519.Sign(key, input), nil
+		}
+	}
+	return nil, errKeyMismatch
+}
+
+// verify checks the signature of input. Private keys verify with their
+// public part.
+func (a signingAlg) verify(key interface{}, input, sig []byte) error {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		key = &k.PublicKey
+	case *ecdsa.PrivateKey:
+		key = &k.PublicKey
+	case ed25519.PrivateKey:
+		key = k.Public()
+	}
+	valid := false
+	switch key := key.(type) {
+	case []byte:
+		if a.kind != "hmac" {
+			return errKeyMismatch
+		}
+		mac := hmac.New(a.hash.New, key)
+		mac.Write(input)
+		valid = hmac.Equal(sig, mac.Sum(nil))
+	case *rsa.PublicKey:
+		if a.kind != "rsa" {
+			return errKeyMismatch
+		}
+		valid = rsa.VerifyPKCS1v15(key, a.hash, a.digest(input), sig) == nil
+	case *ecdsa.PublicKey:
+		if a.kind != "ecdsa" || (key.Curve.Params().BitSize+7)/8 != a.size {
+			return errKeyMismatch
+		}
+		if len(sig) == 2*a.size {
+			r := new(big.Int).SetBytes(sig[:a.size])
+			s := new(big.Int).SetBytes(sig[a.size:])
+			valid = ecdsa.Verify(key, a.digest(input), r, s)
+		}
+	case ed25519.PublicKey:
+		if a.kind != "ed25519" {
+			return errKeyMismatch
+		}
+		valid = ed25519.Verify(key, input, sig)
+	default:
+		return errKeyMismatch
+	}
+	if !valid {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+var b64 = base64.RawURLEncoding
+
+// Sign returns the compact JWS serialization of payload signed with k using
+// the algorithm alg. The payload is left out of the result when detached is
+// set, as in RFC 7515 appendix F.
+func Sign(payload []byte, k *Key, alg string, detached bool) (string, error) {
+	a, ok := signingAlgs[alg]
+	if !ok {
+		return "", fmt.Errorf("unknown algorithm %s", alg)
+	}
+	header := map[string]string{"alg": alg}
+	if k.ID != "" {
+		header["kid"] = k.ID
+	}
+	data, _ := json.Marshal(header)
+	input := b64.EncodeToString(data) + "." + b64.EncodeToString(payload)
+	sig, err := a.sign(k.Key, []byte(input))
+	if err != nil {
+		return "", err
+	}
+	if detached {
+		input = input[:strings.IndexByte(input, '.')+1]
+	}
+	return input + "." + b64.EncodeToString(sig), nil
+}
+
+// Verify checks the compact JWS serialization jws with k and returns its
+// payload and protected header. A detached payload must be passed as
+// payload; otherwise, when payload is non-nil, it must be the payload of
+// jws. Headers listing critical extensions, which are not supported, fail
+// the verification.
+func Verify(jws string, k *Key, payload []byte) ([]byte, map[string]interface{}, error) {
+	parts := strings.Split(jws, ".")
+	if len(parts) != 3 {
+		return nil, nil, errors.New("invalid JWS: expecting three parts")
+	}
+	header, err := decodeJWSHeader(parts[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, ok := header["crit"]; ok {
+		return nil, nil, errors.New("unsupported critical header parameters")
+	}
+	alg, _ := header["alg"].(string)
+	a, ok := signingAlgs[alg]
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	sig, err := b64.DecodeString(parts[2])
+	if err != nil {
+		return nil, nil, errors.New("invalid JWS signature encoding")
+	}
+	switch {
+	case parts[1] == "" && payload == nil:
+		return nil, nil, errors.New("detached payload required")
+	case parts[1] != "":
+		attached, err := b64.DecodeString(parts[1])
+		if err != nil {
+			return nil, nil, errors.New("invalid JWS payload encoding")
+		}
+		if payload != nil && !bytes.Equal(payload, attached) {
+			return nil, nil, errors.New("payload does not match")
+		}
+		payload = attached
+	}
+	input := parts[0] + "." + b64.EncodeToString(payload)
+	if err := a.verify(k.Key, []byte(input), sig); err != nil {
+		return nil, nil, err
+	}
+	return payload, header, nil
+}
+
+// decodeJWSHeader decodes the protected header of a JWS, the first of its
+// parts.
+func decodeJWSHeader(part string) (map[string]interface{}, error) {
+	data, err := b64.DecodeString(part)
+	if err != nil {
+		return nil, errors.New("invalid JWS header encoding")
+	}
+	var header map[string]interface{}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, errors.New("invalid JWS header")
+	}
+	return header, nil
+}
+
+// canonicalJSON returns the encoding of value with sorted keys.
+func canonicalJSON(L *lua.LState, value lua.LValue) ([]byte, error) {
+	return EncodeWithOptions(canonicalize(L, value, nil, nil), &EncodeOptions{SortKeys: true})
+}
+
+// apiSign returns the JWS of the canonical encoding of a value.
+func apiSign(L *lua.LState) int {
+	value := L.CheckAny(1)
+	k := checkSigningKey(L, 2)
+	alg := L.CheckString(3)
+	if _, ok := signingAlgs[alg]; !ok {
+		L.ArgError(3, "unknown algorithm "+alg)
+	}
+	opts := checkOptions(L, 4)
+
+	payload, err := canonicalJSON(L, value)
+	if err == nil {
+		var jws string
+		if jws, err = Sign(payload, k, alg, opts.bool("detached", false)); err == nil {
+			L.Push(lua.LString(jws))
+			return 1
+		}
+	}
+	L.Push(lua.LNil)
+	L.Push(lua.LString(err.Error()))
+	return 2
+}
+
+// apiVerify checks a JWS and returns its decoded payload and header.
+func apiVerify(L *lua.LState) int {
+	jws := L.CheckString(1)
+	k := checkSigningKey(L, 2)
+
+	var payload []byte
+	var err error
+	if L.Get(3) != lua.LNil {
+		payload, err = canonicalJSON(L, L.Get(3))
+	}
+	var header map[string]interface{}
+	if err == nil {
+		payload, header, err = Verify(jws, k, payload)
+	}
+	var value lua.LValue
+	if err == nil {
+		value, err = Decode(L, payload)
+	}
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	L.Push(value)
+	L.Push(DecodeValue(L, header))
+	return 2
+}
@@ -0,0 +1,100 @@
+package json
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestSignVerify(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local event = {type = "login", user = {id = 7, name = "ann"}}
+
+	local jws = json.sign(event, secret, "HS256")
+	local payload, header = json.verify(jws, secret)
+	assert(payload.user.name == "ann" and header.alg == "HS256" and header.kid == "k1")
+	assert(jws:match("^[^.]+%.([^.]+)%.") ~= nil)
+
+	for _, case in ipairs({{ec, "ES256"}, {ed, "EdDSA"}, {rsa, "RS256"}}) do
+		local jws, err = json.sign(event, case[1], case[2])
+		assert(jws, err)
+		assert(json.verify(jws, case[1]).type == "login")
+	end
+
+	local detached = json.sign(event, secret, "HS512", {detached = true})
+	assert(detached:find("..", 1, true))
+	local _, err = json.verify(detached, secret)
+	assert(err == "detached payload required", err)
+	assert(json.verify(detached, secret, {user = {name = "ann", id = 7}, type = "login"}))
+	_, err = json.verify(detached, secret, {type = "logout"})
+	assert(err == "invalid signature", err)
+
+	_, err = json.verify(jws, other)
+	assert(err == "invalid signature", err)
+	_, err = json.verify(jws, ec)
+	assert(err == "key cannot be used with the algorithm", err)
+	_, err = json.sign(event, ec, "ES384")
+	assert(err == "key cannot be used with the algorithm", err)
+	_, err = json.verify(jws, secret, {type = "logout"})
+	assert(err == "payload does not match", err)
+	_, err = json.verify("eyJhbGciOiJub25lIn0.e30.", secret)
+	assert(err == 'unsupported algorithm "none"', err)
+
+	assert(not pcall(json.sign, event, secret, "HS1"))
+	assert(not pcall(json.sign, event, {}, "HS256"))
+	assert(tostring(secret) == "json.key k1")
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	for name, k := range map[string]*Key{
+		"secret": {ID: "k1", Key: []byte("0123456789abcdef0123456789abcdef")},
+		"other":  {ID: "k1", Key: []byte("fedcba9876543210fedcba9876543210")},
+		"ec":     {Key: ecKey},
+		"ed":     {Key: edKey},
+		"rsa":    {Key: rsaKey},
+	} {
+		ud, err := NewKey(s, k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.SetGlobal(name, ud)
+	}
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNewKeyUnsupported(t *testing.T) {
+	s := lua.NewState()
+	defer s.Close()
+
+	if _, err := NewKey(s, &Key{Key: "secret"}); err == nil {
+		t.Error("expecting an error for a string key")
+	}
+}
+
+func TestVerifyPublicKey(t *testing.T) {
+	priv, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	jws, err := Sign([]byte(`{"a":1}`), &Key{Key: priv}, "ES384", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, header, err := Verify(jws, &Key{Key: &priv.PublicKey}, nil)
+	if err != nil || string(payload) != `{"a":1}` || header["alg"] != "ES384" {
+		t.Errorf("got %q, %v, %v", payload, header, err)
+	}
+	if _, err := Sign(nil, &Key{Key: &priv.PublicKey}, "ES384", false); err == nil {
+		t.Error("expecting public keys not to sign")
+	}
+}
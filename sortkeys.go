@@ -0,0 +1,19 @@
+package json
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// sortKeys returns the JSON text data, compacted like the output of
+// encoding/json, with the members of every object sorted by key, for the
+// SortKeys option. Numbers keep their text.
+func sortKeys(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
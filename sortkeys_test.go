@@ -0,0 +1,42 @@
+package json
+
+import (
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestSortKeys(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local doc = json.decode_opaque('{"b": 1.50, "a": {"d": [2], "c": "<x>"}}')
+	assert(json.encode({doc = doc}) == '{"doc":{"b":1.50,"a":{"d":[2],"c":"\\u003cx\\u003e"}}}')
+	assert(json.encode({doc = doc}, {sort_keys = true}) == '{"doc":{"a":{"c":"\\u003cx\\u003e","d":[2]},"b":1.50}}')
+	assert(json.encode({doc = doc}, {sort_keys = true, max_depth = 8}) == '{"doc":{"a":{"c":"\\u003cx\\u003e","d":[2]},"b":1.50}}')
+	assert(json.hash(json.decode_opaque('{"b": 1, "a": [true]}')) == json.hash({a = {true}, b = 1}))
+
+	local raw = json.encode({r = '{"z": 1, "y": 2}'}, {overrides = {["$.r"] = "raw"}, sort_keys = true})
+	assert(raw == '{"r":{"y":2,"z":1}}', raw)
+
+	local built = json.build(function(b)
+		b:obj(function()
+			b:kv("z", 1)
+			b:obj("m", function() b:kv("y", true) b:kv("x", false) end)
+		end)
+	end, {sort_keys = true})
+	assert(built == '{"m":{"x":false,"y":true},"z":1}', built)
+
+	assert(json.encode({v = point}, {reflect_userdata = true}) == '{"v":{"Y":2,"X":1}}')
+	assert(json.encode({v = point}, {reflect_userdata = true, sort_keys = true}) == '{"v":{"X":1,"Y":2}}')
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	ud := s.NewUserData()
+	ud.Value = struct{ Y, X int }{2, 1}
+	s.SetGlobal("point", ud)
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
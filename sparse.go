@@ -0,0 +1,133 @@
+package json
+
+import (
+	"sort"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// SparseArrays selects how tables whose keys are numbers, but not the
+// sequence 1, 2, ..., n, are encoded.
+type SparseArrays int
+
+const (
+	// SparseError fails the conversion.
+	SparseError SparseArrays = iota
+	// SparseNull encodes an array up to the largest key, with null for the
+	// missing elements. The keys must be positive integers, and the largest
+	// at most maxSparseLen.
+	SparseNull
+	// SparseObject encodes an object whose member names are the keys,
+	// formatted like tostring does.
+	SparseObject
+)
+
+var sparseArraysNames = map[string]SparseArrays{
+	"error":  SparseError,
+	"null":   SparseNull,
+	"object": SparseObject,
+}
+
+// maxSparseLen is the length of the longest array that SparseNull fills, so
+// that a single large key cannot make the output huge.
+const maxSparseLen = 1 << 20
+
+// WithSparseArrays makes json.encode encode sparse arrays with policy, unless
+// scripts pass the sparse option.
+func WithSparseArrays(policy SparseArrays) Option {
+	return func(c *config) {
+		c.encode.SparseArrays = policy
+	}
+}
+
+// sparseLen returns the length of the array that the sparse array t encodes
+// to with SparseNull, failing unless all its keys are valid indexes.
+func sparseLen(t *lua.LTable) (int, error) {
+	n := 0
+	for key, _ := t.Next(lua.LNil); key != lua.LNil; key, _ = t.Next(key) {
+		k, ok := key.(lua.LNumber)
+		if !ok {
+			return 0, invalidKey(key)
+		}
+		if k < 1 || k > maxSparseLen || k != lua.LNumber(int(k)) {
+			return 0, errSparseArray
+		}
+		if int(k) > n {
+			n = int(k)
+		}
+	}
+	return n, nil
+}
+
+// sparseObject returns the members that the sparse array t encodes to with
+// SparseObject, failing unless all its keys are numbers.
+func sparseObject(t *lua.LTable) (map[string]lua.LValue, error) {
+	obj := make(map[string]lua.LValue)
+	for key, value := t.Next(lua.LNil); key != lua.LNil; key, value = t.Next(key) {
+		if key.Type() != lua.LTNumber {
+			return nil, invalidKey(key)
+		}
+		obj[key.String()] = value
+	}
+	return obj, nil
+}
+
+// marshalSparse encodes the sparse array t with the SparseArrays option.
+func (j jsonValue) marshalSparse(t *lua.LTable) ([]byte, error) {
+	if j.state.opts.SparseArrays == SparseObject {
+		members, err := sparseObject(t)
+		if err != nil {
+			return nil, err
+		}
+		obj := make(map[string]jsonValue, len(members))
+		for key, value := range members {
+			obj[key] = j.child(value, key)
+		}
+		return j.marshalObject(obj)
+	}
+	n, err := sparseLen(t)
+	if err != nil {
+		return nil, err
+	}
+	arr := make([]jsonValue, n)
+	for i := range arr {
+		arr[i] = j.elem(t.RawGetInt(i+1), i)
+	}
+	return j.marshalArray(arr)
+}
+
+// sparse appends the encoding of the sparse array t with the SparseArrays
+// option.
+func (e *appendEncoder) sparse(t *lua.LTable) error {
+	if e.opts.SparseArrays == SparseObject {
+		members, err := sparseObject(t)
+		if err != nil {
+			return err
+		}
+		start := len(e.keys)
+		for key := range members {
+			e.keys = append(e.keys, key)
+		}
+		sort.Strings(e.keys[start:])
+		err = e.object(start, len(e.keys), func(key string) lua.LValue {
+			return members[key]
+		})
+		e.keys = e.keys[:start]
+		return err
+	}
+	n, err := sparseLen(t)
+	if err != nil {
+		return err
+	}
+	e.buf = append(e.buf, '[')
+	for i := 1; i <= n; i++ {
+		if i > 1 {
+			e.buf = append(e.buf, ',')
+		}
+		if err := e.value(t.RawGetInt(i)); err != nil {
+			return err
+		}
+	}
+	e.buf = append(e.buf, ']')
+	return nil
+}
@@ -0,0 +1,54 @@
+package json
+
+import (
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestSparseArrays(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local t = {[1] = "a", [3] = "c"}
+
+	local _, err = json.encode(t)
+	assert(err == "cannot encode sparse array", err)
+
+	assert(json.encode(t, {sparse = "null"}) == '["a",null,"c"]')
+	assert(json.encode({[2] = true}, {sparse = "null"}) == '[null,true]')
+	assert(json.encode({x = t}, {sparse = "null", max_depth = 5}) == '{"x":["a",null,"c"]}')
+	_, err = json.encode({[1] = 1, [2.5] = 2}, {sparse = "null"})
+	assert(err == "cannot encode sparse array", err)
+	_, err = json.encode({[1] = 1, [2^21] = 2}, {sparse = "null"})
+	assert(err == "cannot encode sparse array", err)
+
+	assert(json.encode(t, {sparse = "object"}) == '{"1":"a","3":"c"}')
+	assert(json.encode({[-1] = 1, [0.5] = 2}, {sparse = "object", max_depth = 5}) == '{"-1":1,"0.5":2}')
+	_, err = json.encode({[1] = 1, [3] = 3, x = 4}, {sparse = "object"})
+	assert(err == "cannot encode mixed or invalid key types", err)
+
+	assert(not pcall(json.encode, t, {sparse = "fill"}))
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWithSparseArrays(t *testing.T) {
+	const str = `
+	local json = require("json")
+	assert(json.encode({[2] = 2}) == '{"2":2}')
+	assert(json.encode({[2] = 2}, {sparse = "null"}) == '[null,2]')
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s, WithSparseArrays(SparseObject))
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
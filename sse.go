@@ -0,0 +1,106 @@
+package json
+
+import (
+	"bufio"
+	"io"
+	"strings"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// sseReader reads the events of a Server-Sent Events stream.
+type sseReader struct {
+	r *bufio.Reader
+	// id is the last event ID, which carries over to the following events.
+	id    string
+	hasID bool
+}
+
+// sseEvent is an event with its type and data, its data lines joined by
+// newlines.
+type sseEvent struct {
+	typ  string
+	data string
+}
+
+// next returns the next event with data, skipping comments and the events
+// without data lines. It returns io.EOF at the end of the stream; an event
+// left unterminated at the end is discarded, as the specification requires.
+func (s *sseReader) next() (sseEvent, error) {
+	var ev sseEvent
+	var data []string
+	for {
+		line, err := s.r.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return ev, err
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		if line == "" {
+			if data != nil {
+				ev.data = strings.Join(data, "\n")
+				if ev.typ == "" {
+					ev.typ = "message"
+				}
+				return ev, nil
+			}
+			ev = sseEvent{}
+			continue
+		}
+		if err == io.EOF {
+			return ev, err
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "data":
+			data = append(data, value)
+		case "event":
+			ev.typ = value
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				s.id, s.hasID = value, true
+			}
+		}
+	}
+}
+
+// apiSSE returns an iterator over the events of a Server-Sent Events stream,
+// yielding the type, the decoded data and the last event ID of each event.
+func (m *module) apiSSE(L *lua.LState) int {
+	r := checkReader(L, 1)
+	opts, lopts := checkDecodeOptions(L, 2, m.decode)
+	done, stop := lopts.string("done", ""), false
+
+	s := &sseReader{r: bufio.NewReader(r)}
+	n := 0
+	L.Push(L.NewFunction(func(L *lua.LState) int {
+		if stop {
+			return 0
+		}
+		ev, err := s.next()
+		if err == io.EOF {
+			return 0
+		}
+		n++
+		if err != nil {
+			L.RaiseError("event %d: %s", n, err.Error())
+		}
+		if done != "" && ev.data == done {
+			stop = true
+			return 0
+		}
+		value, err := DecodeWithOptions(L, []byte(ev.data), &opts)
+		if err != nil {
+			L.RaiseError("event %d: %s", n, err.Error())
+		}
+		L.Push(lua.LString(ev.typ))
+		L.Push(value)
+		if s.hasID {
+			L.Push(lua.LString(s.id))
+		} else {
+			L.Push(lua.LNil)
+		}
+		return 3
+	}))
+	return 1
+}
@@ -0,0 +1,67 @@
+package json
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestSSE(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local stream = table.concat({
+		": keep-alive",
+		"",
+		'data: {"delta":"Hel"}',
+		"",
+		"event: update",
+		"id: 7",
+		'data: {"delta":',
+		'data:"lo"}',
+		"",
+		"event: ping",
+		"",
+		"data: [1, 2]\r",
+		"\r",
+		"data: [DONE]",
+		"",
+		"data: 1",
+		"",
+	}, "\n")
+
+	local events = {}
+	for event, value, id in json.sse(stream, {done = "[DONE]"}) do
+		events[#events + 1] = {event, value, id}
+	end
+	assert(#events == 3)
+	assert(events[1][1] == "message" and events[1][2].delta == "Hel" and events[1][3] == nil)
+	assert(events[2][1] == "update" and events[2][2].delta == "lo" and events[2][3] == "7")
+	assert(events[3][1] == "message" and events[3][2][2] == 2 and events[3][3] == "7")
+
+	local n = 0
+	for _, value in json.sse("data: null\n\ndata: 2\n\ndata: 3") do
+		n = n + 1
+	end
+	assert(n == 2)
+
+	local ok, err = pcall(function()
+		for _ in json.sse("data: 1\n\ndata: [DONE]\n\n") do end
+	end)
+	assert(not ok and err:find("event 2: ", 1, true), err)
+
+	local total = 0
+	for _, value in json.sse(reader) do
+		total = total + value.n
+	end
+	assert(total == 6)
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	s.SetGlobal("reader", &lua.LUserData{Value: strings.NewReader("data: {\"n\":1}\n\ndata: {\"n\":2}\n\ndata: {\"n\":3}\n\n")})
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,122 @@
+package json
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// DocumentStats describes the size and complexity of a JSON document.
+type DocumentStats struct {
+	Objects    int
+	Arrays     int
+	Strings    int
+	Numbers    int
+	Booleans   int
+	Nulls      int
+	MaxDepth   int
+	LongestKey int
+	Bytes      int
+}
+
+var errTrailingData = errors.New("invalid data after top-level value")
+
+// Stats scans the JSON encoded data and reports its size and complexity,
+// without converting it to Lua values.
+func Stats(data []byte) (DocumentStats, error) {
+	stats := DocumentStats{Bytes: len(data)}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	// inObject records, for each open container, whether it is an object.
+	var inObject []bool
+	expectKey := false
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return DocumentStats{}, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return DocumentStats{}, err
+		}
+		if key, ok := tok.(string); ok && expectKey {
+			if len(key) > stats.LongestKey {
+				stats.LongestKey = len(key)
+			}
+			expectKey = false
+			continue
+		}
+		switch tok := tok.(type) {
+		case json.Delim:
+			switch tok {
+			case '{', '[':
+				if tok == '{' {
+					stats.Objects++
+				} else {
+					stats.Arrays++
+				}
+				inObject = append(inObject, tok == '{')
+				if len(inObject) > stats.MaxDepth {
+					stats.MaxDepth = len(inObject)
+				}
+				expectKey = tok == '{'
+				continue
+			case '}', ']':
+				inObject = inObject[:len(inObject)-1]
+			}
+		case string:
+			stats.Strings++
+		case json.Number:
+			stats.Numbers++
+		case bool:
+			stats.Booleans++
+		case nil:
+			stats.Nulls++
+		}
+		if len(inObject) == 0 {
+			break
+		}
+		expectKey = inObject[len(inObject)-1]
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return DocumentStats{}, errTrailingData
+	}
+	return stats, nil
+}
+
+func (m *module) apiStats(L *lua.LState) int {
+	var data []byte
+	if str, ok := L.Get(1).(lua.LString); ok {
+		data = []byte(str)
+	} else {
+		encoded, err := Encode(L.CheckAny(1))
+		if err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+		data = encoded
+	}
+
+	stats, err := Stats(data)
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	t := L.CreateTable(0, 9)
+	t.RawSetString("objects", lua.LNumber(stats.Objects))
+	t.RawSetString("arrays", lua.LNumber(stats.Arrays))
+	t.RawSetString("strings", lua.LNumber(stats.Strings))
+	t.RawSetString("numbers", lua.LNumber(stats.Numbers))
+	t.RawSetString("booleans", lua.LNumber(stats.Booleans))
+	t.RawSetString("nulls", lua.LNumber(stats.Nulls))
+	t.RawSetString("max_depth", lua.LNumber(stats.MaxDepth))
+	t.RawSetString("longest_key", lua.LNumber(stats.LongestKey))
+	t.RawSetString("bytes", lua.LNumber(stats.Bytes))
+	L.Push(t)
+	return 1
+}
@@ -0,0 +1,54 @@
+package json
+
+import (
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestStats(t *testing.T) {
+	stats, err := Stats([]byte(`{"name":"tim","tags":["a","b"],"nested":{"ok":true,"none":null,"n":1}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := DocumentStats{
+		Objects:    2,
+		Arrays:     1,
+		Strings:    3,
+		Numbers:    1,
+		Booleans:   1,
+		Nulls:      1,
+		MaxDepth:   2,
+		LongestKey: 6,
+		Bytes:      70,
+	}
+	if stats != expected {
+		t.Fatalf("expecting %+v, got %+v", expected, stats)
+	}
+}
+
+func TestStatsLua(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local stats = json.stats({a = {1, 2, {b = "c"}}})
+	assert(stats.objects == 2)
+	assert(stats.arrays == 1)
+	assert(stats.numbers == 2)
+	assert(stats.strings == 1)
+	assert(stats.max_depth == 3)
+	assert(stats.bytes == #json.encode({a = {1, 2, {b = "c"}}}))
+
+	local stats, err = json.stats("[1,")
+	assert(stats == nil and err)
+
+	local stats, err = json.stats("1 2")
+	assert(stats == nil and err)
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,79 @@
+package json
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/yuin/gopher-lua"
+)
+
+var errTableKey = errors.New("cannot encode a table as an object key")
+
+// TableKeys selects how tables used as keys of other tables are encoded.
+type TableKeys int
+
+const (
+	// TableKeysError fails the conversion.
+	TableKeysError TableKeys = iota
+	// TableKeysSkip leaves out the members with such keys.
+	TableKeysSkip
+	// TableKeysJSON uses the JSON encoding of the key, as a string, as the
+	// member name.
+	TableKeysJSON
+)
+
+var tableKeysNames = map[string]TableKeys{
+	"error":  TableKeysError,
+	"skip":   TableKeysSkip,
+	"tojson": TableKeysJSON,
+}
+
+// WithTableKeys makes json.encode encode tables used as keys with policy,
+// unless scripts pass the table_keys option.
+func WithTableKeys(policy TableKeys) Option {
+	return func(c *config) {
+		c.encode.TableKeys = policy
+	}
+}
+
+// invalidKey returns the error for the key of a table that cannot be encoded.
+func invalidKey(key lua.LValue) error {
+	if key.Type() == lua.LTTable {
+		return errTableKey
+	}
+	return errInvalidKeys
+}
+
+// withoutTableKeys returns t, or a copy of it in which the keys that are
+// tables have been dropped or replaced by their encoding, according to the
+// TableKeys option.
+func (j jsonValue) withoutTableKeys(t *lua.LTable) (*lua.LTable, error) {
+	found := false
+	t.ForEach(func(key, _ lua.LValue) {
+		found = found || key.Type() == lua.LTTable
+	})
+	if !found {
+		return t, nil
+	}
+	c := &lua.LTable{Metatable: t.Metatable}
+	var err error
+	t.ForEach(func(key, value lua.LValue) {
+		if err != nil {
+			return
+		}
+		if key.Type() == lua.LTTable {
+			if j.state.opts.TableKeys == TableKeysSkip {
+				j.state.degrade(j.path, "member with a table key left out")
+				return
+			}
+			// Sharing the state rejects keys holding the table itself.
+			var data []byte
+			if data, err = json.Marshal(jsonValue{LValue: key, state: j.state, path: j.path}); err != nil {
+				return
+			}
+			key = lua.LString(data)
+		}
+		c.RawSet(key, value)
+	})
+	return c, err
+}
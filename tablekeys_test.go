@@ -0,0 +1,52 @@
+package json
+
+import (
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestTableKeys(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local t = {a = 1, [{1, 2}] = "pair"}
+
+	local _, err = json.encode(t)
+	assert(err == "cannot encode a table as an object key", err)
+	_, err = json.encode({[{}] = 1})
+	assert(err == "cannot encode a table as an object key", err)
+
+	assert(json.encode(t, {table_keys = "skip"}) == '{"a":1}')
+	assert(json.encode({[{}] = 1}, {table_keys = "skip"}) == '[]')
+	assert(json.encode(t, {table_keys = "tojson"}) == '{"[1,2]":"pair","a":1}')
+	assert(json.encode({[{x = true}] = 1}, {table_keys = "tojson", indent = "  "}) == '{\n  "{\\"x\\":true}": 1\n}')
+
+	local parent = {}
+	parent[{parent}] = 1
+	_, err = json.encode(parent, {table_keys = "tojson"})
+	assert(err == "cannot encode recursively nested tables to JSON", err)
+
+	assert(not pcall(json.encode, t, {table_keys = "string"}))
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWithTableKeys(t *testing.T) {
+	const str = `
+	local json = require("json")
+	assert(json.encode({{[{}] = 1, b = 2}}) == '[{"b":2}]')
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s, WithTableKeys(TableKeysSkip))
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,50 @@
+package json
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// userDataValue returns the value encoded in place of ud: the result of its
+// __tojson metamethod or, failing that, the string returned by __tostring.
+// ok is false when ud has neither.
+func userDataValue(L *lua.LState, ud *lua.LUserData) (value lua.LValue, ok bool, err error) {
+	method := "__tojson"
+	fn := L.GetMetaField(ud, method)
+	if fn == lua.LNil {
+		method = "__tostring"
+		if fn = L.GetMetaField(ud, method); fn == lua.LNil {
+			return nil, false, nil
+		}
+	}
+	if err := L.CallByParam(lua.P{Fn: fn, NRet: 1, Protect: true}, ud); err != nil {
+		return nil, true, fmt.Errorf("%s metamethod failed: %v", method, err)
+	}
+	value = L.Get(-1)
+	L.Pop(1)
+	if _, isString := value.(lua.LString); method == "__tostring" && !isString {
+		return nil, true, errors.New("__tostring metamethod must return a string")
+	}
+	return value, true, nil
+}
+
+// marshalMetamethod encodes the userdata ud through its metamethods, when it
+// has them.
+func (j jsonValue) marshalMetamethod(ud *lua.LUserData) (data []byte, ok bool, err error) {
+	value, ok, err := userDataValue(j.state.opts.State, ud)
+	if !ok || err != nil {
+		return nil, ok, err
+	}
+	if j.state.converting[ud] {
+		return nil, true, errNested
+	}
+	if j.state.converting == nil {
+		j.state.converting = make(map[*lua.LUserData]bool)
+	}
+	j.state.converting[ud] = true
+	defer delete(j.state.converting, ud)
+	data, err = jsonValue{LValue: value, state: j.state, path: j.path}.MarshalJSON()
+	return data, true, err
+}
@@ -0,0 +1,82 @@
+package json
+
+import (
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestUserDataMetamethods(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local function with(mt)
+		local u = newuserdata()
+		setuserdatametatable(u, mt)
+		return u
+	end
+
+	local stamp = with({__tojson = function(u) return {unix = 1700000000} end})
+	assert(json.encode({at = stamp}) == '{"at":{"unix":1700000000}}')
+
+	local decimal = with({__tostring = function(u) return "12.50" end})
+	assert(json.encode({decimal}) == '["12.50"]')
+
+	local both = with({__tojson = function() return 1 end, __tostring = function() return "x" end})
+	assert(json.encode(both) == "1")
+
+	local _, err = json.encode(with({__tostring = function() return 1 end}))
+	assert(err == "__tostring metamethod must return a string", err)
+	_, err = json.encode(with({__tojson = function() error("boom") end}))
+	assert(err:find("^__tojson metamethod failed: "), err)
+
+	local loop = with({})
+	getmetatable(loop).__tojson = function(u) return {u} end
+	_, err = json.encode(loop)
+	assert(err == "cannot encode recursively nested tables to JSON", err)
+
+	local shared = with({__tojson = function() return "s" end})
+	assert(json.encode({shared, shared}) == '["s","s"]')
+
+	_, err = json.encode(with({}))
+	assert(err == "cannot encode userdata to JSON", err)
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	s.SetGlobal("newuserdata", s.NewFunction(func(L *lua.LState) int {
+		L.Push(L.NewUserData())
+		return 1
+	}))
+	s.SetGlobal("setuserdatametatable", s.NewFunction(func(L *lua.LState) int {
+		L.CheckUserData(1).Metatable = L.CheckTable(2)
+		return 0
+	}))
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEncodeWithState(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	ud := L.NewUserData()
+	mt := L.NewTable()
+	mt.RawSetString("__tostring", L.NewFunction(func(L *lua.LState) int {
+		L.Push(lua.LString("2024-01-02"))
+		return 1
+	}))
+	ud.Metatable = mt
+
+	if _, err := Encode(ud); err == nil {
+		t.Fatal("expecting an error without a state")
+	}
+	data, err := EncodeWithOptions(ud, &EncodeOptions{State: L})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `"2024-01-02"` {
+		t.Fatalf("unexpected encoding %s", data)
+	}
+}
@@ -0,0 +1,165 @@
+package json
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// tokenDecoder builds Lua values from the token stream of a json.Decoder, so
+// that values can be inspected, or skipped, as they are parsed.
+type tokenDecoder struct {
+	*decoder
+	dec *json.Decoder
+}
+
+func newTokenDecoder(d *decoder, r io.Reader) *tokenDecoder {
+	dec := json.NewDecoder(r)
+	// Unsafe integers are recognized from their text, before rounding.
+	if d.opts.BigInts != BigIntsFloat || d.opts.WarnUnsafeInts {
+		dec.UseNumber()
+	}
+	return &tokenDecoder{decoder: d, dec: dec}
+}
+
+// read decodes the next value, found at path p.
+func (t *tokenDecoder) read(p path) (lua.LValue, error) {
+	tok, err := t.dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	return t.build(tok, p)
+}
+
+// build decodes the value starting with tok.
+func (t *tokenDecoder) build(tok json.Token, p path) (lua.LValue, error) {
+	switch tok {
+	case json.Delim('{'):
+		if !t.container(p) {
+			return nil, t.err
+		}
+		tbl := t.newObject()
+		seen := t.duplicates()
+		for t.dec.More() {
+			key, err := t.key()
+			if err != nil {
+				return nil, err
+			}
+			var kp path
+			if t.paths {
+				kp = p.child(key)
+			}
+			if !t.member(seen, key, kp) {
+				if t.err != nil {
+					return nil, t.err
+				}
+				tok, err := t.dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				if err := t.skip(tok); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			value, err := t.read(kp)
+			if err != nil {
+				return nil, err
+			}
+			t.setMember(tbl, key, value, kp)
+		}
+		if err := t.end(); err != nil {
+			return nil, err
+		}
+		if value := t.construct(tbl, p); t.err == nil {
+			return value, nil
+		}
+		return nil, t.err
+	case json.Delim('['):
+		if !t.container(p) {
+			return nil, t.err
+		}
+		var arr lua.LValue = t.newTable(true, 0, 0)
+		for i := 0; t.dec.More(); i++ {
+			var ip path
+			if t.paths {
+				ip = p.elem(i)
+			}
+			value, err := t.read(ip)
+			if err != nil {
+				return nil, err
+			}
+			arr = t.appendElem(arr, value, ip)
+		}
+		return arr, t.end()
+	}
+	var value lua.LValue
+	if n, ok := tok.(json.Number); ok {
+		var err error
+		if value, err = t.number(string(n), p); err != nil {
+			return nil, err
+		}
+	} else {
+		value = t.value(tok, p)
+	}
+	if t.enums != nil {
+		value = mapEnum(t.enums, value, p)
+	}
+	return value, t.err
+}
+
+func (t *tokenDecoder) key() (string, error) {
+	tok, err := t.dec.Token()
+	if err != nil {
+		return "", err
+	}
+	return tok.(string), nil
+}
+
+// end consumes the delimiter closing the current container.
+func (t *tokenDecoder) end() error {
+	_, err := t.dec.Token()
+	return err
+}
+
+// skip discards the value starting with tok.
+func (t *tokenDecoder) skip(tok json.Token) error {
+	if tok != json.Delim('{') && tok != json.Delim('[') {
+		return nil
+	}
+	for depth := 1; depth > 0; {
+		tok, err := t.dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+	return nil
+}
+
+// finish checks that nothing but whitespace follows the decoded value.
+func (t *tokenDecoder) finish() error {
+	if _, err := t.dec.Token(); err != io.EOF {
+		if err == nil {
+			err = errTrailingData
+		}
+		return err
+	}
+	return nil
+}
+
+func decodeTokens(d *decoder, data []byte) (lua.LValue, error) {
+	t := newTokenDecoder(d, bytes.NewReader(data))
+	value, err := t.read(nil)
+	if err != nil {
+		return nil, err
+	}
+	return value, t.finish()
+}
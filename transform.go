@@ -0,0 +1,46 @@
+package json
+
+import (
+	"github.com/yuin/gopher-lua"
+)
+
+// mapLeaves returns a copy of value in which every leaf, that is every value
+// that is not a table, is replaced by the result of calling fn with its path
+// and the leaf. Leaves for which fn returns nil are removed.
+func mapLeaves(L *lua.LState, fn lua.LValue, p path, value lua.LValue, visited map[*lua.LTable]bool) lua.LValue {
+	t, ok := value.(*lua.LTable)
+	if !ok {
+		L.Push(fn)
+		L.Push(lua.LString(p.String()))
+		L.Push(value)
+		L.Call(2, 1)
+		ret := L.Get(-1)
+		L.Pop(1)
+		return ret
+	}
+	if visited[t] {
+		L.RaiseError(errNested.Error())
+	}
+	visited[t] = true
+	defer delete(visited, t)
+
+	result := L.CreateTable(0, 0)
+	result.Metatable = t.Metatable
+	if n, array := isArray(t); array {
+		for i := 1; i <= n; i++ {
+			result.Append(mapLeaves(L, fn, p.elem(i-1), t.RawGetInt(i), visited))
+		}
+		return result
+	}
+	t.ForEach(func(key, item lua.LValue) {
+		result.RawSet(key, mapLeaves(L, fn, p.child(lua.LVAsString(key)), item, visited))
+	})
+	return result
+}
+
+func apiMap(L *lua.LState) int {
+	doc := L.CheckAny(1)
+	fn := L.CheckFunction(2)
+	L.Push(mapLeaves(L, fn, nil, doc, make(map[*lua.LTable]bool)))
+	return 1
+}
@@ -0,0 +1,43 @@
+package json
+
+import (
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestMap(t *testing.T) {
+	const str = `
+	local json = require("json")
+	local doc = {name = "tim", tags = {"a", "b"}, nested = {count = 1, secret = "x"}}
+	local seen = {}
+	local out = json.map(doc, function(path, value)
+		seen[path] = true
+		if path == "$.nested.secret" then
+			return nil
+		end
+		if type(value) == "string" then
+			return string.upper(value)
+		end
+		return value + 1
+	end)
+	assert(out ~= doc and out.nested ~= doc.nested)
+	assert(out.name == "TIM" and out.tags[1] == "A" and out.tags[2] == "B")
+	assert(out.nested.count == 2 and out.nested.secret == nil)
+	assert(doc.name == "tim" and doc.nested.secret == "x")
+	assert(seen["$.tags[1]"] and seen["$.nested.count"])
+
+	assert(json.map(3, function(path, v) assert(path == "$") return v * 2 end) == 6)
+
+	local cyclic = {}
+	cyclic.self = cyclic
+	assert(not pcall(json.map, cyclic, function(_, v) return v end))
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,28 @@
+package json
+
+import (
+	"encoding/json"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// apiValid reports whether a string is valid JSON, without decoding it.
+func apiValid(L *lua.LState) int {
+	str := L.CheckString(1)
+	L.Push(lua.LBool(json.Valid([]byte(str))))
+	return 1
+}
+
+// apiTypeOf returns the type of the JSON value in a string from its first
+// byte, without checking the rest, or nil if no value starts there.
+func apiTypeOf(L *lua.LState) int {
+	switch kind := peekKind([]byte(L.CheckString(1))); kind {
+	case "invalid":
+		L.Push(lua.LNil)
+	case "boolean":
+		L.Push(lua.LString("bool"))
+	default:
+		L.Push(lua.LString(kind))
+	}
+	return 1
+}
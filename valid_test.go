@@ -0,0 +1,37 @@
+package json
+
+import (
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestValidTypeOf(t *testing.T) {
+	const str = `
+	local json = require("json")
+	assert(json.valid('{"a": [1, null, true]}'))
+	assert(json.valid(' "x" '))
+	assert(not json.valid('{"a": 1,}'))
+	assert(not json.valid(''))
+	assert(not json.valid('[1] [2]'))
+
+	assert(json.typeof(' {"a": 1}') == "object")
+	assert(json.typeof('\n[1') == "array")
+	assert(json.typeof('"s"') == "string")
+	assert(json.typeof('-1.5') == "number")
+	assert(json.typeof('0') == "number")
+	assert(json.typeof('true') == "bool")
+	assert(json.typeof('false') == "bool")
+	assert(json.typeof('null') == "null")
+	assert(json.typeof('') == nil)
+	assert(json.typeof('  ') == nil)
+	assert(json.typeof('<xml/>') == nil)
+	`
+	s := lua.NewState()
+	defer s.Close()
+
+	Preload(s)
+	if err := s.DoString(str); err != nil {
+		t.Error(err)
+	}
+}
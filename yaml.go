@@ -0,0 +1,461 @@
+package json
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// yamlParser parses the subset of YAML used in front matter: block mappings
+// and sequences, plain, quoted and block scalars, and flow collections on a
+// single line. Anchors, aliases, tags and multiple documents are rejected.
+// Values are returned as encoding/json decodes them, with mapping keys as
+// strings.
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+// yamlError is an error at a line of the input, numbered from first.
+type yamlError struct {
+	line int
+	msg  string
+}
+
+func (e *yamlError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.line, e.msg)
+}
+
+// parseYAML parses s, whose first line is line first of its document.
+func parseYAML(s string, first int) (interface{}, error) {
+	p := &yamlParser{}
+	for i, text := range strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimLeft(text, " ")
+		p.lines = append(p.lines, yamlLine{num: first + i, indent: len(text) - len(trimmed), text: trimmed})
+	}
+	value, err := p.node(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.skip() {
+		return nil, p.errorf("unexpected indentation")
+	}
+	return value, nil
+}
+
+func (p *yamlParser) errorf(format string, args ...interface{}) error {
+	line := p.lines[len(p.lines)-1].num
+	if p.pos < len(p.lines) {
+		line = p.lines[p.pos].num
+	}
+	return &yamlError{line: line, msg: fmt.Sprintf(format, args...)}
+}
+
+// skip moves past blank and comment lines, reporting whether a line is left.
+func (p *yamlParser) skip() bool {
+	for ; p.pos < len(p.lines); p.pos++ {
+		if text := strings.TrimSpace(p.lines[p.pos].text); text != "" && text[0] != '#' {
+			return true
+		}
+	}
+	return false
+}
+
+// node parses the node starting at the next line, which must be indented by
+// at least min spaces. A missing node is null.
+func (p *yamlParser) node(min int) (interface{}, error) {
+	if !p.skip() {
+		return nil, nil
+	}
+	line := p.lines[p.pos]
+	if line.indent < min {
+		return nil, nil
+	}
+	if strings.HasPrefix(line.text, "\t") {
+		return nil, p.errorf("tabs cannot be used for indentation")
+	}
+	if isSequenceItem(line.text) {
+		return p.sequence(line.indent)
+	}
+	if _, _, ok := splitMappingKey(line.text); ok {
+		return p.mapping(line.indent)
+	}
+	if line.text == "---" || line.text == "..." {
+		return nil, p.errorf("multiple documents are not supported")
+	}
+	p.pos++
+	return p.scalar(line.text)
+}
+
+func isSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func (p *yamlParser) sequence(indent int) (interface{}, error) {
+	seq := []interface{}{}
+	for p.skip() {
+		line := p.lines[p.pos]
+		if line.indent != indent || !isSequenceItem(line.text) {
+			break
+		}
+		var item interface{}
+		var err error
+		if rest := strings.TrimLeft(line.text[1:], " "); rest == "" || rest[0] == '#' {
+			p.pos++
+			item, err = p.node(indent + 1)
+		} else {
+			// The rest of the line is parsed as a node indented by its
+			// column, so that the lines of a mapping can follow it.
+			p.lines[p.pos] = yamlLine{num: line.num, indent: indent + len(line.text) - len(rest), text: rest}
+			item, err = p.node(indent + 1)
+		}
+		if err != nil {
+			return nil, err
+		}
+		seq = append(seq, item)
+	}
+	return seq, nil
+}
+
+func (p *yamlParser) mapping(indent int) (interface{}, error) {
+	m := map[string]interface{}{}
+	for p.skip() {
+		line := p.lines[p.pos]
+		if line.indent != indent {
+			break
+		}
+		key, rest, ok := splitMappingKey(line.text)
+		if !ok {
+			return nil, p.errorf("mapping key expected")
+		}
+		if _, dup := m[key]; dup {
+			return nil, p.errorf("duplicate key %q", key)
+		}
+		var value interface{}
+		var err error
+		switch {
+		case rest == "" || rest[0] == '#':
+			p.pos++
+			// Sequences may be indented like the key they belong to.
+			if p.skip() && p.lines[p.pos].indent == indent && isSequenceItem(p.lines[p.pos].text) {
+				value, err = p.sequence(indent)
+			} else {
+				value, err = p.node(indent + 1)
+			}
+		case rest[0] == '|' || rest[0] == '>':
+			value, err = p.blockScalar(rest, indent)
+		default:
+			value, err = p.scalar(rest)
+			p.pos++
+		}
+		if err != nil {
+			return nil, err
+		}
+		m[key] = value
+	}
+	return m, nil
+}
+
+// splitMappingKey splits a "key: value" line, returning the unquoted key and
+// the value with its surrounding spaces removed.
+func splitMappingKey(text string) (key, rest string, ok bool) {
+	if text == "" || isSequenceItem(text) {
+		return "", "", false
+	}
+	// end is the length of a quoted key.
+	end := 0
+	if c := text[0]; c == '"' || c == '\'' {
+		if end, ok = quotedEnd(text); !ok {
+			return "", "", false
+		}
+	} else if strings.IndexByte("[{#|>&*!%@`", c) >= 0 {
+		return "", "", false
+	}
+	// The key ends at the first colon followed by a space or the end of
+	// the line.
+	for i := end; i < len(text); i++ {
+		if text[i] != ':' || (i+1 < len(text) && text[i+1] != ' ') {
+			continue
+		}
+		rest = strings.TrimSpace(text[i+1:])
+		if end == 0 {
+			return strings.TrimSpace(text[:i]), rest, true
+		}
+		if strings.TrimSpace(text[end:i]) != "" {
+			return "", "", false
+		}
+		key, err := unquoteYAML(text[:end])
+		return key, rest, err == nil
+	}
+	return "", "", false
+}
+
+// quotedEnd returns the length of the quoted scalar at the start of s, and
+// false when it is not terminated.
+func quotedEnd(s string) (int, bool) {
+	q := s[0]
+	for i := 1; i < len(s); i++ {
+		switch {
+		case q == '"' && s[i] == '\\':
+			i++
+		case s[i] == q && q == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			i++
+		case s[i] == q:
+			return i + 1, true
+		}
+	}
+	return 0, false
+}
+
+func unquoteYAML(s string) (string, error) {
+	if s[0] == '\'' {
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	}
+	var out string
+	if err := json.Unmarshal([]byte(s), &out); err != nil {
+		return "", fmt.Errorf("invalid double-quoted scalar %s", s)
+	}
+	return out, nil
+}
+
+// scalar parses a value on a single line: a quoted or plain scalar, or a
+// flow collection, optionally followed by a comment.
+func (p *yamlParser) scalar(text string) (interface{}, error) {
+	f := &yamlFlow{s: text}
+	value, err := f.value(false)
+	if err == nil {
+		f.space()
+		if f.pos < len(f.s) && f.s[f.pos] != '#' {
+			err = fmt.Errorf("unexpected %q", f.s[f.pos:])
+		}
+	}
+	if err != nil {
+		return nil, p.errorf("%s", err.Error())
+	}
+	return value, nil
+}
+
+// blockScalar parses a literal (|) or folded (>) scalar whose header is on
+// the current line, and whose content is indented more than indent.
+func (p *yamlParser) blockScalar(header string, indent int) (interface{}, error) {
+	if i := strings.Index(header, " #"); i >= 0 {
+		header = strings.TrimSpace(header[:i])
+	}
+	style, chomp := header[0], header[1:]
+	if chomp != "" && chomp != "-" && chomp != "+" {
+		return nil, p.errorf("unsupported block scalar header %q", header)
+	}
+	p.pos++
+	var lines []string
+	content := -1
+	for ; p.pos < len(p.lines); p.pos++ {
+		line := p.lines[p.pos]
+		if strings.TrimSpace(line.text) == "" {
+			lines = append(lines, "")
+			continue
+		}
+		if line.indent <= indent || (content >= 0 && line.indent < content) {
+			break
+		}
+		if content < 0 {
+			content = line.indent
+		}
+		lines = append(lines, strings.Repeat(" ", line.indent-content)+line.text)
+	}
+	trailing := 0
+	for trailing < len(lines) && lines[len(lines)-1-trailing] == "" {
+		trailing++
+	}
+	lines = lines[:len(lines)-trailing]
+	if content < 0 {
+		return "", nil
+	}
+	var b strings.Builder
+	for i, line := range lines {
+		switch {
+		case i == 0:
+		case style == '|' || line == "" || lines[i-1] == "" || line[0] == ' ':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(' ')
+		}
+		b.WriteString(line)
+	}
+	switch chomp {
+	case "":
+		b.WriteByte('\n')
+	case "+":
+		b.WriteString(strings.Repeat("\n", trailing+1))
+	}
+	return b.String(), nil
+}
+
+// yamlFlow parses scalars and flow collections within a line.
+type yamlFlow struct {
+	s   string
+	pos int
+}
+
+func (f *yamlFlow) space() {
+	for f.pos < len(f.s) && f.s[f.pos] == ' ' {
+		f.pos++
+	}
+}
+
+// value parses a node; inFlow is set within a flow collection, where plain
+// scalars end at the indicators of the collection.
+func (f *yamlFlow) value(inFlow bool) (interface{}, error) {
+	f.space()
+	if f.pos == len(f.s) {
+		return nil, nil
+	}
+	switch c := f.s[f.pos]; c {
+	case '[':
+		return f.sequence()
+	case '{':
+		return f.mapping()
+	case '"', '\'':
+		n, ok := quotedEnd(f.s[f.pos:])
+		if !ok {
+			return nil, fmt.Errorf("unterminated quoted scalar")
+		}
+		s, err := unquoteYAML(f.s[f.pos : f.pos+n])
+		f.pos += n
+		return s, err
+	case '&', '*', '!':
+		return nil, fmt.Errorf("anchors, aliases and tags are not supported")
+	case '|', '>':
+		if !inFlow {
+			return nil, fmt.Errorf("block scalars are only supported as mapping values")
+		}
+	}
+	return plainScalar(f.plain(inFlow)), nil
+}
+
+// plain returns the plain scalar at the current position, which ends before
+// a comment or, in a flow collection, an indicator.
+func (f *yamlFlow) plain(inFlow bool) string {
+	start := f.pos
+	for ; f.pos < len(f.s); f.pos++ {
+		c := f.s[f.pos]
+		if c == '#' && f.pos > start && f.s[f.pos-1] == ' ' {
+			break
+		}
+		if inFlow && (c == ',' || c == ']' || c == '}' ||
+			(c == ':' && (f.pos+1 == len(f.s) || strings.IndexByte(" ,]}", f.s[f.pos+1]) >= 0))) {
+			break
+		}
+	}
+	return strings.TrimRight(f.s[start:f.pos], " ")
+}
+
+func (f *yamlFlow) sequence() (interface{}, error) {
+	f.pos++
+	seq := []interface{}{}
+	for {
+		f.space()
+		if f.pos == len(f.s) {
+			return nil, fmt.Errorf("unterminated flow sequence")
+		}
+		if f.s[f.pos] == ']' {
+			f.pos++
+			return seq, nil
+		}
+		item, err := f.value(true)
+		if err != nil {
+			return nil, err
+		}
+		seq = append(seq, item)
+		if err := f.separator(']'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (f *yamlFlow) mapping() (interface{}, error) {
+	f.pos++
+	m := map[string]interface{}{}
+	for {
+		f.space()
+		if f.pos == len(f.s) {
+			return nil, fmt.Errorf("unterminated flow mapping")
+		}
+		if f.s[f.pos] == '}' {
+			f.pos++
+			return m, nil
+		}
+		key, err := f.value(true)
+		if err != nil {
+			return nil, err
+		}
+		f.space()
+		var value interface{}
+		if f.pos < len(f.s) && f.s[f.pos] == ':' {
+			f.pos++
+			if value, err = f.value(true); err != nil {
+				return nil, err
+			}
+		}
+		m[scalarKey(key)] = value
+		if err := f.separator('}'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// separator moves past the comma after an item of a flow collection, or
+// stops before its closing indicator.
+func (f *yamlFlow) separator(end byte) error {
+	f.space()
+	if f.pos < len(f.s) && f.s[f.pos] == ',' {
+		f.pos++
+		return nil
+	}
+	if f.pos < len(f.s) && f.s[f.pos] == end {
+		return nil
+	}
+	if f.pos == len(f.s) {
+		return fmt.Errorf("flow collections must be on a single line")
+	}
+	return fmt.Errorf("unexpected %q in flow collection", f.s[f.pos])
+}
+
+// scalarKey formats a scalar used as a mapping key.
+func scalarKey(key interface{}) string {
+	switch key := key.(type) {
+	case string:
+		return key
+	case nil:
+		return "null"
+	}
+	data, _ := json.Marshal(key)
+	return string(data)
+}
+
+var yamlNumber = regexp.MustCompile(`^[-+]?(\d+\.?\d*|\.\d+)([eE][-+]?\d+)?$`)
+
+// plainScalar resolves a plain scalar with the YAML 1.2 core schema.
+func plainScalar(s string) interface{} {
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	}
+	if yamlNumber.MatchString(s) {
+		if n, err := strconv.ParseFloat(s, 64); err == nil {
+			return n
+		}
+	}
+	return s
+}